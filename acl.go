@@ -0,0 +1,326 @@
+package blugo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 5.4.2
+// Packet_Boundary_Flag
+
+const (
+	ACL_PB_FIRST_NON_FLUSHABLE = 0x00
+	ACL_PB_CONTINUING          = 0x01
+	ACL_PB_FIRST_FLUSHABLE     = 0x02
+	ACL_PB_COMPLETE            = 0x03
+)
+
+// AclBufferSize is the controller data buffer information, reported by
+// Read_Buffer_Size and LE_Read_Buffer_Size. LE links share the BR/EDR
+// buffers when LeMtu is zero.
+type AclBufferSize struct {
+	AclMtu  uint16
+	AclPkts uint16
+	LeMtu   uint16
+	LePkts  uint16
+}
+
+type aclBuffer struct {
+	mtu     int
+	credits int
+}
+
+// AclMux writes L2CAP frames to the controller honoring the controller
+// buffer credits, and reassembles received ACL fragments into L2CAP frames
+// per connection handle.
+//
+// Received packets are fed through Handle, or by Serve reading the
+// transport.
+type AclMux struct {
+	w     io.Writer
+	lock  sync.Mutex
+	cond  *sync.Cond
+	bredr *aclBuffer
+	le    *aclBuffer
+	links map[uint16]*AclLink
+}
+
+func NewAclMux(w io.Writer, size AclBufferSize) *AclMux {
+	self := &AclMux{
+		w: w,
+		bredr: &aclBuffer{
+			mtu:     int(size.AclMtu),
+			credits: int(size.AclPkts),
+		},
+		links: make(map[uint16]*AclLink),
+	}
+	if size.LeMtu == 0 {
+		self.le = self.bredr
+	} else {
+		self.le = &aclBuffer{
+			mtu:     int(size.LeMtu),
+			credits: int(size.LePkts),
+		}
+	}
+	self.cond = sync.NewCond(&self.lock)
+	return self
+}
+
+// AclLink is a logical link of a connection handle.
+type AclLink struct {
+	Handle uint16
+	LE     bool
+
+	// NonFlushable marks BR/EDR frames as non-automatically-flushable.
+	// LE frames are always non-flushable.
+	NonFlushable bool
+
+	mux     *AclMux
+	wlock   sync.Mutex // serializes fragments of a frame
+	pending int        // packets not yet reported by Number Of Completed Packets
+	rx      []byte
+	frames  [][]byte
+	closed  bool
+}
+
+// Open registers the connection handle, or returns the link already
+// registered. Links are opened automatically on successful Connection
+// Complete and LE Connection Complete events passed to Handle.
+func (self *AclMux) Open(handle uint16, le bool) *AclLink {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	link, ok := self.links[handle]
+	if ok && !link.closed {
+		return link
+	}
+	ret := &AclLink{
+		Handle: handle,
+		LE:     le,
+		mux:    self,
+	}
+	if ok {
+		ret.pending = link.pending // still in the controller
+	}
+	self.links[handle] = ret
+	return ret
+}
+
+// Link returns the link of the handle, or nil.
+func (self *AclMux) Link(handle uint16) *AclLink {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.links[handle]
+}
+
+func (self *AclMux) buffer(link *AclLink) *aclBuffer {
+	if link.LE {
+		return self.le
+	}
+	return self.bredr
+}
+
+// disconnected must be called with lock held.
+func (self *AclMux) disconnected(link *AclLink) {
+	link.closed = true
+	// controller flushes the packets of the disconnected handle
+	self.buffer(link).credits += link.pending
+	link.pending = 0
+	delete(self.links, link.Handle)
+	self.cond.Broadcast()
+}
+
+// Handle consumes ACL data packets and the events that the flow control
+// depends on. It returns false for packets that the mux does not consume.
+// Events are observed and also reported as not consumed so that other
+// layers can see them.
+func (self *AclMux) Handle(pkt Pkt) bool {
+	switch p := pkt.(type) {
+	case AcldataPkt:
+		self.receive(p)
+		return true
+	case EventPkt:
+		if ev, err := p.Parse(); err == nil {
+			switch e := ev.(type) {
+			case EvtNumCompPkts:
+				self.lock.Lock()
+				for i, handle := range e.Handles {
+					if link, ok := self.links[handle]; ok {
+						n := int(e.Counts[i])
+						if n > link.pending {
+							n = link.pending
+						}
+						link.pending -= n
+						self.buffer(link).credits += n
+					}
+				}
+				self.cond.Broadcast()
+				self.lock.Unlock()
+			case EvtDisconnComplete:
+				if e.Status == 0 {
+					self.lock.Lock()
+					if link, ok := self.links[e.Handle]; ok {
+						self.disconnected(link)
+					}
+					self.lock.Unlock()
+				}
+			case EvtConnComplete:
+				if e.Status == 0 && e.LinkType == ACL_LINK {
+					self.Open(e.Handle, false)
+				}
+			case EvtLeMetaEvent:
+				if sub, err := e.Parse(); err == nil {
+					if c, ok := sub.(EvtLeConnComplete); ok && c.Status == 0 {
+						self.Open(c.Handle, true)
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (self *AclMux) receive(pkt AcldataPkt) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	link, ok := self.links[pkt.Handle]
+	if !ok || link.closed {
+		return
+	}
+	switch pkt.PB {
+	case ACL_PB_FIRST_NON_FLUSHABLE, ACL_PB_FIRST_FLUSHABLE, ACL_PB_COMPLETE:
+		// a start fragment discards an incomplete frame
+		link.rx = append([]byte(nil), pkt.Data...)
+	case ACL_PB_CONTINUING:
+		if link.rx == nil {
+			return
+		}
+		link.rx = append(link.rx, pkt.Data...)
+	}
+	if len(link.rx) < 4 {
+		return
+	}
+	length := 4 + int(binary.LittleEndian.Uint16(link.rx))
+	if len(link.rx) < length {
+		return
+	}
+	link.frames = append(link.frames, link.rx[:length])
+	link.rx = nil
+	self.cond.Broadcast()
+}
+
+// Serve reads HCI packets from r and passes them to Handle. Packets that
+// were not consumed are passed to other, if not nil. Serve returns on read
+// error, closing all the links.
+func (self *AclMux) Serve(r io.Reader, other func(Pkt)) error {
+	var capture []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			self.lock.Lock()
+			for _, link := range self.links {
+				self.disconnected(link)
+			}
+			self.lock.Unlock()
+			return err
+		}
+		capture = append(capture, buf[:n]...)
+		for {
+			pkt, step := Parse(capture)
+			if step == 0 {
+				break
+			}
+			if !self.Handle(pkt) && other != nil {
+				other(pkt)
+			}
+			capture = capture[step:]
+		}
+		if len(capture) == 0 {
+			capture = nil // Parse results alias capture; start afresh
+		} else {
+			capture = append([]byte(nil), capture...)
+		}
+	}
+}
+
+// WriteFrame sends an L2CAP frame, fragmented to the controller buffer size.
+// It blocks while the controller has no free buffer.
+func (self *AclLink) WriteFrame(frame []byte) error {
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+
+	mux := self.mux
+	buffer := mux.buffer(self)
+	if buffer.mtu == 0 {
+		return fmt.Errorf("no controller buffer")
+	}
+
+	pb := uint8(ACL_PB_FIRST_FLUSHABLE)
+	if self.LE || self.NonFlushable {
+		pb = ACL_PB_FIRST_NON_FLUSHABLE
+	}
+	for off := 0; off == 0 || off < len(frame); {
+		end := off + buffer.mtu
+		if end > len(frame) {
+			end = len(frame)
+		}
+
+		mux.lock.Lock()
+		for buffer.credits == 0 && !self.closed {
+			mux.cond.Wait()
+		}
+		if self.closed {
+			mux.lock.Unlock()
+			return io.ErrClosedPipe
+		}
+		buffer.credits--
+		self.pending++
+		mux.lock.Unlock()
+
+		data, err := AcldataPkt{
+			Handle: self.Handle,
+			PB:     pb,
+			Data:   frame[off:end],
+		}.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := mux.w.Write(data); err != nil {
+			return err
+		}
+		pb = ACL_PB_CONTINUING
+		off = end
+	}
+	return nil
+}
+
+// ReadFrame returns a reassembled L2CAP frame, including the basic L2CAP
+// header. It returns io.EOF after the link was disconnected.
+func (self *AclLink) ReadFrame() ([]byte, error) {
+	mux := self.mux
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+	for len(self.frames) == 0 && !self.closed {
+		mux.cond.Wait()
+	}
+	if len(self.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := self.frames[0]
+	self.frames = self.frames[1:]
+	return frame, nil
+}
+
+// Close releases the link locally, waking up blocked readers and writers.
+// It does not disconnect the connection, and the packets in flight are
+// accounted until the disconnection.
+func (self *AclLink) Close() error {
+	self.mux.lock.Lock()
+	defer self.mux.lock.Unlock()
+	self.closed = true
+	self.mux.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+package blugo
+
+// ReadBufferSize reads the controller buffer information for AclMux.
+func (self HciDev) ReadBufferSize() (AclBufferSize, error) {
+	var size AclBufferSize
+	if ret, err := self.Request(HCI_Read_Buffer_Size); err != nil {
+		return size, err
+	} else if err := statusError(ret); err != nil {
+		return size, err
+	} else {
+		size.AclMtu = ret[1].(uint16)
+		size.AclPkts = ret[3].(uint16)
+	}
+	if ret, err := self.Request(HCI_LE_Read_Buffer_Size); err != nil {
+		return size, err
+	} else if err := statusError(ret); err != nil {
+		if err != HCI_UNKNOWN_COMMAND {
+			return size, err
+		} // BR/EDR only controller
+	} else {
+		size.LeMtu = ret[1].(uint16)
+		size.LePkts = uint16(ret[2].(uint8))
+	}
+	return size, nil
+}
+
+// SetAclFilter configures the socket to receive ACL data and the events
+// that AclMux depends on, in addition to the events given. The socket may be
+// then passed to AclMux.Serve. Request should be issued on another socket
+// because it takes the events away from the reader.
+func (self HciDev) SetAclFilter(events ...int) error {
+	return SetsockoptHciFilter(int(self), SOL_HCI, HCI_FILTER, &HciFilter{
+		Type_mask: 1<<HCI_ACLDATA_PKT | 1<<HCI_EVENT_PKT,
+		Event_mask: FilterEventMask(append(events,
+			EVT_CONN_COMPLETE,
+			EVT_DISCONN_COMPLETE,
+			EVT_NUM_COMP_PKTS,
+			EVT_LE_META_EVENT)...),
+	})
+}
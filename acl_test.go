@@ -0,0 +1,110 @@
+package blugo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+type aclCapture struct {
+	lock sync.Mutex
+	pkts []AcldataPkt
+}
+
+func (self *aclCapture) count() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.pkts)
+}
+
+func (self *aclCapture) Write(data []byte) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if pkt, step := Parse(append([]byte(nil), data...)); step != len(data) {
+		panic("partial packet")
+	} else {
+		self.pkts = append(self.pkts, pkt.(AcldataPkt))
+	}
+	return len(data), nil
+}
+
+func l2capFrame(cid uint16, payload []byte) []byte {
+	frame := make([]byte, 4, 4+len(payload))
+	binary.LittleEndian.PutUint16(frame, uint16(len(payload)))
+	binary.LittleEndian.PutUint16(frame[2:], cid)
+	return append(frame, payload...)
+}
+
+func TestAclFragment(t *testing.T) {
+	w := &aclCapture{}
+	mux := NewAclMux(w, AclBufferSize{
+		AclMtu:  10,
+		AclPkts: 8,
+		LeMtu:   27,
+		LePkts:  2,
+	})
+	mux.Handle(EventPkt{
+		Code:   EVT_LE_META_EVENT,
+		Params: []byte{EVT_LE_CONN_COMPLETE, 0, 0x40, 0, 0, 0, 1, 2, 3, 4, 5, 6, 0x18, 0, 0, 0, 0x48, 0, 0},
+	})
+	link := mux.Link(0x40)
+	if link == nil || !link.LE {
+		t.Fatal("link not opened")
+	}
+
+	frame := l2capFrame(0x0004, bytes.Repeat([]byte{0xAA}, 60))
+	done := make(chan error)
+	go func() {
+		done <- link.WriteFrame(frame)
+	}()
+	// only two credits; the third fragment waits for completion
+	for w.count() != 2 {
+		runtime.Gosched()
+	}
+	mux.Handle(EventPkt{
+		Code:   EVT_NUM_COMP_PKTS,
+		Params: []byte{1, 0x40, 0, 2, 0},
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(w.pkts) != 2+1 {
+		t.Fatalf("fragments=%d", len(w.pkts))
+	}
+	var joined []byte
+	for i, pkt := range w.pkts {
+		if i == 0 && pkt.PB != ACL_PB_FIRST_NON_FLUSHABLE {
+			t.Errorf("first PB=%d", pkt.PB)
+		} else if i > 0 && pkt.PB != ACL_PB_CONTINUING {
+			t.Errorf("continuing PB=%d", pkt.PB)
+		}
+		joined = append(joined, pkt.Data...)
+	}
+	if !bytes.Equal(joined, frame) {
+		t.Error("fragments do not compose the frame")
+	}
+}
+
+func TestAclReassemble(t *testing.T) {
+	mux := NewAclMux(&aclCapture{}, AclBufferSize{AclMtu: 10, AclPkts: 8})
+	link := mux.Open(0x01, false)
+
+	frame := l2capFrame(0x0040, []byte("hello, world"))
+	mux.Handle(AcldataPkt{Handle: 0x01, PB: ACL_PB_FIRST_FLUSHABLE, Data: frame[:5]})
+	mux.Handle(AcldataPkt{Handle: 0x01, PB: ACL_PB_CONTINUING, Data: frame[5:]})
+	if got, err := link.ReadFrame(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, frame) {
+		t.Errorf("reassembled %x", got)
+	}
+
+	mux.Handle(EventPkt{
+		Code:   EVT_DISCONN_COMPLETE,
+		Params: []byte{0, 0x01, 0, uint8(HCI_OE_USER_ENDED_CONNECTION)},
+	})
+	if _, err := link.ReadFrame(); err == nil {
+		t.Error("expected EOF after disconnection")
+	}
+}
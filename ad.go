@@ -0,0 +1,330 @@
+package blugo
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hkwi/blugo/assigned"
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Advertising and Scan Response data format,
+// Bluetooth Core specification, Vol 3, Part C, Section 11 and
+// Core Specification Supplement, Part A
+
+const (
+	AD_FLAGS                 = 0x01
+	AD_UUID16_INCOMPLETE     = 0x02
+	AD_UUID16_COMPLETE       = 0x03
+	AD_UUID32_INCOMPLETE     = 0x04
+	AD_UUID32_COMPLETE       = 0x05
+	AD_UUID128_INCOMPLETE    = 0x06
+	AD_UUID128_COMPLETE      = 0x07
+	AD_SHORT_NAME            = 0x08
+	AD_COMPLETE_NAME         = 0x09
+	AD_TX_POWER              = 0x0A
+	AD_CLASS_OF_DEVICE       = 0x0D
+	AD_CONN_INTERVAL_RANGE   = 0x12
+	AD_SOLICIT_UUID16        = 0x14
+	AD_SOLICIT_UUID128       = 0x15
+	AD_SERVICE_DATA16        = 0x16
+	AD_PUBLIC_TARGET_ADDRESS = 0x17
+	AD_RANDOM_TARGET_ADDRESS = 0x18
+	AD_APPEARANCE            = 0x19
+	AD_ADVERTISING_INTERVAL  = 0x1A
+	AD_LE_DEVICE_ADDRESS     = 0x1B
+	AD_LE_ROLE               = 0x1C
+	AD_SOLICIT_UUID32        = 0x1F
+	AD_SERVICE_DATA32        = 0x20
+	AD_SERVICE_DATA128       = 0x21
+	AD_URI                   = 0x24
+	AD_MANUFACTURER_SPECIFIC = 0xFF
+)
+
+// AD_FLAGS bits
+const (
+	AD_FLAG_LE_LIMITED          = 0x01
+	AD_FLAG_LE_GENERAL          = 0x02
+	AD_FLAG_BREDR_NOT_SUPPORTED = 0x04
+	AD_FLAG_LE_BREDR_CONTROLLER = 0x08
+	AD_FLAG_LE_BREDR_HOST       = 0x10
+)
+
+// MAX_AD_LEN is the size of legacy advertising and scan response data.
+const MAX_AD_LEN = 31
+
+// AdStructure is a single AD structure.
+type AdStructure struct {
+	Type uint8
+	Data []byte
+}
+
+// String shows the AD type name and the data, with the company and the
+// appearance names from the assigned numbers.
+func (self AdStructure) String() string {
+	name := assigned.ADType(self.Type).String()
+	switch self.Type {
+	case AD_SHORT_NAME, AD_COMPLETE_NAME:
+		return fmt.Sprintf("%s: %q", name, self.Data)
+	case AD_APPEARANCE:
+		if len(self.Data) == 2 {
+			return fmt.Sprintf("%s: %v", name, assigned.Appearance(binary.LittleEndian.Uint16(self.Data)))
+		}
+	case AD_MANUFACTURER_SPECIFIC:
+		if len(self.Data) >= 2 {
+			return fmt.Sprintf("%s: %v %x", name, assigned.CompanyID(binary.LittleEndian.Uint16(self.Data)), self.Data[2:])
+		}
+	}
+	return fmt.Sprintf("%s: %x", name, self.Data)
+}
+
+// AdData is the sequence of AD structures.
+type AdData []AdStructure
+
+func (self AdData) MarshalBinary() ([]byte, error) {
+	var ret []byte
+	for _, ad := range self {
+		if len(ad.Data) > 254 {
+			return nil, fmt.Errorf("AD too long")
+		}
+		ret = append(ret, uint8(len(ad.Data)+1), ad.Type)
+		ret = append(ret, ad.Data...)
+	}
+	return ret, nil
+}
+
+// UnmarshalBinary parses the AD structures. The zero length structure
+// terminates the data, as the remaining octets are padding.
+func (self *AdData) UnmarshalBinary(data []byte) error {
+	var ret AdData
+	for len(data) > 0 {
+		n := int(data[0])
+		if n == 0 {
+			break
+		} else if len(data) < 1+n {
+			return fmt.Errorf("too short")
+		}
+		ret = append(ret, AdStructure{
+			Type: data[1],
+			Data: data[2 : 1+n],
+		})
+		data = data[1+n:]
+	}
+	*self = ret
+	return nil
+}
+
+// Get returns the data of the first structure of the type.
+func (self AdData) Get(typ uint8) ([]byte, bool) {
+	for _, ad := range self {
+		if ad.Type == typ {
+			return ad.Data, true
+		}
+	}
+	return nil, false
+}
+
+// Flags returns the value of AD_FLAGS.
+func (self AdData) Flags() uint8 {
+	if data, ok := self.Get(AD_FLAGS); ok && len(data) > 0 {
+		return data[0]
+	}
+	return 0
+}
+
+// LocalName returns the complete or shortened local name.
+func (self AdData) LocalName() string {
+	if data, ok := self.Get(AD_COMPLETE_NAME); ok {
+		return string(data)
+	} else if data, ok := self.Get(AD_SHORT_NAME); ok {
+		return string(data)
+	}
+	return ""
+}
+
+// TxPower returns the value of AD_TX_POWER in dBm.
+func (self AdData) TxPower() (int8, bool) {
+	if data, ok := self.Get(AD_TX_POWER); ok && len(data) > 0 {
+		return int8(data[0]), true
+	}
+	return 0, false
+}
+
+// UUID16s returns the 16-bit service UUIDs of both complete and incomplete
+// lists.
+func (self AdData) UUID16s() []uint16 {
+	var ret []uint16
+	for _, ad := range self {
+		if ad.Type == AD_UUID16_INCOMPLETE || ad.Type == AD_UUID16_COMPLETE {
+			for i := 0; i+2 <= len(ad.Data); i += 2 {
+				ret = append(ret, binary.LittleEndian.Uint16(ad.Data[i:]))
+			}
+		}
+	}
+	return ret
+}
+
+// uuidSize returns the size of the UUIDs in the list of the AD type.
+func uuidSize(typ uint8) int {
+	switch typ {
+	case AD_UUID16_INCOMPLETE, AD_UUID16_COMPLETE, AD_SOLICIT_UUID16:
+		return 2
+	case AD_UUID32_INCOMPLETE, AD_UUID32_COMPLETE, AD_SOLICIT_UUID32:
+		return 4
+	case AD_UUID128_INCOMPLETE, AD_UUID128_COMPLETE, AD_SOLICIT_UUID128:
+		return 16
+	}
+	return 0
+}
+
+func (self AdData) uuidLists(solicit bool) []uuid.UUID {
+	var ret []uuid.UUID
+	for _, ad := range self {
+		size := uuidSize(ad.Type)
+		if size == 0 || solicit != (ad.Type == AD_SOLICIT_UUID16 || ad.Type == AD_SOLICIT_UUID32 || ad.Type == AD_SOLICIT_UUID128) {
+			continue
+		}
+		for i := 0; i+size <= len(ad.Data); i += size {
+			u, _ := uuid.FromBytes(ad.Data[i : i+size])
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+// UUIDs returns the service UUIDs of all the complete and incomplete lists.
+func (self AdData) UUIDs() []uuid.UUID {
+	return self.uuidLists(false)
+}
+
+// SolicitUUIDs returns the service solicitation UUIDs.
+func (self AdData) SolicitUUIDs() []uuid.UUID {
+	return self.uuidLists(true)
+}
+
+// HasUUID tells whether the service UUID is listed.
+func (self AdData) HasUUID(u uuid.UUID) bool {
+	for _, v := range self.UUIDs() {
+		if v.Equal(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceData returns the service data of the uuid in any of the 16, 32
+// and 128-bit forms.
+func (self AdData) ServiceData(u uuid.UUID) ([]byte, bool) {
+	for _, ad := range self {
+		size := 0
+		switch ad.Type {
+		case AD_SERVICE_DATA16:
+			size = 2
+		case AD_SERVICE_DATA32:
+			size = 4
+		case AD_SERVICE_DATA128:
+			size = 16
+		}
+		if size > 0 && len(ad.Data) >= size && uuid.UUID(ad.Data[:size]).Equal(u) {
+			return ad.Data[size:], true
+		}
+	}
+	return nil, false
+}
+
+// ManufacturerData returns the company identifier and the data of
+// AD_MANUFACTURER_SPECIFIC.
+func (self AdData) ManufacturerData() (uint16, []byte, bool) {
+	if data, ok := self.Get(AD_MANUFACTURER_SPECIFIC); ok && len(data) >= 2 {
+		return binary.LittleEndian.Uint16(data), data[2:], true
+	}
+	return 0, nil, false
+}
+
+// ServiceData16 returns the data of AD_SERVICE_DATA16 for the uuid.
+func (self AdData) ServiceData16(uuid uint16) ([]byte, bool) {
+	for _, ad := range self {
+		if ad.Type == AD_SERVICE_DATA16 && len(ad.Data) >= 2 && binary.LittleEndian.Uint16(ad.Data) == uuid {
+			return ad.Data[2:], true
+		}
+	}
+	return nil, false
+}
+
+func AdFlags(flags uint8) AdStructure {
+	return AdStructure{Type: AD_FLAGS, Data: []byte{flags}}
+}
+
+func AdCompleteName(name string) AdStructure {
+	return AdStructure{Type: AD_COMPLETE_NAME, Data: []byte(name)}
+}
+
+func AdUUID16(complete bool, uuids ...uint16) AdStructure {
+	typ := uint8(AD_UUID16_INCOMPLETE)
+	if complete {
+		typ = AD_UUID16_COMPLETE
+	}
+	data := make([]byte, 2*len(uuids))
+	for i, uuid := range uuids {
+		binary.LittleEndian.PutUint16(data[2*i:], uuid)
+	}
+	return AdStructure{Type: typ, Data: data}
+}
+
+func AdAppearance(appearance uint16) AdStructure {
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, appearance)
+	return AdStructure{Type: AD_APPEARANCE, Data: data}
+}
+
+func AdManufacturerData(company uint16, data []byte) AdStructure {
+	buf := make([]byte, 2, 2+len(data))
+	binary.LittleEndian.PutUint16(buf, company)
+	return AdStructure{Type: AD_MANUFACTURER_SPECIFIC, Data: append(buf, data...)}
+}
+
+func AdServiceData16(uuid uint16, data []byte) AdStructure {
+	buf := make([]byte, 2, 2+len(data))
+	binary.LittleEndian.PutUint16(buf, uuid)
+	return AdStructure{Type: AD_SERVICE_DATA16, Data: append(buf, data...)}
+}
+
+// AdUUIDs makes the service UUID lists, one for each of the forms in use.
+// The UUIDs are put in the shortest forms.
+func AdUUIDs(complete bool, uuids ...uuid.UUID) []AdStructure {
+	var ret []AdStructure
+	for _, typ := range [][3]uint8{
+		{2, AD_UUID16_INCOMPLETE, AD_UUID16_COMPLETE},
+		{4, AD_UUID32_INCOMPLETE, AD_UUID32_COMPLETE},
+		{16, AD_UUID128_INCOMPLETE, AD_UUID128_COMPLETE},
+	} {
+		var data []byte
+		for _, u := range uuids {
+			if s := u.Shortest(); len(s) == int(typ[0]) {
+				data = append(data, s...)
+			}
+		}
+		if len(data) == 0 {
+			continue
+		}
+		ad := AdStructure{Type: typ[1], Data: data}
+		if complete {
+			ad.Type = typ[2]
+		}
+		ret = append(ret, ad)
+	}
+	return ret
+}
+
+// AdServiceData makes the service data in the shortest form of the uuid.
+func AdServiceData(u uuid.UUID, data []byte) AdStructure {
+	s := u.Shortest()
+	typ := uint8(AD_SERVICE_DATA128)
+	switch len(s) {
+	case 2:
+		typ = AD_SERVICE_DATA16
+	case 4:
+		typ = AD_SERVICE_DATA32
+	}
+	return AdStructure{Type: typ, Data: append(append([]byte(nil), s...), data...)}
+}
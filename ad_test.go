@@ -0,0 +1,84 @@
+package blugo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+func TestAdData(t *testing.T) {
+	data := AdData{
+		AdFlags(AD_FLAG_LE_GENERAL | AD_FLAG_BREDR_NOT_SUPPORTED),
+		AdUUID16(true, 0x180F, 0x180A),
+		AdCompleteName("blugo"),
+		AdManufacturerData(0x004C, []byte{0x02, 0x15}),
+	}
+	buf, err := data.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:7], []byte{0x02, 0x01, 0x06, 0x05, 0x03, 0x0F, 0x18}) {
+		t.Errorf("got %x", buf)
+	}
+	var parsed AdData
+	if err := parsed.UnmarshalBinary(append(buf, 0, 0, 0)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(parsed, data) {
+		t.Errorf("got %v", parsed)
+	}
+	if parsed.Flags() != 0x06 || parsed.LocalName() != "blugo" {
+		t.Errorf("flags %x name %q", parsed.Flags(), parsed.LocalName())
+	}
+	if uuids := parsed.UUID16s(); !reflect.DeepEqual(uuids, []uint16{0x180F, 0x180A}) {
+		t.Errorf("uuids %v", uuids)
+	}
+	if company, v, ok := parsed.ManufacturerData(); !ok || company != 0x004C || !bytes.Equal(v, []byte{0x02, 0x15}) {
+		t.Errorf("manufacturer %x %x", company, v)
+	}
+	if err := parsed.UnmarshalBinary([]byte{0x05, 0x09, 'a'}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestAdUUIDs(t *testing.T) {
+	custom := uuid.MustParse("6e400001-b5a3-f393-e0a9-e50e24dcca9e")
+	data := AdData(AdUUIDs(false, uuid.UUID16(0x180D).Full(), custom, uuid.UUID32(0x12345678), uuid.UUID16(0x180F)))
+	data = append(data, AdServiceData(uuid.UUID16(0xFEAA), []byte{0x10}), AdStructure{Type: AD_SOLICIT_UUID16, Data: []byte{0x12, 0x18}})
+	if len(data) != 5 || data[0].Type != AD_UUID16_INCOMPLETE || !bytes.Equal(data[0].Data, []byte{0x0D, 0x18, 0x0F, 0x18}) ||
+		data[1].Type != AD_UUID32_INCOMPLETE || data[2].Type != AD_UUID128_INCOMPLETE {
+		t.Errorf("got %v", data)
+	}
+	if uuids := data.UUIDs(); len(uuids) != 4 || !uuids[3].Equal(custom) {
+		t.Errorf("got %v", uuids)
+	}
+	if !data.HasUUID(custom) || data.HasUUID(uuid.UUID16(0x1812)) {
+		t.Error("HasUUID")
+	}
+	if uuids := data.SolicitUUIDs(); len(uuids) != 1 || !uuids[0].Equal(uuid.UUID16(0x1812)) {
+		t.Errorf("got %v", uuids)
+	}
+	if v, ok := data.ServiceData(uuid.UUID16(0xFEAA).Full()); !ok || !bytes.Equal(v, []byte{0x10}) {
+		t.Errorf("got %x", v)
+	}
+	if v, ok := data.ServiceData16(0xFEAA); !ok || !bytes.Equal(v, []byte{0x10}) {
+		t.Errorf("got %x", v)
+	}
+}
+
+func TestAdString(t *testing.T) {
+	for _, v := range []struct {
+		ad   AdStructure
+		text string
+	}{
+		{AdManufacturerData(0x004C, []byte{0x02, 0x15}), "Manufacturer Specific Data: Apple, Inc. 0215"},
+		{AdAppearance(0x00C1), "Appearance: Watch: Sports Watch"},
+		{AdCompleteName("blugo"), `Complete Local Name: "blugo"`},
+		{AdFlags(AD_FLAG_LE_GENERAL), "Flags: 02"},
+	} {
+		if s := v.ad.String(); s != v.text {
+			t.Errorf("expected %s got %s", v.text, s)
+		}
+	}
+}
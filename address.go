@@ -0,0 +1,248 @@
+package blugo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+
+	"github.com/hkwi/blugo/crypto"
+)
+
+// Bluetooth Core specification, Vol 6, Part B, Section 1.3
+// LE device addresses.
+
+// LE address types of HCI commands and events
+const (
+	LE_ADDR_PUBLIC          = 0x00
+	LE_ADDR_RANDOM          = 0x01
+	LE_ADDR_PUBLIC_IDENTITY = 0x02 // resolved by the controller
+	LE_ADDR_RANDOM_IDENTITY = 0x03 // resolved by the controller
+)
+
+// AddrKind classifies an LE device address.
+type AddrKind uint8
+
+const (
+	ADDR_PUBLIC AddrKind = iota
+	ADDR_RANDOM_STATIC
+	ADDR_RESOLVABLE_PRIVATE
+	ADDR_NON_RESOLVABLE_PRIVATE
+	ADDR_RESERVED // random address with the reserved sub type
+)
+
+func (self AddrKind) String() string {
+	switch self {
+	case ADDR_PUBLIC:
+		return "public"
+	case ADDR_RANDOM_STATIC:
+		return "random static"
+	case ADDR_RESOLVABLE_PRIVATE:
+		return "resolvable private"
+	case ADDR_NON_RESOLVABLE_PRIVATE:
+		return "non-resolvable private"
+	default:
+		return "reserved"
+	}
+}
+
+// LeAddr is an LE device address with its type.
+type LeAddr struct {
+	Type uint8 // LE_ADDR_PUBLIC or LE_ADDR_RANDOM
+	Addr Bdaddr
+}
+
+func (self LeAddr) String() string {
+	if self.Type == LE_ADDR_PUBLIC || self.Type == LE_ADDR_PUBLIC_IDENTITY {
+		return self.Addr.String() + " (public)"
+	}
+	return self.Addr.String() + " (random)"
+}
+
+// Kind classifies the address by the type and the two most significant bits
+// of random addresses.
+func (self LeAddr) Kind() AddrKind {
+	switch self.Type {
+	case LE_ADDR_PUBLIC, LE_ADDR_PUBLIC_IDENTITY:
+		return ADDR_PUBLIC
+	case LE_ADDR_RANDOM_IDENTITY:
+		return ADDR_RANDOM_STATIC
+	}
+	switch self.Addr[5] >> 6 {
+	case 0x03:
+		return ADDR_RANDOM_STATIC
+	case 0x01:
+		return ADDR_RESOLVABLE_PRIVATE
+	case 0x00:
+		return ADDR_NON_RESOLVABLE_PRIVATE
+	default:
+		return ADDR_RESERVED
+	}
+}
+
+// IsIdentity tells whether the address is stable, public or random static.
+func (self LeAddr) IsIdentity() bool {
+	kind := self.Kind()
+	return kind == ADDR_PUBLIC || kind == ADDR_RANDOM_STATIC
+}
+
+// IsResolvable tells whether the address is a resolvable private address.
+func (self LeAddr) IsResolvable() bool {
+	return self.Kind() == ADDR_RESOLVABLE_PRIVATE
+}
+
+// randomPart fills the random bits of an address, which must not be all
+// zeros nor all ones.
+func randomPart(b []byte, mask byte) error {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		b[len(b)-1] &= mask
+		var zeros, ones = true, true
+		for i, v := range b {
+			m := byte(0xff)
+			if i == len(b)-1 {
+				m = mask
+			}
+			zeros = zeros && v == 0
+			ones = ones && v == m
+		}
+		if !zeros && !ones {
+			return nil
+		}
+	}
+}
+
+// NewStaticAddr generates a random static address, which is used as the
+// identity address of a device that has no public address.
+func NewStaticAddr() (Bdaddr, error) {
+	var addr Bdaddr
+	if err := randomPart(addr[:], 0x3f); err != nil {
+		return addr, err
+	}
+	addr[5] |= 0xc0
+	return addr, nil
+}
+
+// NewNonResolvableAddr generates a non-resolvable private address.
+func NewNonResolvableAddr() (Bdaddr, error) {
+	var addr Bdaddr
+	if err := randomPart(addr[:], 0x3f); err != nil {
+		return addr, err
+	}
+	return addr, nil
+}
+
+// Identity Resolving Keys are in the little endian order, as they are
+// carried in SMP and HCI.
+
+// NewRPA generates a resolvable private address from the IRK.
+//
+// Bluetooth Core specification, Vol 6, Part B, Section 1.3.2.2
+func NewRPA(irk [16]byte) (Bdaddr, error) {
+	var addr Bdaddr
+	if err := randomPart(addr[3:], 0x3f); err != nil {
+		return addr, err
+	}
+	addr[5] |= 0x40
+	copy(addr[:3], rpaHash(irk, addr))
+	return addr, nil
+}
+
+// rpaHash returns the hash part of the address, in the little endian order.
+func rpaHash(irk [16]byte, addr Bdaddr) []byte {
+	return crypto.Swap(crypto.Ah(crypto.Swap(irk[:]), crypto.Swap(addr[3:])))
+}
+
+// ResolvableBy tells whether the resolvable private address was generated
+// with the IRK.
+//
+// Bluetooth Core specification, Vol 6, Part B, Section 1.3.2.3
+func (self Bdaddr) ResolvableBy(irk [16]byte) bool {
+	if self[5]>>6 != 0x01 {
+		return false
+	}
+	return bytes.Equal(rpaHash(irk, self), self[:3])
+}
+
+// ResolveRPA returns the index of the IRK that resolves the address, or -1.
+func ResolveRPA(addr Bdaddr, irks [][16]byte) int {
+	for i, irk := range irks {
+		if addr.ResolvableBy(irk) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Resolver maps resolvable private addresses to the identity addresses of
+// the bonded devices. Peers rotate their addresses typically every 15
+// minutes, so the last resolutions are remembered to save the AES runs on
+// each advertising report.
+type Resolver struct {
+	lock     sync.Mutex
+	irks     [][16]byte
+	ids      []LeAddr
+	resolved map[Bdaddr]LeAddr
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		resolved: make(map[Bdaddr]LeAddr),
+	}
+}
+
+// Add registers the IRK distributed by the peer with its identity address,
+// replacing the former IRK of the identity.
+func (self *Resolver) Add(irk [16]byte, identity LeAddr) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.remove(identity)
+	self.irks = append(self.irks, irk)
+	self.ids = append(self.ids, identity)
+}
+
+// Remove forgets the identity.
+func (self *Resolver) Remove(identity LeAddr) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.remove(identity)
+}
+
+func (self *Resolver) remove(identity LeAddr) {
+	for i, id := range self.ids {
+		if id == identity {
+			self.irks = append(self.irks[:i], self.irks[i+1:]...)
+			self.ids = append(self.ids[:i], self.ids[i+1:]...)
+			break
+		}
+	}
+	for rpa, id := range self.resolved {
+		if id == identity {
+			delete(self.resolved, rpa)
+		}
+	}
+}
+
+// Resolve returns the identity address of the address. Identity addresses
+// and the addresses that no IRK resolves are returned as they are, with
+// false.
+func (self *Resolver) Resolve(addr LeAddr) (LeAddr, bool) {
+	if !addr.IsResolvable() {
+		return addr, false
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if id, ok := self.resolved[addr.Addr]; ok {
+		return id, true
+	}
+	if i := ResolveRPA(addr.Addr, self.irks); i < 0 {
+		return addr, false
+	} else {
+		if len(self.resolved) >= 256 {
+			self.resolved = make(map[Bdaddr]LeAddr)
+		}
+		self.resolved[addr.Addr] = self.ids[i]
+		return self.ids[i], true
+	}
+}
@@ -0,0 +1,65 @@
+package blugo
+
+import (
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	for _, v := range []struct {
+		addr LeAddr
+		kind AddrKind
+	}{
+		{LeAddr{LE_ADDR_PUBLIC, Bdaddr{1, 2, 3, 4, 5, 0xC6}}, ADDR_PUBLIC},
+		{LeAddr{LE_ADDR_RANDOM, Bdaddr{1, 2, 3, 4, 5, 0xC6}}, ADDR_RANDOM_STATIC},
+		{LeAddr{LE_ADDR_RANDOM, Bdaddr{1, 2, 3, 4, 5, 0x46}}, ADDR_RESOLVABLE_PRIVATE},
+		{LeAddr{LE_ADDR_RANDOM, Bdaddr{1, 2, 3, 4, 5, 0x06}}, ADDR_NON_RESOLVABLE_PRIVATE},
+		{LeAddr{LE_ADDR_RANDOM, Bdaddr{1, 2, 3, 4, 5, 0x86}}, ADDR_RESERVED},
+		{LeAddr{LE_ADDR_RANDOM_IDENTITY, Bdaddr{1, 2, 3, 4, 5, 0xC6}}, ADDR_RANDOM_STATIC},
+	} {
+		if kind := v.addr.Kind(); kind != v.kind {
+			t.Errorf("%v got %v", v.addr, kind)
+		}
+	}
+	if addr, err := NewStaticAddr(); err != nil || !(LeAddr{LE_ADDR_RANDOM, addr}).IsIdentity() {
+		t.Errorf("static %v %v", addr, err)
+	}
+	if addr, err := NewNonResolvableAddr(); err != nil || (LeAddr{LE_ADDR_RANDOM, addr}).Kind() != ADDR_NON_RESOLVABLE_PRIVATE {
+		t.Errorf("non-resolvable %v %v", addr, err)
+	}
+}
+
+func TestRPA(t *testing.T) {
+	// Bluetooth Core specification, Vol 3, Part H, Appendix D.7
+	irk := [16]byte{0x9b, 0x7d, 0x39, 0x0a, 0xa6, 0x10, 0x10, 0x34, 0x05, 0xad, 0xc8, 0x57, 0xa3, 0x34, 0x02, 0xec}
+	addr, _ := ParseMAC("70:81:94:0d:fb:aa")
+	if !addr.ResolvableBy(irk) {
+		t.Error("sample address must resolve")
+	}
+	other := [16]byte{1}
+	if ResolveRPA(addr, [][16]byte{other, irk}) != 1 || ResolveRPA(addr, [][16]byte{other}) != -1 {
+		t.Error("resolution by the set")
+	}
+
+	rpa, err := NewRPA(other)
+	if err != nil {
+		t.Fatal(err)
+	} else if !rpa.ResolvableBy(other) || rpa.ResolvableBy(irk) {
+		t.Errorf("generated %v", rpa)
+	}
+
+	identity := LeAddr{LE_ADDR_PUBLIC, Bdaddr{1, 2, 3, 4, 5, 6}}
+	r := NewResolver()
+	r.Add(irk, identity)
+	for i := 0; i < 2; i++ {
+		if id, ok := r.Resolve(LeAddr{LE_ADDR_RANDOM, addr}); !ok || id != identity {
+			t.Errorf("resolved %v %v", id, ok)
+		}
+	}
+	if _, ok := r.Resolve(LeAddr{LE_ADDR_RANDOM, rpa}); ok {
+		t.Error("unknown irk resolved")
+	}
+	r.Remove(identity)
+	if _, ok := r.Resolve(LeAddr{LE_ADDR_RANDOM, addr}); ok {
+		t.Error("removed identity resolved")
+	}
+}
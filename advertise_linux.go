@@ -0,0 +1,179 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+	"fmt"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.8.5 - 7.8.9
+// Legacy advertising of the LE controller.
+
+// Advertising types
+const (
+	ADV_IND            = 0x00 // connectable and scannable undirected
+	ADV_DIRECT_IND     = 0x01 // connectable high duty cycle directed
+	ADV_SCAN_IND       = 0x02 // scannable undirected
+	ADV_NONCONN_IND    = 0x03 // non connectable undirected
+	ADV_DIRECT_IND_LOW = 0x04 // connectable low duty cycle directed
+)
+
+// Own address types
+const (
+	OWN_ADDR_PUBLIC = 0x00
+	OWN_ADDR_RANDOM = 0x01
+)
+
+// Advertiser configures and runs legacy advertising on the controller.
+// Intervals are in 0.625 msec units.
+type Advertiser struct {
+	dev          HciDev
+	IntervalMin  uint16
+	IntervalMax  uint16
+	Type         uint8
+	OwnAddrType  uint8
+	PeerAddrType uint8
+	PeerAddr     Bdaddr // for directed advertising
+	ChannelMap   uint8  // 0 means all the channels
+	FilterPolicy uint8
+	Data         AdData
+	ScanResponse AdData
+}
+
+func NewAdvertiser(dev HciDev) *Advertiser {
+	return &Advertiser{
+		dev:         dev,
+		IntervalMin: 0x0800,
+		IntervalMax: 0x0800,
+	}
+}
+
+func (self HciDev) requestStatus(opcode OpCode, params ...Parameter) error {
+	if ret, err := self.Request(opcode, params...); err != nil {
+		return err
+	} else {
+		return statusError(ret)
+	}
+}
+
+func adParameter(data AdData) ([]Parameter, error) {
+	if buf, err := data.MarshalBinary(); err != nil {
+		return nil, err
+	} else if len(buf) > MAX_AD_LEN {
+		return nil, fmt.Errorf("advertising data too long")
+	} else {
+		pad := make([]byte, MAX_AD_LEN)
+		copy(pad, buf)
+		return []Parameter{uint8(len(buf)), pad}, nil
+	}
+}
+
+// SetRandomAddress sets the random device address used with
+// OWN_ADDR_RANDOM.
+func (self *Advertiser) SetRandomAddress(addr Bdaddr) error {
+	return self.dev.requestStatus(HCI_LE_Set_Random_Address, addr)
+}
+
+// SetData updates the advertising data, which may be done while
+// advertising.
+func (self *Advertiser) SetData(data AdData) error {
+	if params, err := adParameter(data); err != nil {
+		return err
+	} else if err := self.dev.requestStatus(HCI_LE_Set_Advertising_Data, params...); err != nil {
+		return err
+	}
+	self.Data = data
+	return nil
+}
+
+// SetScanResponse updates the scan response data.
+func (self *Advertiser) SetScanResponse(data AdData) error {
+	if params, err := adParameter(data); err != nil {
+		return err
+	} else if err := self.dev.requestStatus(HCI_LE_Set_Scan_Response_Data, params...); err != nil {
+		return err
+	}
+	self.ScanResponse = data
+	return nil
+}
+
+func (self *Advertiser) configure() error {
+	channelMap := self.ChannelMap
+	if channelMap == 0 {
+		channelMap = 0x07
+	}
+	if err := self.dev.requestStatus(HCI_LE_Set_Advertising_Parameters,
+		self.IntervalMin,
+		self.IntervalMax,
+		self.Type,
+		self.OwnAddrType,
+		self.PeerAddrType,
+		self.PeerAddr,
+		channelMap,
+		self.FilterPolicy,
+	); err != nil {
+		return err
+	}
+	if err := self.SetData(self.Data); err != nil {
+		return err
+	}
+	if self.Type == ADV_IND || self.Type == ADV_SCAN_IND {
+		if err := self.SetScanResponse(self.ScanResponse); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start configures the parameters and the data, and enables advertising.
+func (self *Advertiser) Start() error {
+	if err := self.configure(); err != nil {
+		return err
+	}
+	return self.dev.requestStatus(HCI_LE_Set_Advertise_Enable, uint8(1))
+}
+
+// Stop disables advertising.
+func (self *Advertiser) Stop() error {
+	return self.dev.requestStatus(HCI_LE_Set_Advertise_Enable, uint8(0))
+}
+
+// Accept starts advertising and waits for a central to connect, when the
+// controller stops advertising by itself. The connection is also reported
+// to AclMux reading another socket, from which the link is obtained by the
+// handle.
+func (self *Advertiser) Accept(ctx context.Context) (EvtLeConnComplete, error) {
+	var ret EvtLeConnComplete
+	if self.Type == ADV_SCAN_IND || self.Type == ADV_NONCONN_IND {
+		return ret, fmt.Errorf("advertising not connectable")
+	}
+	if err := self.configure(); err != nil {
+		return ret, err
+	}
+	err := self.dev.exchange(ctx, HCI_LE_Set_Advertise_Enable, []Parameter{
+		uint8(1),
+	}, nil, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtCmdComplete); ok && ev.OpCode == uint16(HCI_LE_Set_Advertise_Enable) {
+			if len(ev.Params) > 0 && ev.Params[0] != 0 {
+				return true, HciError(ev.Params[0])
+			}
+			return false, nil
+		} else if meta, ok := p.(EvtLeMetaEvent); !ok {
+			return false, nil
+		} else if sub, err := meta.Parse(); err != nil {
+			return false, nil
+		} else if ev, ok := sub.(EvtLeConnComplete); ok && ev.Role == HCI_ROLE_SLAVE {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			ret = ev
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		self.Stop()
+	}
+	return ret, err
+}
@@ -0,0 +1,131 @@
+// Package assigned holds the Bluetooth SIG assigned numbers: company
+// identifiers, GAP appearance values, AD types, the names of the 16-bit
+// UUIDs, and the core specification versions of HCI and LMP.
+//
+// The tables in tables.go are generated from the YAML files of the SIG
+// repository https://bitbucket.org/bluetooth-SIG/public; see internal/gen.
+// Run go generate with BLUETOOTH_SIG_PUBLIC set to a checkout of it to
+// refresh them. The generator fails without the variable; the subset of
+// the files in internal/gen/testdata is only for its tests.
+//
+// The tables.go checked in is still generated from that subset, as its
+// header says, and knows only about 20 companies. It is to be regenerated
+// from a checkout of the SIG repository.
+package assigned
+
+//go:generate go run ./internal/gen -out tables.go
+
+import (
+	"fmt"
+)
+
+// CompanyID is the company identifier of manufacturer specific data and of
+// LMP.
+type CompanyID uint16
+
+func (self CompanyID) String() string {
+	if name, ok := companies[uint16(self)]; ok {
+		return name
+	}
+	return fmt.Sprintf("Company 0x%04x", uint16(self))
+}
+
+// Appearance is the GAP appearance, the category in the upper 10 bits and
+// the subcategory in the lower 6 bits.
+type Appearance uint16
+
+func (self Appearance) Category() uint16 {
+	return uint16(self) >> 6
+}
+
+func (self Appearance) Subcategory() uint8 {
+	return uint8(self) & 0x3F
+}
+
+// String is like "Watch: Sports Watch", or only the category without a
+// known subcategory.
+func (self Appearance) String() string {
+	category, ok := appearanceCategories[self.Category()]
+	if !ok {
+		return fmt.Sprintf("Appearance 0x%04x", uint16(self))
+	}
+	if self.Subcategory() == 0 {
+		return category
+	} else if sub, ok := appearanceSubcategories[uint16(self)]; ok {
+		return category + ": " + sub
+	}
+	return fmt.Sprintf("%s: 0x%02x", category, self.Subcategory())
+}
+
+// ADType is the type of an AD structure.
+type ADType uint8
+
+func (self ADType) String() string {
+	if name, ok := adTypes[uint8(self)]; ok {
+		return name
+	}
+	return fmt.Sprintf("AD type 0x%02x", uint8(self))
+}
+
+// CoreVersion is HCI_Version and LMP_Version of Read Local Version
+// Information, and of the LL and LMP version exchanges.
+type CoreVersion uint8
+
+var coreVersions = []string{
+	"1.0b",
+	"1.1",
+	"1.2",
+	"2.0+EDR",
+	"2.1+EDR",
+	"3.0+HS",
+	"4.0",
+	"4.1",
+	"4.2",
+	"5.0",
+	"5.1",
+	"5.2",
+	"5.3",
+	"5.4",
+	"6.0",
+}
+
+func (self CoreVersion) String() string {
+	if int(self) < len(coreVersions) {
+		return "Bluetooth " + coreVersions[self]
+	}
+	return fmt.Sprintf("Bluetooth version 0x%02x", uint8(self))
+}
+
+// UUID kinds of the tables, that UUID16 returns
+const (
+	UUID_PROTOCOL       = "protocol"
+	UUID_SERVICE_CLASS  = "service class"
+	UUID_SERVICE        = "service"
+	UUID_DECLARATION    = "declaration"
+	UUID_DESCRIPTOR     = "descriptor"
+	UUID_CHARACTERISTIC = "characteristic"
+	UUID_UNIT           = "unit"
+	UUID_MEMBER         = "member"
+)
+
+// UUID16 returns the name and the kind of the 16-bit UUID.
+func UUID16(v uint16) (string, string, bool) {
+	for _, t := range []struct {
+		kind  string
+		names map[uint16]string
+	}{
+		{UUID_PROTOCOL, protocols},
+		{UUID_SERVICE_CLASS, serviceClasses},
+		{UUID_SERVICE, services},
+		{UUID_DECLARATION, declarations},
+		{UUID_DESCRIPTOR, descriptors},
+		{UUID_CHARACTERISTIC, characteristics},
+		{UUID_UNIT, units},
+		{UUID_MEMBER, members},
+	} {
+		if name, ok := t.names[v]; ok {
+			return name, t.kind, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,41 @@
+package assigned
+
+import (
+	"testing"
+)
+
+func TestAssigned(t *testing.T) {
+	for _, v := range []struct {
+		value interface {
+			String() string
+		}
+		name string
+	}{
+		{CompanyID(0x004C), "Apple, Inc."},
+		{CompanyID(0xFFFE), "Company 0xfffe"},
+		{Appearance(0x00C1), "Watch: Sports Watch"},
+		{Appearance(0x03C1), "Human Interface Device: Keyboard"},
+		{Appearance(0x0040), "Phone"},
+		{Appearance(0x007F), "Phone: 0x3f"},
+		{Appearance(0xFFC0), "Appearance 0xffc0"},
+		{ADType(0xFF), "Manufacturer Specific Data"},
+		{ADType(0x00), "AD type 0x00"},
+		{CoreVersion(0x0C), "Bluetooth 5.3"},
+		{CoreVersion(0x03), "Bluetooth 2.0+EDR"},
+		{CoreVersion(0xF0), "Bluetooth version 0xf0"},
+	} {
+		if s := v.value.String(); s != v.name {
+			t.Errorf("expected %s got %s", v.name, s)
+		}
+	}
+
+	if name, kind, ok := UUID16(0x180D); !ok || name != "Heart Rate" || kind != UUID_SERVICE {
+		t.Errorf("got %s %s", name, kind)
+	}
+	if name, kind, ok := UUID16(0x2902); !ok || name != "Client Characteristic Configuration" || kind != UUID_DESCRIPTOR {
+		t.Errorf("got %s %s", name, kind)
+	}
+	if _, _, ok := UUID16(0xFFFF); ok {
+		t.Error("unassigned uuid found")
+	}
+}
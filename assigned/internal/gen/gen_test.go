@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc, err := parseYAML(`# comment
+appearance_values:
+  - category: 0x003
+    name: Watch
+    subcategory:
+      - value: 0x01
+        name: 'Sports Watch' # comment
+      - value: 0x02
+        name: "Smart \"watch\""
+  - category: 0x004
+    name: 'Clock: it''s # not a comment'
+list:
+- a
+- b
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"appearance_values": []interface{}{
+			map[string]interface{}{
+				"category": "0x003",
+				"name":     "Watch",
+				"subcategory": []interface{}{
+					map[string]interface{}{"value": "0x01", "name": "Sports Watch"},
+					map[string]interface{}{"value": "0x02", "name": `Smart "watch"`},
+				},
+			},
+			map[string]interface{}{"category": "0x004", "name": "Clock: it's # not a comment"},
+		},
+		"list": []interface{}{"a", "b"},
+	}
+	if !reflect.DeepEqual(doc, expect) {
+		t.Errorf("got %v", doc)
+	}
+
+	if _, err := parseYAML("a: 1\n   b: 2\n"); err == nil {
+		t.Error("bad indent accepted")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tables, err := load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := generate(tables, "testdata"); err != nil {
+		t.Error(err)
+	} else if s := string(data); !strings.Contains(s, `0x004C: "Apple, Inc.",`) ||
+		!strings.Contains(s, "var appearanceSubcategories = map[uint16]string{") ||
+		!strings.Contains(s, `0x00C1: "Sports Watch",`) {
+		t.Errorf("got %s", s)
+	}
+}
@@ -0,0 +1,172 @@
+// Command gen generates the tables of the assigned package from the YAML
+// files of a checkout of https://bitbucket.org/bluetooth-SIG/public:
+//
+//	go run ./internal/gen -src ../bluetooth-sig-public -out tables.go
+//
+// -src defaults to the environment variable BLUETOOTH_SIG_PUBLIC, which
+// go generate passes through. It fails when neither is given.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// table is a generated map of the numbers to the names.
+type table struct {
+	name    string
+	keyType string
+	entries map[uint64]string
+}
+
+type source struct {
+	file  string // relative to -src
+	list  string // top level key
+	key   string
+	table string
+}
+
+var sources = []source{
+	{"assigned_numbers/company_identifiers/company_identifiers.yaml", "company_identifiers", "value", "companies"},
+	{"assigned_numbers/core/ad_types.yaml", "ad_types", "value", "adTypes"},
+	{"assigned_numbers/uuids/protocol_identifiers.yaml", "uuids", "uuid", "protocols"},
+	{"assigned_numbers/uuids/service_class.yaml", "uuids", "uuid", "serviceClasses"},
+	{"assigned_numbers/uuids/service_uuids.yaml", "uuids", "uuid", "services"},
+	{"assigned_numbers/uuids/declarations.yaml", "uuids", "uuid", "declarations"},
+	{"assigned_numbers/uuids/descriptors.yaml", "uuids", "uuid", "descriptors"},
+	{"assigned_numbers/uuids/characteristic_uuids.yaml", "uuids", "uuid", "characteristics"},
+	{"assigned_numbers/uuids/units.yaml", "uuids", "uuid", "units"},
+	{"assigned_numbers/uuids/member_uuids.yaml", "uuids", "uuid", "members"},
+}
+
+const appearanceFile = "assigned_numbers/core/appearance_values.yaml"
+
+func readList(path, list string) ([]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if m, ok := doc.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s: mapping expected", path)
+	} else if items, ok := m[list].([]interface{}); !ok {
+		return nil, fmt.Errorf("%s: %s not found", path, list)
+	} else {
+		return items, nil
+	}
+}
+
+// entry returns the number and the name of the list item.
+func entry(item interface{}, key string) (uint64, string, error) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return 0, "", fmt.Errorf("mapping expected in the list")
+	}
+	k, _ := m[key].(string)
+	name, _ := m["name"].(string)
+	if v, err := strconv.ParseUint(k, 0, 32); err != nil {
+		return 0, "", fmt.Errorf("invalid %s %q", key, k)
+	} else if name == "" {
+		return 0, "", fmt.Errorf("no name of %s", k)
+	} else {
+		return v, name, nil
+	}
+}
+
+func load(src string) ([]table, error) {
+	var tables []table
+	for _, s := range sources {
+		items, err := readList(filepath.Join(src, s.file), s.list)
+		if err != nil {
+			return nil, err
+		}
+		t := table{name: s.table, keyType: "uint16", entries: make(map[uint64]string)}
+		if s.table == "adTypes" {
+			t.keyType = "uint8"
+		}
+		for _, item := range items {
+			if k, name, err := entry(item, s.key); err != nil {
+				return nil, fmt.Errorf("%s: %v", s.file, err)
+			} else {
+				t.entries[k] = name
+			}
+		}
+		tables = append(tables, t)
+	}
+
+	items, err := readList(filepath.Join(src, appearanceFile), "appearance_values")
+	if err != nil {
+		return nil, err
+	}
+	categories := table{name: "appearanceCategories", keyType: "uint16", entries: make(map[uint64]string)}
+	subcategories := table{name: "appearanceSubcategories", keyType: "uint16", entries: make(map[uint64]string)}
+	for _, item := range items {
+		category, name, err := entry(item, "category")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", appearanceFile, err)
+		}
+		categories.entries[category] = name
+		subs, _ := item.(map[string]interface{})["subcategory"].([]interface{})
+		for _, sub := range subs {
+			if v, name, err := entry(sub, "value"); err != nil {
+				return nil, fmt.Errorf("%s: %v", appearanceFile, err)
+			} else {
+				subcategories.entries[category<<6|v] = name
+			}
+		}
+	}
+	return append(tables, categories, subcategories), nil
+}
+
+func generate(tables []table, src string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by internal/gen from %s; DO NOT EDIT.\n\n", filepath.ToSlash(src))
+	fmt.Fprintf(&buf, "package assigned\n")
+	for _, t := range tables {
+		var keys []uint64
+		for k := range t.entries {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+		digits := 4
+		if t.keyType == "uint8" {
+			digits = 2
+		}
+		fmt.Fprintf(&buf, "\nvar %s = map[%s]string{\n", t.name, t.keyType)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "0x%0*X: %s,\n", digits, k, strconv.Quote(t.entries[k]))
+		}
+		fmt.Fprintf(&buf, "}\n")
+	}
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	src := flag.String("src", os.Getenv("BLUETOOTH_SIG_PUBLIC"), "checkout of the bluetooth-SIG/public repository")
+	out := flag.String("out", "tables.go", "output file")
+	flag.Parse()
+	if *src == "" {
+		log.Fatal("set BLUETOOTH_SIG_PUBLIC or -src to a checkout of https://bitbucket.org/bluetooth-SIG/public")
+	}
+	tables, err := load(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if data, err := generate(tables, *src); err != nil {
+		log.Fatal(err)
+	} else if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The SIG files use a small part of YAML: block mappings and sequences of
+// scalars, plain or quoted. parseYAML reads that part into
+// map[string]interface{}, []interface{} and string values.
+
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+func parseYAML(data string) (interface{}, error) {
+	var lines []yamlLine
+	for i, l := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		t := strings.TrimRight(l, " \t")
+		s := strings.TrimLeft(t, " ")
+		if s == "" || strings.HasPrefix(s, "#") || s == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{no: i + 1, indent: len(t) - len(s), text: s})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.node(lines[0].indent)
+	if err == nil && p.pos < len(lines) {
+		err = fmt.Errorf("line %d: unexpected indent", lines[p.pos].no)
+	}
+	return v, err
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (self *yamlParser) node(indent int) (interface{}, error) {
+	if l := self.lines[self.pos]; strings.HasPrefix(l.text, "- ") || l.text == "-" {
+		return self.sequence(indent)
+	}
+	return self.mapping(indent)
+}
+
+func (self *yamlParser) sequence(indent int) (interface{}, error) {
+	var ret []interface{}
+	for self.pos < len(self.lines) {
+		l := self.lines[self.pos]
+		if l.indent != indent || !(strings.HasPrefix(l.text, "- ") || l.text == "-") {
+			break
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if item == "" {
+			self.pos++
+			if self.pos < len(self.lines) && self.lines[self.pos].indent > indent {
+				if v, err := self.node(self.lines[self.pos].indent); err != nil {
+					return nil, err
+				} else {
+					ret = append(ret, v)
+				}
+			} else {
+				ret = append(ret, "")
+			}
+		} else if _, _, ok := splitKey(item); ok {
+			// the item is a mapping starting on the line of "-"
+			self.lines[self.pos] = yamlLine{
+				no:     l.no,
+				indent: indent + len(l.text) - len(item),
+				text:   item,
+			}
+			if v, err := self.mapping(self.lines[self.pos].indent); err != nil {
+				return nil, err
+			} else {
+				ret = append(ret, v)
+			}
+		} else {
+			ret = append(ret, scalar(item))
+			self.pos++
+		}
+	}
+	return ret, nil
+}
+
+func (self *yamlParser) mapping(indent int) (interface{}, error) {
+	ret := make(map[string]interface{})
+	for self.pos < len(self.lines) {
+		l := self.lines[self.pos]
+		if l.indent < indent {
+			break
+		} else if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indent", l.no)
+		}
+		key, value, ok := splitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: mapping expected", l.no)
+		}
+		self.pos++
+		if value != "" {
+			ret[key] = scalar(value)
+		} else if self.pos < len(self.lines) && (self.lines[self.pos].indent > indent ||
+			(self.lines[self.pos].indent == indent && strings.HasPrefix(self.lines[self.pos].text, "- "))) {
+			if v, err := self.node(self.lines[self.pos].indent); err != nil {
+				return nil, err
+			} else {
+				ret[key] = v
+			}
+		} else {
+			ret[key] = ""
+		}
+	}
+	return ret, nil
+}
+
+// splitKey splits "key: value" outside of the quotes.
+func splitKey(s string) (string, string, bool) {
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, "\"") {
+		return "", "", false
+	}
+	if i := strings.Index(s, ": "); i > 0 {
+		return s[:i], strings.TrimSpace(s[i+2:]), true
+	} else if strings.HasSuffix(s, ":") {
+		return s[:len(s)-1], "", true
+	}
+	return "", "", false
+}
+
+func scalar(s string) string {
+	if strings.HasPrefix(s, "'") {
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			} else if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+			} else {
+				return strings.Replace(s[1:i], "''", "'", -1)
+			}
+		}
+	} else if strings.HasPrefix(s, "\"") {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				r := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\n`, "\n", `\t`, "\t")
+				return r.Replace(s[1:i])
+			}
+		}
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -0,0 +1,254 @@
+// Code generated by internal/gen from internal/gen/testdata; DO NOT EDIT.
+
+package assigned
+
+var companies = map[uint16]string{
+	0x0000: "Ericsson AB",
+	0x0001: "Nokia Mobile Phones",
+	0x0002: "Intel Corp.",
+	0x0003: "IBM Corp.",
+	0x0006: "Microsoft",
+	0x000A: "Qualcomm Technologies International, Ltd. (QTIL)",
+	0x000D: "Texas Instruments Inc.",
+	0x000F: "Broadcom Corporation",
+	0x001D: "Qualcomm",
+	0x004C: "Apple, Inc.",
+	0x0059: "Nordic Semiconductor ASA",
+	0x0075: "Samsung Electronics Co. Ltd.",
+	0x0087: "Garmin International, Inc.",
+	0x00E0: "Google",
+	0x0118: "Radius Networks, Inc.",
+	0x0131: "Cypress Semiconductor",
+	0x02E5: "Espressif Systems (Shanghai) Co., Ltd.",
+	0x05A7: "Sonos Inc",
+	0x0822: "adafruit industries",
+	0xFFFF: "Bluetooth SIG Specification Reserved Default Vendor ID for Remote Devices Without Device ID Service Record.",
+}
+
+var adTypes = map[uint8]string{
+	0x01: "Flags",
+	0x02: "Incomplete List of 16-bit Service or Service Class UUIDs",
+	0x03: "Complete List of 16-bit Service or Service Class UUIDs",
+	0x04: "Incomplete List of 32-bit Service or Service Class UUIDs",
+	0x05: "Complete List of 32-bit Service or Service Class UUIDs",
+	0x06: "Incomplete List of 128-bit Service or Service Class UUIDs",
+	0x07: "Complete List of 128-bit Service or Service Class UUIDs",
+	0x08: "Shortened Local Name",
+	0x09: "Complete Local Name",
+	0x0A: "Tx Power Level",
+	0x0D: "Class of Device",
+	0x10: "Device ID",
+	0x12: "Peripheral Connection Interval Range",
+	0x14: "List of 16-bit Service Solicitation UUIDs",
+	0x15: "List of 128-bit Service Solicitation UUIDs",
+	0x16: "Service Data - 16-bit UUID",
+	0x17: "Public Target Address",
+	0x18: "Random Target Address",
+	0x19: "Appearance",
+	0x1A: "Advertising Interval",
+	0x1B: "LE Bluetooth Device Address",
+	0x1C: "LE Role",
+	0x1F: "List of 32-bit Service Solicitation UUIDs",
+	0x20: "Service Data - 32-bit UUID",
+	0x21: "Service Data - 128-bit UUID",
+	0x24: "URI",
+	0x27: "LE Supported Features",
+	0x2E: "Resolvable Set Identifier",
+	0x30: "Broadcast Name",
+	0xFF: "Manufacturer Specific Data",
+}
+
+var protocols = map[uint16]string{
+	0x0001: "SDP",
+	0x0003: "RFCOMM",
+	0x0007: "ATT",
+	0x0008: "OBEX",
+	0x000F: "BNEP",
+	0x0011: "HIDP",
+	0x0017: "AVCTP",
+	0x0019: "AVDTP",
+	0x0100: "L2CAP",
+}
+
+var serviceClasses = map[uint16]string{
+	0x1000: "Service Discovery Server",
+	0x1001: "Browse Group Descriptor",
+	0x1002: "Public Browse Root",
+	0x1101: "Serial Port",
+	0x1103: "Dialup Networking",
+	0x1105: "OBEX Object Push",
+	0x1106: "OBEX File Transfer",
+	0x1108: "Headset",
+	0x110A: "Audio Source",
+	0x110B: "Audio Sink",
+	0x110C: "A/V Remote Control Target",
+	0x110D: "Advanced Audio Distribution",
+	0x110E: "A/V Remote Control",
+	0x1112: "Headset Audio Gateway",
+	0x1115: "PANU",
+	0x1116: "NAP",
+	0x111E: "Handsfree",
+	0x111F: "Handsfree Audio Gateway",
+	0x1124: "Human Interface Device",
+	0x112F: "Phonebook Access Server",
+	0x1200: "PnP Information",
+	0x1203: "Generic Audio",
+}
+
+var services = map[uint16]string{
+	0x1800: "Generic Access",
+	0x1801: "Generic Attribute",
+	0x1802: "Immediate Alert",
+	0x1803: "Link Loss",
+	0x1804: "Tx Power",
+	0x1805: "Current Time",
+	0x180A: "Device Information",
+	0x180D: "Heart Rate",
+	0x180F: "Battery",
+	0x1810: "Blood Pressure",
+	0x1812: "Human Interface Device",
+	0x1816: "Cycling Speed and Cadence",
+	0x1818: "Cycling Power",
+	0x1819: "Location and Navigation",
+	0x181A: "Environmental Sensing",
+	0x181C: "User Data",
+	0x1822: "Pulse Oximeter",
+	0x1826: "Fitness Machine",
+}
+
+var declarations = map[uint16]string{
+	0x2800: "Primary Service",
+	0x2801: "Secondary Service",
+	0x2802: "Include",
+	0x2803: "Characteristic",
+}
+
+var descriptors = map[uint16]string{
+	0x2900: "Characteristic Extended Properties",
+	0x2901: "Characteristic User Description",
+	0x2902: "Client Characteristic Configuration",
+	0x2903: "Server Characteristic Configuration",
+	0x2904: "Characteristic Presentation Format",
+	0x2905: "Characteristic Aggregate Format",
+	0x2906: "Valid Range",
+	0x2908: "Report Reference",
+}
+
+var characteristics = map[uint16]string{
+	0x2A00: "Device Name",
+	0x2A01: "Appearance",
+	0x2A02: "Peripheral Privacy Flag",
+	0x2A04: "Peripheral Preferred Connection Parameters",
+	0x2A05: "Service Changed",
+	0x2A06: "Alert Level",
+	0x2A07: "Tx Power Level",
+	0x2A19: "Battery Level",
+	0x2A23: "System ID",
+	0x2A24: "Model Number String",
+	0x2A25: "Serial Number String",
+	0x2A26: "Firmware Revision String",
+	0x2A27: "Hardware Revision String",
+	0x2A28: "Software Revision String",
+	0x2A29: "Manufacturer Name String",
+	0x2A2B: "Current Time",
+	0x2A37: "Heart Rate Measurement",
+	0x2A38: "Body Sensor Location",
+	0x2A4A: "HID Information",
+	0x2A4B: "Report Map",
+	0x2A4D: "Report",
+	0x2A50: "PnP ID",
+	0x2A6E: "Temperature",
+	0x2A6F: "Humidity",
+	0x2AA6: "Central Address Resolution",
+	0x2AC9: "Resolvable Private Address Only",
+	0x2B29: "Client Supported Features",
+	0x2B2A: "Database Hash",
+	0x2B3A: "Server Supported Features",
+}
+
+var units = map[uint16]string{
+	0x2700: "unitless",
+	0x2701: "length (metre)",
+	0x2702: "mass (kilogram)",
+	0x2703: "time (second)",
+	0x2704: "electric current (ampere)",
+	0x2705: "thermodynamic temperature (kelvin)",
+	0x2706: "amount of substance (mole)",
+	0x2707: "luminous intensity (candela)",
+	0x2724: "pressure (pascal)",
+	0x2728: "electric potential difference (volt)",
+	0x272F: "Celsius temperature (degree Celsius)",
+	0x27A7: "time (minute)",
+	0x27A8: "time (hour)",
+	0x27AD: "percentage",
+	0x27AF: "period (beats per minute)",
+	0x27C3: "logarithmic radio quantity (decibel)",
+}
+
+var members = map[uint16]string{
+	0xFD6F: "Apple, Inc.",
+	0xFE2C: "Google LLC",
+	0xFE9F: "Google LLC",
+	0xFEAA: "Google LLC",
+	0xFEF3: "Google LLC",
+}
+
+var appearanceCategories = map[uint16]string{
+	0x0000: "Unknown",
+	0x0001: "Phone",
+	0x0002: "Computer",
+	0x0003: "Watch",
+	0x0004: "Clock",
+	0x0005: "Display",
+	0x0006: "Remote Control",
+	0x0007: "Eye-glasses",
+	0x0008: "Tag",
+	0x0009: "Keyring",
+	0x000A: "Media Player",
+	0x000B: "Barcode Scanner",
+	0x000C: "Thermometer",
+	0x000D: "Heart Rate Sensor",
+	0x000E: "Blood Pressure",
+	0x000F: "Human Interface Device",
+	0x0010: "Glucose Meter",
+	0x0011: "Running Walking Sensor",
+	0x0012: "Cycling",
+	0x0021: "Audio Sink",
+	0x0025: "Wearable Audio Device",
+	0x0031: "Pulse Oximeter",
+}
+
+var appearanceSubcategories = map[uint16]string{
+	0x0081: "Desktop Workstation",
+	0x0082: "Server-class Computer",
+	0x0083: "Laptop",
+	0x0085: "Tablet",
+	0x00C1: "Sports Watch",
+	0x00C2: "Smartwatch",
+	0x0301: "Ear Thermometer",
+	0x0341: "Heart Rate Belt",
+	0x0381: "Arm Blood Pressure",
+	0x0382: "Wrist Blood Pressure",
+	0x03C1: "Keyboard",
+	0x03C2: "Mouse",
+	0x03C3: "Joystick",
+	0x03C4: "Gamepad",
+	0x03C5: "Digitizer Tablet",
+	0x03C6: "Card Reader",
+	0x03C7: "Digital Pen",
+	0x03C8: "Barcode Scanner",
+	0x0441: "In-Shoe Running Walking Sensor",
+	0x0481: "Cycling Computer",
+	0x0482: "Speed Sensor",
+	0x0483: "Cadence Sensor",
+	0x0484: "Power Sensor",
+	0x0485: "Speed and Cadence Sensor",
+	0x0841: "Standalone Speaker",
+	0x0846: "Headphones",
+	0x0941: "Earbud",
+	0x0942: "Headset",
+	0x0943: "Headphones",
+	0x0944: "Neck Band",
+	0x0C41: "Fingertip Pulse Oximeter",
+	0x0C42: "Wrist Worn Pulse Oximeter",
+}
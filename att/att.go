@@ -0,0 +1,179 @@
+// Package att implements the Attribute Protocol over any io.ReadWriter that
+// keeps the PDU boundaries, such as the L2CAP fixed channel 0x0004.
+//
+// Bluetooth Core specification, Vol 3, Part F
+package att
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Attribute opcodes, Section 3.4.8
+const (
+	ERROR_RSP              = 0x01
+	MTU_REQ                = 0x02
+	MTU_RSP                = 0x03
+	FIND_INFO_REQ          = 0x04
+	FIND_INFO_RSP          = 0x05
+	FIND_BY_TYPE_VALUE_REQ = 0x06
+	FIND_BY_TYPE_VALUE_RSP = 0x07
+	READ_BY_TYPE_REQ       = 0x08
+	READ_BY_TYPE_RSP       = 0x09
+	READ_REQ               = 0x0A
+	READ_RSP               = 0x0B
+	READ_BLOB_REQ          = 0x0C
+	READ_BLOB_RSP          = 0x0D
+	READ_MULTI_REQ         = 0x0E
+	READ_MULTI_RSP         = 0x0F
+	READ_BY_GROUP_TYPE_REQ = 0x10
+	READ_BY_GROUP_TYPE_RSP = 0x11
+	WRITE_REQ              = 0x12
+	WRITE_RSP              = 0x13
+	PREPARE_WRITE_REQ      = 0x16
+	PREPARE_WRITE_RSP      = 0x17
+	EXECUTE_WRITE_REQ      = 0x18
+	EXECUTE_WRITE_RSP      = 0x19
+	HANDLE_VALUE_NTF       = 0x1B
+	HANDLE_VALUE_IND       = 0x1D
+	HANDLE_VALUE_CFM       = 0x1E
+	READ_MULTI_VAR_REQ     = 0x20
+	READ_MULTI_VAR_RSP     = 0x21
+	MULTI_HANDLE_VALUE_NTF = 0x23
+	WRITE_CMD              = 0x52
+	SIGNED_WRITE_CMD       = 0xD2
+
+	OP_COMMAND_FLAG = 0x40
+	OP_SIGNED_FLAG  = 0x80
+)
+
+const (
+	DEFAULT_MTU         = 23
+	MAX_MTU             = 517
+	MAX_VALUE_LEN       = 512
+	TRANSACTION_TIMEOUT = 30 * time.Second
+)
+
+// Execute Write Request flags
+const (
+	EXEC_CANCEL = 0x00
+	EXEC_WRITE  = 0x01
+)
+
+// GATT attribute types that ATT knows as the grouping types.
+const (
+	UUID_PRIMARY_SERVICE   = 0x2800
+	UUID_SECONDARY_SERVICE = 0x2801
+)
+
+// ErrorCode is the error code of Error Response, Section 3.4.1.1
+type ErrorCode uint8
+
+const (
+	_ ErrorCode = iota
+	ECODE_INVALID_HANDLE
+	ECODE_READ_NOT_PERMITTED
+	ECODE_WRITE_NOT_PERMITTED
+	ECODE_INVALID_PDU
+	ECODE_INSUFFICIENT_AUTHEN
+	ECODE_REQ_NOT_SUPPORTED
+	ECODE_INVALID_OFFSET
+	ECODE_INSUFFICIENT_AUTHOR
+	ECODE_PREPARE_QUEUE_FULL
+	ECODE_ATTR_NOT_FOUND
+	ECODE_ATTR_NOT_LONG
+	ECODE_INSUFFICIENT_ENC_KEY_SIZE
+	ECODE_INVALID_ATTR_VALUE_LEN
+	ECODE_UNLIKELY
+	ECODE_INSUFFICIENT_ENC
+	ECODE_UNSUPPORTED_GROUP_TYPE
+	ECODE_INSUFFICIENT_RESOURCES
+	ECODE_DB_OUT_OF_SYNC
+	ECODE_VALUE_NOT_ALLOWED
+)
+
+// Common profile and service error codes, Core Specification Supplement,
+// Part B
+const (
+	ECODE_WRITE_REQUEST_REJECTED ErrorCode = 0xFC
+	ECODE_CCCD_IMPROPER          ErrorCode = 0xFD
+	ECODE_PROCEDURE_IN_PROGRESS  ErrorCode = 0xFE
+	ECODE_OUT_OF_RANGE           ErrorCode = 0xFF
+)
+
+func (self ErrorCode) String() string {
+	switch self {
+	case ECODE_INVALID_HANDLE:
+		return "ECODE_INVALID_HANDLE"
+	case ECODE_READ_NOT_PERMITTED:
+		return "ECODE_READ_NOT_PERMITTED"
+	case ECODE_WRITE_NOT_PERMITTED:
+		return "ECODE_WRITE_NOT_PERMITTED"
+	case ECODE_INVALID_PDU:
+		return "ECODE_INVALID_PDU"
+	case ECODE_INSUFFICIENT_AUTHEN:
+		return "ECODE_INSUFFICIENT_AUTHEN"
+	case ECODE_REQ_NOT_SUPPORTED:
+		return "ECODE_REQ_NOT_SUPPORTED"
+	case ECODE_INVALID_OFFSET:
+		return "ECODE_INVALID_OFFSET"
+	case ECODE_INSUFFICIENT_AUTHOR:
+		return "ECODE_INSUFFICIENT_AUTHOR"
+	case ECODE_PREPARE_QUEUE_FULL:
+		return "ECODE_PREPARE_QUEUE_FULL"
+	case ECODE_ATTR_NOT_FOUND:
+		return "ECODE_ATTR_NOT_FOUND"
+	case ECODE_ATTR_NOT_LONG:
+		return "ECODE_ATTR_NOT_LONG"
+	case ECODE_INSUFFICIENT_ENC_KEY_SIZE:
+		return "ECODE_INSUFFICIENT_ENC_KEY_SIZE"
+	case ECODE_INVALID_ATTR_VALUE_LEN:
+		return "ECODE_INVALID_ATTR_VALUE_LEN"
+	case ECODE_UNLIKELY:
+		return "ECODE_UNLIKELY"
+	case ECODE_INSUFFICIENT_ENC:
+		return "ECODE_INSUFFICIENT_ENC"
+	case ECODE_UNSUPPORTED_GROUP_TYPE:
+		return "ECODE_UNSUPPORTED_GROUP_TYPE"
+	case ECODE_INSUFFICIENT_RESOURCES:
+		return "ECODE_INSUFFICIENT_RESOURCES"
+	case ECODE_DB_OUT_OF_SYNC:
+		return "ECODE_DB_OUT_OF_SYNC"
+	case ECODE_VALUE_NOT_ALLOWED:
+		return "ECODE_VALUE_NOT_ALLOWED"
+	case ECODE_WRITE_REQUEST_REJECTED:
+		return "ECODE_WRITE_REQUEST_REJECTED"
+	case ECODE_CCCD_IMPROPER:
+		return "ECODE_CCCD_IMPROPER"
+	case ECODE_PROCEDURE_IN_PROGRESS:
+		return "ECODE_PROCEDURE_IN_PROGRESS"
+	case ECODE_OUT_OF_RANGE:
+		return "ECODE_OUT_OF_RANGE"
+	default:
+		if self >= 0x80 && self <= 0x9F {
+			return fmt.Sprintf("application error 0x%02x", uint8(self))
+		}
+		return fmt.Sprintf("ECODE_0x%02x", uint8(self))
+	}
+}
+
+func (self ErrorCode) Error() string {
+	return "att: " + self.String()
+}
+
+// Error is Error Response received for a request.
+type Error struct {
+	ReqOpcode uint8
+	Handle    uint16
+	Code      ErrorCode
+}
+
+func (self *Error) Error() string {
+	return fmt.Sprintf("att: %v opcode=0x%02x handle=0x%04x", self.Code, self.ReqOpcode, self.Handle)
+}
+
+var (
+	ErrTimeout = errors.New("att: transaction timeout")
+	ErrClosed  = errors.New("att: bearer closed")
+)
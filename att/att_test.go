@@ -0,0 +1,145 @@
+package att
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+func TestPDU(t *testing.T) {
+	for _, pdu := range []PDU{
+		ErrorRsp{ReqOpcode: READ_REQ, Handle: 0x0010, Code: ECODE_READ_NOT_PERMITTED},
+		MtuReq{MTU: 247},
+		FindInfoRsp{Info: []HandleInfo{{1, uuid.UUID16(0x2800)}, {2, uuid.UUID16(0x2803)}}},
+		FindByTypeValueReq{Start: 1, End: 0xFFFF, Type: 0x2800, Value: []byte{0x0F, 0x18}},
+		ReadByTypeRsp{Data: []HandleValue{{2, []byte{0x02, 0x03, 0x00, 0x00, 0x2A}}}},
+		ReadByGroupTypeRsp{Data: []GroupValue{{1, 5, []byte{0x00, 0x18}}, {6, 9, []byte{0x01, 0x18}}}},
+		PrepareWriteReq{Handle: 3, Offset: 18, Value: []byte("abc")},
+		ReadMultiVarRsp{Values: [][]byte{[]byte("a"), []byte("bc")}},
+		MultiHandleValueNtf{Values: []HandleValue{{3, []byte{1}}, {5, []byte{2, 3}}}},
+		SignedWriteCmd{Handle: 3, Value: []byte{1}, Signature: [12]byte{1, 2, 3}},
+	} {
+		data, err := pdu.MarshalBinary()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, err := Parse(data); err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(got, pdu) {
+			t.Errorf("got %v, expected %v", got, pdu)
+		}
+	}
+	for _, data := range [][]byte{
+		{FIND_INFO_RSP, 0x01},
+		{FIND_BY_TYPE_VALUE_RSP},
+		{READ_BY_TYPE_RSP, 0x07},
+		{READ_BY_GROUP_TYPE_RSP, 0x06},
+	} {
+		if pdu, err := Parse(data); err == nil {
+			t.Errorf("got %v for %x", pdu, data)
+		}
+	}
+	if data, _ := (MtuReq{MTU: 0x0200}).MarshalBinary(); !bytes.Equal(data, []byte{0x02, 0x00, 0x02}) {
+		t.Errorf("got %x", data)
+	}
+}
+
+func testDB() *DB {
+	db := NewDB()
+	db.Add(&Attribute{Handle: 1, Type: uuid.UUID16(UUID_PRIMARY_SERVICE), Perm: PERM_READ, Value: []byte{0x0F, 0x18}, EndGroup: 4})
+	db.Add(&Attribute{Handle: 2, Type: uuid.UUID16(0x2803), Perm: PERM_READ, Value: []byte{0x12, 0x03, 0x00, 0x19, 0x2A}})
+	db.Add(&Attribute{Handle: 3, Type: uuid.UUID16(0x2A19), Perm: PERM_READ | PERM_WRITE, Value: bytes.Repeat([]byte("0123456789"), 10)})
+	db.Add(&Attribute{Handle: 4, Type: uuid.UUID16(0x2902), Perm: PERM_READ | PERM_WRITE_ENCRYPT, Value: []byte{0, 0}})
+	return db
+}
+
+func TestClientServer(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	client := NewClient(a)
+	server := NewServer(b, testDB())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if mtu, err := client.ExchangeMTU(ctx, 64); err != nil || mtu != 64 || server.MTU() != 64 {
+		t.Errorf("mtu %d/%d %v", mtu, server.MTU(), err)
+	}
+	if groups, err := client.ReadByGroupType(ctx, 1, 0xFFFF, uuid.UUID16(UUID_PRIMARY_SERVICE)); err != nil {
+		t.Error(err)
+	} else if len(groups) != 1 || groups[0].End != 4 || !bytes.Equal(groups[0].Value, []byte{0x0F, 0x18}) {
+		t.Errorf("got %v", groups)
+	}
+	if info, err := client.FindInformation(ctx, 2, 0xFFFF); err != nil || len(info) != 3 {
+		t.Errorf("got %v %v", info, err)
+	}
+	if ranges, err := client.FindByTypeValue(ctx, 1, 0xFFFF, UUID_PRIMARY_SERVICE, []byte{0x0F, 0x18}); err != nil {
+		t.Error(err)
+	} else if len(ranges) != 1 || ranges[0] != (HandleRange{1, 4}) {
+		t.Errorf("got %v", ranges)
+	}
+	if value, err := client.ReadLong(ctx, 3); err != nil || len(value) != 100 {
+		t.Errorf("read long %d %v", len(value), err)
+	}
+
+	long := bytes.Repeat([]byte("abcdefghij"), 20)
+	if err := client.WriteLong(ctx, 3, long); err != nil {
+		t.Error(err)
+	} else if value, err := client.ReadLong(ctx, 3); err != nil || !bytes.Equal(value, long) {
+		t.Errorf("read back %q %v", value, err)
+	}
+	if _, err := client.PrepareWrite(ctx, 3, 10, []byte("XYZ")); err != nil {
+		t.Error(err)
+	} else if err := client.ExecuteWrite(ctx, true); err != nil {
+		t.Error(err)
+	} else if value, err := client.ReadLong(ctx, 3); err != nil {
+		t.Error(err)
+	} else if expect := append(append(long[:10:10], "XYZ"...), long[13:]...); !bytes.Equal(value, expect) {
+		t.Errorf("partial write %q", value)
+	}
+	if _, err := client.PrepareWrite(ctx, 3, 0, []byte("Q")); err != nil {
+		t.Error(err)
+	} else if _, err := client.do(ctx, ExecuteWriteReq{Flags: 0x02}); err == nil || err.(*Error).Code != ECODE_INVALID_PDU {
+		t.Errorf("got %v", err)
+	} else if err := client.ExecuteWrite(ctx, true); err != nil {
+		t.Error(err)
+	} else if value, err := client.Read(ctx, 3); err != nil || value[0] != 'Q' {
+		t.Errorf("queue lost %q %v", value, err)
+	}
+
+	if err := client.Write(ctx, 4, []byte{1, 0}); err == nil {
+		t.Error("expected error")
+	} else if e, ok := err.(*Error); !ok || e.Code != ECODE_INSUFFICIENT_ENC || e.Handle != 4 {
+		t.Errorf("got %v", err)
+	}
+	server.SetSecurity(SECURITY_MEDIUM)
+	if err := client.Write(ctx, 4, []byte{1, 0}); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Read(ctx, 9); err == nil || err.(*Error).Code != ECODE_INVALID_HANDLE {
+		t.Errorf("got %v", err)
+	}
+
+	got := make(chan HandleValue, 2)
+	client.OnNotification(func(handle uint16, value []byte, indication bool) {
+		got <- HandleValue{Handle: handle, Value: append([]byte(nil), value...)}
+	})
+	if err := server.Notify(3, []byte{1}); err != nil {
+		t.Error(err)
+	}
+	if v := <-got; v.Handle != 3 || !bytes.Equal(v.Value, []byte{1}) {
+		t.Errorf("notification %v", v)
+	}
+	if err := server.Indicate(ctx, 3, []byte{2}); err != nil {
+		t.Error(err)
+	}
+	if v := <-got; !bytes.Equal(v.Value, []byte{2}) {
+		t.Errorf("indication %v", v)
+	}
+}
@@ -0,0 +1,129 @@
+package att
+
+import (
+	"io"
+	"sync"
+)
+
+// bearer reads the PDUs of the channel and dispatches them to the client
+// and the server roles of the local device.
+type bearer struct {
+	rw     io.ReadWriter
+	wlock  sync.Mutex
+	lock   sync.Mutex
+	mtu    int
+	client *Client
+	server *Server
+	err    error
+	done   chan struct{}
+}
+
+func newBearer(rw io.ReadWriter) *bearer {
+	return &bearer{
+		rw:   rw,
+		mtu:  DEFAULT_MTU,
+		done: make(chan struct{}),
+	}
+}
+
+func (self *bearer) send(pdu PDU) error {
+	data, err := pdu.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+	_, err = self.rw.Write(data)
+	return err
+}
+
+func (self *bearer) getMtu() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.mtu
+}
+
+func (self *bearer) setMtu(mtu int) {
+	if mtu < DEFAULT_MTU {
+		mtu = DEFAULT_MTU
+	} else if mtu > MAX_MTU {
+		mtu = MAX_MTU
+	}
+	self.lock.Lock()
+	self.mtu = mtu
+	self.lock.Unlock()
+}
+
+// fail closes the bearer; no more PDUs are sent after transaction timeout.
+func (self *bearer) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err == nil {
+		self.err = err
+		close(self.done)
+	}
+}
+
+func (self *bearer) error() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err == io.EOF {
+		return ErrClosed
+	}
+	return self.err
+}
+
+func (self *bearer) serve() {
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := self.rw.Read(buf)
+		if err != nil {
+			self.fail(err)
+			return
+		}
+		select {
+		case <-self.done:
+			return
+		default:
+		}
+		if n == 0 {
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+		op := data[0]
+		switch {
+		case op == HANDLE_VALUE_NTF || op == HANDLE_VALUE_IND || op == MULTI_HANDLE_VALUE_NTF:
+			if self.client != nil {
+				self.client.notification(data)
+			} else if op == HANDLE_VALUE_IND {
+				go self.send(HandleValueCfm{})
+			}
+		case op == HANDLE_VALUE_CFM:
+			if self.server != nil {
+				self.server.confirm()
+			}
+		case op == ERROR_RSP || (op&OP_COMMAND_FLAG == 0 && op&1 == 1):
+			if self.client != nil {
+				self.client.response(data)
+			}
+		default:
+			if self.server != nil {
+				self.server.handle(data)
+			} else if op&OP_COMMAND_FLAG == 0 {
+				self.send(ErrorRsp{
+					ReqOpcode: op,
+					Code:      ECODE_REQ_NOT_SUPPORTED,
+				})
+			}
+		}
+	}
+}
+
+// NewPeer serves both of the client and the server roles on the channel.
+func NewPeer(rw io.ReadWriter, db *DB) (*Client, *Server) {
+	b := newBearer(rw)
+	b.client = newClient(b)
+	b.server = newServer(b, db)
+	go b.serve()
+	return b.client, b.server
+}
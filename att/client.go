@@ -0,0 +1,351 @@
+package att
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Client issues requests to the server of the peer. Requests are
+// serialized, as ATT allows only one outstanding request on a bearer.
+type Client struct {
+	bearer  *bearer
+	sem     chan struct{}
+	lock    sync.Mutex
+	pending chan result
+	reqOp   uint8
+	timer   *time.Timer
+	handler func(handle uint16, value []byte, indication bool)
+}
+
+// result is the response of the request, or the error that the response
+// failed to parse with.
+type result struct {
+	pdu PDU
+	err error
+}
+
+func newClient(b *bearer) *Client {
+	return &Client{
+		bearer: b,
+		sem:    make(chan struct{}, 1),
+	}
+}
+
+// NewClient serves the client role on the channel. Requests from the peer
+// are answered with ECODE_REQ_NOT_SUPPORTED.
+func NewClient(rw io.ReadWriter) *Client {
+	b := newBearer(rw)
+	b.client = newClient(b)
+	go b.serve()
+	return b.client
+}
+
+// OnNotification sets the handler of notifications and indications. The
+// indication is confirmed after the handler returns.
+func (self *Client) OnNotification(handler func(handle uint16, value []byte, indication bool)) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.handler = handler
+}
+
+func (self *Client) notification(data []byte) {
+	pdu, err := Parse(data)
+	if err != nil {
+		return
+	}
+	self.lock.Lock()
+	handler := self.handler
+	self.lock.Unlock()
+
+	switch p := pdu.(type) {
+	case HandleValueNtf:
+		if handler != nil {
+			handler(p.Handle, p.Value, false)
+		}
+	case MultiHandleValueNtf:
+		if handler != nil {
+			for _, v := range p.Values {
+				handler(v.Handle, v.Value, false)
+			}
+		}
+	case HandleValueInd:
+		if handler != nil {
+			handler(p.Handle, p.Value, true)
+		}
+		// the reader must not block on the write
+		go self.bearer.send(HandleValueCfm{})
+	}
+}
+
+func (self *Client) response(data []byte) {
+	pdu, err := Parse(data)
+	self.lock.Lock()
+	c := self.pending
+	if c == nil {
+		self.lock.Unlock()
+		return
+	}
+	if err != nil {
+		// the malformed response of the request fails it, instead of
+		// waiting for the transaction timeout
+		if data[0] != self.reqOp+1 {
+			self.lock.Unlock()
+			return
+		}
+	} else if e, ok := pdu.(ErrorRsp); ok {
+		if e.ReqOpcode != self.reqOp {
+			self.lock.Unlock()
+			return
+		}
+	} else if pdu.Opcode() != self.reqOp+1 {
+		self.lock.Unlock()
+		return
+	}
+	self.pending = nil
+	self.timer.Stop()
+	self.lock.Unlock()
+
+	c <- result{pdu, err}
+	<-self.sem
+}
+
+// MTU returns the current ATT_MTU.
+func (self *Client) MTU() int {
+	return self.bearer.getMtu()
+}
+
+// Err returns the error that closed the bearer.
+func (self *Client) Err() error {
+	return self.bearer.error()
+}
+
+// do sends the request and waits for the response. The transaction
+// continues after ctx is done, so that the next request waits for it.
+func (self *Client) do(ctx context.Context, req PDU) (PDU, error) {
+	b := self.bearer
+	select {
+	case self.sem <- struct{}{}:
+	case <-b.done:
+		return nil, b.error()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c := make(chan result, 1)
+	self.lock.Lock()
+	self.pending = c
+	self.reqOp = req.Opcode()
+	self.timer = time.AfterFunc(TRANSACTION_TIMEOUT, func() {
+		b.fail(ErrTimeout)
+	})
+	self.lock.Unlock()
+
+	if err := b.send(req); err != nil {
+		self.lock.Lock()
+		self.pending = nil
+		self.timer.Stop()
+		self.lock.Unlock()
+		<-self.sem
+		return nil, err
+	}
+
+	select {
+	case r := <-c:
+		if r.err != nil {
+			return nil, r.err
+		}
+		pdu := r.pdu
+		if e, ok := pdu.(ErrorRsp); ok {
+			return nil, &Error{
+				ReqOpcode: e.ReqOpcode,
+				Handle:    e.Handle,
+				Code:      e.Code,
+			}
+		}
+		return pdu, nil
+	case <-b.done:
+		return nil, b.error()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ExchangeMTU tells the receive MTU of the client, and returns the ATT_MTU
+// that both sides use.
+func (self *Client) ExchangeMTU(ctx context.Context, mtu int) (int, error) {
+	if rsp, err := self.do(ctx, MtuReq{MTU: uint16(mtu)}); err != nil {
+		return 0, err
+	} else {
+		if server := int(rsp.(MtuRsp).MTU); server < mtu {
+			mtu = server
+		}
+		self.bearer.setMtu(mtu)
+		return self.bearer.getMtu(), nil
+	}
+}
+
+func (self *Client) FindInformation(ctx context.Context, start, end uint16) ([]HandleInfo, error) {
+	if rsp, err := self.do(ctx, FindInfoReq{Start: start, End: end}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(FindInfoRsp).Info, nil
+	}
+}
+
+func (self *Client) FindByTypeValue(ctx context.Context, start, end, typ uint16, value []byte) ([]HandleRange, error) {
+	if rsp, err := self.do(ctx, FindByTypeValueReq{
+		Start: start,
+		End:   end,
+		Type:  typ,
+		Value: value,
+	}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(FindByTypeValueRsp).Ranges, nil
+	}
+}
+
+func (self *Client) ReadByType(ctx context.Context, start, end uint16, typ uuid.UUID) ([]HandleValue, error) {
+	if rsp, err := self.do(ctx, ReadByTypeReq{
+		Start: start,
+		End:   end,
+		Type:  typ,
+	}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadByTypeRsp).Data, nil
+	}
+}
+
+func (self *Client) ReadByGroupType(ctx context.Context, start, end uint16, typ uuid.UUID) ([]GroupValue, error) {
+	if rsp, err := self.do(ctx, ReadByGroupTypeReq{
+		Start: start,
+		End:   end,
+		Type:  typ,
+	}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadByGroupTypeRsp).Data, nil
+	}
+}
+
+func (self *Client) Read(ctx context.Context, handle uint16) ([]byte, error) {
+	if rsp, err := self.do(ctx, ReadReq{Handle: handle}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadRsp).Value, nil
+	}
+}
+
+func (self *Client) ReadBlob(ctx context.Context, handle, offset uint16) ([]byte, error) {
+	if rsp, err := self.do(ctx, ReadBlobReq{Handle: handle, Offset: offset}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadBlobRsp).Value, nil
+	}
+}
+
+// ReadLong reads the whole value with Read Blob Requests following Read
+// Request, while the response fills the MTU.
+func (self *Client) ReadLong(ctx context.Context, handle uint16) ([]byte, error) {
+	value, err := self.Read(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < self.MTU()-1 {
+		return value, nil
+	}
+	for len(value) < MAX_VALUE_LEN {
+		part, err := self.ReadBlob(ctx, handle, uint16(len(value)))
+		if e, ok := err.(*Error); ok && (e.Code == ECODE_ATTR_NOT_LONG || e.Code == ECODE_INVALID_OFFSET) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		value = append(value, part...)
+		if len(part) < self.MTU()-1 {
+			break
+		}
+	}
+	return value, nil
+}
+
+func (self *Client) ReadMultiple(ctx context.Context, handles ...uint16) ([]byte, error) {
+	if rsp, err := self.do(ctx, ReadMultiReq{Handles: handles}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadMultiRsp).Values, nil
+	}
+}
+
+func (self *Client) ReadMultipleVariable(ctx context.Context, handles ...uint16) ([][]byte, error) {
+	if rsp, err := self.do(ctx, ReadMultiVarReq{Handles: handles}); err != nil {
+		return nil, err
+	} else {
+		return rsp.(ReadMultiVarRsp).Values, nil
+	}
+}
+
+func (self *Client) Write(ctx context.Context, handle uint16, value []byte) error {
+	_, err := self.do(ctx, WriteReq{Handle: handle, Value: value})
+	return err
+}
+
+// WriteCommand writes without response.
+func (self *Client) WriteCommand(handle uint16, value []byte) error {
+	if err := self.bearer.error(); err != nil {
+		return err
+	}
+	return self.bearer.send(WriteCmd{Handle: handle, Value: value})
+}
+
+func (self *Client) PrepareWrite(ctx context.Context, handle, offset uint16, value []byte) (PrepareWriteRsp, error) {
+	if rsp, err := self.do(ctx, PrepareWriteReq{
+		Handle: handle,
+		Offset: offset,
+		Value:  value,
+	}); err != nil {
+		return PrepareWriteRsp{}, err
+	} else {
+		return rsp.(PrepareWriteRsp), nil
+	}
+}
+
+// ExecuteWrite commits, or cancels when commit is false, the prepared
+// writes.
+func (self *Client) ExecuteWrite(ctx context.Context, commit bool) error {
+	flags := uint8(EXEC_CANCEL)
+	if commit {
+		flags = EXEC_WRITE
+	}
+	_, err := self.do(ctx, ExecuteWriteReq{Flags: flags})
+	return err
+}
+
+// WriteLong writes the value with Prepare Write Requests, verifying the
+// echoed parts, and commits them.
+func (self *Client) WriteLong(ctx context.Context, handle uint16, value []byte) error {
+	for off := 0; ; {
+		end := off + self.MTU() - 5
+		if end > len(value) {
+			end = len(value)
+		}
+		rsp, err := self.PrepareWrite(ctx, handle, uint16(off), value[off:end])
+		if err != nil {
+			return err
+		} else if rsp.Handle != handle || int(rsp.Offset) != off || !bytes.Equal(rsp.Value, value[off:end]) {
+			self.ExecuteWrite(ctx, false)
+			return fmt.Errorf("att: prepared value mismatch")
+		}
+		if off = end; off >= len(value) {
+			break
+		}
+	}
+	return self.ExecuteWrite(ctx, true)
+}
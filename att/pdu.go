@@ -0,0 +1,988 @@
+package att
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// PDU is an attribute protocol PDU. MarshalBinary includes the opcode.
+type PDU interface {
+	Opcode() uint8
+	MarshalBinary() ([]byte, error)
+}
+
+func le16(b []byte) uint16 {
+	return binary.LittleEndian.Uint16(b)
+}
+
+func put16(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = append(b, uint8(v), uint8(v>>8))
+	}
+	return b
+}
+
+func tooShort(op uint8) error {
+	return fmt.Errorf("att: too short pdu 0x%02x", op)
+}
+
+type HandleInfo struct {
+	Handle uint16
+	UUID   uuid.UUID
+}
+
+type HandleRange struct {
+	Found uint16
+	End   uint16
+}
+
+type HandleValue struct {
+	Handle uint16
+	Value  []byte
+}
+
+type GroupValue struct {
+	Handle uint16
+	End    uint16
+	Value  []byte
+}
+
+type ErrorRsp struct {
+	ReqOpcode uint8
+	Handle    uint16
+	Code      ErrorCode
+}
+
+func (self ErrorRsp) Opcode() uint8 { return ERROR_RSP }
+
+func (self ErrorRsp) MarshalBinary() ([]byte, error) {
+	return []byte{ERROR_RSP, self.ReqOpcode, uint8(self.Handle), uint8(self.Handle >> 8), uint8(self.Code)}, nil
+}
+
+func (self *ErrorRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return tooShort(ERROR_RSP)
+	}
+	self.ReqOpcode = data[1]
+	self.Handle = le16(data[2:])
+	self.Code = ErrorCode(data[4])
+	return nil
+}
+
+type MtuReq struct {
+	MTU uint16
+}
+
+func (self MtuReq) Opcode() uint8 { return MTU_REQ }
+
+func (self MtuReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{MTU_REQ}, self.MTU), nil
+}
+
+func (self *MtuReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(MTU_REQ)
+	}
+	self.MTU = le16(data[1:])
+	return nil
+}
+
+type MtuRsp struct {
+	MTU uint16
+}
+
+func (self MtuRsp) Opcode() uint8 { return MTU_RSP }
+
+func (self MtuRsp) MarshalBinary() ([]byte, error) {
+	return put16([]byte{MTU_RSP}, self.MTU), nil
+}
+
+func (self *MtuRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(MTU_RSP)
+	}
+	self.MTU = le16(data[1:])
+	return nil
+}
+
+type FindInfoReq struct {
+	Start uint16
+	End   uint16
+}
+
+func (self FindInfoReq) Opcode() uint8 { return FIND_INFO_REQ }
+
+func (self FindInfoReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{FIND_INFO_REQ}, self.Start, self.End), nil
+}
+
+func (self *FindInfoReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return tooShort(FIND_INFO_REQ)
+	}
+	self.Start = le16(data[1:])
+	self.End = le16(data[3:])
+	return nil
+}
+
+// FindInfoRsp carries UUIDs of the same length.
+type FindInfoRsp struct {
+	Info []HandleInfo
+}
+
+func (self FindInfoRsp) Opcode() uint8 { return FIND_INFO_RSP }
+
+func (self FindInfoRsp) MarshalBinary() ([]byte, error) {
+	if len(self.Info) == 0 {
+		return nil, fmt.Errorf("att: empty find information response")
+	}
+	size := len(self.Info[0].UUID)
+	format := uint8(1)
+	if size == 16 {
+		format = 2
+	} else if size != 2 {
+		return nil, fmt.Errorf("att: invalid uuid length")
+	}
+	ret := []byte{FIND_INFO_RSP, format}
+	for _, info := range self.Info {
+		if len(info.UUID) != size {
+			return nil, fmt.Errorf("att: mixed uuid length")
+		}
+		ret = append(put16(ret, info.Handle), info.UUID...)
+	}
+	return ret, nil
+}
+
+func (self *FindInfoRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return tooShort(FIND_INFO_RSP)
+	}
+	size := 2
+	if data[1] == 2 {
+		size = 16
+	} else if data[1] != 1 {
+		return fmt.Errorf("att: unknown format %d", data[1])
+	} else if len(data) < 2+2+size {
+		return tooShort(FIND_INFO_RSP)
+	}
+	self.Info = nil
+	for p := data[2:]; len(p) > 0; p = p[2+size:] {
+		if len(p) < 2+size {
+			return tooShort(FIND_INFO_RSP)
+		}
+		self.Info = append(self.Info, HandleInfo{
+			Handle: le16(p),
+			UUID:   append(uuid.UUID(nil), p[2:2+size]...),
+		})
+	}
+	return nil
+}
+
+type FindByTypeValueReq struct {
+	Start uint16
+	End   uint16
+	Type  uint16
+	Value []byte
+}
+
+func (self FindByTypeValueReq) Opcode() uint8 { return FIND_BY_TYPE_VALUE_REQ }
+
+func (self FindByTypeValueReq) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{FIND_BY_TYPE_VALUE_REQ}, self.Start, self.End, self.Type), self.Value...), nil
+}
+
+func (self *FindByTypeValueReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return tooShort(FIND_BY_TYPE_VALUE_REQ)
+	}
+	self.Start = le16(data[1:])
+	self.End = le16(data[3:])
+	self.Type = le16(data[5:])
+	self.Value = data[7:]
+	return nil
+}
+
+type FindByTypeValueRsp struct {
+	Ranges []HandleRange
+}
+
+func (self FindByTypeValueRsp) Opcode() uint8 { return FIND_BY_TYPE_VALUE_RSP }
+
+func (self FindByTypeValueRsp) MarshalBinary() ([]byte, error) {
+	ret := []byte{FIND_BY_TYPE_VALUE_RSP}
+	for _, r := range self.Ranges {
+		ret = put16(ret, r.Found, r.End)
+	}
+	return ret, nil
+}
+
+func (self *FindByTypeValueRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 || len(data)%4 != 1 {
+		return tooShort(FIND_BY_TYPE_VALUE_RSP)
+	}
+	self.Ranges = nil
+	for p := data[1:]; len(p) >= 4; p = p[4:] {
+		self.Ranges = append(self.Ranges, HandleRange{
+			Found: le16(p),
+			End:   le16(p[2:]),
+		})
+	}
+	return nil
+}
+
+type ReadByTypeReq struct {
+	Start uint16
+	End   uint16
+	Type  uuid.UUID
+}
+
+func (self ReadByTypeReq) Opcode() uint8 { return READ_BY_TYPE_REQ }
+
+func (self ReadByTypeReq) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{READ_BY_TYPE_REQ}, self.Start, self.End), self.Type...), nil
+}
+
+func (self *ReadByTypeReq) UnmarshalBinary(data []byte) error {
+	if len(data) != 7 && len(data) != 21 {
+		return tooShort(READ_BY_TYPE_REQ)
+	}
+	self.Start = le16(data[1:])
+	self.End = le16(data[3:])
+	self.Type = uuid.UUID(data[5:])
+	return nil
+}
+
+// ReadByTypeRsp carries values of the same length.
+type ReadByTypeRsp struct {
+	Data []HandleValue
+}
+
+func (self ReadByTypeRsp) Opcode() uint8 { return READ_BY_TYPE_RSP }
+
+func (self ReadByTypeRsp) MarshalBinary() ([]byte, error) {
+	if len(self.Data) == 0 {
+		return nil, fmt.Errorf("att: empty read by type response")
+	}
+	size := len(self.Data[0].Value)
+	if size > 253 {
+		return nil, fmt.Errorf("att: value too long")
+	}
+	ret := []byte{READ_BY_TYPE_RSP, uint8(2 + size)}
+	for _, d := range self.Data {
+		if len(d.Value) != size {
+			return nil, fmt.Errorf("att: mixed value length")
+		}
+		ret = append(put16(ret, d.Handle), d.Value...)
+	}
+	return ret, nil
+}
+
+func (self *ReadByTypeRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[1] < 2 || len(data) < 2+int(data[1]) {
+		return tooShort(READ_BY_TYPE_RSP)
+	}
+	size := int(data[1])
+	self.Data = nil
+	for p := data[2:]; len(p) > 0; p = p[size:] {
+		if len(p) < size {
+			return tooShort(READ_BY_TYPE_RSP)
+		}
+		self.Data = append(self.Data, HandleValue{
+			Handle: le16(p),
+			Value:  p[2:size],
+		})
+	}
+	return nil
+}
+
+type ReadReq struct {
+	Handle uint16
+}
+
+func (self ReadReq) Opcode() uint8 { return READ_REQ }
+
+func (self ReadReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{READ_REQ}, self.Handle), nil
+}
+
+func (self *ReadReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(READ_REQ)
+	}
+	self.Handle = le16(data[1:])
+	return nil
+}
+
+type ReadRsp struct {
+	Value []byte
+}
+
+func (self ReadRsp) Opcode() uint8 { return READ_RSP }
+
+func (self ReadRsp) MarshalBinary() ([]byte, error) {
+	return append([]byte{READ_RSP}, self.Value...), nil
+}
+
+func (self *ReadRsp) UnmarshalBinary(data []byte) error {
+	self.Value = data[1:]
+	return nil
+}
+
+type ReadBlobReq struct {
+	Handle uint16
+	Offset uint16
+}
+
+func (self ReadBlobReq) Opcode() uint8 { return READ_BLOB_REQ }
+
+func (self ReadBlobReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{READ_BLOB_REQ}, self.Handle, self.Offset), nil
+}
+
+func (self *ReadBlobReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return tooShort(READ_BLOB_REQ)
+	}
+	self.Handle = le16(data[1:])
+	self.Offset = le16(data[3:])
+	return nil
+}
+
+type ReadBlobRsp struct {
+	Value []byte
+}
+
+func (self ReadBlobRsp) Opcode() uint8 { return READ_BLOB_RSP }
+
+func (self ReadBlobRsp) MarshalBinary() ([]byte, error) {
+	return append([]byte{READ_BLOB_RSP}, self.Value...), nil
+}
+
+func (self *ReadBlobRsp) UnmarshalBinary(data []byte) error {
+	self.Value = data[1:]
+	return nil
+}
+
+type ReadMultiReq struct {
+	Handles []uint16
+}
+
+func (self ReadMultiReq) Opcode() uint8 { return READ_MULTI_REQ }
+
+func (self ReadMultiReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{READ_MULTI_REQ}, self.Handles...), nil
+}
+
+func (self *ReadMultiReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 || len(data)%2 != 1 {
+		return tooShort(READ_MULTI_REQ)
+	}
+	self.Handles = nil
+	for p := data[1:]; len(p) >= 2; p = p[2:] {
+		self.Handles = append(self.Handles, le16(p))
+	}
+	return nil
+}
+
+// ReadMultiRsp is the concatenation of the values, which the client must
+// split by the known lengths.
+type ReadMultiRsp struct {
+	Values []byte
+}
+
+func (self ReadMultiRsp) Opcode() uint8 { return READ_MULTI_RSP }
+
+func (self ReadMultiRsp) MarshalBinary() ([]byte, error) {
+	return append([]byte{READ_MULTI_RSP}, self.Values...), nil
+}
+
+func (self *ReadMultiRsp) UnmarshalBinary(data []byte) error {
+	self.Values = data[1:]
+	return nil
+}
+
+type ReadByGroupTypeReq struct {
+	Start uint16
+	End   uint16
+	Type  uuid.UUID
+}
+
+func (self ReadByGroupTypeReq) Opcode() uint8 { return READ_BY_GROUP_TYPE_REQ }
+
+func (self ReadByGroupTypeReq) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{READ_BY_GROUP_TYPE_REQ}, self.Start, self.End), self.Type...), nil
+}
+
+func (self *ReadByGroupTypeReq) UnmarshalBinary(data []byte) error {
+	if len(data) != 7 && len(data) != 21 {
+		return tooShort(READ_BY_GROUP_TYPE_REQ)
+	}
+	self.Start = le16(data[1:])
+	self.End = le16(data[3:])
+	self.Type = uuid.UUID(data[5:])
+	return nil
+}
+
+// ReadByGroupTypeRsp carries values of the same length.
+type ReadByGroupTypeRsp struct {
+	Data []GroupValue
+}
+
+func (self ReadByGroupTypeRsp) Opcode() uint8 { return READ_BY_GROUP_TYPE_RSP }
+
+func (self ReadByGroupTypeRsp) MarshalBinary() ([]byte, error) {
+	if len(self.Data) == 0 {
+		return nil, fmt.Errorf("att: empty read by group type response")
+	}
+	size := len(self.Data[0].Value)
+	if size > 251 {
+		return nil, fmt.Errorf("att: value too long")
+	}
+	ret := []byte{READ_BY_GROUP_TYPE_RSP, uint8(4 + size)}
+	for _, d := range self.Data {
+		if len(d.Value) != size {
+			return nil, fmt.Errorf("att: mixed value length")
+		}
+		ret = append(put16(ret, d.Handle, d.End), d.Value...)
+	}
+	return ret, nil
+}
+
+func (self *ReadByGroupTypeRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[1] < 4 || len(data) < 2+int(data[1]) {
+		return tooShort(READ_BY_GROUP_TYPE_RSP)
+	}
+	size := int(data[1])
+	self.Data = nil
+	for p := data[2:]; len(p) > 0; p = p[size:] {
+		if len(p) < size {
+			return tooShort(READ_BY_GROUP_TYPE_RSP)
+		}
+		self.Data = append(self.Data, GroupValue{
+			Handle: le16(p),
+			End:    le16(p[2:]),
+			Value:  p[4:size],
+		})
+	}
+	return nil
+}
+
+type WriteReq struct {
+	Handle uint16
+	Value  []byte
+}
+
+func (self WriteReq) Opcode() uint8 { return WRITE_REQ }
+
+func (self WriteReq) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{WRITE_REQ}, self.Handle), self.Value...), nil
+}
+
+func (self *WriteReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(WRITE_REQ)
+	}
+	self.Handle = le16(data[1:])
+	self.Value = data[3:]
+	return nil
+}
+
+type WriteRsp struct{}
+
+func (self WriteRsp) Opcode() uint8 { return WRITE_RSP }
+
+func (self WriteRsp) MarshalBinary() ([]byte, error) {
+	return []byte{WRITE_RSP}, nil
+}
+
+func (self *WriteRsp) UnmarshalBinary(data []byte) error {
+	return nil
+}
+
+type WriteCmd struct {
+	Handle uint16
+	Value  []byte
+}
+
+func (self WriteCmd) Opcode() uint8 { return WRITE_CMD }
+
+func (self WriteCmd) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{WRITE_CMD}, self.Handle), self.Value...), nil
+}
+
+func (self *WriteCmd) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(WRITE_CMD)
+	}
+	self.Handle = le16(data[1:])
+	self.Value = data[3:]
+	return nil
+}
+
+// SignedWriteCmd carries the authentication signature made with CSRK,
+// sign counter followed by the MAC.
+type SignedWriteCmd struct {
+	Handle    uint16
+	Value     []byte
+	Signature [12]byte
+}
+
+func (self SignedWriteCmd) Opcode() uint8 { return SIGNED_WRITE_CMD }
+
+func (self SignedWriteCmd) MarshalBinary() ([]byte, error) {
+	ret := append(put16([]byte{SIGNED_WRITE_CMD}, self.Handle), self.Value...)
+	return append(ret, self.Signature[:]...), nil
+}
+
+func (self *SignedWriteCmd) UnmarshalBinary(data []byte) error {
+	if len(data) < 15 {
+		return tooShort(SIGNED_WRITE_CMD)
+	}
+	self.Handle = le16(data[1:])
+	self.Value = data[3 : len(data)-12]
+	copy(self.Signature[:], data[len(data)-12:])
+	return nil
+}
+
+type PrepareWriteReq struct {
+	Handle uint16
+	Offset uint16
+	Value  []byte
+}
+
+func (self PrepareWriteReq) Opcode() uint8 { return PREPARE_WRITE_REQ }
+
+func (self PrepareWriteReq) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{PREPARE_WRITE_REQ}, self.Handle, self.Offset), self.Value...), nil
+}
+
+func (self *PrepareWriteReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return tooShort(PREPARE_WRITE_REQ)
+	}
+	self.Handle = le16(data[1:])
+	self.Offset = le16(data[3:])
+	self.Value = data[5:]
+	return nil
+}
+
+type PrepareWriteRsp struct {
+	Handle uint16
+	Offset uint16
+	Value  []byte
+}
+
+func (self PrepareWriteRsp) Opcode() uint8 { return PREPARE_WRITE_RSP }
+
+func (self PrepareWriteRsp) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{PREPARE_WRITE_RSP}, self.Handle, self.Offset), self.Value...), nil
+}
+
+func (self *PrepareWriteRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return tooShort(PREPARE_WRITE_RSP)
+	}
+	self.Handle = le16(data[1:])
+	self.Offset = le16(data[3:])
+	self.Value = data[5:]
+	return nil
+}
+
+type ExecuteWriteReq struct {
+	Flags uint8
+}
+
+func (self ExecuteWriteReq) Opcode() uint8 { return EXECUTE_WRITE_REQ }
+
+func (self ExecuteWriteReq) MarshalBinary() ([]byte, error) {
+	return []byte{EXECUTE_WRITE_REQ, self.Flags}, nil
+}
+
+func (self *ExecuteWriteReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return tooShort(EXECUTE_WRITE_REQ)
+	}
+	self.Flags = data[1]
+	return nil
+}
+
+type ExecuteWriteRsp struct{}
+
+func (self ExecuteWriteRsp) Opcode() uint8 { return EXECUTE_WRITE_RSP }
+
+func (self ExecuteWriteRsp) MarshalBinary() ([]byte, error) {
+	return []byte{EXECUTE_WRITE_RSP}, nil
+}
+
+func (self *ExecuteWriteRsp) UnmarshalBinary(data []byte) error {
+	return nil
+}
+
+type HandleValueNtf struct {
+	Handle uint16
+	Value  []byte
+}
+
+func (self HandleValueNtf) Opcode() uint8 { return HANDLE_VALUE_NTF }
+
+func (self HandleValueNtf) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{HANDLE_VALUE_NTF}, self.Handle), self.Value...), nil
+}
+
+func (self *HandleValueNtf) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(HANDLE_VALUE_NTF)
+	}
+	self.Handle = le16(data[1:])
+	self.Value = data[3:]
+	return nil
+}
+
+type HandleValueInd struct {
+	Handle uint16
+	Value  []byte
+}
+
+func (self HandleValueInd) Opcode() uint8 { return HANDLE_VALUE_IND }
+
+func (self HandleValueInd) MarshalBinary() ([]byte, error) {
+	return append(put16([]byte{HANDLE_VALUE_IND}, self.Handle), self.Value...), nil
+}
+
+func (self *HandleValueInd) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return tooShort(HANDLE_VALUE_IND)
+	}
+	self.Handle = le16(data[1:])
+	self.Value = data[3:]
+	return nil
+}
+
+type HandleValueCfm struct{}
+
+func (self HandleValueCfm) Opcode() uint8 { return HANDLE_VALUE_CFM }
+
+func (self HandleValueCfm) MarshalBinary() ([]byte, error) {
+	return []byte{HANDLE_VALUE_CFM}, nil
+}
+
+func (self *HandleValueCfm) UnmarshalBinary(data []byte) error {
+	return nil
+}
+
+type ReadMultiVarReq struct {
+	Handles []uint16
+}
+
+func (self ReadMultiVarReq) Opcode() uint8 { return READ_MULTI_VAR_REQ }
+
+func (self ReadMultiVarReq) MarshalBinary() ([]byte, error) {
+	return put16([]byte{READ_MULTI_VAR_REQ}, self.Handles...), nil
+}
+
+func (self *ReadMultiVarReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 || len(data)%2 != 1 {
+		return tooShort(READ_MULTI_VAR_REQ)
+	}
+	self.Handles = nil
+	for p := data[1:]; len(p) >= 2; p = p[2:] {
+		self.Handles = append(self.Handles, le16(p))
+	}
+	return nil
+}
+
+// ReadMultiVarRsp carries length prefixed values. The last value may be
+// truncated by the MTU.
+type ReadMultiVarRsp struct {
+	Values [][]byte
+}
+
+func (self ReadMultiVarRsp) Opcode() uint8 { return READ_MULTI_VAR_RSP }
+
+func (self ReadMultiVarRsp) MarshalBinary() ([]byte, error) {
+	ret := []byte{READ_MULTI_VAR_RSP}
+	for _, v := range self.Values {
+		ret = append(put16(ret, uint16(len(v))), v...)
+	}
+	return ret, nil
+}
+
+func (self *ReadMultiVarRsp) UnmarshalBinary(data []byte) error {
+	self.Values = nil
+	for p := data[1:]; len(p) > 0; {
+		if len(p) < 2 {
+			return tooShort(READ_MULTI_VAR_RSP)
+		}
+		n := int(le16(p))
+		p = p[2:]
+		if n > len(p) {
+			n = len(p)
+		}
+		self.Values = append(self.Values, p[:n])
+		p = p[n:]
+	}
+	return nil
+}
+
+type MultiHandleValueNtf struct {
+	Values []HandleValue
+}
+
+func (self MultiHandleValueNtf) Opcode() uint8 { return MULTI_HANDLE_VALUE_NTF }
+
+func (self MultiHandleValueNtf) MarshalBinary() ([]byte, error) {
+	ret := []byte{MULTI_HANDLE_VALUE_NTF}
+	for _, v := range self.Values {
+		ret = append(put16(ret, v.Handle, uint16(len(v.Value))), v.Value...)
+	}
+	return ret, nil
+}
+
+func (self *MultiHandleValueNtf) UnmarshalBinary(data []byte) error {
+	self.Values = nil
+	for p := data[1:]; len(p) > 0; {
+		if len(p) < 4 {
+			return tooShort(MULTI_HANDLE_VALUE_NTF)
+		}
+		n := int(le16(p[2:]))
+		if len(p) < 4+n {
+			return tooShort(MULTI_HANDLE_VALUE_NTF)
+		}
+		self.Values = append(self.Values, HandleValue{
+			Handle: le16(p),
+			Value:  p[4 : 4+n],
+		})
+		p = p[4+n:]
+	}
+	return nil
+}
+
+// Parse decodes a PDU. Value slices of the result refer to data.
+func Parse(data []byte) (PDU, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("att: empty pdu")
+	}
+	switch data[0] {
+	case ERROR_RSP:
+		pdu := ErrorRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case MTU_REQ:
+		pdu := MtuReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case MTU_RSP:
+		pdu := MtuRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case FIND_INFO_REQ:
+		pdu := FindInfoReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case FIND_INFO_RSP:
+		pdu := FindInfoRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case FIND_BY_TYPE_VALUE_REQ:
+		pdu := FindByTypeValueReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case FIND_BY_TYPE_VALUE_RSP:
+		pdu := FindByTypeValueRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BY_TYPE_REQ:
+		pdu := ReadByTypeReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BY_TYPE_RSP:
+		pdu := ReadByTypeRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_REQ:
+		pdu := ReadReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_RSP:
+		pdu := ReadRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BLOB_REQ:
+		pdu := ReadBlobReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BLOB_RSP:
+		pdu := ReadBlobRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_MULTI_REQ:
+		pdu := ReadMultiReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_MULTI_RSP:
+		pdu := ReadMultiRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BY_GROUP_TYPE_REQ:
+		pdu := ReadByGroupTypeReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_BY_GROUP_TYPE_RSP:
+		pdu := ReadByGroupTypeRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case WRITE_REQ:
+		pdu := WriteReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case WRITE_RSP:
+		pdu := WriteRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case WRITE_CMD:
+		pdu := WriteCmd{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case SIGNED_WRITE_CMD:
+		pdu := SignedWriteCmd{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case PREPARE_WRITE_REQ:
+		pdu := PrepareWriteReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case PREPARE_WRITE_RSP:
+		pdu := PrepareWriteRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case EXECUTE_WRITE_REQ:
+		pdu := ExecuteWriteReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case EXECUTE_WRITE_RSP:
+		pdu := ExecuteWriteRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case HANDLE_VALUE_NTF:
+		pdu := HandleValueNtf{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case HANDLE_VALUE_IND:
+		pdu := HandleValueInd{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case HANDLE_VALUE_CFM:
+		pdu := HandleValueCfm{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_MULTI_VAR_REQ:
+		pdu := ReadMultiVarReq{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case READ_MULTI_VAR_RSP:
+		pdu := ReadMultiVarRsp{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	case MULTI_HANDLE_VALUE_NTF:
+		pdu := MultiHandleValueNtf{}
+		if err := pdu.UnmarshalBinary(data); err != nil {
+			return nil, err
+		} else {
+			return pdu, nil
+		}
+	default:
+		return nil, fmt.Errorf("att: unknown opcode 0x%02x", data[0])
+	}
+}
@@ -0,0 +1,606 @@
+package att
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Attribute permissions
+const (
+	PERM_READ          = 0x01
+	PERM_WRITE         = 0x02
+	PERM_READ_ENCRYPT  = 0x04
+	PERM_WRITE_ENCRYPT = 0x08
+	PERM_READ_AUTHEN   = 0x10
+	PERM_WRITE_AUTHEN  = 0x20
+)
+
+// Security levels of the link that the server checks the permissions with.
+const (
+	SECURITY_LOW    = 1 // no encryption
+	SECURITY_MEDIUM = 2 // encrypted
+	SECURITY_HIGH   = 3 // encrypted with an authenticated key
+)
+
+const maxPrepareQueue = 64
+
+// Attribute of the server database. Read and Write override the static
+// Value; an ErrorCode returned by them is sent in Error Response.
+type Attribute struct {
+	Handle   uint16
+	Type     uuid.UUID
+	Perm     uint8
+	Value    []byte
+	EndGroup uint16 // last handle of the group, for grouping types
+	Read     func(server *Server, offset int) ([]byte, error)
+	Write    func(server *Server, value []byte) error
+}
+
+// DB is the attribute database, which servers of many connections share.
+type DB struct {
+	lock  sync.RWMutex
+	attrs []*Attribute // ordered by handle
+}
+
+func NewDB() *DB {
+	return &DB{}
+}
+
+// Add inserts the attribute.
+func (self *DB) Add(attr *Attribute) error {
+	if attr.Handle == 0 {
+		return fmt.Errorf("att: invalid handle 0")
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	i := sort.Search(len(self.attrs), func(i int) bool {
+		return self.attrs[i].Handle >= attr.Handle
+	})
+	if i < len(self.attrs) && self.attrs[i].Handle == attr.Handle {
+		return fmt.Errorf("att: handle 0x%04x in use", attr.Handle)
+	}
+	self.attrs = append(self.attrs, nil)
+	copy(self.attrs[i+1:], self.attrs[i:])
+	self.attrs[i] = attr
+	return nil
+}
+
+// Remove deletes the attributes in the handle range.
+func (self *DB) Remove(start, end uint16) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var attrs []*Attribute
+	for _, attr := range self.attrs {
+		if attr.Handle < start || attr.Handle > end {
+			attrs = append(attrs, attr)
+		}
+	}
+	self.attrs = attrs
+}
+
+func (self *DB) Attribute(handle uint16) *Attribute {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	i := sort.Search(len(self.attrs), func(i int) bool {
+		return self.attrs[i].Handle >= handle
+	})
+	if i < len(self.attrs) && self.attrs[i].Handle == handle {
+		return self.attrs[i]
+	}
+	return nil
+}
+
+// Range returns the attributes in the handle range.
+func (self *DB) Range(start, end uint16) []*Attribute {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	var ret []*Attribute
+	for _, attr := range self.attrs {
+		if attr.Handle >= start && attr.Handle <= end {
+			ret = append(ret, attr)
+		}
+	}
+	return ret
+}
+
+// Server answers requests from the client of the peer with the database.
+type Server struct {
+	bearer *bearer
+	db     *DB
+
+	lock     sync.Mutex
+	rxMtu    int
+	security int
+	queue    []PrepareWriteReq
+
+	indSem chan struct{}
+	cfm    chan struct{}
+}
+
+func newServer(b *bearer, db *DB) *Server {
+	return &Server{
+		bearer:   b,
+		db:       db,
+		rxMtu:    MAX_MTU,
+		security: SECURITY_LOW,
+		indSem:   make(chan struct{}, 1),
+		cfm:      make(chan struct{}, 1),
+	}
+}
+
+// NewServer serves the server role on the channel. Notifications from the
+// peer are dropped.
+func NewServer(rw io.ReadWriter, db *DB) *Server {
+	b := newBearer(rw)
+	b.server = newServer(b, db)
+	go b.serve()
+	return b.server
+}
+
+// DB returns the database of the server.
+func (self *Server) DB() *DB {
+	return self.db
+}
+
+// MTU returns the current ATT_MTU.
+func (self *Server) MTU() int {
+	return self.bearer.getMtu()
+}
+
+// SetReceiveMTU sets the MTU that is offered in Exchange MTU Response.
+func (self *Server) SetReceiveMTU(mtu int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.rxMtu = mtu
+}
+
+// SetSecurity tells the security level of the link, SECURITY_*.
+func (self *Server) SetSecurity(level int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.security = level
+}
+
+// Err returns the error that closed the bearer.
+func (self *Server) Err() error {
+	return self.bearer.error()
+}
+
+func (self *Server) check(attr *Attribute, write bool) ErrorCode {
+	self.lock.Lock()
+	security := self.security
+	self.lock.Unlock()
+
+	perm, enc, authen := uint8(PERM_READ), uint8(PERM_READ_ENCRYPT), uint8(PERM_READ_AUTHEN)
+	if write {
+		perm, enc, authen = PERM_WRITE, PERM_WRITE_ENCRYPT, PERM_WRITE_AUTHEN
+	}
+	if attr.Perm&(perm|enc|authen) == 0 {
+		if write {
+			return ECODE_WRITE_NOT_PERMITTED
+		}
+		return ECODE_READ_NOT_PERMITTED
+	} else if attr.Perm&authen != 0 && security < SECURITY_HIGH {
+		return ECODE_INSUFFICIENT_AUTHEN
+	} else if attr.Perm&enc != 0 && security < SECURITY_MEDIUM {
+		return ECODE_INSUFFICIENT_ENC
+	}
+	return 0
+}
+
+func errorCode(err error) ErrorCode {
+	if code, ok := err.(ErrorCode); ok {
+		return code
+	}
+	return ECODE_UNLIKELY
+}
+
+func (self *Server) read(attr *Attribute, offset int) ([]byte, ErrorCode) {
+	if code := self.check(attr, false); code != 0 {
+		return nil, code
+	}
+	return self.value(attr, offset)
+}
+
+// value reads the attribute value from offset, without the permission check.
+func (self *Server) value(attr *Attribute, offset int) ([]byte, ErrorCode) {
+	if attr.Read != nil {
+		value, err := attr.Read(self, offset)
+		if err != nil {
+			return nil, errorCode(err)
+		}
+		return value, 0
+	}
+	self.db.lock.RLock()
+	defer self.db.lock.RUnlock()
+	if offset > len(attr.Value) {
+		return nil, ECODE_INVALID_OFFSET
+	}
+	return append([]byte(nil), attr.Value[offset:]...), 0
+}
+
+func (self *Server) write(attr *Attribute, value []byte) ErrorCode {
+	if code := self.check(attr, true); code != 0 {
+		return code
+	}
+	if len(value) > MAX_VALUE_LEN {
+		return ECODE_INVALID_ATTR_VALUE_LEN
+	}
+	if attr.Write != nil {
+		if err := attr.Write(self, value); err != nil {
+			return errorCode(err)
+		}
+		return 0
+	}
+	self.db.lock.Lock()
+	attr.Value = append([]byte(nil), value...)
+	self.db.lock.Unlock()
+	return 0
+}
+
+func truncate(value []byte, n int) []byte {
+	if len(value) > n {
+		return value[:n]
+	}
+	return value
+}
+
+func (self *Server) handle(data []byte) {
+	op := data[0]
+	pdu, err := Parse(data)
+	if err != nil {
+		if op&OP_COMMAND_FLAG == 0 {
+			self.bearer.send(ErrorRsp{ReqOpcode: op, Code: ECODE_INVALID_PDU})
+		}
+		return
+	}
+	if rsp := self.respond(pdu); rsp != nil {
+		self.bearer.send(rsp)
+	}
+}
+
+func (self *Server) respond(pdu PDU) PDU {
+	mtu := self.MTU()
+	fail := func(handle uint16, code ErrorCode) PDU {
+		return ErrorRsp{
+			ReqOpcode: pdu.Opcode(),
+			Handle:    handle,
+			Code:      code,
+		}
+	}
+	validRange := func(start, end uint16) bool {
+		return start != 0 && start <= end
+	}
+
+	switch req := pdu.(type) {
+	case MtuReq:
+		self.lock.Lock()
+		rxMtu := self.rxMtu
+		self.lock.Unlock()
+		mtu := int(req.MTU)
+		if rxMtu < mtu {
+			mtu = rxMtu
+		}
+		self.bearer.setMtu(mtu)
+		return MtuRsp{MTU: uint16(rxMtu)}
+	case FindInfoReq:
+		if !validRange(req.Start, req.End) {
+			return fail(req.Start, ECODE_INVALID_HANDLE)
+		}
+		var rsp FindInfoRsp
+		size := 2
+		for _, attr := range self.db.Range(req.Start, req.End) {
+			if len(rsp.Info) > 0 && len(attr.Type) != len(rsp.Info[0].UUID) {
+				break
+			} else if size+2+len(attr.Type) > mtu {
+				break
+			}
+			size += 2 + len(attr.Type)
+			rsp.Info = append(rsp.Info, HandleInfo{Handle: attr.Handle, UUID: attr.Type})
+		}
+		if len(rsp.Info) == 0 {
+			return fail(req.Start, ECODE_ATTR_NOT_FOUND)
+		}
+		return rsp
+	case FindByTypeValueReq:
+		if !validRange(req.Start, req.End) {
+			return fail(req.Start, ECODE_INVALID_HANDLE)
+		}
+		var rsp FindByTypeValueRsp
+		for _, attr := range self.db.Range(req.Start, req.End) {
+			if !attr.Type.Equal(uuid.UUID16(req.Type)) {
+				continue
+			} else if 1+4*(len(rsp.Ranges)+1) > mtu {
+				break
+			}
+			if value, code := self.read(attr, 0); code != 0 || !bytes.Equal(value, req.Value) {
+				continue
+			}
+			end := attr.Handle
+			if attr.EndGroup > end {
+				end = attr.EndGroup
+			}
+			rsp.Ranges = append(rsp.Ranges, HandleRange{Found: attr.Handle, End: end})
+		}
+		if len(rsp.Ranges) == 0 {
+			return fail(req.Start, ECODE_ATTR_NOT_FOUND)
+		}
+		return rsp
+	case ReadByTypeReq:
+		if !validRange(req.Start, req.End) {
+			return fail(req.Start, ECODE_INVALID_HANDLE)
+		}
+		var rsp ReadByTypeRsp
+		size := 2
+		for _, attr := range self.db.Range(req.Start, req.End) {
+			if !attr.Type.Equal(req.Type) {
+				continue
+			}
+			value, code := self.read(attr, 0)
+			if code != 0 {
+				if len(rsp.Data) == 0 {
+					return fail(attr.Handle, code)
+				}
+				break
+			}
+			value = truncate(truncate(value, mtu-4), 253)
+			if len(rsp.Data) > 0 && len(value) != len(rsp.Data[0].Value) {
+				break
+			} else if size+2+len(value) > mtu {
+				break
+			}
+			size += 2 + len(value)
+			rsp.Data = append(rsp.Data, HandleValue{Handle: attr.Handle, Value: value})
+		}
+		if len(rsp.Data) == 0 {
+			return fail(req.Start, ECODE_ATTR_NOT_FOUND)
+		}
+		return rsp
+	case ReadByGroupTypeReq:
+		if !validRange(req.Start, req.End) {
+			return fail(req.Start, ECODE_INVALID_HANDLE)
+		} else if !req.Type.Equal(uuid.UUID16(UUID_PRIMARY_SERVICE)) && !req.Type.Equal(uuid.UUID16(UUID_SECONDARY_SERVICE)) {
+			return fail(req.Start, ECODE_UNSUPPORTED_GROUP_TYPE)
+		}
+		var rsp ReadByGroupTypeRsp
+		size := 2
+		for _, attr := range self.db.Range(req.Start, req.End) {
+			if !attr.Type.Equal(req.Type) {
+				continue
+			}
+			value, code := self.read(attr, 0)
+			if code != 0 {
+				if len(rsp.Data) == 0 {
+					return fail(attr.Handle, code)
+				}
+				break
+			}
+			value = truncate(truncate(value, mtu-6), 251)
+			if len(rsp.Data) > 0 && len(value) != len(rsp.Data[0].Value) {
+				break
+			} else if size+4+len(value) > mtu {
+				break
+			}
+			size += 4 + len(value)
+			end := attr.Handle
+			if attr.EndGroup > end {
+				end = attr.EndGroup
+			}
+			rsp.Data = append(rsp.Data, GroupValue{Handle: attr.Handle, End: end, Value: value})
+		}
+		if len(rsp.Data) == 0 {
+			return fail(req.Start, ECODE_ATTR_NOT_FOUND)
+		}
+		return rsp
+	case ReadReq:
+		attr := self.db.Attribute(req.Handle)
+		if attr == nil {
+			return fail(req.Handle, ECODE_INVALID_HANDLE)
+		}
+		if value, code := self.read(attr, 0); code != 0 {
+			return fail(req.Handle, code)
+		} else {
+			return ReadRsp{Value: truncate(value, mtu-1)}
+		}
+	case ReadBlobReq:
+		attr := self.db.Attribute(req.Handle)
+		if attr == nil {
+			return fail(req.Handle, ECODE_INVALID_HANDLE)
+		}
+		if value, code := self.read(attr, int(req.Offset)); code != 0 {
+			return fail(req.Handle, code)
+		} else {
+			return ReadBlobRsp{Value: truncate(value, mtu-1)}
+		}
+	case ReadMultiReq:
+		var values []byte
+		for _, h := range req.Handles {
+			attr := self.db.Attribute(h)
+			if attr == nil {
+				return fail(h, ECODE_INVALID_HANDLE)
+			}
+			value, code := self.read(attr, 0)
+			if code != 0 {
+				return fail(h, code)
+			}
+			values = append(values, value...)
+		}
+		return ReadMultiRsp{Values: truncate(values, mtu-1)}
+	case ReadMultiVarReq:
+		var rsp ReadMultiVarRsp
+		size := 1
+		for _, h := range req.Handles {
+			attr := self.db.Attribute(h)
+			if attr == nil {
+				return fail(h, ECODE_INVALID_HANDLE)
+			}
+			value, code := self.read(attr, 0)
+			if code != 0 {
+				return fail(h, code)
+			}
+			if size+2 > mtu {
+				break
+			}
+			value = truncate(value, mtu-size-2)
+			size += 2 + len(value)
+			rsp.Values = append(rsp.Values, value)
+		}
+		return rsp
+	case WriteReq:
+		attr := self.db.Attribute(req.Handle)
+		if attr == nil {
+			return fail(req.Handle, ECODE_INVALID_HANDLE)
+		}
+		if code := self.write(attr, req.Value); code != 0 {
+			return fail(req.Handle, code)
+		}
+		return WriteRsp{}
+	case WriteCmd:
+		if attr := self.db.Attribute(req.Handle); attr != nil {
+			self.write(attr, req.Value)
+		}
+		return nil
+	case SignedWriteCmd:
+		// the signature can not be verified without CSRK
+		return nil
+	case PrepareWriteReq:
+		attr := self.db.Attribute(req.Handle)
+		if attr == nil {
+			return fail(req.Handle, ECODE_INVALID_HANDLE)
+		} else if code := self.check(attr, true); code != 0 {
+			return fail(req.Handle, code)
+		}
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		if len(self.queue) >= maxPrepareQueue {
+			return fail(req.Handle, ECODE_PREPARE_QUEUE_FULL)
+		}
+		req.Value = append([]byte(nil), req.Value...)
+		self.queue = append(self.queue, req)
+		return PrepareWriteRsp{Handle: req.Handle, Offset: req.Offset, Value: req.Value}
+	case ExecuteWriteReq:
+		if req.Flags != EXEC_CANCEL && req.Flags != EXEC_WRITE {
+			// the queue is kept for the request of a valid flag
+			return fail(0, ECODE_INVALID_PDU)
+		}
+		self.lock.Lock()
+		queue := self.queue
+		self.queue = nil
+		self.lock.Unlock()
+		if req.Flags == EXEC_WRITE {
+			if handle, code := self.execute(queue); code != 0 {
+				return fail(handle, code)
+			}
+		}
+		return ExecuteWriteRsp{}
+	default:
+		if pdu.Opcode()&OP_COMMAND_FLAG != 0 {
+			return nil
+		}
+		return fail(0, ECODE_REQ_NOT_SUPPORTED)
+	}
+}
+
+// execute writes the prepared values. Each handle starts from the current
+// value of the attribute, and the parts overwrite it at their offsets.
+func (self *Server) execute(queue []PrepareWriteReq) (uint16, ErrorCode) {
+	var order []uint16
+	attrs := make(map[uint16]*Attribute)
+	values := make(map[uint16][]byte)
+	for _, req := range queue {
+		value, ok := values[req.Handle]
+		if !ok {
+			attr := self.db.Attribute(req.Handle)
+			if attr == nil {
+				return req.Handle, ECODE_INVALID_HANDLE
+			}
+			if current, code := self.value(attr, 0); code != 0 {
+				return req.Handle, code
+			} else {
+				value = append([]byte(nil), current...)
+			}
+			order = append(order, req.Handle)
+			attrs[req.Handle] = attr
+		}
+		if int(req.Offset) > len(value) {
+			return req.Handle, ECODE_INVALID_OFFSET
+		}
+		end := int(req.Offset) + len(req.Value)
+		if end > MAX_VALUE_LEN {
+			return req.Handle, ECODE_INVALID_ATTR_VALUE_LEN
+		}
+		if end > len(value) {
+			value = append(value, make([]byte, end-len(value))...)
+		}
+		copy(value[req.Offset:], req.Value)
+		values[req.Handle] = value
+	}
+	for _, h := range order {
+		if code := self.write(attrs[h], values[h]); code != 0 {
+			return h, code
+		}
+	}
+	return 0, 0
+}
+
+func (self *Server) confirm() {
+	select {
+	case self.cfm <- struct{}{}:
+	default:
+	}
+}
+
+// Notify sends Handle Value Notification, truncating the value by the MTU.
+func (self *Server) Notify(handle uint16, value []byte) error {
+	if err := self.bearer.error(); err != nil {
+		return err
+	}
+	return self.bearer.send(HandleValueNtf{
+		Handle: handle,
+		Value:  truncate(value, self.MTU()-3),
+	})
+}
+
+// Indicate sends Handle Value Indication and waits for the confirmation.
+func (self *Server) Indicate(ctx context.Context, handle uint16, value []byte) error {
+	b := self.bearer
+	select {
+	case self.indSem <- struct{}{}:
+	case <-b.done:
+		return b.error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-self.indSem }()
+
+	select {
+	case <-self.cfm: // stale
+	default:
+	}
+	if err := b.send(HandleValueInd{
+		Handle: handle,
+		Value:  truncate(value, self.MTU()-3),
+	}); err != nil {
+		return err
+	}
+	timer := time.NewTimer(TRANSACTION_TIMEOUT)
+	defer timer.Stop()
+	select {
+	case <-self.cfm:
+		return nil
+	case <-timer.C:
+		b.fail(ErrTimeout)
+		return ErrTimeout
+	case <-b.done:
+		return b.error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
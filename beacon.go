@@ -0,0 +1,397 @@
+package blugo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Beacon formats carried in the advertising data. The decoders are methods
+// of AdData and the AdData methods of the beacons make the advertising data
+// for Advertiser, which is usually run with ADV_NONCONN_IND.
+
+// BEACON_FLAGS is AD_FLAGS of the advertising data made for the beacons.
+const BEACON_FLAGS = AD_FLAG_LE_GENERAL | AD_FLAG_BREDR_NOT_SUPPORTED
+
+// iBeacon of Apple, in the manufacturer specific data of company 0x004C.
+
+const (
+	IBEACON_COMPANY = 0x004C
+	IBEACON_TYPE    = 0x02
+	IBEACON_LEN     = 0x15
+)
+
+type IBeacon struct {
+	UUID          uuid.UUID // proximity UUID
+	Major         uint16
+	Minor         uint16
+	MeasuredPower int8 // RSSI at 1 m
+}
+
+// IBeacon decodes the iBeacon advertisement.
+func (self AdData) IBeacon() (IBeacon, bool) {
+	company, data, ok := self.ManufacturerData()
+	if !ok || company != IBEACON_COMPANY || len(data) != 23 || data[0] != IBEACON_TYPE || data[1] != IBEACON_LEN {
+		return IBeacon{}, false
+	}
+	u, _ := uuid.FromBigEndian(data[2:18])
+	return IBeacon{
+		UUID:          u,
+		Major:         binary.BigEndian.Uint16(data[18:]),
+		Minor:         binary.BigEndian.Uint16(data[20:]),
+		MeasuredPower: int8(data[22]),
+	}, true
+}
+
+func (self IBeacon) AdData() AdData {
+	data := make([]byte, 23)
+	data[0] = IBEACON_TYPE
+	data[1] = IBEACON_LEN
+	copy(data[2:18], self.UUID.Full().BigEndian())
+	binary.BigEndian.PutUint16(data[18:], self.Major)
+	binary.BigEndian.PutUint16(data[20:], self.Minor)
+	data[22] = uint8(self.MeasuredPower)
+	return AdData{
+		AdFlags(BEACON_FLAGS),
+		AdManufacturerData(IBEACON_COMPANY, data),
+	}
+}
+
+// AltBeacon, https://github.com/AltBeacon/spec
+
+const ALTBEACON_CODE = 0xBEAC
+
+type AltBeacon struct {
+	Company       uint16
+	ID            [20]byte // the first 16 octets are usually an organizational unit
+	ReferenceRSSI int8     // RSSI at 1 m
+	Reserved      uint8    // for the manufacturer
+}
+
+// AltBeacon decodes the AltBeacon advertisement.
+func (self AdData) AltBeacon() (AltBeacon, bool) {
+	company, data, ok := self.ManufacturerData()
+	if !ok || len(data) != 24 || binary.BigEndian.Uint16(data) != ALTBEACON_CODE {
+		return AltBeacon{}, false
+	}
+	ret := AltBeacon{
+		Company:       company,
+		ReferenceRSSI: int8(data[22]),
+		Reserved:      data[23],
+	}
+	copy(ret.ID[:], data[2:22])
+	return ret, true
+}
+
+func (self AltBeacon) AdData() AdData {
+	data := make([]byte, 24)
+	binary.BigEndian.PutUint16(data, ALTBEACON_CODE)
+	copy(data[2:22], self.ID[:])
+	data[22] = uint8(self.ReferenceRSSI)
+	data[23] = self.Reserved
+	return AdData{
+		AdFlags(BEACON_FLAGS),
+		AdManufacturerData(self.Company, data),
+	}
+}
+
+// Eddystone, https://github.com/google/eddystone
+// The frames are in the service data of 0xFEAA.
+
+const EDDYSTONE_UUID = 0xFEAA
+
+// Eddystone frame types
+const (
+	EDDYSTONE_UID = 0x00
+	EDDYSTONE_URL = 0x10
+	EDDYSTONE_TLM = 0x20
+	EDDYSTONE_EID = 0x30
+)
+
+// Eddystone-TLM versions
+const (
+	EDDYSTONE_TLM_PLAIN     = 0x00
+	EDDYSTONE_TLM_ENCRYPTED = 0x01
+)
+
+func (self AdData) eddystone(frame uint8) ([]byte, bool) {
+	if data, ok := self.ServiceData16(EDDYSTONE_UUID); ok && len(data) > 0 && data[0] == frame {
+		return data[1:], true
+	}
+	return nil, false
+}
+
+func eddystoneAdData(frame uint8, data []byte) AdData {
+	return AdData{
+		AdFlags(BEACON_FLAGS),
+		AdUUID16(true, EDDYSTONE_UUID),
+		AdServiceData16(EDDYSTONE_UUID, append([]byte{frame}, data...)),
+	}
+}
+
+type EddystoneUID struct {
+	TxPower   int8 // at 0 m
+	Namespace [10]byte
+	Instance  [6]byte
+}
+
+// EddystoneUID decodes the Eddystone-UID frame. The RFU octets may be
+// omitted.
+func (self AdData) EddystoneUID() (EddystoneUID, bool) {
+	data, ok := self.eddystone(EDDYSTONE_UID)
+	if !ok || (len(data) != 17 && len(data) != 19) {
+		return EddystoneUID{}, false
+	}
+	ret := EddystoneUID{TxPower: int8(data[0])}
+	copy(ret.Namespace[:], data[1:11])
+	copy(ret.Instance[:], data[11:17])
+	return ret, true
+}
+
+func (self EddystoneUID) AdData() AdData {
+	data := make([]byte, 19)
+	data[0] = uint8(self.TxPower)
+	copy(data[1:11], self.Namespace[:])
+	copy(data[11:17], self.Instance[:])
+	return eddystoneAdData(EDDYSTONE_UID, data)
+}
+
+var eddystoneSchemes = []string{
+	"http://www.",
+	"https://www.",
+	"http://",
+	"https://",
+}
+
+var eddystoneExpansions = []string{
+	".com/",
+	".org/",
+	".edu/",
+	".net/",
+	".info/",
+	".biz/",
+	".gov/",
+	".com",
+	".org",
+	".edu",
+	".net",
+	".info",
+	".biz",
+	".gov",
+}
+
+// MAX_EDDYSTONE_URL is the size limit of the encoded URL after the scheme.
+const MAX_EDDYSTONE_URL = 17
+
+// EncodeEddystoneURL compresses the URL with the scheme prefix and the
+// expansion codes.
+func EncodeEddystoneURL(url string) ([]byte, error) {
+	var ret []byte
+	for i, s := range eddystoneSchemes {
+		if strings.HasPrefix(url, s) {
+			ret = append(ret, uint8(i))
+			url = url[len(s):]
+			break
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("unsupported scheme")
+	}
+	for len(url) > 0 {
+		code := -1
+		for i, s := range eddystoneExpansions {
+			// the expansions with a slash come first, and win
+			if strings.HasPrefix(url, s) {
+				code = i
+				break
+			}
+		}
+		if code >= 0 {
+			ret = append(ret, uint8(code))
+			url = url[len(eddystoneExpansions[code]):]
+		} else if c := url[0]; c <= 0x20 || c >= 0x7F {
+			return nil, fmt.Errorf("invalid character in URL")
+		} else {
+			ret = append(ret, c)
+			url = url[1:]
+		}
+	}
+	if len(ret)-1 > MAX_EDDYSTONE_URL {
+		return nil, fmt.Errorf("URL too long")
+	}
+	return ret, nil
+}
+
+// DecodeEddystoneURL expands the scheme prefix and the expansion codes.
+func DecodeEddystoneURL(data []byte) (string, error) {
+	if len(data) < 1 || int(data[0]) >= len(eddystoneSchemes) {
+		return "", fmt.Errorf("unsupported scheme")
+	} else if len(data)-1 > MAX_EDDYSTONE_URL {
+		return "", fmt.Errorf("URL too long")
+	}
+	ret := eddystoneSchemes[data[0]]
+	for _, c := range data[1:] {
+		if int(c) < len(eddystoneExpansions) {
+			ret += eddystoneExpansions[c]
+		} else if c <= 0x20 || c >= 0x7F {
+			return "", fmt.Errorf("invalid character in URL")
+		} else {
+			ret += string(rune(c))
+		}
+	}
+	return ret, nil
+}
+
+type EddystoneURL struct {
+	TxPower int8 // at 0 m
+	URL     string
+}
+
+// EddystoneURL decodes the Eddystone-URL frame.
+func (self AdData) EddystoneURL() (EddystoneURL, bool) {
+	data, ok := self.eddystone(EDDYSTONE_URL)
+	if !ok || len(data) < 2 {
+		return EddystoneURL{}, false
+	}
+	if url, err := DecodeEddystoneURL(data[1:]); err != nil {
+		return EddystoneURL{}, false
+	} else {
+		return EddystoneURL{TxPower: int8(data[0]), URL: url}, true
+	}
+}
+
+func (self EddystoneURL) AdData() (AdData, error) {
+	if url, err := EncodeEddystoneURL(self.URL); err != nil {
+		return nil, err
+	} else {
+		return eddystoneAdData(EDDYSTONE_URL, append([]byte{uint8(self.TxPower)}, url...)), nil
+	}
+}
+
+// EDDYSTONE_TEMP_NONE is the temperature value of no sensor.
+const EDDYSTONE_TEMP_NONE = -0x8000
+
+// EddystoneTLM is the unencrypted telemetry.
+type EddystoneTLM struct {
+	Battery     uint16 // mV, 0 if not powered by a battery
+	Temperature int16  // 8.8 fixed point degrees Celsius
+	AdvCount    uint32 // advertising PDUs since the power up
+	SecCount    uint32 // 0.1 second units since the power up
+}
+
+// Celsius returns the temperature, and false without a sensor.
+func (self EddystoneTLM) Celsius() (float64, bool) {
+	if self.Temperature == EDDYSTONE_TEMP_NONE {
+		return math.NaN(), false
+	}
+	return float64(self.Temperature) / 256, true
+}
+
+// Uptime returns SecCount as a duration.
+func (self EddystoneTLM) Uptime() time.Duration {
+	return time.Duration(self.SecCount) * 100 * time.Millisecond
+}
+
+// EddystoneTLM decodes the unencrypted Eddystone-TLM frame.
+func (self AdData) EddystoneTLM() (EddystoneTLM, bool) {
+	data, ok := self.eddystone(EDDYSTONE_TLM)
+	if !ok || len(data) != 13 || data[0] != EDDYSTONE_TLM_PLAIN {
+		return EddystoneTLM{}, false
+	}
+	return EddystoneTLM{
+		Battery:     binary.BigEndian.Uint16(data[1:]),
+		Temperature: int16(binary.BigEndian.Uint16(data[3:])),
+		AdvCount:    binary.BigEndian.Uint32(data[5:]),
+		SecCount:    binary.BigEndian.Uint32(data[9:]),
+	}, true
+}
+
+func (self EddystoneTLM) AdData() AdData {
+	data := make([]byte, 13)
+	data[0] = EDDYSTONE_TLM_PLAIN
+	binary.BigEndian.PutUint16(data[1:], self.Battery)
+	binary.BigEndian.PutUint16(data[3:], uint16(self.Temperature))
+	binary.BigEndian.PutUint32(data[5:], self.AdvCount)
+	binary.BigEndian.PutUint32(data[9:], self.SecCount)
+	return eddystoneAdData(EDDYSTONE_TLM, data)
+}
+
+// EddystoneETLM is the encrypted telemetry that accompanies Eddystone-EID.
+// ETLM is the encrypted form of the 12 octets of EddystoneTLM, which the
+// owner of the identity key decrypts.
+type EddystoneETLM struct {
+	ETLM [12]byte
+	Salt uint16
+	MIC  uint16
+}
+
+// EddystoneETLM decodes the encrypted Eddystone-TLM frame.
+func (self AdData) EddystoneETLM() (EddystoneETLM, bool) {
+	data, ok := self.eddystone(EDDYSTONE_TLM)
+	if !ok || len(data) != 17 || data[0] != EDDYSTONE_TLM_ENCRYPTED {
+		return EddystoneETLM{}, false
+	}
+	ret := EddystoneETLM{
+		Salt: binary.BigEndian.Uint16(data[13:]),
+		MIC:  binary.BigEndian.Uint16(data[15:]),
+	}
+	copy(ret.ETLM[:], data[1:13])
+	return ret, true
+}
+
+func (self EddystoneETLM) AdData() AdData {
+	data := make([]byte, 17)
+	data[0] = EDDYSTONE_TLM_ENCRYPTED
+	copy(data[1:13], self.ETLM[:])
+	binary.BigEndian.PutUint16(data[13:], self.Salt)
+	binary.BigEndian.PutUint16(data[15:], self.MIC)
+	return eddystoneAdData(EDDYSTONE_TLM, data)
+}
+
+// EddystoneEID is the ephemeral identifier, which rotates on the beacon and
+// is resolved by the owner of the identity key.
+type EddystoneEID struct {
+	TxPower int8 // at 0 m
+	EID     [8]byte
+}
+
+// EddystoneEID decodes the Eddystone-EID frame.
+func (self AdData) EddystoneEID() (EddystoneEID, bool) {
+	data, ok := self.eddystone(EDDYSTONE_EID)
+	if !ok || len(data) != 9 {
+		return EddystoneEID{}, false
+	}
+	ret := EddystoneEID{TxPower: int8(data[0])}
+	copy(ret.EID[:], data[1:])
+	return ret, true
+}
+
+func (self EddystoneEID) AdData() AdData {
+	return eddystoneAdData(EDDYSTONE_EID, append([]byte{uint8(self.TxPower)}, self.EID[:]...))
+}
+
+// Beacon decodes any of the beacon formats above, returning one of
+// IBeacon, AltBeacon, EddystoneUID, EddystoneURL, EddystoneTLM,
+// EddystoneETLM and EddystoneEID.
+func (self AdData) Beacon() (interface{}, bool) {
+	if v, ok := self.IBeacon(); ok {
+		return v, true
+	} else if v, ok := self.AltBeacon(); ok {
+		return v, true
+	} else if v, ok := self.EddystoneUID(); ok {
+		return v, true
+	} else if v, ok := self.EddystoneURL(); ok {
+		return v, true
+	} else if v, ok := self.EddystoneTLM(); ok {
+		return v, true
+	} else if v, ok := self.EddystoneETLM(); ok {
+		return v, true
+	} else if v, ok := self.EddystoneEID(); ok {
+		return v, true
+	}
+	return nil, false
+}
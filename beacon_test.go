@@ -0,0 +1,98 @@
+package blugo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+func beaconAdData(t *testing.T, s string) AdData {
+	var ret AdData
+	if data, err := hex.DecodeString(s); err != nil {
+		t.Fatal(err)
+	} else if err := ret.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestBeaconIBeacon(t *testing.T) {
+	raw := "0201061aff4c000215e2c56db5dffb48d2b060d0f5a71096e000010002c5"
+	ad := beaconAdData(t, raw)
+	b, ok := ad.IBeacon()
+	if !ok || b.UUID.String() != "e2c56db5-dffb-48d2-b060-d0f5a71096e0" || b.Major != 1 || b.Minor != 2 || b.MeasuredPower != -59 {
+		t.Errorf("got %v %v", b, ok)
+	}
+	if data, err := b.AdData().MarshalBinary(); err != nil || hex.EncodeToString(data) != raw {
+		t.Errorf("got %x %v", data, err)
+	}
+	if _, ok := ad.AltBeacon(); ok {
+		t.Error("iBeacon decoded as AltBeacon")
+	}
+}
+
+func TestBeaconAltBeacon(t *testing.T) {
+	b := AltBeacon{Company: 0x0118, ReferenceRSSI: -65, Reserved: 0x7f}
+	copy(b.ID[:], bytes.Repeat([]byte{0xab}, 20))
+	data, _ := b.AdData().MarshalBinary()
+	if len(data) != 31 || data[3] != 0x1b || data[7] != 0xbe || data[8] != 0xac {
+		t.Errorf("got %x", data)
+	}
+	var ad AdData
+	ad.UnmarshalBinary(data)
+	if v, ok := ad.Beacon(); !ok || !reflect.DeepEqual(v, b) {
+		t.Errorf("got %v", v)
+	}
+}
+
+func TestBeaconEddystone(t *testing.T) {
+	uid := EddystoneUID{TxPower: -20}
+	copy(uid.Namespace[:], "0123456789")
+	copy(uid.Instance[:], "abcdef")
+	tlm := EddystoneTLM{Battery: 3000, Temperature: 0x1880, AdvCount: 100, SecCount: 36000}
+	etlm := EddystoneETLM{Salt: 0x1234, MIC: 0x5678}
+	copy(etlm.ETLM[:], "encrypted tl")
+	eid := EddystoneEID{TxPower: -10, EID: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	for _, v := range []struct {
+		ad     AdData
+		beacon interface{}
+	}{
+		{uid.AdData(), uid},
+		{tlm.AdData(), tlm},
+		{etlm.AdData(), etlm},
+		{eid.AdData(), eid},
+	} {
+		if data, err := v.ad.MarshalBinary(); err != nil || len(data) > MAX_AD_LEN {
+			t.Errorf("got %x %v", data, err)
+		}
+		if b, ok := v.ad.Beacon(); !ok || !reflect.DeepEqual(b, v.beacon) {
+			t.Errorf("expected %v got %v", v.beacon, b)
+		}
+	}
+	if c, ok := tlm.Celsius(); !ok || c != 24.5 || tlm.Uptime().Hours() != 1 {
+		t.Errorf("got %v %v", c, tlm.Uptime())
+	}
+	if _, ok := (EddystoneTLM{Temperature: EDDYSTONE_TEMP_NONE}).Celsius(); ok {
+		t.Error("no sensor")
+	}
+
+	ad := beaconAdData(t, "0201060303aafe1316aafe10eb0167697468756200626c75676f00")
+	if b, ok := ad.EddystoneURL(); !ok || b.TxPower != -21 || b.URL != "https://www.github.com/blugo.com/" {
+		t.Errorf("got %v %v", b, ok)
+	}
+	url := EddystoneURL{TxPower: -21, URL: "https://www.github.com/blugo.com/"}
+	if ad2, err := url.AdData(); err != nil || !reflect.DeepEqual(ad2, ad) {
+		t.Errorf("got %v %v", ad2, err)
+	}
+	for _, s := range []string{"ftp://example.com", "http://example.com/a b", "https://a-very-long-domain-name.com/"} {
+		if _, err := EncodeEddystoneURL(s); err == nil {
+			t.Errorf("%s accepted", s)
+		}
+	}
+	if _, ok := AdData(AdUUIDs(true, uuid.UUID16(EDDYSTONE_UUID))).Beacon(); ok {
+		t.Error("no frame decoded")
+	}
+}
@@ -19,3 +19,43 @@ const (
 	SOL_SCO    = 17
 	SOL_RFCOMM = 18
 )
+
+const SOL_BLUETOOTH = 274
+
+// SOL_BLUETOOTH socket options
+const (
+	BT_SECURITY       = 4
+	BT_DEFER_SETUP    = 7
+	BT_FLUSHABLE      = 8
+	BT_POWER          = 9
+	BT_CHANNEL_POLICY = 10
+	BT_VOICE          = 11
+	BT_SNDMTU         = 12
+	BT_RCVMTU         = 13
+	BT_PHY            = 14
+	BT_MODE           = 15
+	BT_PKT_STATUS     = 16
+)
+
+const (
+	BT_SECURITY_SDP = iota
+	BT_SECURITY_LOW
+	BT_SECURITY_MEDIUM
+	BT_SECURITY_HIGH
+	BT_SECURITY_FIPS
+)
+
+const (
+	BT_MODE_BASIC = iota
+	BT_MODE_ERTM
+	BT_MODE_STREAMING
+	BT_MODE_LE_FLOWCTL
+	BT_MODE_EXT_FLOWCTL
+)
+
+// address type of sockaddr
+const (
+	BDADDR_BREDR = iota
+	BDADDR_LE_PUBLIC
+	BDADDR_LE_RANDOM
+)
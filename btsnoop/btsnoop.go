@@ -0,0 +1,293 @@
+// Package btsnoop reads and writes btsnoop version 1 files, the capture
+// format of Android bug reports, of btmon and of hcidump.
+//
+// Record.Packet gives the packets in the form of the HCI UART transport,
+// the packet type octet first, which blugo.Parse takes:
+//
+//	pkt, _ := blugo.Parse(rec.Packet())
+//
+// Records are not parsed here, as blugo imports this package for
+// BtsnoopTap; blugo.BtsnoopReader gives the parsed packets.
+//
+// The file is big endian.
+package btsnoop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var MAGIC = []byte("btsnoop\x00")
+
+const VERSION = 1
+
+// Datalink types
+const (
+	DATALINK_H1      = 1001 // un-encapsulated HCI, the type in the flags
+	DATALINK_H4      = 1002 // HCI UART, the type octet in the data
+	DATALINK_BSCP    = 1003
+	DATALINK_H5      = 1004
+	DATALINK_MONITOR = 2001 // Linux monitor of btmon, the opcode in the flags
+)
+
+// Record flags of DATALINK_H1 and DATALINK_H4
+const (
+	FLAG_RECEIVED      = 0x01 // controller to host
+	FLAG_COMMAND_EVENT = 0x02 // command or event, rather than data
+)
+
+// H4 packet types, same as the HCI_*_PKT of blugo
+const (
+	PKT_COMMAND = 0x01
+	PKT_ACLDATA = 0x02
+	PKT_SCODATA = 0x03
+	PKT_EVENT   = 0x04
+	PKT_ISODATA = 0x05
+)
+
+// Opcodes of DATALINK_MONITOR, the lower 16 bits of the flags. The upper
+// 16 bits are the adapter index.
+const (
+	MONITOR_NEW_INDEX    = 0
+	MONITOR_DEL_INDEX    = 1
+	MONITOR_COMMAND_PKT  = 2
+	MONITOR_EVENT_PKT    = 3
+	MONITOR_ACL_TX_PKT   = 4
+	MONITOR_ACL_RX_PKT   = 5
+	MONITOR_SCO_TX_PKT   = 6
+	MONITOR_SCO_RX_PKT   = 7
+	MONITOR_OPEN_INDEX   = 8
+	MONITOR_CLOSE_INDEX  = 9
+	MONITOR_INDEX_INFO   = 10
+	MONITOR_VENDOR_DIAG  = 11
+	MONITOR_SYSTEM_NOTE  = 12
+	MONITOR_USER_LOGGING = 13
+	MONITOR_CTRL_OPEN    = 14
+	MONITOR_CTRL_CLOSE   = 15
+	MONITOR_CTRL_COMMAND = 16
+	MONITOR_CTRL_EVENT   = 17
+	MONITOR_ISO_TX_PKT   = 18
+	MONITOR_ISO_RX_PKT   = 19
+)
+
+// EPOCH_OFFSET is the Unix epoch in the microseconds since the midnight of
+// January 1st, 0 AD, which the timestamps count.
+const EPOCH_OFFSET = 0x00DCDDB30F2F8000
+
+var ErrFormat = errors.New("btsnoop: invalid format")
+
+const (
+	headerLen = 16
+	recordLen = 24
+	maxData   = 1 << 20 // beyond the largest HCI packet
+)
+
+// Record is a record of the file. Type, Received, Index and Opcode are
+// decoded from the flags and the data by the datalink type.
+type Record struct {
+	OriginalLength uint32 // zero means len(Data) in writing
+	Flags          uint32
+	Drops          uint32 // cumulative
+	Time           time.Time
+	Data           []byte
+
+	Type     uint8  // PKT_*, or zero for the monitor records of no packet
+	Received bool   // controller to host
+	Index    uint16 // adapter index of DATALINK_MONITOR
+	Opcode   uint16 // of DATALINK_MONITOR
+	typed    bool   // Data starts with the type octet
+}
+
+// Packet returns the packet in the H4 form, or nil for the records of no
+// packet.
+func (self Record) Packet() []byte {
+	if self.Type == 0 {
+		return nil
+	}
+	if self.typed {
+		return self.Data
+	}
+	return append([]byte{self.Type}, self.Data...)
+}
+
+func encodeTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/1000 + EPOCH_OFFSET)
+}
+
+func decodeTime(v uint64) time.Time {
+	us := int64(v) - EPOCH_OFFSET
+	return time.Unix(us/1000000, us%1000000*1000)
+}
+
+var monitorPackets = map[uint16]struct {
+	typ      uint8
+	received bool
+}{
+	MONITOR_COMMAND_PKT: {PKT_COMMAND, false},
+	MONITOR_EVENT_PKT:   {PKT_EVENT, true},
+	MONITOR_ACL_TX_PKT:  {PKT_ACLDATA, false},
+	MONITOR_ACL_RX_PKT:  {PKT_ACLDATA, true},
+	MONITOR_SCO_TX_PKT:  {PKT_SCODATA, false},
+	MONITOR_SCO_RX_PKT:  {PKT_SCODATA, true},
+	MONITOR_ISO_TX_PKT:  {PKT_ISODATA, false},
+	MONITOR_ISO_RX_PKT:  {PKT_ISODATA, true},
+}
+
+// h1Type guesses the packet type of DATALINK_H1, which does not tell SCO
+// from ACL.
+func h1Type(flags uint32) uint8 {
+	switch flags & (FLAG_RECEIVED | FLAG_COMMAND_EVENT) {
+	case FLAG_COMMAND_EVENT:
+		return PKT_COMMAND
+	case FLAG_COMMAND_EVENT | FLAG_RECEIVED:
+		return PKT_EVENT
+	default:
+		return PKT_ACLDATA
+	}
+}
+
+type Reader struct {
+	r        *bufio.Reader
+	Datalink uint32
+}
+
+// NewReader reads the file header.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	} else if !bytes.Equal(hdr[:8], MAGIC) {
+		return nil, ErrFormat
+	} else if v := binary.BigEndian.Uint32(hdr[8:]); v != VERSION {
+		return nil, fmt.Errorf("btsnoop: unsupported version %d", v)
+	}
+	return &Reader{
+		r:        br,
+		Datalink: binary.BigEndian.Uint32(hdr[12:]),
+	}, nil
+}
+
+// Next reads the next record, and returns io.EOF at the end of the file.
+func (self *Reader) Next() (Record, error) {
+	hdr := make([]byte, recordLen)
+	if _, err := io.ReadFull(self.r, hdr); err == io.ErrUnexpectedEOF {
+		return Record{}, ErrFormat
+	} else if err != nil {
+		return Record{}, err
+	}
+	if binary.BigEndian.Uint32(hdr[4:]) > maxData {
+		return Record{}, ErrFormat
+	}
+	rec := Record{
+		OriginalLength: binary.BigEndian.Uint32(hdr[0:]),
+		Flags:          binary.BigEndian.Uint32(hdr[8:]),
+		Drops:          binary.BigEndian.Uint32(hdr[12:]),
+		Time:           decodeTime(binary.BigEndian.Uint64(hdr[16:])),
+		Data:           make([]byte, binary.BigEndian.Uint32(hdr[4:])),
+	}
+	if _, err := io.ReadFull(self.r, rec.Data); err != nil {
+		return Record{}, ErrFormat
+	}
+
+	switch self.Datalink {
+	case DATALINK_H1:
+		rec.Type = h1Type(rec.Flags)
+		rec.Received = rec.Flags&FLAG_RECEIVED != 0
+	case DATALINK_H4:
+		if len(rec.Data) == 0 {
+			return Record{}, ErrFormat
+		}
+		rec.Type = rec.Data[0]
+		rec.typed = true
+		rec.Received = rec.Flags&FLAG_RECEIVED != 0
+	case DATALINK_MONITOR:
+		rec.Index = uint16(rec.Flags >> 16)
+		rec.Opcode = uint16(rec.Flags)
+		if p, ok := monitorPackets[rec.Opcode]; ok {
+			rec.Type = p.typ
+			rec.Received = p.received
+		}
+	}
+	return rec, nil
+}
+
+type Writer struct {
+	w        io.Writer
+	Datalink uint32
+	Index    uint16 // adapter index of DATALINK_MONITOR in WritePacket
+}
+
+// NewWriter writes the file header.
+func NewWriter(w io.Writer, datalink uint32) (*Writer, error) {
+	hdr := make([]byte, headerLen)
+	copy(hdr, MAGIC)
+	binary.BigEndian.PutUint32(hdr[8:], VERSION)
+	binary.BigEndian.PutUint32(hdr[12:], datalink)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:        w,
+		Datalink: datalink,
+	}, nil
+}
+
+// Write writes the record with Flags and Data as they are.
+func (self *Writer) Write(rec Record) error {
+	length := rec.OriginalLength
+	if length == 0 {
+		length = uint32(len(rec.Data))
+	}
+	buf := make([]byte, recordLen, recordLen+len(rec.Data))
+	binary.BigEndian.PutUint32(buf[0:], length)
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(rec.Data)))
+	binary.BigEndian.PutUint32(buf[8:], rec.Flags)
+	binary.BigEndian.PutUint32(buf[12:], rec.Drops)
+	binary.BigEndian.PutUint64(buf[16:], encodeTime(rec.Time))
+	_, err := self.w.Write(append(buf, rec.Data...))
+	return err
+}
+
+// WritePacket writes the packet in the H4 form, encoding the record for
+// the datalink type.
+func (self *Writer) WritePacket(t time.Time, received bool, pkt []byte) error {
+	if len(pkt) == 0 {
+		return fmt.Errorf("btsnoop: empty packet")
+	}
+	rec := Record{Time: t}
+	switch self.Datalink {
+	case DATALINK_H1, DATALINK_H4:
+		if received {
+			rec.Flags |= FLAG_RECEIVED
+		}
+		if pkt[0] == PKT_COMMAND || pkt[0] == PKT_EVENT {
+			rec.Flags |= FLAG_COMMAND_EVENT
+		}
+		if self.Datalink == DATALINK_H1 {
+			rec.Data = pkt[1:]
+		} else {
+			rec.Data = pkt
+		}
+	case DATALINK_MONITOR:
+		opcode := -1
+		for op, p := range monitorPackets {
+			if p.typ == pkt[0] && p.received == received {
+				opcode = int(op)
+			}
+		}
+		if opcode < 0 {
+			return fmt.Errorf("btsnoop: unsupported packet type %d", pkt[0])
+		}
+		rec.Flags = uint32(self.Index)<<16 | uint32(opcode)
+		rec.Data = pkt[1:]
+	default:
+		return fmt.Errorf("btsnoop: unsupported datalink %d", self.Datalink)
+	}
+	return self.Write(rec)
+}
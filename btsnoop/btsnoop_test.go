@@ -0,0 +1,92 @@
+package btsnoop
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+)
+
+var packets = []struct {
+	received bool
+	pkt      string
+}{
+	{false, "01030c00"},                // HCI_Reset
+	{true, "040e0401030c00"},           // Command Complete
+	{false, "0240000400" + "00000100"}, // ACL
+	{true, "0240200400" + "00000100"},  // ACL
+}
+
+func TestReadWrite(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	for _, datalink := range []uint32{DATALINK_H1, DATALINK_H4, DATALINK_MONITOR} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, datalink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Index = 1
+		for i, p := range packets {
+			pkt, _ := hex.DecodeString(p.pkt)
+			if err := w.WritePacket(base.Add(time.Duration(i)*time.Millisecond), p.received, pkt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data := buf.Bytes()
+		if !bytes.Equal(data[:16], append([]byte("btsnoop\x00\x00\x00\x00\x01\x00\x00"), uint8(datalink>>8), uint8(datalink))) {
+			t.Errorf("header %x", data[:16])
+		}
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil || r.Datalink != datalink {
+			t.Fatal(datalink, err)
+		}
+		for i, p := range packets {
+			rec, err := r.Next()
+			if err != nil {
+				t.Fatal(datalink, err)
+			}
+			if hex.EncodeToString(rec.Packet()) != p.pkt || rec.Received != p.received {
+				t.Errorf("%d got %x %v", datalink, rec.Packet(), rec.Received)
+			}
+			if !rec.Time.Equal(base.Add(time.Duration(i) * time.Millisecond)) {
+				t.Errorf("got %v", rec.Time)
+			}
+			if datalink == DATALINK_MONITOR && rec.Index != 1 {
+				t.Errorf("index %d", rec.Index)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("got %v", err)
+		}
+		r, _ = NewReader(bytes.NewReader(data[:len(data)-1]))
+		for err == nil {
+			_, err = r.Next()
+		}
+		if err != ErrFormat {
+			t.Errorf("truncated file got %v", err)
+		}
+	}
+
+	// the flags and the timestamp of an H4 record
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, DATALINK_H4)
+	w.WritePacket(time.Unix(0, 0), true, []byte{PKT_EVENT, 0x0e, 0x00})
+	if rec := buf.Bytes()[16:]; hex.EncodeToString(rec[:24]) != "000000030000000300000003000000000"+"0dcddb30f2f8000" {
+		t.Errorf("got %x", rec)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("snoop\x00\x00\x00\x00\x00\x00\x01\x00\x00\x03\xea"))); err != ErrFormat {
+		t.Errorf("got %v", err)
+	}
+
+	// monitor records of no packet
+	buf.Reset()
+	w, _ = NewWriter(&buf, DATALINK_MONITOR)
+	w.Write(Record{Flags: 0x0000000C, Data: []byte("note\x00")})
+	r, _ := NewReader(&buf)
+	if rec, err := r.Next(); err != nil || rec.Opcode != MONITOR_SYSTEM_NOTE || rec.Packet() != nil {
+		t.Errorf("got %v %v", rec, err)
+	}
+}
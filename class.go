@@ -0,0 +1,354 @@
+package blugo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bluetooth Assigned Numbers, Section 2.8
+// Class of Device of BR/EDR, the 24 bit value of the major service classes,
+// the major device class and the minor device class.
+
+// ClassOfDevice holds the class in the lower 24 bits.
+type ClassOfDevice uint32
+
+// Major service classes, bits of ClassOfDevice
+const (
+	COD_SERVICE_LIMITED_DISCOVERABLE = 1 << 13
+	COD_SERVICE_LE_AUDIO             = 1 << 14
+	COD_SERVICE_POSITIONING          = 1 << 16
+	COD_SERVICE_NETWORKING           = 1 << 17
+	COD_SERVICE_RENDERING            = 1 << 18
+	COD_SERVICE_CAPTURING            = 1 << 19
+	COD_SERVICE_OBJECT_TRANSFER      = 1 << 20
+	COD_SERVICE_AUDIO                = 1 << 21
+	COD_SERVICE_TELEPHONY            = 1 << 22
+	COD_SERVICE_INFORMATION          = 1 << 23
+)
+
+// Major device classes
+const (
+	COD_MAJOR_MISCELLANEOUS = 0x00
+	COD_MAJOR_COMPUTER      = 0x01
+	COD_MAJOR_PHONE         = 0x02
+	COD_MAJOR_LAN           = 0x03 // network access point
+	COD_MAJOR_AUDIO_VIDEO   = 0x04
+	COD_MAJOR_PERIPHERAL    = 0x05
+	COD_MAJOR_IMAGING       = 0x06
+	COD_MAJOR_WEARABLE      = 0x07
+	COD_MAJOR_TOY           = 0x08
+	COD_MAJOR_HEALTH        = 0x09
+	COD_MAJOR_UNCATEGORIZED = 0x1F
+)
+
+// Minor device classes of the peripheral major class are a combination of
+// the keyboard/pointing bits and the device type.
+const (
+	COD_MINOR_PERIPHERAL_KEYBOARD = 0x10
+	COD_MINOR_PERIPHERAL_POINTING = 0x20
+)
+
+// Minor device classes of the imaging major class are bits.
+const (
+	COD_MINOR_IMAGING_DISPLAY = 0x04
+	COD_MINOR_IMAGING_CAMERA  = 0x08
+	COD_MINOR_IMAGING_SCANNER = 0x10
+	COD_MINOR_IMAGING_PRINTER = 0x20
+)
+
+var codServiceNames = []struct {
+	bit  uint32
+	name string
+}{
+	{COD_SERVICE_LIMITED_DISCOVERABLE, "Limited Discoverable Mode"},
+	{COD_SERVICE_LE_AUDIO, "LE Audio"},
+	{COD_SERVICE_POSITIONING, "Positioning"},
+	{COD_SERVICE_NETWORKING, "Networking"},
+	{COD_SERVICE_RENDERING, "Rendering"},
+	{COD_SERVICE_CAPTURING, "Capturing"},
+	{COD_SERVICE_OBJECT_TRANSFER, "Object Transfer"},
+	{COD_SERVICE_AUDIO, "Audio"},
+	{COD_SERVICE_TELEPHONY, "Telephony"},
+	{COD_SERVICE_INFORMATION, "Information"},
+}
+
+var codMajorNames = map[uint8]string{
+	COD_MAJOR_MISCELLANEOUS: "Miscellaneous",
+	COD_MAJOR_COMPUTER:      "Computer",
+	COD_MAJOR_PHONE:         "Phone",
+	COD_MAJOR_LAN:           "LAN/Network Access Point",
+	COD_MAJOR_AUDIO_VIDEO:   "Audio/Video",
+	COD_MAJOR_PERIPHERAL:    "Peripheral",
+	COD_MAJOR_IMAGING:       "Imaging",
+	COD_MAJOR_WEARABLE:      "Wearable",
+	COD_MAJOR_TOY:           "Toy",
+	COD_MAJOR_HEALTH:        "Health",
+	COD_MAJOR_UNCATEGORIZED: "Uncategorized",
+}
+
+// minor device class names by the 6 bit value, of the major classes that
+// number them
+var codMinorNames = map[uint8][]string{
+	COD_MAJOR_COMPUTER: {
+		"Uncategorized",
+		"Desktop Workstation",
+		"Server-class Computer",
+		"Laptop",
+		"Handheld PC/PDA",
+		"Palm-size PC/PDA",
+		"Wearable Computer",
+		"Tablet",
+	},
+	COD_MAJOR_PHONE: {
+		"Uncategorized",
+		"Cellular",
+		"Cordless",
+		"Smartphone",
+		"Wired Modem or Voice Gateway",
+		"Common ISDN Access",
+	},
+	COD_MAJOR_AUDIO_VIDEO: {
+		"Uncategorized",
+		"Wearable Headset Device",
+		"Hands-free Device",
+		"",
+		"Microphone",
+		"Loudspeaker",
+		"Headphones",
+		"Portable Audio",
+		"Car Audio",
+		"Set-top Box",
+		"HiFi Audio Device",
+		"VCR",
+		"Video Camera",
+		"Camcorder",
+		"Video Monitor",
+		"Video Display and Loudspeaker",
+		"Video Conferencing",
+		"",
+		"Gaming/Toy",
+	},
+	COD_MAJOR_WEARABLE: {
+		"Uncategorized",
+		"Wristwatch",
+		"Pager",
+		"Jacket",
+		"Helmet",
+		"Glasses",
+		"Pin",
+	},
+	COD_MAJOR_TOY: {
+		"Uncategorized",
+		"Robot",
+		"Vehicle",
+		"Doll/Action Figure",
+		"Controller",
+		"Game",
+	},
+	COD_MAJOR_HEALTH: {
+		"Undefined",
+		"Blood Pressure Monitor",
+		"Thermometer",
+		"Weighing Scale",
+		"Glucose Meter",
+		"Pulse Oximeter",
+		"Heart/Pulse Rate Monitor",
+		"Health Data Display",
+		"Step Counter",
+		"Body Composition Analyzer",
+		"Peak Flow Monitor",
+		"Medication Monitor",
+		"Knee Prosthesis",
+		"Ankle Prosthesis",
+		"Generic Health Manager",
+		"Personal Mobility Device",
+	},
+}
+
+// device types of the peripheral major class, the lower 4 bits
+var codPeripheralNames = []string{
+	"Uncategorized",
+	"Joystick",
+	"Gamepad",
+	"Remote Control",
+	"Sensing Device",
+	"Digitizer Tablet",
+	"Card Reader",
+	"Digital Pen",
+	"Handheld Scanner",
+	"Handheld Gestural Input Device",
+}
+
+// load factors of the LAN major class, the upper 3 bits
+var codLanNames = []string{
+	"Fully Available",
+	"1% to 17% Utilized",
+	"17% to 33% Utilized",
+	"33% to 50% Utilized",
+	"50% to 67% Utilized",
+	"67% to 83% Utilized",
+	"83% to 99% Utilized",
+	"No Service Available",
+}
+
+// NewClassOfDevice builds the class from the major service class bits, the
+// major device class and the 6 bit minor device class, as written by
+// HciDev.WriteClassOfDevice.
+func NewClassOfDevice(services uint32, major, minor uint8) ClassOfDevice {
+	return ClassOfDevice(services&0xFFE000 | uint32(major&0x1F)<<8 | uint32(minor&0x3F)<<2)
+}
+
+// ParseClassOfDevice decodes the 3 octets of HCI commands and events.
+func ParseClassOfDevice(data []byte) ClassOfDevice {
+	if len(data) < 3 {
+		return 0
+	}
+	return ClassOfDevice(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+}
+
+// Bytes encodes the class in the 3 octets of HCI commands and events.
+func (self ClassOfDevice) Bytes() []byte {
+	return []byte{uint8(self), uint8(self >> 8), uint8(self >> 16)}
+}
+
+// Services returns the major service class bits.
+func (self ClassOfDevice) Services() uint32 {
+	return uint32(self) & 0xFFE000
+}
+
+// HasService tells whether all the major service class bits are set.
+func (self ClassOfDevice) HasService(bits uint32) bool {
+	return uint32(self)&bits == bits
+}
+
+func (self ClassOfDevice) MajorClass() uint8 {
+	return uint8(self>>8) & 0x1F
+}
+
+// MinorClass returns the 6 bit minor device class.
+func (self ClassOfDevice) MinorClass() uint8 {
+	return uint8(self>>2) & 0x3F
+}
+
+// ServiceNames returns the names of the major service classes set.
+func (self ClassOfDevice) ServiceNames() []string {
+	var ret []string
+	for _, s := range codServiceNames {
+		if uint32(self)&s.bit != 0 {
+			ret = append(ret, s.name)
+		}
+	}
+	return ret
+}
+
+func (self ClassOfDevice) MajorName() string {
+	if name, ok := codMajorNames[self.MajorClass()]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reserved 0x%02x", self.MajorClass())
+}
+
+func (self ClassOfDevice) MinorName() string {
+	minor := self.MinorClass()
+	switch self.MajorClass() {
+	case COD_MAJOR_MISCELLANEOUS, COD_MAJOR_UNCATEGORIZED:
+		return ""
+	case COD_MAJOR_LAN:
+		return codLanNames[minor>>3]
+	case COD_MAJOR_PERIPHERAL:
+		var names []string
+		if minor&COD_MINOR_PERIPHERAL_KEYBOARD != 0 {
+			names = append(names, "Keyboard")
+		}
+		if minor&COD_MINOR_PERIPHERAL_POINTING != 0 {
+			names = append(names, "Pointing Device")
+		}
+		if t := int(minor & 0x0F); t < len(codPeripheralNames) {
+			if t != 0 || len(names) == 0 {
+				names = append(names, codPeripheralNames[t])
+			}
+		} else {
+			names = append(names, fmt.Sprintf("Reserved 0x%x", t))
+		}
+		return strings.Join(names, "/")
+	case COD_MAJOR_IMAGING:
+		var names []string
+		for _, v := range []struct {
+			bit  uint8
+			name string
+		}{
+			{COD_MINOR_IMAGING_DISPLAY, "Display"},
+			{COD_MINOR_IMAGING_CAMERA, "Camera"},
+			{COD_MINOR_IMAGING_SCANNER, "Scanner"},
+			{COD_MINOR_IMAGING_PRINTER, "Printer"},
+		} {
+			if minor&v.bit != 0 {
+				names = append(names, v.name)
+			}
+		}
+		if len(names) == 0 {
+			return "Uncategorized"
+		}
+		return strings.Join(names, "/")
+	}
+	if names, ok := codMinorNames[self.MajorClass()]; ok && int(minor) < len(names) && names[minor] != "" {
+		return names[minor]
+	}
+	return fmt.Sprintf("Reserved 0x%02x", minor)
+}
+
+// String is like "0x5a020c Phone, Smartphone (Networking, Capturing,
+// Object Transfer, Telephony)".
+func (self ClassOfDevice) String() string {
+	s := fmt.Sprintf("0x%06x %s", uint32(self), self.MajorName())
+	if minor := self.MinorName(); minor != "" {
+		s += ", " + minor
+	}
+	if services := self.ServiceNames(); len(services) > 0 {
+		s += " (" + strings.Join(services, ", ") + ")"
+	}
+	return s
+}
+
+type classOfDeviceJSON struct {
+	Class    string   `json:"class"`
+	Major    string   `json:"major"`
+	Minor    string   `json:"minor,omitempty"`
+	Services []string `json:"services,omitempty"`
+}
+
+// MarshalJSON encodes the value with the names, as an object.
+func (self ClassOfDevice) MarshalJSON() ([]byte, error) {
+	return json.Marshal(classOfDeviceJSON{
+		Class:    fmt.Sprintf("0x%06x", uint32(self)),
+		Major:    self.MajorName(),
+		Minor:    self.MinorName(),
+		Services: self.ServiceNames(),
+	})
+}
+
+// UnmarshalJSON accepts the object of MarshalJSON, a number, or a string of
+// the number. The names in the object are ignored.
+func (self *ClassOfDevice) UnmarshalJSON(data []byte) error {
+	var num uint32
+	var text string
+	var obj classOfDeviceJSON
+	switch {
+	case json.Unmarshal(data, &num) == nil:
+		*self = ClassOfDevice(num & 0xFFFFFF)
+		return nil
+	case json.Unmarshal(data, &text) == nil:
+	case json.Unmarshal(data, &obj) == nil:
+		text = obj.Class
+	default:
+		return fmt.Errorf("invalid class of device %s", data)
+	}
+	if v, err := strconv.ParseUint(text, 0, 24); err != nil {
+		return fmt.Errorf("invalid class of device %q", text)
+	} else {
+		*self = ClassOfDevice(v)
+		return nil
+	}
+}
@@ -0,0 +1,21 @@
+// +build linux
+
+package blugo
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.3.25 - 7.3.26
+
+func (self HciDev) ReadClassOfDevice() (ClassOfDevice, error) {
+	if ret, err := self.Request(HCI_Read_Class_Of_Device); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return ParseClassOfDevice(ret[1].([]byte)), nil
+	}
+}
+
+// WriteClassOfDevice sets the class that the adapter reports in inquiry
+// responses and connection requests.
+func (self HciDev) WriteClassOfDevice(class ClassOfDevice) error {
+	return self.requestStatus(HCI_Write_Class_Of_Device, class.Bytes())
+}
@@ -0,0 +1,69 @@
+package blugo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClassOfDevice(t *testing.T) {
+	c := ParseClassOfDevice([]byte{0x0c, 0x02, 0x5a})
+	if c != NewClassOfDevice(COD_SERVICE_NETWORKING|COD_SERVICE_CAPTURING|COD_SERVICE_OBJECT_TRANSFER|COD_SERVICE_TELEPHONY, COD_MAJOR_PHONE, 3) {
+		t.Errorf("got 0x%06x", uint32(c))
+	}
+	if !c.HasService(COD_SERVICE_TELEPHONY) || c.HasService(COD_SERVICE_AUDIO) {
+		t.Error("service bits")
+	}
+	if s := c.String(); s != "0x5a020c Phone, Smartphone (Networking, Capturing, Object Transfer, Telephony)" {
+		t.Errorf("got %s", s)
+	}
+	for _, v := range []struct {
+		class ClassOfDevice
+		name  string
+	}{
+		{0x240404, "Wearable Headset Device"},
+		{0x002540, "Keyboard"},
+		{0x002580, "Pointing Device"},
+		{0x002508, "Gamepad"},
+		{0x000680, "Printer"},
+		{0x0006a0, "Camera/Printer"},
+		{0x000380, "50% to 67% Utilized"},
+		{0x00010c, "Laptop"},
+		{0x00090c, "Weighing Scale"},
+		{0x00020f, "Smartphone"}, // format type bits ignored
+		{0x000250, "Reserved 0x14"},
+	} {
+		if s := v.class.MinorName(); s != v.name {
+			t.Errorf("0x%06x got %q", uint32(v.class), s)
+		}
+	}
+	if b := c.Bytes(); ParseClassOfDevice(b) != c {
+		t.Errorf("got %x", b)
+	}
+
+	if data, err := json.Marshal(c); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"class":"0x5a020c","major":"Phone","minor":"Smartphone","services":["Networking","Capturing","Object Transfer","Telephony"]}` {
+		t.Errorf("got %s", data)
+	} else {
+		var d ClassOfDevice
+		if err := json.Unmarshal(data, &d); err != nil || d != c {
+			t.Errorf("got 0x%06x %v", uint32(d), err)
+		}
+	}
+	for _, data := range []string{`5898764`, `"0x5a020c"`} {
+		var d ClassOfDevice
+		if err := json.Unmarshal([]byte(data), &d); err != nil || d != c {
+			t.Errorf("%s got 0x%06x %v", data, uint32(d), err)
+		}
+	}
+	var d ClassOfDevice
+	if err := json.Unmarshal([]byte(`"phone"`), &d); err == nil {
+		t.Error("invalid class accepted")
+	}
+
+	if p, err := (EventPkt{Code: EVT_CONN_REQUEST, Params: []byte{1, 2, 3, 4, 5, 6, 0x0c, 0x02, 0x5a, 1}}).Parse(); err != nil {
+		t.Error(err)
+	} else if p.(EvtConnRequest).Class != c {
+		t.Errorf("got %v", p)
+	}
+}
@@ -0,0 +1,278 @@
+// Command blugo-config shows and configures the Bluetooth adapters in the
+// manner of hciconfig, for the systems without the BlueZ utilities:
+//
+//	blugo-config [-json] [-a] [hciN [command [arg]]]
+//
+// With no adapter, it lists all the adapters. The commands are:
+//
+//	up, down, reset   bring the adapter up or down, or reset it
+//	rstat             clear the counters
+//	piscan, pscan, iscan, noscan
+//	                  set the scan mode, page for connectable and inquiry
+//	                  for discoverable
+//	auth, noauth      enable or disable the authentication
+//	encrypt, noencrypt
+//	                  enable or disable the encryption
+//	class [class]     show or set the class of device, such as 0x5a020c
+//	name [name]       show or set the local name
+//
+// It is pure Go, and builds into a static binary with CGO_ENABLED=0.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hkwi/blugo"
+)
+
+type stats struct {
+	RxBytes  uint32 `json:"rx_bytes"`
+	RxAcl    uint32 `json:"rx_acl"`
+	RxSco    uint32 `json:"rx_sco"`
+	RxEvents uint32 `json:"rx_events"`
+	RxErrors uint32 `json:"rx_errors"`
+	TxBytes  uint32 `json:"tx_bytes"`
+	TxAcl    uint32 `json:"tx_acl"`
+	TxSco    uint32 `json:"tx_sco"`
+	TxCmds   uint32 `json:"tx_commands"`
+	TxErrors uint32 `json:"tx_errors"`
+}
+
+type adapter struct {
+	Name    string               `json:"name"`
+	Id      uint16               `json:"id"`
+	Type    string               `json:"type"`
+	Bus     string               `json:"bus"`
+	Address string               `json:"address"`
+	Flags   []string             `json:"flags"`
+	AclMtu  uint16               `json:"acl_mtu"`
+	AclPkts uint16               `json:"acl_pkts"`
+	ScoMtu  uint16               `json:"sco_mtu"`
+	ScoPkts uint16               `json:"sco_pkts"`
+	Stats   stats                `json:"stats"`
+	Class   *blugo.ClassOfDevice `json:"class,omitempty"`
+	Local   string               `json:"local_name,omitempty"`
+	Version *blugo.LocalVersion  `json:"version,omitempty"`
+}
+
+func newAdapter(info blugo.HciDevInfo) adapter {
+	flags := info.DevFlags()
+	return adapter{
+		Name:    info.DevName(),
+		Id:      info.Dev_id,
+		Type:    info.DevType().String(),
+		Bus:     info.Bus().String(),
+		Address: info.Bdaddr.String(),
+		Flags:   strings.Fields(flags.String()),
+		AclMtu:  info.Acl_mtu,
+		AclPkts: info.Acl_pkts,
+		ScoMtu:  info.Sco_mtu,
+		ScoPkts: info.Sco_pkts,
+		Stats: stats{
+			RxBytes:  info.Stat.Byte_rx,
+			RxAcl:    info.Stat.Acl_rx,
+			RxSco:    info.Stat.Sco_rx,
+			RxEvents: info.Stat.Evt_rx,
+			RxErrors: info.Stat.Err_rx,
+			TxBytes:  info.Stat.Byte_tx,
+			TxAcl:    info.Stat.Acl_tx,
+			TxSco:    info.Stat.Sco_tx,
+			TxCmds:   info.Stat.Cmd_tx,
+			TxErrors: info.Stat.Err_tx,
+		},
+	}
+}
+
+// readDetails fills the details that take the HCI commands, which the
+// adapter answers only when it is up.
+func (self *adapter) readDetails() error {
+	dev, err := blugo.NewHciDev(self.Id)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	if class, err := dev.ReadClassOfDevice(); err != nil {
+		return err
+	} else {
+		self.Class = &class
+	}
+	if name, err := dev.ReadLocalName(); err != nil {
+		return err
+	} else {
+		self.Local = name
+	}
+	if version, err := dev.ReadLocalVersion(); err != nil {
+		return err
+	} else {
+		self.Version = &version
+	}
+	return nil
+}
+
+func (self adapter) print() {
+	fmt.Printf("%s:\tType: %s  Bus: %s\n", self.Name, self.Type, self.Bus)
+	fmt.Printf("\tBD Address: %s  ACL MTU: %d:%d  SCO MTU: %d:%d\n",
+		self.Address, self.AclMtu, self.AclPkts, self.ScoMtu, self.ScoPkts)
+	fmt.Printf("\t%s\n", strings.Join(self.Flags, " "))
+	fmt.Printf("\tRX bytes:%d acl:%d sco:%d events:%d errors:%d\n",
+		self.Stats.RxBytes, self.Stats.RxAcl, self.Stats.RxSco, self.Stats.RxEvents, self.Stats.RxErrors)
+	fmt.Printf("\tTX bytes:%d acl:%d sco:%d commands:%d errors:%d\n",
+		self.Stats.TxBytes, self.Stats.TxAcl, self.Stats.TxSco, self.Stats.TxCmds, self.Stats.TxErrors)
+	if self.Class != nil {
+		fmt.Printf("\tClass: %v\n", *self.Class)
+	}
+	if self.Version != nil {
+		fmt.Printf("\tName: %q\n", self.Local)
+		fmt.Printf("\t%v\n", *self.Version)
+	}
+	fmt.Println()
+}
+
+func output(jsonOut bool, v interface{}, text func()) {
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		text()
+	}
+}
+
+func parseDev(s string) (uint16, error) {
+	if id, err := strconv.ParseUint(strings.TrimPrefix(s, "hci"), 10, 16); err != nil {
+		return 0, fmt.Errorf("invalid adapter %q", s)
+	} else {
+		return uint16(id), nil
+	}
+}
+
+var scanModes = map[string]uint32{
+	"noscan": blugo.SCAN_DISABLED,
+	"iscan":  blugo.SCAN_INQUIRY,
+	"pscan":  blugo.SCAN_PAGE,
+	"piscan": blugo.SCAN_PAGE | blugo.SCAN_INQUIRY,
+}
+
+func command(hci blugo.Hci, id uint16, jsonOut bool, cmd string, args []string) error {
+	if mode, ok := scanModes[cmd]; ok {
+		return hci.SetScan(id, mode)
+	}
+	switch cmd {
+	case "up":
+		return hci.DevUp(id)
+	case "down":
+		return hci.DevDown(id)
+	case "reset":
+		return hci.DevReset(id)
+	case "rstat":
+		return hci.ResetStats(id)
+	case "auth", "noauth":
+		return hci.SetAuth(id, cmd == "auth")
+	case "encrypt", "noencrypt":
+		return hci.SetEncrypt(id, cmd == "encrypt")
+	case "class":
+		dev, err := blugo.NewHciDev(id)
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+		if len(args) > 0 {
+			if v, err := strconv.ParseUint(args[0], 0, 24); err != nil {
+				return fmt.Errorf("invalid class %q", args[0])
+			} else {
+				return dev.WriteClassOfDevice(blugo.ClassOfDevice(v))
+			}
+		}
+		if class, err := dev.ReadClassOfDevice(); err != nil {
+			return err
+		} else {
+			output(jsonOut, class, func() { fmt.Printf("Class: %v\n", class) })
+		}
+	case "name":
+		dev, err := blugo.NewHciDev(id)
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+		if len(args) > 0 {
+			return dev.WriteLocalName(args[0])
+		}
+		if name, err := dev.ReadLocalName(); err != nil {
+			return err
+		} else {
+			output(jsonOut, map[string]string{"name": name}, func() { fmt.Printf("Name: %q\n", name) })
+		}
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("blugo-config: ")
+	jsonOut := flag.Bool("json", false, "output in JSON")
+	all := flag.Bool("a", false, "show the class, the name and the version of the adapters that are up")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-json] [-a] [hciN [command [arg]]]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "commands: up down reset rstat piscan pscan iscan noscan auth noauth encrypt noencrypt class [class] name [name]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	hci, err := blugo.NewHci()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hci.Close()
+
+	var ids []uint16
+	if flag.NArg() > 0 {
+		if id, err := parseDev(flag.Arg(0)); err != nil {
+			log.Fatal(err)
+		} else {
+			ids = append(ids, id)
+		}
+	} else if reqs, err := hci.GetDevList(); err != nil {
+		log.Fatal(err)
+	} else {
+		for _, req := range reqs {
+			ids = append(ids, req.Id)
+		}
+	}
+
+	if flag.NArg() > 1 {
+		if err := command(hci, ids[0], *jsonOut, flag.Arg(1), flag.Args()[2:]); err != nil {
+			log.Fatalf("%s %s: %v", flag.Arg(0), flag.Arg(1), err)
+		}
+		return
+	}
+
+	var adapters []adapter
+	for _, id := range ids {
+		if info, err := hci.GetDevInfo(id); err != nil {
+			log.Fatalf("hci%d: %v", id, err)
+		} else {
+			a := newAdapter(info)
+			if *all && info.DevFlags().Has(blugo.HCI_UP) {
+				if err := a.readDetails(); err != nil {
+					log.Printf("%s: %v", a.Name, err)
+				}
+			}
+			adapters = append(adapters, a)
+		}
+	}
+	output(*jsonOut, adapters, func() {
+		for _, a := range adapters {
+			a.print()
+		}
+	})
+}
@@ -0,0 +1,332 @@
+// Command blugo-tool scans for the Bluetooth devices and sends the HCI
+// commands in the manner of hcitool, for the systems without the BlueZ
+// utilities:
+//
+//	blugo-tool [-i hciN] command [args]
+//
+// The commands are:
+//
+//	lescan [-duplicates] [-passive] [-timeout d]
+//	                  LE scan, decoding the advertising data
+//	scan [-length n] [-flush]
+//	                  classic inquiry, with the names of the devices
+//	name bdaddr       remote name request
+//	rssi bdaddr       RSSI of the connection
+//	lq bdaddr         link quality of the connection
+//	con               connections of the adapter
+//	cmd ogf ocf [bytes]
+//	                  raw HCI command, such as "cmd 0x03 0x0014"
+//	info bdaddr       remote name, version and features, connecting to
+//	                  the device unless connected
+//
+// It is pure Go, and builds into a static binary with CGO_ENABLED=0.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hkwi/blugo"
+)
+
+var devId uint16
+
+func openDev() blugo.HciDev {
+	dev, err := blugo.NewHciDev(devId)
+	if err != nil {
+		log.Fatalf("hci%d: %v", devId, err)
+	}
+	return dev
+}
+
+// interruptible returns the context that SIGINT cancels.
+func interruptible(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
+
+func parseAddr(args []string) blugo.Bdaddr {
+	if len(args) < 1 {
+		log.Fatal("bdaddr required")
+	}
+	addr, err := blugo.ParseMAC(args[0])
+	if err != nil {
+		log.Fatalf("invalid bdaddr %q", args[0])
+	}
+	return addr
+}
+
+func connHandle(dev blugo.HciDev, addr blugo.Bdaddr) uint16 {
+	handle, err := dev.ConnHandle(addr)
+	if err != nil {
+		log.Fatalf("%v: not connected: %v", addr, err)
+	}
+	return handle
+}
+
+func lescan(args []string) {
+	fs := flag.NewFlagSet("lescan", flag.ExitOnError)
+	duplicates := fs.Bool("duplicates", false, "report the devices every time")
+	passive := fs.Bool("passive", false, "passive scan, without the scan responses")
+	timeout := fs.Duration("timeout", 0, "stop after the duration")
+	fs.Parse(args)
+
+	dev := openDev()
+	defer dev.Close()
+	scanner := blugo.NewScanner(dev)
+	scanner.Active = !*passive
+	scanner.FilterDuplicates = !*duplicates
+	if err := scanner.Start(); err != nil {
+		log.Fatalf("start scan: %v", err)
+	}
+	defer scanner.Stop()
+
+	ctx, cancel := interruptible(*timeout)
+	defer cancel()
+	seen := make(map[blugo.LeAddr]bool)
+	fmt.Println("LE Scan ...")
+	err := scanner.Reports(ctx, func(r blugo.LeAdvertisingReport) error {
+		// The scan responses come after the advertisements of the same
+		// address, and are shown as well.
+		if !*duplicates && r.EventType != blugo.ADV_REPORT_SCAN_RSP {
+			if seen[r.Addr] {
+				return nil
+			}
+			seen[r.Addr] = true
+		}
+		fmt.Printf("%v rssi %d\n", r.Addr, r.Rssi)
+		for _, s := range r.Data {
+			fmt.Printf("\t%v\n", s)
+		}
+		if b, ok := r.Data.Beacon(); ok {
+			fmt.Printf("\t%T %+v\n", b, b)
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+func scan(args []string) {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	length := fs.Uint("length", 8, "inquiry length in 1.28 sec units")
+	flush := fs.Bool("flush", false, "drop the results of the previous inquiries")
+	fs.Parse(args)
+
+	hci, err := blugo.NewHci()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hci.Close()
+	var flags uint16
+	if *flush {
+		flags |= blugo.IREQ_CACHE_FLUSH
+	}
+	fmt.Println("Scanning ...")
+	infos, err := hci.Inquiry(devId, uint8(*length), 0, flags)
+	if err != nil {
+		log.Fatalf("inquiry: %v", err)
+	}
+
+	dev := openDev()
+	defer dev.Close()
+	for _, info := range infos {
+		ctx, cancel := interruptible(10 * time.Second)
+		name, err := dev.RemoteName(ctx, info.Bdaddr, info.ConnectOptions())
+		cancel()
+		if err != nil {
+			name = "n/a"
+		}
+		fmt.Printf("\t%v\t%s\t%v\n", info.Bdaddr, name, info.Class)
+	}
+}
+
+func name(args []string) {
+	addr := parseAddr(args)
+	dev := openDev()
+	defer dev.Close()
+	ctx, cancel := interruptible(10 * time.Second)
+	defer cancel()
+	if name, err := dev.RemoteName(ctx, addr, nil); err != nil {
+		log.Fatalf("%v: %v", addr, err)
+	} else {
+		fmt.Println(name)
+	}
+}
+
+func rssi(args []string) {
+	addr := parseAddr(args)
+	dev := openDev()
+	defer dev.Close()
+	if rssi, err := dev.ReadRSSI(connHandle(dev, addr)); err != nil {
+		log.Fatalf("read RSSI: %v", err)
+	} else {
+		fmt.Printf("RSSI return value: %d\n", rssi)
+	}
+}
+
+func lq(args []string) {
+	addr := parseAddr(args)
+	dev := openDev()
+	defer dev.Close()
+	if lq, err := dev.ReadLinkQuality(connHandle(dev, addr)); err != nil {
+		log.Fatalf("read link quality: %v", err)
+	} else {
+		fmt.Printf("Link quality: %d\n", lq)
+	}
+}
+
+func con(args []string) {
+	hci, err := blugo.NewHci()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hci.Close()
+	conns, err := hci.GetConnList(devId)
+	if err != nil {
+		log.Fatalf("hci%d: %v", devId, err)
+	}
+	fmt.Println("Connections:")
+	for _, c := range conns {
+		dir := ">"
+		if c.Out != 0 {
+			dir = "<"
+		}
+		fmt.Printf("\t%s %v %v handle %d state %d lm %v\n",
+			dir, blugo.LinkType(c.Type), c.Bdaddr, c.Handle, c.State, blugo.LinkMode(c.Mode))
+	}
+}
+
+func cmd(args []string) {
+	if len(args) < 2 {
+		log.Fatal("ogf and ocf required")
+	}
+	ogf, err := strconv.ParseUint(args[0], 0, 6)
+	if err != nil {
+		log.Fatalf("invalid ogf %q", args[0])
+	}
+	ocf, err := strconv.ParseUint(args[1], 0, 10)
+	if err != nil {
+		log.Fatalf("invalid ocf %q", args[1])
+	}
+	var params []byte
+	for _, arg := range args[2:] {
+		if b, err := strconv.ParseUint(strings.TrimPrefix(arg, "0x"), 16, 8); err != nil {
+			log.Fatalf("invalid byte %q", arg)
+		} else {
+			params = append(params, uint8(b))
+		}
+	}
+	opcode := blugo.MakeOpCode(uint8(ogf), uint16(ocf))
+
+	dev := openDev()
+	defer dev.Close()
+	fmt.Printf("< %v\n", blugo.CommandPkt{OpCode: opcode, Params: params})
+	if ret, err := dev.RequestRaw(opcode, params); err != nil {
+		log.Fatal(err)
+	} else if ret == nil {
+		fmt.Println("> Command Status: Success (0x00)")
+	} else {
+		fmt.Printf("> %s\n", hex.EncodeToString(ret))
+		ev := blugo.EvtCmdComplete{Ncmd: 1, OpCode: uint16(opcode), Params: ret}
+		fmt.Printf("  %s\n", strings.Replace(ev.String(), "\n", "\n  ", -1))
+	}
+}
+
+func info(args []string) {
+	addr := parseAddr(args)
+	dev := openDev()
+	defer dev.Close()
+	ctx, cancel := interruptible(20 * time.Second)
+	defer cancel()
+
+	fmt.Println("Requesting information ...")
+	handle, err := dev.ConnHandle(addr)
+	if err != nil {
+		if handle, err = dev.Connect(ctx, addr, nil); err != nil {
+			log.Fatalf("connect %v: %v", addr, err)
+		}
+		defer dev.Disconnect(handle, blugo.HCI_OE_USER_ENDED_CONNECTION)
+	}
+	fmt.Printf("\tBD Address:  %v\n", addr)
+	if name, err := dev.RemoteName(ctx, addr, nil); err == nil {
+		fmt.Printf("\tDevice Name: %s\n", name)
+	}
+	if ver, err := dev.ReadRemoteVersion(ctx, handle); err != nil {
+		log.Printf("read remote version: %v", err)
+	} else {
+		fmt.Printf("\tLMP Version: %v (0x%x) LMP Subversion: 0x%x\n", ver.LmpVersion, uint8(ver.LmpVersion), ver.LmpSubversion)
+		fmt.Printf("\tManufacturer: %v (%d)\n", ver.Manufacturer, uint16(ver.Manufacturer))
+	}
+	if features, err := dev.ReadRemoteFeatures(ctx, handle); err != nil {
+		log.Printf("read remote features: %v", err)
+	} else {
+		fmt.Printf("\tFeatures: %v\n", features)
+		for _, name := range features.Names() {
+			fmt.Printf("\t\t<%s>\n", name)
+		}
+	}
+}
+
+var commands = map[string]func([]string){
+	"lescan": lescan,
+	"scan":   scan,
+	"name":   name,
+	"rssi":   rssi,
+	"lq":     lq,
+	"con":    con,
+	"cmd":    cmd,
+	"info":   info,
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("blugo-tool: ")
+	dev := flag.String("i", "hci0", "adapter")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-i hciN] command [args]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "commands: lescan scan name rssi lq con cmd info")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if id, err := strconv.ParseUint(strings.TrimPrefix(*dev, "hci"), 10, 16); err != nil {
+		log.Fatalf("invalid adapter %q", *dev)
+	} else {
+		devId = uint16(id)
+	}
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if run, ok := commands[flag.Arg(0)]; !ok {
+		flag.Usage()
+		os.Exit(2)
+	} else {
+		run(flag.Args()[1:])
+	}
+}
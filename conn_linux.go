@@ -0,0 +1,256 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.1 and 7.2
+// BR/EDR connection management built on Link Control and Link Policy commands.
+
+type ConnectOptions struct {
+	PacketType      uint16 // HCI_DM1|HCI_DH1|... 0 means DM/DH 1,3,5 slots
+	PageScanRepMode uint8
+	ClockOffset     uint16 // bit 15 set when valid
+	NoRoleSwitch    bool
+}
+
+const defaultPacketType = 0xCC18 // DM1 DH1 DM3 DH3 DM5 DH5
+
+func statusError(ret Parameters) error {
+	if len(ret) == 0 {
+		return nil
+	} else if status, ok := ret[0].(uint8); ok && status != 0 {
+		return HciError(status)
+	}
+	return nil
+}
+
+// Connect creates an ACL connection to addr and returns the connection handle.
+// Cancelling ctx while paging issues Create Connection Cancel.
+func (self HciDev) Connect(ctx context.Context, addr Bdaddr, opts *ConnectOptions) (uint16, error) {
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+	ptype := opts.PacketType
+	if ptype == 0 {
+		ptype = defaultPacketType
+	}
+	rep := opts.PageScanRepMode
+	if rep == 0 {
+		rep = 0x02
+	}
+	var roleSwitch uint8 = 0x01
+	if opts.NoRoleSwitch {
+		roleSwitch = 0x00
+	}
+
+	var handle uint16
+	err := self.exchange(ctx, HCI_Create_Connection, []Parameter{
+		addr,
+		ptype,
+		rep,
+		uint8(0), // reserved
+		opts.ClockOffset,
+		roleSwitch,
+	}, []int{EVT_CONN_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtConnComplete); ok && ev.Bdaddr == addr && ev.LinkType == ACL_LINK {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			handle = ev.Handle
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		self.Request(HCI_Create_Connection_Cancel, addr)
+	}
+	return handle, err
+}
+
+// Disconnect terminates the connection and waits for Disconnection Complete.
+// The reason should be one of HCI_OE_USER_ENDED_CONNECTION, HCI_OE_LOW_RESOURCES,
+// HCI_OE_POWER_OFF, HCI_AUTHENTICATION_FAILURE, HCI_UNSUPPORTED_REMOTE_FEATURE
+// or HCI_PAIRING_NOT_SUPPORTED.
+func (self HciDev) Disconnect(handle uint16, reason HciError) error {
+	return self.exchange(context.Background(), HCI_Disconnect, []Parameter{
+		handle,
+		uint8(reason),
+	}, []int{EVT_DISCONN_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtDisconnComplete); ok && ev.Handle == handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// NextConnectionRequest waits for an incoming Connection Request event.
+// The kernel may answer the request by itself when the adapter is up and
+// managed by the kernel stack.
+func (self HciDev) NextConnectionRequest(ctx context.Context) (EvtConnRequest, error) {
+	var ret EvtConnRequest
+	err := self.exchange(ctx, 0, nil, []int{EVT_CONN_REQUEST}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtConnRequest); ok {
+			ret = ev
+			return true, nil
+		}
+		return false, nil
+	})
+	return ret, err
+}
+
+// AcceptConnection accepts the incoming connection from addr. role is either
+// HCI_ROLE_MASTER to switch role, or HCI_ROLE_SLAVE to remain.
+func (self HciDev) AcceptConnection(ctx context.Context, addr Bdaddr, role uint8) (uint16, error) {
+	var handle uint16
+	err := self.exchange(ctx, HCI_Accept_Connection_Request, []Parameter{
+		addr,
+		role,
+	}, []int{EVT_CONN_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtConnComplete); ok && ev.Bdaddr == addr {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			handle = ev.Handle
+			return true, nil
+		}
+		return false, nil
+	})
+	return handle, err
+}
+
+// RejectConnection rejects the incoming connection from addr. The reason
+// should be one of HCI_REJECTED_LIMITED_RESOURCES, HCI_REJECTED_SECURITY or
+// HCI_REJECTED_PERSONAL.
+func (self HciDev) RejectConnection(ctx context.Context, addr Bdaddr, reason HciError) error {
+	return self.exchange(ctx, HCI_Reject_Connection_Request, []Parameter{
+		addr,
+		uint8(reason),
+	}, []int{EVT_CONN_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtConnComplete); ok && ev.Bdaddr == addr {
+			if ev.Status == 0 {
+				return true, HciError(HCI_UNSPECIFIED_ERROR)
+			}
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// SwitchRole changes the role of this device in the connection with addr,
+// either HCI_ROLE_MASTER or HCI_ROLE_SLAVE.
+func (self HciDev) SwitchRole(ctx context.Context, addr Bdaddr, role uint8) error {
+	return self.exchange(ctx, HCI_Switch_Role, []Parameter{
+		addr,
+		role,
+	}, []int{EVT_ROLE_CHANGE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtRoleChange); ok && ev.Bdaddr == addr {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// RoleDiscovery returns the current role of this device in the connection.
+func (self HciDev) RoleDiscovery(handle uint16) (uint8, error) {
+	if ret, err := self.Request(HCI_Role_Discovery, handle); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return ret[2].(uint8), nil
+	}
+}
+
+func (self HciDev) ReadLinkPolicy(handle uint16) (LinkPolicy, error) {
+	if ret, err := self.Request(HCI_Read_Link_Policy_Settings, handle); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return LinkPolicy(ret[2].(uint16)), nil
+	}
+}
+
+func (self HciDev) WriteLinkPolicy(handle uint16, policy LinkPolicy) error {
+	if ret, err := self.Request(HCI_Write_Link_Policy_Settings, handle, uint16(policy)); err != nil {
+		return err
+	} else {
+		return statusError(ret)
+	}
+}
+
+func (self HciDev) WriteDefaultLinkPolicy(policy LinkPolicy) error {
+	if ret, err := self.Request(HCI_Write_Default_Link_Policy_Settings, uint16(policy)); err != nil {
+		return err
+	} else {
+		return statusError(ret)
+	}
+}
+
+func (self HciDev) modeChange(ctx context.Context, opcode OpCode, handle uint16, params ...Parameter) (EvtModeChange, error) {
+	var ret EvtModeChange
+	err := self.exchange(ctx, opcode, append([]Parameter{handle}, params...), []int{EVT_MODE_CHANGE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtModeChange); ok && ev.Handle == handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			ret = ev
+			return true, nil
+		}
+		return false, nil
+	})
+	return ret, err
+}
+
+// HoldMode puts the connection in hold mode. Intervals are in 0.625 msec slots.
+func (self HciDev) HoldMode(ctx context.Context, handle, maxInterval, minInterval uint16) (EvtModeChange, error) {
+	return self.modeChange(ctx, HCI_Hold_Mode, handle, maxInterval, minInterval)
+}
+
+// SniffMode puts the connection in sniff mode. Intervals, attempt and
+// timeout are in 0.625 msec slots.
+func (self HciDev) SniffMode(ctx context.Context, handle, maxInterval, minInterval, attempt, timeout uint16) (EvtModeChange, error) {
+	return self.modeChange(ctx, HCI_Sniff_Mode, handle, maxInterval, minInterval, attempt, timeout)
+}
+
+func (self HciDev) ExitSniffMode(ctx context.Context, handle uint16) (EvtModeChange, error) {
+	return self.modeChange(ctx, HCI_Exit_Sniff_Mode, handle)
+}
+
+// ParkState puts the connection in park state. Beacon intervals are in
+// 0.625 msec slots.
+func (self HciDev) ParkState(ctx context.Context, handle, maxBeaconInterval, minBeaconInterval uint16) (EvtModeChange, error) {
+	return self.modeChange(ctx, HCI_Park_State, handle, maxBeaconInterval, minBeaconInterval)
+}
+
+func (self HciDev) ExitParkState(ctx context.Context, handle uint16) (EvtModeChange, error) {
+	return self.modeChange(ctx, HCI_Exit_Park_State, handle)
+}
+
+// ReadClockOffset returns the clock offset of the remote device, which may
+// be used for ConnectOptions.ClockOffset of later connections.
+func (self HciDev) ReadClockOffset(ctx context.Context, handle uint16) (uint16, error) {
+	var offset uint16
+	err := self.exchange(ctx, HCI_Read_Clock_Offset, []Parameter{
+		handle,
+	}, []int{EVT_READ_CLOCK_OFFSET_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtReadClockOffsetComplete); ok && ev.Handle == handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			offset = ev.ClockOffset
+			return true, nil
+		}
+		return false, nil
+	})
+	return offset, err
+}
@@ -0,0 +1,192 @@
+// Package crypto implements the cryptographic toolbox of the Security
+// Manager. Values are in the most significant octet first order of the
+// specification, while PDUs and HCI carry them in the little endian order;
+// Swap converts between them.
+//
+// Bluetooth Core specification, Vol 3, Part H, Section 2.2
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// Swap returns the octets in the reversed order.
+func Swap(b []byte) []byte {
+	ret := make([]byte, len(b))
+	for i, v := range b {
+		ret[len(b)-1-i] = v
+	}
+	return ret
+}
+
+func xor(a, b []byte) []byte {
+	ret := make([]byte, len(a))
+	for i := range a {
+		ret[i] = a[i] ^ b[i]
+	}
+	return ret
+}
+
+func concat(msgs ...[]byte) []byte {
+	var ret []byte
+	for _, m := range msgs {
+		ret = append(ret, m...)
+	}
+	return ret
+}
+
+// E is the security function e, AES-128 of a 128 bit block.
+func E(key, plaintext []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	ret := make([]byte, 16)
+	block.Encrypt(ret, plaintext)
+	return ret
+}
+
+// AesCmac is AES-CMAC of RFC 4493 over the concatenated messages.
+func AesCmac(key []byte, msgs ...[]byte) []byte {
+	msg := concat(msgs...)
+	shift := func(b []byte) []byte {
+		ret := make([]byte, 16)
+		for i := 0; i < 16; i++ {
+			ret[i] = b[i] << 1
+			if i < 15 {
+				ret[i] |= b[i+1] >> 7
+			}
+		}
+		if b[0]&0x80 != 0 {
+			ret[15] ^= 0x87
+		}
+		return ret
+	}
+	k1 := shift(E(key, make([]byte, 16)))
+	k2 := shift(k1)
+
+	n := (len(msg) + 15) / 16
+	var last []byte
+	if n > 0 && len(msg)%16 == 0 {
+		last = xor(msg[16*(n-1):], k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		pad := make([]byte, 16)
+		rest := msg[16*(n-1):]
+		copy(pad, rest)
+		pad[len(rest)] = 0x80
+		last = xor(pad, k2)
+	}
+	x := make([]byte, 16)
+	for i := 0; i < n-1; i++ {
+		x = E(key, xor(x, msg[16*i:16*i+16]))
+	}
+	return E(key, xor(x, last))
+}
+
+// Ah is the random address hash function, of which r and the result are
+// 24 bits.
+func Ah(k, r []byte) []byte {
+	return E(k, append(make([]byte, 13), r...))[13:]
+}
+
+// C1 is the confirm value generation function of LE legacy pairing. preq
+// and pres are the 7 octet commands, ia and ra 6 octet addresses.
+func C1(k, r, preq, pres []byte, iat uint8, ia []byte, rat uint8, ra []byte) []byte {
+	p1 := concat(pres, preq, []byte{rat, iat})
+	p2 := concat(make([]byte, 4), ia, ra)
+	return E(k, xor(E(k, xor(r, p1)), p2))
+}
+
+// S1 is the key generation function of LE legacy pairing.
+func S1(k, r1, r2 []byte) []byte {
+	return E(k, concat(r1[8:], r2[8:]))
+}
+
+// F4 is the confirm value generation function of LE Secure Connections.
+func F4(u, v, x []byte, z uint8) []byte {
+	return AesCmac(x, u, v, []byte{z})
+}
+
+var f5Salt = []byte{0x6C, 0x88, 0x83, 0x91, 0xAA, 0xF5, 0xA5, 0x38, 0x60, 0x37, 0x0B, 0xDB, 0x5A, 0x60, 0x83, 0xBE}
+
+// F5 is the key generation function of LE Secure Connections, which
+// returns MacKey and LTK. a1 and a2 are 7 octets of the address type and
+// the address.
+func F5(w, n1, n2, a1, a2 []byte) ([]byte, []byte) {
+	t := AesCmac(f5Salt, w)
+	keyID := []byte{0x62, 0x74, 0x6c, 0x65}
+	length := []byte{0x01, 0x00}
+	macKey := AesCmac(t, []byte{0}, keyID, n1, n2, a1, a2, length)
+	ltk := AesCmac(t, []byte{1}, keyID, n1, n2, a1, a2, length)
+	return macKey, ltk
+}
+
+// F6 is the check value generation function of LE Secure Connections.
+func F6(w, n1, n2, r, ioCap, a1, a2 []byte) []byte {
+	return AesCmac(w, n1, n2, r, ioCap, a1, a2)
+}
+
+// G2 is the numeric comparison value generation function. The six digit
+// value is the result modulo 1000000.
+func G2(u, v, x, y []byte) uint32 {
+	return binary.BigEndian.Uint32(AesCmac(x, u, v, y)[12:])
+}
+
+// H6 is the link key conversion function.
+func H6(w, keyID []byte) []byte {
+	return AesCmac(w, keyID)
+}
+
+// H7 is the link key conversion function with the salt, used when CT2 is
+// supported.
+func H7(salt, w []byte) []byte {
+	return AesCmac(salt, w)
+}
+
+// P-256 elliptic curve Diffie-Hellman of LE Secure Connections,
+// Section 2.3.5.6.1
+
+// GenerateKey generates a P-256 key pair.
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.P256().GenerateKey(rand.Reader)
+}
+
+// PublicKeyXY returns the coordinates of the public key.
+func PublicKeyXY(key *ecdh.PrivateKey) ([]byte, []byte) {
+	raw := key.PublicKey().Bytes()
+	return raw[1:33], raw[33:65]
+}
+
+// ParsePublicKey makes the public key of the coordinates, which must be on
+// the curve.
+func ParsePublicKey(x, y []byte) (*ecdh.PublicKey, error) {
+	if len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("crypto: invalid coordinate length")
+	}
+	return ecdh.P256().NewPublicKey(concat([]byte{4}, x, y))
+}
+
+// DHKey computes the shared secret, the x coordinate of the product.
+func DHKey(key *ecdh.PrivateKey, peer *ecdh.PublicKey) ([]byte, error) {
+	return key.ECDH(peer)
+}
+
+// DebugKey returns the debug key pair of Section 2.3.5.6.1, which sniffers
+// use to decrypt the traffic. It must not be used outside of tests.
+func DebugKey() *ecdh.PrivateKey {
+	key, err := ecdh.P256().NewPrivateKey([]byte{
+		0x3f, 0x49, 0xf6, 0xd4, 0xa3, 0xc5, 0x5f, 0x38, 0x74, 0xc9, 0xb3, 0xe3, 0xd2, 0x10, 0x3f, 0x50,
+		0x4a, 0xff, 0x60, 0x7b, 0xeb, 0x40, 0xb7, 0x99, 0x58, 0x99, 0xb8, 0xa6, 0xcd, 0x3c, 0x1a, 0xbd,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
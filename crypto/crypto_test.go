@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// RFC 4493, Section 4
+func TestAesCmac(t *testing.T) {
+	key := unhex("2b7e1516 28aed2a6 abf71588 09cf4f3c")
+	msg := unhex("6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51" +
+		"30c81c46 a35ce411 e5fbc119 1a0a52ef f69f2445 df4f9b17 ad2b417b e66c3710")
+	for _, v := range []struct {
+		n   int
+		mac string
+	}{
+		{0, "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{16, "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+		{40, "dfa66747 de9ae630 30ca3261 1497c827"},
+		{64, "51f0bebf 7e3b9d92 fc497417 79363cfe"},
+	} {
+		if mac := AesCmac(key, msg[:v.n]); !bytes.Equal(mac, unhex(v.mac)) {
+			t.Errorf("%d octets got %x", v.n, mac)
+		}
+	}
+}
+
+// Bluetooth Core specification, Vol 3, Part H, Appendix D
+func TestToolbox(t *testing.T) {
+	u := unhex("20b003d2 f297be2c 5e2c83a7 e9f9a5b9 eff49111 acf4fddb cc030148 0e359de6")
+	v := unhex("55188b3d 32f6bb9a 900afcfb eed4e72a 59cb9ac2 f19d7cfb 6b4fdd49 f47fc5fd")
+	x := unhex("d5cb8454 d177733e ffffb2ec 712baeab")
+	if got := F4(u, v, x, 0); !bytes.Equal(got, unhex("f2c916f1 07a9bd1c f1eda1be a974872d")) {
+		t.Errorf("f4 %x", got)
+	}
+
+	w := unhex("ec0234a3 57c8ad05 341010a6 0a397d9b 99796b13 b4f866f1 868d34f3 73bfa698")
+	n1 := unhex("d5cb8454 d177733e ffffb2ec 712baeab")
+	n2 := unhex("a6e8e7cc 25a75f6e 216583f7 ff3dc4cf")
+	a1 := unhex("00561237 37bfce")
+	a2 := unhex("00a71370 2dcfc1")
+	macKey, ltk := F5(w, n1, n2, a1, a2)
+	if !bytes.Equal(macKey, unhex("2965f176 a1084a02 fd3f6a20 ce636e20")) {
+		t.Errorf("f5 mackey %x", macKey)
+	}
+	if !bytes.Equal(ltk, unhex("69867911 69d7cd23 980522b5 94750a38")) {
+		t.Errorf("f5 ltk %x", ltk)
+	}
+
+	r := unhex("12a3343b b453bb54 08da42d2 0c2d0fc8")
+	if got := F6(macKey, n1, n2, r, unhex("010102"), a1, a2); !bytes.Equal(got, unhex("e3c47398 9cd0e8c5 d26c0b09 da958f61")) {
+		t.Errorf("f6 %x", got)
+	}
+	if got := G2(u, v, x, n2); got != 0x2f9ed5ba {
+		t.Errorf("g2 %x", got)
+	}
+
+	key := unhex("ec0234a3 57c8ad05 341010a6 0a397d9b")
+	if got := H6(key, unhex("6c656272")); !bytes.Equal(got, unhex("2d9ae102 e76dc91c e8d3a9e2 80b16399")) {
+		t.Errorf("h6 %x", got)
+	}
+	if got := H7(unhex("00000000 00000000 00000000 746D7031"), key); !bytes.Equal(got, unhex("fb173597 c6a3c0ec d2998c2a 75a57011")) {
+		t.Errorf("h7 %x", got)
+	}
+	if got := Ah(key, unhex("708194")); !bytes.Equal(got, unhex("0dfbaa")) {
+		t.Errorf("ah %x", got)
+	}
+
+	k := make([]byte, 16)
+	confirm := C1(k, unhex("5783D521 56AD6F0E 6388274E C6702EE0"),
+		unhex("07071000 000101"), unhex("05000800 000302"),
+		1, unhex("A1A2A3A4A5A6"), 0, unhex("B1B2B3B4B5B6"))
+	if !bytes.Equal(confirm, unhex("1e1e3fef 878988ea d2a74dc5 bef13b86")) {
+		t.Errorf("c1 %x", confirm)
+	}
+	stk := S1(k, unhex("000F0E0D 0C0B0A09 11223344 55667788"), unhex("01020304 05060708 99AABBCC DDEEFF00"))
+	if !bytes.Equal(stk, unhex("9a1fe1f0 e8b0f49b 5b4216ae 796da062")) {
+		t.Errorf("s1 %x", stk)
+	}
+}
+
+// Bluetooth Core specification, Vol 3, Part H, Section 2.3.5.6.1 and
+// Appendix D.1
+func TestECDH(t *testing.T) {
+	a := DebugKey()
+	if x, y := PublicKeyXY(a); !bytes.Equal(x, unhex("20b003d2 f297be2c 5e2c83a7 e9f9a5b9 eff49111 acf4fddb cc030148 0e359de6")) ||
+		!bytes.Equal(y, unhex("dc809c49 652aeb6d 63329abf 5a52155c 766345c2 8fed3024 741c8ed0 1589d28b")) {
+		t.Errorf("debug public key %x %x", x, y)
+	}
+	b, err := ecdh.P256().NewPrivateKey(unhex("55188b3d 32f6bb9a 900afcfb eed4e72a 59cb9ac2 f19d7cfb 6b4fdd49 f47fc5fd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bx, by := PublicKeyXY(b)
+	if !bytes.Equal(bx, unhex("1ea1f0f0 1faf1d96 09592284 f19e4c00 47b58afd 8615a69f 559077b2 2faaa190")) ||
+		!bytes.Equal(by, unhex("4c55f33e 429dad37 7356703a 9ab85160 472d1130 e28e3676 5f89aff9 15b1214a")) {
+		t.Errorf("public key b %x %x", bx, by)
+	}
+	pub, err := ParsePublicKey(bx, by)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dhkey, err := DHKey(a, pub); err != nil || !bytes.Equal(dhkey, unhex("ec0234a3 57c8ad05 341010a6 0a397d9b 99796b13 b4f866f1 868d34f3 73bfa698")) {
+		t.Errorf("dhkey %x %v", dhkey, err)
+	}
+	if _, err := ParsePublicKey(bx, bx); err == nil {
+		t.Error("point not on the curve must be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+// +build linux
+
+package blugo
+
+import (
+	"bytes"
+	"strings"
+	"unsafe"
+)
+
+// Adapter flags, the bit numbers of HciDevInfo.Flags
+const (
+	HCI_UP = iota
+	HCI_INIT
+	HCI_RUNNING
+	HCI_PSCAN
+	HCI_ISCAN
+	HCI_AUTH
+	HCI_ENCRYPT
+	HCI_INQUIRY
+	HCI_RAW
+)
+
+type HciDevFlags uint32
+
+var hciDevFlagNames = []string{
+	HCI_UP:      "UP",
+	HCI_INIT:    "INIT",
+	HCI_RUNNING: "RUNNING",
+	HCI_PSCAN:   "PSCAN",
+	HCI_ISCAN:   "ISCAN",
+	HCI_AUTH:    "AUTH",
+	HCI_ENCRYPT: "ENCRYPT",
+	HCI_INQUIRY: "INQUIRY",
+	HCI_RAW:     "RAW",
+}
+
+func (self HciDevFlags) Has(flag int) bool {
+	return self&(1<<uint(flag)) != 0
+}
+
+// String shows the flags in the form of hciconfig, such as
+// "UP RUNNING PSCAN".
+func (self HciDevFlags) String() string {
+	var comps []string
+	if !self.Has(HCI_UP) {
+		comps = append(comps, "DOWN")
+	}
+	for flag, name := range hciDevFlagNames {
+		if self.Has(flag) {
+			comps = append(comps, name)
+		}
+	}
+	return strings.Join(comps, " ")
+}
+
+// Scan modes of SetScan, same as Write_Scan_Enable
+const (
+	SCAN_DISABLED = 0x00
+	SCAN_INQUIRY  = 0x01
+	SCAN_PAGE     = 0x02
+)
+
+func (self HciDevInfo) Bus() HciBus {
+	return HciBus(self.Type & 0x0f)
+}
+
+func (self HciDevInfo) DevType() HciType {
+	return HciType((self.Type >> 4) & 0x03)
+}
+
+func (self HciDevInfo) DevFlags() HciDevFlags {
+	return HciDevFlags(self.Flags)
+}
+
+// DevName returns the kernel name of the adapter, such as "hci0".
+func (self HciDevInfo) DevName() string {
+	name := self.Name[:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// DevUp brings the adapter up. It is EALREADY if the adapter is up.
+func (self Hci) DevUp(devId uint16) error {
+	return ioctl(int(self), uintptr(HCIDEVUP), uintptr(devId))
+}
+
+func (self Hci) DevDown(devId uint16) error {
+	return ioctl(int(self), uintptr(HCIDEVDOWN), uintptr(devId))
+}
+
+func (self Hci) DevReset(devId uint16) error {
+	return ioctl(int(self), uintptr(HCIDEVRESET), uintptr(devId))
+}
+
+// ResetStats clears the counters of HciDevInfo.Stat.
+func (self Hci) ResetStats(devId uint16) error {
+	return ioctl(int(self), uintptr(HCIDEVRESTAT), uintptr(devId))
+}
+
+func (self Hci) setDevOpt(req uintptr, devId uint16, opt uint32) error {
+	dr := HciDevReq{
+		Id:  devId,
+		Opt: opt,
+	}
+	return ioctl(int(self), req, uintptr(unsafe.Pointer(&dr)))
+}
+
+// SetScan sets the scan mode of SCAN_* bits, SCAN_PAGE for connectable and
+// SCAN_INQUIRY for discoverable.
+func (self Hci) SetScan(devId uint16, mode uint32) error {
+	return self.setDevOpt(uintptr(HCISETSCAN), devId, mode)
+}
+
+func (self Hci) SetAuth(devId uint16, enable bool) error {
+	var opt uint32
+	if enable {
+		opt = 1
+	}
+	return self.setDevOpt(uintptr(HCISETAUTH), devId, opt)
+}
+
+func (self Hci) SetEncrypt(devId uint16, enable bool) error {
+	var opt uint32
+	if enable {
+		opt = 1
+	}
+	return self.setDevOpt(uintptr(HCISETENCRYPT), devId, opt)
+}
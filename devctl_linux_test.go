@@ -0,0 +1,24 @@
+// +build linux
+
+package blugo
+
+import (
+	"testing"
+)
+
+func TestDevInfo(t *testing.T) {
+	info := HciDevInfo{
+		Name:  [8]uint8{'h', 'c', 'i', '0'},
+		Type:  uint8(HCI_AMP)<<4 | uint8(HCI_USB),
+		Flags: 1<<HCI_UP | 1<<HCI_RUNNING | 1<<HCI_PSCAN,
+	}
+	if info.DevName() != "hci0" || info.Bus() != HCI_USB || info.DevType() != HCI_AMP {
+		t.Error(info.DevName(), info.Bus(), info.DevType())
+	}
+	if s := info.DevFlags().String(); s != "UP RUNNING PSCAN" {
+		t.Error(s)
+	}
+	if s := HciDevFlags(0).String(); s != "DOWN" {
+		t.Error(s)
+	}
+}
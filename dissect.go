@@ -0,0 +1,437 @@
+package blugo
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The packets and the events print in the style of btmon, the header line
+// followed by the decoded fields indented:
+//
+//	HCI Event: Disconnection Complete (0x05) plen 4
+//	  Status: Success (0x00)
+//	  Handle: 64
+//	  Reason: HCI_OE_USER_ENDED_CONNECTION (0x13)
+//
+// MarshalJSON of the packets gives the same fields for the log pipelines.
+
+// Name returns the command name of the specification, or "Unknown".
+func (self OpCode) Name() string {
+	if name, ok := opcodeNames[self]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// EventName returns the event name of the specification, or "Unknown".
+func EventName(code uint8) string {
+	if name, ok := eventNames[code]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// LeEventName returns the LE subevent name of the specification, or
+// "Unknown".
+func LeEventName(subevent uint8) string {
+	if name, ok := leEventNames[subevent]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+func statusName(status uint8) string {
+	if status == 0 {
+		return "Success"
+	}
+	return HciError(status).String()
+}
+
+func statusString(status uint8) string {
+	return fmt.Sprintf("%s (0x%02x)", statusName(status), status)
+}
+
+var (
+	typeStringer = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	typeAdData   = reflect.TypeOf(AdData(nil))
+	typeHciError = reflect.TypeOf(HciError(0))
+)
+
+// field is a decoded field, Lines for the values that take the lines of
+// their own such as AD structures and advertising reports.
+type field struct {
+	Name  string
+	Value string
+	Lines []string
+}
+
+// intValue is the number of the integer kinds, without the String method
+// of the type that %x would take.
+func intValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	}
+	return v.Uint()
+}
+
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func formatValue(name string, v reflect.Value) field {
+	f := field{Name: name}
+	switch {
+	case name == "Status" && v.Kind() == reflect.Uint8:
+		f.Value = statusString(uint8(v.Uint()))
+	case name == "OpCode" && v.Kind() == reflect.Uint16:
+		f.Value = OpCode(v.Uint()).String()
+	case name == "Rssi" && v.Kind() == reflect.Int8:
+		f.Value = fmt.Sprintf("%d dBm", v.Int())
+	case v.Type() == typeHciError:
+		f.Value = statusString(uint8(v.Uint()))
+	case v.Type() == typeAdData:
+		for _, s := range v.Interface().(AdData) {
+			f.Lines = append(f.Lines, s.String())
+		}
+	case v.Type().Implements(typeStringer):
+		f.Value = v.Interface().(fmt.Stringer).String()
+		if isInt(v.Kind()) {
+			f.Value = fmt.Sprintf("%s (0x%02x)", f.Value, intValue(v))
+		}
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		f.Value = hex.EncodeToString(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		f.Value = fmt.Sprintf("%d entries", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			f.Lines = append(f.Lines, fmt.Sprintf("Entry %d", i))
+			for _, line := range fieldLines(v.Index(i).Interface()) {
+				f.Lines = append(f.Lines, "  "+line)
+			}
+		}
+	case v.Kind() == reflect.String:
+		f.Value = fmt.Sprintf("%q", v.String())
+	default:
+		f.Value = fmt.Sprint(v.Interface())
+	}
+	return f
+}
+
+func fields(params interface{}) []field {
+	v := reflect.ValueOf(params)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return []field{formatValue("Value", v)}
+	}
+	var ret []field
+	for i := 0; i < v.NumField(); i++ {
+		if t := v.Type().Field(i); t.PkgPath == "" {
+			ret = append(ret, formatValue(t.Name, v.Field(i)))
+		}
+	}
+	return ret
+}
+
+func fieldLines(params interface{}) []string {
+	var ret []string
+	for _, f := range fields(params) {
+		if f.Value != "" {
+			ret = append(ret, f.Name+": "+f.Value)
+		} else {
+			ret = append(ret, f.Name+":")
+		}
+		for _, line := range f.Lines {
+			ret = append(ret, "  "+line)
+		}
+	}
+	return ret
+}
+
+// fieldsString is String of the typed events, the fields one a line.
+func fieldsString(params interface{}) string {
+	return strings.Join(fieldLines(params), "\n")
+}
+
+func indent(s string, prefix string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+}
+
+// jsonValue converts the value to the tree of the JSON encoding, the
+// Stringers to the strings and the bytes to the hex.
+func jsonValue(name string, v reflect.Value) interface{} {
+	switch {
+	case name == "Status" && v.Kind() == reflect.Uint8, v.Type() == typeHciError:
+		return map[string]interface{}{
+			"code": v.Uint(),
+			"name": statusName(uint8(v.Uint())),
+		}
+	case name == "OpCode" && v.Kind() == reflect.Uint16:
+		return map[string]interface{}{
+			"opcode": v.Uint(),
+			"name":   OpCode(v.Uint()).Name(),
+		}
+	case v.Type() == typeAdData:
+		var ret []interface{}
+		for _, s := range v.Interface().(AdData) {
+			ret = append(ret, map[string]interface{}{
+				"type": s.Type,
+				"data": hex.EncodeToString(s.Data),
+				"text": s.String(),
+			})
+		}
+		return ret
+	case v.Type().Implements(typeStringer):
+		return v.Interface().(fmt.Stringer).String()
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return hex.EncodeToString(b)
+	case v.Kind() == reflect.Slice:
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			ret[i] = jsonValue("", v.Index(i))
+		}
+		return ret
+	case v.Kind() == reflect.Struct:
+		return jsonFields(v.Interface())
+	default:
+		return v.Interface()
+	}
+}
+
+func jsonFields(params interface{}) map[string]interface{} {
+	v := reflect.ValueOf(params)
+	ret := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		if t := v.Type().Field(i); t.PkgPath == "" {
+			ret[t.Name] = jsonValue(t.Name, v.Field(i))
+		}
+	}
+	return ret
+}
+
+// String shows the parameters decoded by Parse, and in hex for the commands
+// of no decoder.
+func (self CommandPkt) String() string {
+	ret := fmt.Sprintf("HCI Command: %v plen %d", self.OpCode, len(self.Params))
+	if params, err := self.Parse(); err != nil {
+		if len(self.Params) > 0 {
+			ret += "\n  " + hex.EncodeToString(self.Params)
+		}
+	} else if params != nil {
+		if body := indent(fieldsString(params), "  "); body != "" {
+			ret += "\n" + body
+		}
+	}
+	return ret
+}
+
+func (self CommandPkt) MarshalJSON() ([]byte, error) {
+	ret := map[string]interface{}{
+		"type":   "command",
+		"opcode": uint16(self.OpCode),
+		"ogf":    self.OpCode.Ogf(),
+		"ocf":    self.OpCode.Ocf(),
+		"name":   self.OpCode.Name(),
+		"params": hex.EncodeToString(self.Params),
+	}
+	if params, err := self.Parse(); err == nil && params != nil {
+		ret["fields"] = jsonFields(params)
+	}
+	return json.Marshal(ret)
+}
+
+func (self AcldataPkt) String() string {
+	ret := fmt.Sprintf("ACL Data: handle %d flags 0x%02x dlen %d", self.Handle, self.PB|self.BC<<2, len(self.Data))
+	if self.PB != 0x01 && len(self.Data) >= 4 {
+		ret += fmt.Sprintf("\n  L2CAP: cid 0x%04x len %d",
+			binary.LittleEndian.Uint16(self.Data[2:]),
+			binary.LittleEndian.Uint16(self.Data))
+		ret += "\n  " + hex.EncodeToString(self.Data[4:])
+	} else if len(self.Data) > 0 {
+		ret += "\n  " + hex.EncodeToString(self.Data)
+	}
+	return ret
+}
+
+func (self AcldataPkt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":   "acl",
+		"handle": self.Handle,
+		"pb":     self.PB,
+		"bc":     self.BC,
+		"data":   hex.EncodeToString(self.Data),
+	})
+}
+
+func (self ScodataPkt) String() string {
+	ret := fmt.Sprintf("SCO Data: handle %d flags 0x%02x dlen %d", self.ConnectionHandle, self.PacketStatusFlag, len(self.Data))
+	if len(self.Data) > 0 {
+		ret += "\n  " + hex.EncodeToString(self.Data)
+	}
+	return ret
+}
+
+func (self ScodataPkt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":   "sco",
+		"handle": self.ConnectionHandle,
+		"status": self.PacketStatusFlag,
+		"data":   hex.EncodeToString(self.Data),
+	})
+}
+
+func (self EventPkt) String() string {
+	ret := fmt.Sprintf("HCI Event: %s (0x%02x) plen %d", EventName(self.Code), self.Code, len(self.Params))
+	if params, err := self.Parse(); err != nil {
+		if len(self.Params) > 0 {
+			ret += "\n  " + hex.EncodeToString(self.Params)
+		}
+	} else if s, ok := params.(fmt.Stringer); ok {
+		if body := indent(s.String(), "  "); body != "" {
+			ret += "\n" + body
+		}
+	} else {
+		if body := indent(fieldsString(params), "  "); body != "" {
+			ret += "\n" + body
+		}
+	}
+	return ret
+}
+
+func (self EventPkt) MarshalJSON() ([]byte, error) {
+	ret := map[string]interface{}{
+		"type":   "event",
+		"code":   self.Code,
+		"name":   EventName(self.Code),
+		"params": hex.EncodeToString(self.Params),
+	}
+	if params, err := self.Parse(); err == nil {
+		switch p := params.(type) {
+		case EvtCmdComplete:
+			ret["fields"] = p.jsonFields()
+		case EvtLeMetaEvent:
+			ret["fields"] = p.jsonFields()
+		default:
+			ret["fields"] = jsonFields(params)
+		}
+	}
+	return json.Marshal(ret)
+}
+
+// String shows the return parameters decoded by OpCode.Response, named by
+// OpCode.ResponseName, and in hex for the commands of no decoder.
+func (self EvtCmdComplete) String() string {
+	lines := []string{
+		fmt.Sprintf("%v ncmd %d", OpCode(self.OpCode), self.Ncmd),
+	}
+	if ret, err := OpCode(self.OpCode).Response(self.Params); err != nil || len(ret) == 0 {
+		if len(self.Params) > 0 {
+			lines = append(lines, hex.EncodeToString(self.Params))
+		}
+	} else {
+		for i, p := range ret {
+			name := OpCode(self.OpCode).ResponseName(i)
+			if f := formatValue(name, reflect.ValueOf(p)); name != "" {
+				lines = append(lines, name+": "+f.Value)
+			} else {
+				lines = append(lines, f.Value)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (self EvtCmdComplete) jsonFields() map[string]interface{} {
+	ret := map[string]interface{}{
+		"Ncmd":   self.Ncmd,
+		"OpCode": jsonValue("OpCode", reflect.ValueOf(self.OpCode)),
+		"Params": hex.EncodeToString(self.Params),
+	}
+	if params, err := OpCode(self.OpCode).Response(self.Params); err == nil && len(params) > 0 {
+		values := map[string]interface{}{}
+		for i, p := range params {
+			name := OpCode(self.OpCode).ResponseName(i)
+			if name == "" {
+				name = fmt.Sprintf("Param%d", i)
+			}
+			values[name] = jsonValue(name, reflect.ValueOf(p))
+		}
+		ret["Return"] = values
+	}
+	return ret
+}
+
+func (self EvtCmdStatus) String() string {
+	return fmt.Sprintf("%v ncmd %d\nStatus: %s", OpCode(self.OpCode), self.Ncmd, statusString(self.Status))
+}
+
+// String shows the subevent decoded by Parse, and in hex for the subevents
+// of no decoder.
+func (self EvtLeMetaEvent) String() string {
+	ret := fmt.Sprintf("%s (0x%02x)", LeEventName(self.Subevent), self.Subevent)
+	if params, err := self.Parse(); err != nil {
+		if len(self.Data) > 0 {
+			ret += "\n  " + hex.EncodeToString(self.Data)
+		}
+	} else if body := indent(fieldsString(params), "  "); body != "" {
+		ret += "\n" + body
+	}
+	return ret
+}
+
+func (self EvtLeMetaEvent) jsonFields() map[string]interface{} {
+	ret := map[string]interface{}{
+		"Subevent": self.Subevent,
+		"Name":     LeEventName(self.Subevent),
+		"Data":     hex.EncodeToString(self.Data),
+	}
+	if params, err := self.Parse(); err == nil {
+		ret["Fields"] = jsonFields(params)
+	}
+	return ret
+}
+
+func (self EvtConnComplete) String() string               { return fieldsString(self) }
+func (self EvtConnRequest) String() string                { return fieldsString(self) }
+func (self EvtDisconnComplete) String() string            { return fieldsString(self) }
+func (self EvtRemoteNameReqComplete) String() string      { return fieldsString(self) }
+func (self EvtAuthComplete) String() string               { return fieldsString(self) }
+func (self EvtPinCodeReq) String() string                 { return fieldsString(self) }
+func (self EvtLinkKeyReq) String() string                 { return fieldsString(self) }
+func (self EvtLinkKeyNotify) String() string              { return fieldsString(self) }
+func (self EvtRoleChange) String() string                 { return fieldsString(self) }
+func (self EvtNumCompPkts) String() string                { return fieldsString(self) }
+func (self EvtModeChange) String() string                 { return fieldsString(self) }
+func (self EvtReadClockOffsetComplete) String() string    { return fieldsString(self) }
+func (self EvtReadRemoteFeaturesComplete) String() string { return fieldsString(self) }
+func (self EvtReadRemoteVersionComplete) String() string  { return fieldsString(self) }
+func (self EvtEncryptChange) String() string              { return fieldsString(self) }
+func (self EvtEncryptKeyRefresh) String() string          { return fieldsString(self) }
+func (self EvtIoCapabilityRequest) String() string        { return fieldsString(self) }
+func (self EvtIoCapabilityResponse) String() string       { return fieldsString(self) }
+func (self EvtUserConfirmRequest) String() string         { return fieldsString(self) }
+func (self EvtUserPasskeyRequest) String() string         { return fieldsString(self) }
+func (self EvtRemoteOobDataRequest) String() string       { return fieldsString(self) }
+func (self EvtSimplePairingComplete) String() string      { return fieldsString(self) }
+func (self EvtUserPasskeyNotify) String() string          { return fieldsString(self) }
+func (self EvtKeypressNotify) String() string             { return fieldsString(self) }
+func (self EvtLeConnComplete) String() string             { return fieldsString(self) }
+func (self EvtLeAdvertisingReport) String() string        { return fieldsString(self) }
+func (self EvtLeLtkRequest) String() string               { return fieldsString(self) }
@@ -0,0 +1,197 @@
+package blugo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDissectOpCode(t *testing.T) {
+	if s := OpCode(HCI_Read_Class_Of_Device).String(); s != "Read Class Of Device (0x03|0x0023)" {
+		t.Error(s)
+	}
+	if s := MakeOpCode(OGF_HOST_CTL, 0x0003).String(); s != "Unknown (0x03|0x0003)" {
+		t.Error(s)
+	}
+}
+
+func TestDissectEvent(t *testing.T) {
+	pkt, _ := Parse([]byte{HCI_EVENT_PKT, EVT_DISCONN_COMPLETE, 0x04, 0x00, 0x40, 0x00, 0x13})
+	expect := strings.Join([]string{
+		"HCI Event: Disconnection Complete (0x05) plen 4",
+		"  Status: Success (0x00)",
+		"  Handle: 64",
+		"  Reason: HCI_OE_USER_ENDED_CONNECTION (0x13)",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+
+	pkt, _ = Parse([]byte{HCI_EVENT_PKT, EVT_CMD_COMPLETE, 0x07, 0x01, 0x23, 0x0c, 0x00, 0x0c, 0x01, 0x5a})
+	expect = strings.Join([]string{
+		"HCI Event: Command Complete (0x0e) plen 7",
+		"  Read Class Of Device (0x03|0x0023) ncmd 1",
+		"  Status: Success (0x00)",
+		"  Class: 0c015a",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+
+	pkt, _ = Parse([]byte{HCI_EVENT_PKT, EVT_CMD_COMPLETE, 0x07, 0x01, 0x05, 0x14, 0x00, 0x40, 0x00, 0xc8})
+	expect = strings.Join([]string{
+		"HCI Event: Command Complete (0x0e) plen 7",
+		"  Read RSSI (0x05|0x0005) ncmd 1",
+		"  Status: Success (0x00)",
+		"  Handle: 64",
+		"  Rssi: -56 dBm",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+	if data, err := json.Marshal(pkt); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(data), `"Return":{"Handle":64,"Rssi":-56,"Status":{"code":0,"name":"Success"}}`) {
+		t.Errorf("got %s", data)
+	}
+
+	pkt, _ = Parse([]byte{HCI_EVENT_PKT, EVT_CMD_COMPLETE, 0x0a, 0x01, 0x09, 0x10, 0x00, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11})
+	expect = strings.Join([]string{
+		"HCI Event: Command Complete (0x0e) plen 10",
+		"  Read BD ADDR (0x04|0x0009) ncmd 1",
+		"  Status: Success (0x00)",
+		"  Bdaddr: 11:22:33:44:55:66",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+
+	pkt, _ = Parse([]byte{HCI_EVENT_PKT, EVT_CMD_STATUS, 0x04, 0x0c, 0x01, 0x05, 0x04})
+	expect = strings.Join([]string{
+		"HCI Event: Command Status (0x0f) plen 4",
+		"  Create Connection (0x01|0x0005) ncmd 1",
+		"  Status: HCI_COMMAND_DISALLOWED (0x0c)",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+}
+
+func TestDissectLeEvent(t *testing.T) {
+	buf := []byte{HCI_EVENT_PKT, EVT_LE_META_EVENT, 0,
+		EVT_LE_ADVERTISING_REPORT, 0x01, ADV_REPORT_IND, LE_ADDR_PUBLIC,
+		0x06, 0x05, 0x04, 0x03, 0x02, 0x01,
+		0x06, 0x05, AD_COMPLETE_NAME, 'b', 'l', 'u', 'e',
+		0xc4}
+	buf[2] = uint8(len(buf) - 3)
+	pkt, _ := Parse(buf)
+	expect := strings.Join([]string{
+		"HCI Event: LE Meta Event (0x3e) plen 18",
+		"  LE Advertising Report (0x02)",
+		"    Reports: 1 entries",
+		"      Entry 0",
+		"        EventType: ADV_IND (0x00)",
+		"        Addr: 01:02:03:04:05:06 (public)",
+		"        Data:",
+		"          Complete Local Name: \"blue\"",
+		"        Rssi: -60 dBm",
+	}, "\n")
+	if s := pkt.(EventPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+
+	if b, err := json.Marshal(pkt); err != nil {
+		t.Error(err)
+	} else {
+		var v struct {
+			Name   string
+			Fields struct {
+				Name   string
+				Fields struct {
+					Reports []struct {
+						EventType string
+						Addr      string
+						Rssi      int
+						Data      []struct {
+							Type int
+							Data string
+						}
+					}
+				}
+			}
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Error(err)
+		} else if v.Name != "LE Meta Event" || v.Fields.Name != "LE Advertising Report" ||
+			len(v.Fields.Fields.Reports) != 1 ||
+			v.Fields.Fields.Reports[0].EventType != "ADV_IND" ||
+			v.Fields.Fields.Reports[0].Addr != "01:02:03:04:05:06 (public)" ||
+			v.Fields.Fields.Reports[0].Rssi != -60 ||
+			v.Fields.Fields.Reports[0].Data[0].Data != "626c7565" {
+			t.Errorf("got %s", b)
+		}
+	}
+}
+
+func TestDissectData(t *testing.T) {
+	pkt, _ := Parse([]byte{HCI_COMMAND_PKT, 0x23, 0x0c, 0x00})
+	if s := pkt.(CommandPkt).String(); s != "HCI Command: Read Class Of Device (0x03|0x0023) plen 0" {
+		t.Error(s)
+	}
+	if b, err := json.Marshal(pkt); err != nil || string(b) != `{"name":"Read Class Of Device","ocf":35,"ogf":3,"opcode":3107,"params":"","type":"command"}` {
+		t.Errorf("%s %v", b, err)
+	}
+
+	pkt, _ = Parse([]byte{HCI_COMMAND_PKT, 0x06, 0x04, 0x03, 0x40, 0x00, 0x13})
+	expect := strings.Join([]string{
+		"HCI Command: Disconnect (0x01|0x0006) plen 3",
+		"  Handle: 64",
+		"  Reason: HCI_OE_USER_ENDED_CONNECTION (0x13)",
+	}, "\n")
+	if s := pkt.(CommandPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+	pkt, _ = Parse([]byte{HCI_COMMAND_PKT, 0x0c, 0x20, 0x02, 0x01, 0x00})
+	if b, err := json.Marshal(pkt); err != nil || !strings.Contains(string(b), `"fields":{"Enable":1,"FilterDuplicates":0}`) {
+		t.Errorf("%s %v", b, err)
+	}
+	// truncated parameters stay in hex
+	pkt, _ = Parse([]byte{HCI_COMMAND_PKT, 0x06, 0x04, 0x02, 0x40, 0x00})
+	if s := pkt.(CommandPkt).String(); s != "HCI Command: Disconnect (0x01|0x0006) plen 2\n  4000" {
+		t.Error(s)
+	}
+
+	pkt, _ = Parse([]byte{HCI_ACLDATA_PKT, 0x40, 0x20, 0x07, 0x00, 0x03, 0x00, 0x04, 0x00, 0x0a, 0x01, 0x00})
+	expect = strings.Join([]string{
+		"ACL Data: handle 64 flags 0x02 dlen 7",
+		"  L2CAP: cid 0x0004 len 3",
+		"  0a0100",
+	}, "\n")
+	if s := pkt.(AcldataPkt).String(); s != expect {
+		t.Errorf("got\n%s", s)
+	}
+}
+
+func TestDissectTruncated(t *testing.T) {
+	for _, v := range []struct {
+		pkt    EventPkt
+		parsed bool
+	}{
+		{EventPkt{Code: EVT_CMD_COMPLETE, Params: []byte{0x0f}}, false},
+		{EventPkt{Code: EVT_CMD_STATUS, Params: []byte{0}}, false},
+		{EventPkt{Code: EVT_LE_META_EVENT}, false},
+		// the return parameters and the subevent are short
+		{EventPkt{Code: EVT_CMD_COMPLETE, Params: []byte{0x01, 0x23, 0x0c, 0x00}}, true},
+		{EventPkt{Code: EVT_LE_META_EVENT, Params: []byte{EVT_LE_CONN_COMPLETE, 0x00}}, true},
+	} {
+		if _, err := v.pkt.Parse(); (err == nil) != v.parsed {
+			t.Errorf("parse %x %v", v.pkt.Params, err)
+		}
+		if s := v.pkt.String(); !strings.HasPrefix(s, "HCI Event: ") {
+			t.Errorf("got %s", s)
+		}
+		if _, err := json.Marshal(v.pkt); err != nil {
+			t.Error(err)
+		}
+	}
+}
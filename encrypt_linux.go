@@ -0,0 +1,110 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.8.24 - 7.8.26
+// Encryption of LE connections.
+
+// LeEncryption drives the encryption of an LE connection, which the smp
+// package uses. The kernel answers LTK requests by itself when the adapter
+// is up and managed by the kernel stack.
+type LeEncryption struct {
+	Dev    HciDev
+	Handle uint16
+}
+
+func (self LeEncryption) changed(p EventPktParams) (bool, error) {
+	switch ev := p.(type) {
+	case EvtEncryptChange:
+		if ev.Handle == self.Handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			} else if ev.Enabled == 0 {
+				return true, HCI_INSUFFICIENT_SECURITY
+			}
+			return true, nil
+		}
+	case EvtEncryptKeyRefresh:
+		if ev.Handle == self.Handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StartEncryption encrypts the link with the key as the central, and waits
+// for the change. An encrypted link is refreshed with the key.
+func (self LeEncryption) StartEncryption(ctx context.Context, ltk [16]byte, ediv uint16, rand uint64) error {
+	return self.Dev.exchange(ctx, HCI_LE_Start_Encryption, []Parameter{
+		self.Handle,
+		rand,
+		ediv,
+		ltk[:],
+	}, []int{EVT_ENCRYPT_CHANGE, EVT_ENCRYPT_KEY_REFRESH}, self.changed)
+}
+
+// WaitEncryption replies the key to LTK Request of the connection as the
+// peripheral, and waits for the change. The failure status of the reply
+// is returned as HciError.
+func (self LeEncryption) WaitEncryption(ctx context.Context, ltk [16]byte) error {
+	return self.Dev.exchange(ctx, 0, nil, []int{
+		EVT_LE_META_EVENT,
+		EVT_ENCRYPT_CHANGE,
+		EVT_ENCRYPT_KEY_REFRESH,
+		EVT_CMD_COMPLETE,
+	}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtCmdComplete); ok {
+			if ev.OpCode == HCI_LE_Long_Term_Key_Request_Reply && len(ev.Params) > 0 && ev.Params[0] != 0 {
+				return true, HciError(ev.Params[0])
+			}
+			return false, nil
+		}
+		if meta, ok := p.(EvtLeMetaEvent); ok {
+			if sub, err := meta.Parse(); err != nil {
+				return false, nil
+			} else if req, ok := sub.(EvtLeLtkRequest); ok && req.Handle == self.Handle {
+				return false, self.Dev.command(HCI_LE_Long_Term_Key_Request_Reply, []Parameter{
+					self.Handle,
+					ltk[:],
+				})
+			}
+			return false, nil
+		}
+		return self.changed(p)
+	})
+}
+
+// NextLtkRequest waits for LE Long Term Key Request, which a peripheral
+// answers with LtkReply from the stored keys.
+func (self HciDev) NextLtkRequest(ctx context.Context) (EvtLeLtkRequest, error) {
+	var ret EvtLeLtkRequest
+	err := self.exchange(ctx, 0, nil, []int{EVT_LE_META_EVENT}, func(p EventPktParams) (bool, error) {
+		if meta, ok := p.(EvtLeMetaEvent); !ok {
+			return false, nil
+		} else if sub, err := meta.Parse(); err != nil {
+			return false, nil
+		} else if req, ok := sub.(EvtLeLtkRequest); ok {
+			ret = req
+			return true, nil
+		}
+		return false, nil
+	})
+	return ret, err
+}
+
+// LtkReply answers LE Long Term Key Request with the key.
+func (self HciDev) LtkReply(handle uint16, ltk [16]byte) error {
+	return self.requestStatus(HCI_LE_Long_Term_Key_Request_Reply, handle, ltk[:])
+}
+
+// LtkNegativeReply tells that no key is available for the request.
+func (self HciDev) LtkNegativeReply(handle uint16) error {
+	return self.requestStatus(HCI_LE_Long_Term_Key_Request_Negative_Reply, handle)
+}
@@ -3,6 +3,7 @@
 package blugo
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"syscall"
@@ -93,14 +94,23 @@ func NewHciDev(devId uint16) (HciDev, error) {
 }
 
 func (self HciDev) Write(data []byte) (int, error) {
-	return syscall.Write(int(self), data)
+	n, err := syscall.Write(int(self), data)
+	if n > 0 {
+		self.tap(false, data[:n])
+	}
+	return n, err
 }
 
 func (self HciDev) Read(data []byte) (int, error) {
-	return syscall.Read(int(self), data)
+	n, err := syscall.Read(int(self), data)
+	if n > 0 {
+		self.tap(true, data[:n])
+	}
+	return n, err
 }
 
 func (self *HciDev) Close() {
+	self.SetTap(nil)
 	syscall.Close(int(*self))
 	*self = -1
 }
@@ -148,92 +158,135 @@ func SetsockoptHciFilter(fd, level, opt int, filter *HciFilter) error {
 }
 
 func (self HciDev) Request(opcode OpCode, params ...Parameter) (Parameters, error) {
+	var ret Parameters
+	err := self.exchange(context.Background(), opcode, params, nil, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtCmdComplete); ok && ev.OpCode == uint16(opcode) {
+			var err error
+			ret, err = opcode.Response(ev.Params)
+			return true, err
+		}
+		return false, nil
+	})
+	return ret, err
+}
+
+// RequestRaw sends the command of the encoded parameters, and returns the
+// return parameters of Command Complete as they are. It returns nil for the
+// commands that Command Status completes, such as Inquiry.
+func (self HciDev) RequestRaw(opcode OpCode, params []byte) ([]byte, error) {
+	var ret []byte
+	err := self.exchange(context.Background(), opcode, []Parameter{params}, nil, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtCmdComplete); ok && ev.OpCode == uint16(opcode) {
+			ret = append([]byte(nil), ev.Params...)
+			return true, nil
+		} else if ev, ok := p.(EvtCmdStatus); ok && ev.OpCode == uint16(opcode) {
+			return true, nil
+		}
+		return false, nil
+	})
+	return ret, err
+}
+
+// command sends the command without waiting for the response.
+func (self HciDev) command(opcode OpCode, params []Parameter) error {
 	req := make([]byte, 4)
 	req[0] = HCI_COMMAND_PKT
 	binary.LittleEndian.PutUint16(req[1:], uint16(opcode))
 
 	if pbuf, err := Parameters(params).MarshalBinary(); err != nil {
-		return nil, err
+		return err
 	} else {
 		req[3] = uint8(len(pbuf))
 		req = append(req, pbuf...)
 	}
 
+	if n, err := self.Write(req); err != nil {
+		return err
+	} else if n != len(req) {
+		return fmt.Errorf("write incomplete")
+	}
+	return nil
+}
+
+// exchange sends the command, unless opcode is zero, and then passes the
+// events of the codes given and the command status/complete events to
+// handle until it reports done. A failure status in Command Status event
+// for the opcode is returned as HciError.
+func (self HciDev) exchange(ctx context.Context, opcode OpCode, params []Parameter, events []int, handle func(EventPktParams) (bool, error)) error {
 	if filter, err := GetsockoptHciFilter(int(self), SOL_HCI, HCI_FILTER); err != nil {
-		return nil, err
+		return err
 	} else {
 		defer SetsockoptHciFilter(int(self), SOL_HCI, HCI_FILTER, filter)
 	}
 
+	if opcode != 0 {
+		events = append(events, EVT_CMD_STATUS, EVT_CMD_COMPLETE)
+		if opcode.Ogf() == OGF_LE_CTL {
+			events = append(events, EVT_LE_META_EVENT)
+		}
+	}
 	filter := &HciFilter{
 		Type_mask:  1 << HCI_EVENT_PKT,
-		Event_mask: FilterEventMask(EVT_CMD_STATUS, EVT_CMD_COMPLETE),
+		Event_mask: FilterEventMask(events...),
 		Opcode:     opcode.Native(),
 	}
-	if opcode.Ogf() == OGF_LE_CTL {
-		filter.Event_mask = FilterEventMask(EVT_CMD_STATUS, EVT_CMD_COMPLETE, EVT_LE_META_EVENT)
-	}
 	if err := SetsockoptHciFilter(int(self), SOL_HCI, HCI_FILTER, filter); err != nil {
-		return nil, err
+		return err
 	}
 
-	if n, err := self.Write(req); err != nil {
-		return nil, err
-	} else if n != len(req) {
-		return nil, fmt.Errorf("write incomplete")
+	if opcode != 0 {
+		if err := self.command(opcode, params); err != nil {
+			return err
+		}
 	}
 
-	if efd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC); err != nil {
-		return nil, err
-	} else {
-		defer syscall.Close(efd)
-
-		var events [1]syscall.EpollEvent
-		syscall.EpollCtl(efd, syscall.EPOLL_CTL_ADD, int(self), &syscall.EpollEvent{
-			Events: syscall.EPOLLIN,
-			Fd:     int32(self),
-		})
-
-		capture := make([]byte, 0, 258)
-		buf := make([]byte, 258)
-		for {
-			if n, err := syscall.EpollWait(efd, events[:], 100); err != nil {
-				return nil, err
-			} else if n == 0 {
+	efd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(efd)
+
+	var evs [1]syscall.EpollEvent
+	syscall.EpollCtl(efd, syscall.EPOLL_CTL_ADD, int(self), &syscall.EpollEvent{
+		Events: syscall.EPOLLIN,
+		Fd:     int32(self),
+	})
+
+	buf := make([]byte, 258)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n, err := syscall.EpollWait(efd, evs[:], 100); err != nil {
+			if err == syscall.EINTR {
 				continue
 			}
-			// todo: operation timeout
-
-			if n, _, _, _, err := syscall.Recvmsg(int(self), buf, nil, syscall.MSG_DONTWAIT); err != nil {
-				if errno, ok := err.(syscall.Errno); ok && errno.Temporary() {
-					continue
-				}
-				return nil, err
-			} else if n == 0 {
+			return err
+		} else if n == 0 {
+			continue
+		}
+
+		n, _, _, _, err := syscall.Recvmsg(int(self), buf, nil, syscall.MSG_DONTWAIT)
+		if err != nil {
+			if errno, ok := err.(syscall.Errno); ok && errno.Temporary() {
 				continue
-			} else {
-				capture = append(capture, buf[:n]...)
 			}
-			if pkt, step := Parse(capture); step == 0 {
-				continue
-			} else if p, err := pkt.(EventPkt).Parse(); err != nil {
-				continue
-			} else {
-				switch ev := p.(type) {
-				case EvtCmdComplete:
-					if ev.OpCode == uint16(opcode) {
-						return opcode.Response(ev.Params)
-					}
-				case EvtCmdStatus:
-					if ev.OpCode == uint16(opcode) && ev.Status != 0 {
-						return nil, HciError(ev.Status)
-					}
-				case EvtLeMetaEvent:
-					// todo: OGF_LE_CTL opcode expects this
-				}
-				capture = capture[step:]
+			return err
+		}
+		self.tap(true, buf[:n])
+		if pkt, step := Parse(buf[:n]); step == 0 {
+			continue
+		} else if evt, ok := pkt.(EventPkt); !ok {
+			continue
+		} else if p, err := evt.Parse(); err != nil {
+			continue
+		} else {
+			if ev, ok := p.(EvtCmdStatus); ok && opcode != 0 && ev.OpCode == uint16(opcode) && ev.Status != 0 {
+				return HciError(ev.Status)
+			}
+			if done, err := handle(p); err != nil || done {
+				return err
 			}
 		}
-		return nil, fmt.Errorf("should not reach")
 	}
 }
@@ -0,0 +1,150 @@
+package blugo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LmpFeatures is the page 0 of the LMP features, Bluetooth Core
+// specification, Vol 2, Part C, Section 3.3
+type LmpFeatures [8]byte
+
+// Bit numbers of LmpFeatures
+const (
+	LMP_3SLOT               = 0
+	LMP_5SLOT               = 1
+	LMP_ENCRYPT             = 2
+	LMP_SLOT_OFFSET         = 3
+	LMP_TIMING_ACCURACY     = 4
+	LMP_ROLE_SWITCH         = 5
+	LMP_HOLD_MODE           = 6
+	LMP_SNIFF_MODE          = 7
+	LMP_POWER_CONTROL_REQ   = 9
+	LMP_CQDDR               = 10
+	LMP_SCO                 = 11
+	LMP_HV2                 = 12
+	LMP_HV3                 = 13
+	LMP_ULAW                = 14
+	LMP_ALAW                = 15
+	LMP_CVSD                = 16
+	LMP_PAGING_NEGOTIATION  = 17
+	LMP_POWER_CONTROL       = 18
+	LMP_TRANSPARENT_SCO     = 19
+	LMP_BROADCAST_ENCRYPT   = 23
+	LMP_EDR_ACL_2M          = 25
+	LMP_EDR_ACL_3M          = 26
+	LMP_ENHANCED_ISCAN      = 27
+	LMP_INTERLACED_ISCAN    = 28
+	LMP_INTERLACED_PSCAN    = 29
+	LMP_RSSI_INQUIRY        = 30
+	LMP_ESCO                = 31
+	LMP_EV4                 = 32
+	LMP_EV5                 = 33
+	LMP_AFH_CAPABLE_SLAVE   = 35
+	LMP_AFH_CLASS_SLAVE     = 36
+	LMP_NO_BREDR            = 37
+	LMP_LE                  = 38
+	LMP_EDR_3SLOT           = 39
+	LMP_EDR_5SLOT           = 40
+	LMP_SNIFF_SUBRATING     = 41
+	LMP_PAUSE_ENCRYPT       = 42
+	LMP_AFH_CAPABLE_MASTER  = 43
+	LMP_AFH_CLASS_MASTER    = 44
+	LMP_EDR_ESCO_2M         = 45
+	LMP_EDR_ESCO_3M         = 46
+	LMP_EDR_3SLOT_ESCO      = 47
+	LMP_EXT_INQUIRY         = 48
+	LMP_LE_BREDR            = 49
+	LMP_SIMPLE_PAIRING      = 51
+	LMP_ENCAPSULATED_PDU    = 52
+	LMP_ERR_DATA_REPORTING  = 53
+	LMP_NON_FLUSHABLE       = 54
+	LMP_LSTO_CHANGED        = 56
+	LMP_INQUIRY_TX_POWER    = 57
+	LMP_ENHANCED_POWER_CTRL = 58
+	LMP_EXT_FEATURES        = 63
+)
+
+var lmpFeatureNames = map[int]string{
+	LMP_3SLOT:               "3-slot packets",
+	LMP_5SLOT:               "5-slot packets",
+	LMP_ENCRYPT:             "Encryption",
+	LMP_SLOT_OFFSET:         "Slot offset",
+	LMP_TIMING_ACCURACY:     "Timing accuracy",
+	LMP_ROLE_SWITCH:         "Role switch",
+	LMP_HOLD_MODE:           "Hold mode",
+	LMP_SNIFF_MODE:          "Sniff mode",
+	LMP_POWER_CONTROL_REQ:   "Power control requests",
+	LMP_CQDDR:               "Channel quality driven data rate",
+	LMP_SCO:                 "SCO link",
+	LMP_HV2:                 "HV2 packets",
+	LMP_HV3:                 "HV3 packets",
+	LMP_ULAW:                "u-law log synchronous data",
+	LMP_ALAW:                "A-law log synchronous data",
+	LMP_CVSD:                "CVSD synchronous data",
+	LMP_PAGING_NEGOTIATION:  "Paging parameter negotiation",
+	LMP_POWER_CONTROL:       "Power control",
+	LMP_TRANSPARENT_SCO:     "Transparent synchronous data",
+	LMP_BROADCAST_ENCRYPT:   "Broadcast Encryption",
+	LMP_EDR_ACL_2M:          "EDR ACL 2 Mb/s mode",
+	LMP_EDR_ACL_3M:          "EDR ACL 3 Mb/s mode",
+	LMP_ENHANCED_ISCAN:      "Enhanced inquiry scan",
+	LMP_INTERLACED_ISCAN:    "Interlaced inquiry scan",
+	LMP_INTERLACED_PSCAN:    "Interlaced page scan",
+	LMP_RSSI_INQUIRY:        "RSSI with inquiry results",
+	LMP_ESCO:                "Extended SCO link (EV3 packets)",
+	LMP_EV4:                 "EV4 packets",
+	LMP_EV5:                 "EV5 packets",
+	LMP_AFH_CAPABLE_SLAVE:   "AFH capable slave",
+	LMP_AFH_CLASS_SLAVE:     "AFH classification slave",
+	LMP_NO_BREDR:            "BR/EDR Not Supported",
+	LMP_LE:                  "LE Supported (Controller)",
+	LMP_EDR_3SLOT:           "3-slot EDR ACL packets",
+	LMP_EDR_5SLOT:           "5-slot EDR ACL packets",
+	LMP_SNIFF_SUBRATING:     "Sniff subrating",
+	LMP_PAUSE_ENCRYPT:       "Pause encryption",
+	LMP_AFH_CAPABLE_MASTER:  "AFH capable master",
+	LMP_AFH_CLASS_MASTER:    "AFH classification master",
+	LMP_EDR_ESCO_2M:         "EDR eSCO 2 Mb/s mode",
+	LMP_EDR_ESCO_3M:         "EDR eSCO 3 Mb/s mode",
+	LMP_EDR_3SLOT_ESCO:      "3-slot EDR eSCO packets",
+	LMP_EXT_INQUIRY:         "Extended Inquiry Response",
+	LMP_LE_BREDR:            "Simultaneous LE and BR/EDR (Controller)",
+	LMP_SIMPLE_PAIRING:      "Secure Simple Pairing",
+	LMP_ENCAPSULATED_PDU:    "Encapsulated PDU",
+	LMP_ERR_DATA_REPORTING:  "Erroneous Data Reporting",
+	LMP_NON_FLUSHABLE:       "Non-flushable Packet Boundary Flag",
+	LMP_LSTO_CHANGED:        "Link Supervision Timeout Changed Event",
+	LMP_INQUIRY_TX_POWER:    "Variable Inquiry TX Power Level",
+	LMP_ENHANCED_POWER_CTRL: "Enhanced Power Control",
+	LMP_EXT_FEATURES:        "Extended features",
+}
+
+func (self LmpFeatures) Has(bit int) bool {
+	return self[bit/8]&(1<<uint(bit%8)) != 0
+}
+
+// Names returns the names of the features set, in the order of the bits.
+func (self LmpFeatures) Names() []string {
+	var ret []string
+	for bit := 0; bit < 64; bit++ {
+		if !self.Has(bit) {
+			continue
+		}
+		if name, ok := lmpFeatureNames[bit]; ok {
+			ret = append(ret, name)
+		} else {
+			ret = append(ret, fmt.Sprintf("Reserved (%d)", bit))
+		}
+	}
+	return ret
+}
+
+// String shows the octets in hex, in the form of hcitool.
+func (self LmpFeatures) String() string {
+	comps := make([]string, len(self))
+	for i, b := range self {
+		comps[i] = fmt.Sprintf("0x%02x", b)
+	}
+	return strings.Join(comps, " ")
+}
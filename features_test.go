@@ -0,0 +1,20 @@
+package blugo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLmpFeatures(t *testing.T) {
+	f := LmpFeatures{0x05, 0, 0, 0, 0x40, 0, 0x08, 0x80}
+	if !f.Has(LMP_3SLOT) || f.Has(LMP_5SLOT) || !f.Has(LMP_LE) || !f.Has(LMP_EXT_FEATURES) {
+		t.Error(f)
+	}
+	expect := []string{"3-slot packets", "Encryption", "LE Supported (Controller)", "Secure Simple Pairing", "Extended features"}
+	if names := f.Names(); !reflect.DeepEqual(names, expect) {
+		t.Error(names)
+	}
+	if s := f.String(); s != "0x05 0x00 0x00 0x00 0x40 0x00 0x08 0x80" {
+		t.Error(s)
+	}
+}
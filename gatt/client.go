@@ -0,0 +1,515 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/hkwi/blugo/att"
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Notification is a value that the server notified or indicated.
+type Notification struct {
+	Handle     uint16
+	Value      []byte
+	Indication bool
+}
+
+// Subscription delivers notifications of a characteristic to C. Values
+// are dropped while C is full.
+type Subscription struct {
+	C      <-chan Notification
+	c      chan Notification
+	client *Client
+	char   *Characteristic
+}
+
+// Client is the GATT client of a connection.
+type Client struct {
+	att   *att.Client
+	cache Cache
+	peer  string
+
+	lock     sync.Mutex
+	services []*Service
+	subs     map[uint16][]*Subscription
+	changed  []chan [2]uint16
+}
+
+// NewClient makes the GATT client on the ATT client. peer identifies the
+// server in cache, which may be nil; use the identity address of bonded
+// peers.
+func NewClient(client *att.Client, peer string, cache Cache) *Client {
+	self := &Client{
+		att:   client,
+		cache: cache,
+		peer:  peer,
+		subs:  make(map[uint16][]*Subscription),
+	}
+	client.OnNotification(self.notification)
+	return self
+}
+
+// ATT returns the underlying ATT client.
+func (self *Client) ATT() *att.Client {
+	return self.att
+}
+
+// errEmpty is returned for the responses without entries, which would
+// leave the discovery without the handle to continue from.
+var errEmpty = fmt.Errorf("gatt: empty response")
+
+func notFound(err error) bool {
+	if e, ok := err.(*att.Error); ok {
+		return e.Code == att.ECODE_ATTR_NOT_FOUND
+	}
+	return false
+}
+
+func (self *Client) serviceChangedHandle() uint16 {
+	for _, s := range self.services {
+		if s.UUID.Equal(uuid.UUID16(UUID_GATT_SERVICE)) {
+			if c := s.Characteristic(uuid.UUID16(UUID_SERVICE_CHANGED)); c != nil {
+				return c.ValueHandle
+			}
+		}
+	}
+	return 0
+}
+
+func (self *Client) notification(handle uint16, value []byte, indication bool) {
+	self.lock.Lock()
+	if indication && handle != 0 && handle == self.serviceChangedHandle() {
+		// the server database changed in the range
+		var r [2]uint16
+		if len(value) >= 4 {
+			r = [2]uint16{binary.LittleEndian.Uint16(value), binary.LittleEndian.Uint16(value[2:])}
+		}
+		if self.cache != nil {
+			self.cache.Invalidate(self.peer)
+		}
+		self.services = nil
+		for _, c := range self.changed {
+			select {
+			case c <- r:
+			default:
+			}
+		}
+		self.lock.Unlock()
+		return
+	}
+	subs := self.subs[handle]
+	self.lock.Unlock()
+
+	n := Notification{
+		Handle:     handle,
+		Value:      append([]byte(nil), value...),
+		Indication: indication,
+	}
+	for _, s := range subs {
+		select {
+		case s.c <- n:
+		default:
+		}
+	}
+}
+
+// ServiceChanged returns a channel that receives the affected handle range
+// of Service Changed indications. The discovered services are discarded
+// then, and DiscoverServices must be called again.
+func (self *Client) ServiceChanged() <-chan [2]uint16 {
+	c := make(chan [2]uint16, 4)
+	self.lock.Lock()
+	self.changed = append(self.changed, c)
+	self.lock.Unlock()
+	return c
+}
+
+// Services returns the discovered services.
+func (self *Client) Services() []*Service {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.services
+}
+
+// Service returns the first discovered service of the uuid.
+func (self *Client) Service(uuid uuid.UUID) *Service {
+	for _, s := range self.Services() {
+		if s.UUID.Equal(uuid) {
+			return s
+		}
+	}
+	return nil
+}
+
+// DatabaseHash reads the Database Hash characteristic.
+func (self *Client) DatabaseHash(ctx context.Context) ([]byte, error) {
+	values, err := self.att.ReadByType(ctx, 1, 0xFFFF, uuid.UUID16(UUID_DATABASE_HASH))
+	if err != nil {
+		return nil, err
+	} else if len(values) == 0 || len(values[0].Value) != 16 {
+		return nil, fmt.Errorf("gatt: invalid database hash")
+	}
+	return append([]byte(nil), values[0].Value...), nil
+}
+
+// DiscoverServices discovers the whole database of the server, or loads it
+// from the cache when Database Hash matches. Indications of Service Changed
+// are enabled.
+func (self *Client) DiscoverServices(ctx context.Context) ([]*Service, error) {
+	var hash []byte
+	if self.cache != nil {
+		if h, err := self.DatabaseHash(ctx); err == nil {
+			hash = h
+			if cached, services, ok := self.cache.Load(self.peer); ok && bytes.Equal(cached, hash) {
+				self.lock.Lock()
+				self.services = services
+				self.lock.Unlock()
+				if err := self.configure(ctx); err != nil {
+					return nil, err
+				}
+				return services, nil
+			}
+		} else if !notFound(err) {
+			return nil, err
+		}
+	}
+
+	services, err := self.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	self.lock.Lock()
+	self.services = services
+	self.lock.Unlock()
+
+	if err := self.configure(ctx); err != nil {
+		return nil, err
+	}
+	if hash != nil {
+		self.cache.Store(self.peer, hash, services)
+	}
+	return services, nil
+}
+
+// configure writes Client Supported Features and enables indications of
+// Service Changed, which the peers without the bond forget at the
+// disconnection, so that it runs on every connection.
+func (self *Client) configure(ctx context.Context) error {
+	if s := self.Service(uuid.UUID16(UUID_GATT_SERVICE)); s != nil {
+		if c := s.Characteristic(uuid.UUID16(UUID_CLIENT_FEATURES)); c != nil {
+			self.att.Write(ctx, c.ValueHandle, []byte{CLIENT_ROBUST_CACHING})
+		}
+		if c := s.Characteristic(uuid.UUID16(UUID_SERVICE_CHANGED)); c != nil {
+			if err := self.EnableNotification(ctx, c, CCC_INDICATE); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (self *Client) discover(ctx context.Context) ([]*Service, error) {
+	var services []*Service
+	for _, primary := range []bool{true, false} {
+		typ := uuid.UUID16(UUID_SECONDARY_SERVICE)
+		if primary {
+			typ = uuid.UUID16(UUID_PRIMARY_SERVICE)
+		}
+		for start := uint16(1); ; {
+			groups, err := self.att.ReadByGroupType(ctx, start, 0xFFFF, typ)
+			if notFound(err) {
+				break
+			} else if e, ok := err.(*att.Error); ok && !primary && e.Code == att.ECODE_UNSUPPORTED_GROUP_TYPE {
+				break
+			} else if err != nil {
+				return nil, err
+			} else if len(groups) == 0 {
+				return nil, errEmpty
+			}
+			for _, g := range groups {
+				services = append(services, &Service{
+					Handle:    g.Handle,
+					EndHandle: g.End,
+					UUID:      append(uuid.UUID(nil), g.Value...),
+					Primary:   primary,
+				})
+			}
+			last := groups[len(groups)-1].End
+			if last == 0xFFFF || last < start {
+				break
+			}
+			start = last + 1
+		}
+	}
+	for _, s := range services {
+		if err := self.discoverIncludes(ctx, s, services); err != nil {
+			return nil, err
+		}
+		if err := self.discoverCharacteristics(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	return services, nil
+}
+
+// DiscoverServiceByUUID discovers the primary services of the uuid, without
+// characteristics.
+func (self *Client) DiscoverServiceByUUID(ctx context.Context, uuid uuid.UUID) ([]*Service, error) {
+	var services []*Service
+	for start := uint16(1); ; {
+		ranges, err := self.att.FindByTypeValue(ctx, start, 0xFFFF, UUID_PRIMARY_SERVICE, uuid)
+		if notFound(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		} else if len(ranges) == 0 {
+			return nil, errEmpty
+		}
+		for _, r := range ranges {
+			services = append(services, &Service{
+				Handle:    r.Found,
+				EndHandle: r.End,
+				UUID:      uuid,
+				Primary:   true,
+			})
+		}
+		last := ranges[len(ranges)-1].End
+		if last == 0xFFFF || last < start {
+			break
+		}
+		start = last + 1
+	}
+	return services, nil
+}
+
+func (self *Client) discoverIncludes(ctx context.Context, s *Service, services []*Service) error {
+	for start := s.Handle + 1; start <= s.EndHandle && start != 0; {
+		values, err := self.att.ReadByType(ctx, start, s.EndHandle, uuid.UUID16(UUID_INCLUDE))
+		if notFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if len(values) == 0 {
+			return errEmpty
+		}
+		for _, v := range values {
+			if len(v.Value) < 4 {
+				return fmt.Errorf("gatt: invalid include declaration")
+			}
+			inc := &Service{
+				Handle:    binary.LittleEndian.Uint16(v.Value),
+				EndHandle: binary.LittleEndian.Uint16(v.Value[2:]),
+			}
+			for _, known := range services {
+				if known.Handle == inc.Handle {
+					inc = known
+				}
+			}
+			if inc.UUID == nil {
+				if len(v.Value) >= 6 {
+					inc.UUID = append(uuid.UUID(nil), v.Value[4:6]...)
+				} else if value, err := self.att.Read(ctx, inc.Handle); err != nil {
+					return err
+				} else {
+					inc.UUID = append(uuid.UUID(nil), value...)
+				}
+			}
+			s.Includes = append(s.Includes, inc)
+		}
+		start = values[len(values)-1].Handle + 1
+	}
+	return nil
+}
+
+func (self *Client) discoverCharacteristics(ctx context.Context, s *Service) error {
+	for start := s.Handle + 1; start <= s.EndHandle && start != 0; {
+		values, err := self.att.ReadByType(ctx, start, s.EndHandle, uuid.UUID16(UUID_CHARACTERISTIC))
+		if notFound(err) {
+			break
+		} else if err != nil {
+			return err
+		} else if len(values) == 0 {
+			return errEmpty
+		}
+		for _, v := range values {
+			if len(v.Value) != 5 && len(v.Value) != 19 {
+				return fmt.Errorf("gatt: invalid characteristic declaration")
+			}
+			s.Characteristics = append(s.Characteristics, &Characteristic{
+				Handle:      v.Handle,
+				Properties:  v.Value[0],
+				ValueHandle: binary.LittleEndian.Uint16(v.Value[1:]),
+				UUID:        append(uuid.UUID(nil), v.Value[3:]...),
+			})
+		}
+		start = values[len(values)-1].Handle + 1
+	}
+	for i, c := range s.Characteristics {
+		c.EndHandle = s.EndHandle
+		if i+1 < len(s.Characteristics) {
+			c.EndHandle = s.Characteristics[i+1].Handle - 1
+		}
+		if err := self.discoverDescriptors(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Client) discoverDescriptors(ctx context.Context, c *Characteristic) error {
+	for start := c.ValueHandle + 1; start <= c.EndHandle && start != 0; {
+		info, err := self.att.FindInformation(ctx, start, c.EndHandle)
+		if notFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if len(info) == 0 {
+			return errEmpty
+		}
+		for _, i := range info {
+			c.Descriptors = append(c.Descriptors, &Descriptor{
+				Handle: i.Handle,
+				UUID:   i.UUID,
+			})
+		}
+		start = info[len(info)-1].Handle + 1
+	}
+	return nil
+}
+
+// Read reads the whole value of the characteristic.
+func (self *Client) Read(ctx context.Context, c *Characteristic) ([]byte, error) {
+	return self.att.ReadLong(ctx, c.ValueHandle)
+}
+
+// ReadDescriptor reads the whole value of the descriptor.
+func (self *Client) ReadDescriptor(ctx context.Context, d *Descriptor) ([]byte, error) {
+	return self.att.ReadLong(ctx, d.Handle)
+}
+
+// ReadByUUID reads the values of the characteristics of the uuid.
+func (self *Client) ReadByUUID(ctx context.Context, uuid uuid.UUID) ([]att.HandleValue, error) {
+	return self.att.ReadByType(ctx, 1, 0xFFFF, uuid)
+}
+
+func (self *Client) write(ctx context.Context, handle uint16, value []byte) error {
+	if len(value) > self.att.MTU()-3 {
+		return self.att.WriteLong(ctx, handle, value)
+	}
+	return self.att.Write(ctx, handle, value)
+}
+
+// Write writes the value of the characteristic, by long write when the
+// value exceeds the MTU.
+func (self *Client) Write(ctx context.Context, c *Characteristic, value []byte) error {
+	return self.write(ctx, c.ValueHandle, value)
+}
+
+// WriteWithoutResponse writes the value by Write Command.
+func (self *Client) WriteWithoutResponse(c *Characteristic, value []byte) error {
+	return self.att.WriteCommand(c.ValueHandle, value)
+}
+
+// WriteDescriptor writes the value of the descriptor.
+func (self *Client) WriteDescriptor(ctx context.Context, d *Descriptor, value []byte) error {
+	return self.write(ctx, d.Handle, value)
+}
+
+// ReliableWrite writes the values with prepared writes, which the server
+// commits only when every echoed part matches.
+func (self *Client) ReliableWrite(ctx context.Context, writes ...att.HandleValue) error {
+	chunk := self.att.MTU() - 5
+	for _, w := range writes {
+		for off := 0; ; {
+			end := off + chunk
+			if end > len(w.Value) {
+				end = len(w.Value)
+			}
+			rsp, err := self.att.PrepareWrite(ctx, w.Handle, uint16(off), w.Value[off:end])
+			if err != nil {
+				self.att.ExecuteWrite(ctx, false)
+				return err
+			} else if rsp.Handle != w.Handle || int(rsp.Offset) != off || !bytes.Equal(rsp.Value, w.Value[off:end]) {
+				self.att.ExecuteWrite(ctx, false)
+				return fmt.Errorf("gatt: reliable write verification failed")
+			}
+			if off = end; off >= len(w.Value) {
+				break
+			}
+		}
+	}
+	return self.att.ExecuteWrite(ctx, true)
+}
+
+// EnableNotification writes the Client Characteristic Configuration
+// descriptor, CCC_* bits or zero to disable.
+func (self *Client) EnableNotification(ctx context.Context, c *Characteristic, bits uint16) error {
+	d := c.Descriptor(uuid.UUID16(UUID_CLIENT_CHAR_CONFIG))
+	if d == nil {
+		return fmt.Errorf("gatt: no client characteristic configuration")
+	}
+	return self.att.Write(ctx, d.Handle, []byte{uint8(bits), uint8(bits >> 8)})
+}
+
+// Subscribe enables notifications, or indications when the characteristic
+// only supports them, and returns the subscription.
+func (self *Client) Subscribe(ctx context.Context, c *Characteristic) (*Subscription, error) {
+	bits := uint16(CCC_NOTIFY)
+	if c.Properties&PROP_NOTIFY == 0 {
+		if c.Properties&PROP_INDICATE == 0 {
+			return nil, fmt.Errorf("gatt: characteristic can not notify")
+		}
+		bits = CCC_INDICATE
+	}
+	ch := make(chan Notification, 16)
+	sub := &Subscription{
+		C:      ch,
+		c:      ch,
+		client: self,
+		char:   c,
+	}
+	self.lock.Lock()
+	first := len(self.subs[c.ValueHandle]) == 0
+	self.subs[c.ValueHandle] = append(self.subs[c.ValueHandle], sub)
+	self.lock.Unlock()
+
+	if first {
+		if err := self.EnableNotification(ctx, c, bits); err != nil {
+			self.remove(sub)
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// remove returns true when the subscription was the last one.
+func (self *Client) remove(sub *Subscription) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	handle := sub.char.ValueHandle
+	var subs []*Subscription
+	for _, s := range self.subs[handle] {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	if len(subs) == 0 {
+		delete(self.subs, handle)
+		return true
+	}
+	self.subs[handle] = subs
+	return false
+}
+
+// Unsubscribe stops the subscription, disabling the notifications when it
+// was the last one of the characteristic.
+func (self *Subscription) Unsubscribe(ctx context.Context) error {
+	if self.client.remove(self) {
+		return self.client.EnableNotification(ctx, self.char, 0)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/att"
+	"github.com/hkwi/blugo/uuid"
+)
+
+func testDB(hash byte) *att.DB {
+	u := uuid.UUID16
+	db := att.NewDB()
+	add := func(handle uint16, typ uuid.UUID, perm uint8, value []byte, end uint16) {
+		db.Add(&att.Attribute{Handle: handle, Type: typ, Perm: perm, Value: value, EndGroup: end})
+	}
+	r, rw := uint8(att.PERM_READ), uint8(att.PERM_READ|att.PERM_WRITE)
+	add(1, u(UUID_PRIMARY_SERVICE), r, []byte{0x01, 0x18}, 8)
+	add(2, u(UUID_CHARACTERISTIC), r, []byte{PROP_INDICATE, 0x03, 0x00, 0x05, 0x2A}, 0)
+	add(3, u(UUID_SERVICE_CHANGED), 0, nil, 0)
+	add(4, u(UUID_CLIENT_CHAR_CONFIG), rw, []byte{0, 0}, 0)
+	add(5, u(UUID_CHARACTERISTIC), r, []byte{PROP_READ, 0x06, 0x00, 0x2A, 0x2B}, 0)
+	add(6, u(UUID_DATABASE_HASH), r, bytes.Repeat([]byte{hash}, 16), 0)
+	add(7, u(UUID_CHARACTERISTIC), r, []byte{PROP_READ | PROP_WRITE, 0x08, 0x00, 0x29, 0x2B}, 0)
+	add(8, u(UUID_CLIENT_FEATURES), rw, []byte{0}, 0)
+
+	add(0x10, u(UUID_PRIMARY_SERVICE), r, []byte{0x0F, 0x18}, 0x15)
+	add(0x11, u(UUID_INCLUDE), r, []byte{0x20, 0x00, 0x21, 0x00, 0x0A, 0x18}, 0)
+	add(0x12, u(UUID_CHARACTERISTIC), r, []byte{PROP_READ | PROP_NOTIFY, 0x13, 0x00, 0x19, 0x2A}, 0)
+	add(0x13, u(0x2A19), rw, []byte{99}, 0)
+	add(0x14, u(UUID_CLIENT_CHAR_CONFIG), rw, []byte{0, 0}, 0)
+	add(0x15, u(UUID_CHAR_USER_DESC), r, []byte("battery"), 0)
+
+	add(0x20, u(UUID_SECONDARY_SERVICE), r, []byte{0x0A, 0x18}, 0x21)
+	add(0x21, u(UUID_CHARACTERISTIC), r, []byte{PROP_READ, 0x22, 0x00, 0x29, 0x2A}, 0)
+	return db
+}
+
+func pair(db *att.DB, cache Cache) (*Client, *att.Server) {
+	a, b := net.Pipe()
+	return NewClient(att.NewClient(a), "peer", cache), att.NewServer(b, db)
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cache := NewMemoryCache()
+
+	db := testDB(1)
+	client, server := pair(db, cache)
+	services, err := client.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 3 || services[2].Primary {
+		t.Fatalf("got %d services", len(services))
+	}
+	battery := client.Service(uuid.UUID16(0x180F))
+	if battery == nil || len(battery.Includes) != 1 || battery.Includes[0] != services[2] {
+		t.Fatalf("battery service %v", battery)
+	}
+	level := battery.Characteristic(uuid.UUID16(0x2A19))
+	if level == nil || level.ValueHandle != 0x13 || len(level.Descriptors) != 2 {
+		t.Fatalf("battery level %v", level)
+	}
+	if v := db.Attribute(4).Value; !bytes.Equal(v, []byte{CCC_INDICATE, 0}) {
+		t.Errorf("service changed cccd %x", v)
+	}
+	if value, err := client.Read(ctx, level); err != nil || !bytes.Equal(value, []byte{99}) {
+		t.Errorf("read %x %v", value, err)
+	}
+	if err := client.ReliableWrite(ctx, att.HandleValue{Handle: 0x13, Value: []byte{50}}); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(db.Attribute(0x13).Value, []byte{50}) {
+		t.Errorf("reliable write %x", db.Attribute(0x13).Value)
+	}
+
+	sub, err := client.Subscribe(ctx, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Notify(0x13, []byte{42})
+	if n := <-sub.C; n.Handle != 0x13 || !bytes.Equal(n.Value, []byte{42}) {
+		t.Errorf("notification %v", n)
+	}
+	if err := sub.Unsubscribe(ctx); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(db.Attribute(0x14).Value, []byte{0, 0}) {
+		t.Errorf("cccd %x", db.Attribute(0x14).Value)
+	}
+
+	// the cached database is used while the hash is the same, and the
+	// new connection configures the peer again
+	db.Remove(0x20, 0x21)
+	db.Attribute(4).Value = []byte{0, 0}
+	db.Attribute(8).Value = []byte{0}
+	client2, _ := pair(db, cache)
+	if services, err := client2.DiscoverServices(ctx); err != nil || len(services) != 3 {
+		t.Errorf("cached %d %v", len(services), err)
+	}
+	if v := db.Attribute(4).Value; !bytes.Equal(v, []byte{CCC_INDICATE, 0}) {
+		t.Errorf("cached service changed cccd %x", v)
+	}
+	if v := db.Attribute(8).Value; !bytes.Equal(v, []byte{CLIENT_ROBUST_CACHING}) {
+		t.Errorf("cached client features %x", v)
+	}
+
+	changed := client.ServiceChanged()
+	if err := server.Indicate(ctx, 3, []byte{0x20, 0x00, 0xFF, 0xFF}); err != nil {
+		t.Error(err)
+	}
+	if r := <-changed; r != [2]uint16{0x20, 0xFFFF} {
+		t.Errorf("changed %v", r)
+	}
+	if _, _, ok := cache.Load("peer"); ok {
+		t.Error("cache must be invalidated")
+	}
+	if services, err := client.DiscoverServices(ctx); err != nil || len(services) != 2 {
+		t.Errorf("rediscovered %d %v", len(services), err)
+	}
+}
+
+func TestDiscoveryEmptyResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a, b := net.Pipe()
+	defer a.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, err := b.Read(buf)
+			if err != nil {
+				return
+			}
+			if buf[0] == att.READ_BY_GROUP_TYPE_REQ {
+				// the entry length without entries
+				b.Write([]byte{att.READ_BY_GROUP_TYPE_RSP, 0x06})
+			} else if n > 0 {
+				rsp, _ := att.ErrorRsp{ReqOpcode: buf[0], Code: att.ECODE_ATTR_NOT_FOUND}.MarshalBinary()
+				b.Write(rsp)
+			}
+		}
+	}()
+	client := NewClient(att.NewClient(a), "peer", nil)
+	if _, err := client.DiscoverServices(ctx); err == nil || err == context.DeadlineExceeded {
+		t.Errorf("got %v", err)
+	}
+}
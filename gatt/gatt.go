@@ -0,0 +1,157 @@
+// Package gatt implements the Generic Attribute Profile over the att
+// package.
+//
+// Bluetooth Core specification, Vol 3, Part G
+package gatt
+
+import (
+	"sync"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Attribute types, Section 3
+const (
+	UUID_PRIMARY_SERVICE   = 0x2800
+	UUID_SECONDARY_SERVICE = 0x2801
+	UUID_INCLUDE           = 0x2802
+	UUID_CHARACTERISTIC    = 0x2803
+)
+
+// Characteristic descriptors, Section 3.3.3
+const (
+	UUID_CHAR_EXTENDED_PROPS = 0x2900
+	UUID_CHAR_USER_DESC      = 0x2901
+	UUID_CLIENT_CHAR_CONFIG  = 0x2902
+	UUID_SERVER_CHAR_CONFIG  = 0x2903
+	UUID_CHAR_FORMAT         = 0x2904
+	UUID_CHAR_AGG_FORMAT     = 0x2905
+)
+
+// Services and characteristics of GAP and GATT
+const (
+	UUID_GAP_SERVICE          = 0x1800
+	UUID_GATT_SERVICE         = 0x1801
+	UUID_DEVICE_NAME          = 0x2A00
+	UUID_APPEARANCE           = 0x2A01
+	UUID_SERVICE_CHANGED      = 0x2A05
+	UUID_CLIENT_FEATURES      = 0x2B29
+	UUID_DATABASE_HASH        = 0x2B2A
+	UUID_SERVER_FEATURES      = 0x2B3A
+	UUID_CENTRAL_ADDR_RESOLVE = 0x2AA6
+)
+
+// Characteristic properties, Section 3.3.1.1
+const (
+	PROP_BROADCAST    = 0x01
+	PROP_READ         = 0x02
+	PROP_WRITE_NO_RSP = 0x04
+	PROP_WRITE        = 0x08
+	PROP_NOTIFY       = 0x10
+	PROP_INDICATE     = 0x20
+	PROP_SIGNED_WRITE = 0x40
+	PROP_EXTENDED     = 0x80
+)
+
+// Client Characteristic Configuration bits
+const (
+	CCC_NOTIFY   = 0x0001
+	CCC_INDICATE = 0x0002
+)
+
+// Client Supported Features bits
+const (
+	CLIENT_ROBUST_CACHING = 0x01
+	CLIENT_EATT           = 0x02
+	CLIENT_MULTI_NTF      = 0x04
+)
+
+type Service struct {
+	Handle          uint16
+	EndHandle       uint16
+	UUID            uuid.UUID
+	Primary         bool
+	Includes        []*Service
+	Characteristics []*Characteristic
+}
+
+// Characteristic returns the first characteristic of the uuid.
+func (self *Service) Characteristic(uuid uuid.UUID) *Characteristic {
+	for _, c := range self.Characteristics {
+		if c.UUID.Equal(uuid) {
+			return c
+		}
+	}
+	return nil
+}
+
+type Characteristic struct {
+	Handle      uint16 // declaration
+	ValueHandle uint16
+	EndHandle   uint16
+	Properties  uint8
+	UUID        uuid.UUID
+	Descriptors []*Descriptor
+}
+
+// Descriptor returns the descriptor of the uuid.
+func (self *Characteristic) Descriptor(uuid uuid.UUID) *Descriptor {
+	for _, d := range self.Descriptors {
+		if d.UUID.Equal(uuid) {
+			return d
+		}
+	}
+	return nil
+}
+
+type Descriptor struct {
+	Handle uint16
+	UUID   uuid.UUID
+}
+
+// Cache keeps discovered databases per peer, keyed by Database Hash.
+// Services stored must be treated as immutable.
+type Cache interface {
+	Load(peer string) (hash []byte, services []*Service, ok bool)
+	Store(peer string, hash []byte, services []*Service)
+	Invalidate(peer string)
+}
+
+type cacheEntry struct {
+	hash     []byte
+	services []*Service
+}
+
+// MemoryCache is a Cache in the process memory.
+type MemoryCache struct {
+	lock    sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (self *MemoryCache) Load(peer string) ([]byte, []*Service, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	e, ok := self.entries[peer]
+	return e.hash, e.services, ok
+}
+
+func (self *MemoryCache) Store(peer string, hash []byte, services []*Service) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.entries[peer] = cacheEntry{
+		hash:     append([]byte(nil), hash...),
+		services: services,
+	}
+}
+
+func (self *MemoryCache) Invalidate(peer string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.entries, peer)
+}
@@ -0,0 +1,27 @@
+package gatt
+
+import (
+	"github.com/hkwi/blugo/att"
+	"github.com/hkwi/blugo/crypto"
+)
+
+// databaseHash computes Database Hash over the attributes, Section 7.3.
+func databaseHash(attrs []*att.Attribute) []byte {
+	var msg []byte
+	for _, attr := range attrs {
+		typ, ok := attr.Type.Uint16()
+		if !ok {
+			continue
+		}
+		switch typ {
+		case UUID_PRIMARY_SERVICE, UUID_SECONDARY_SERVICE, UUID_INCLUDE, UUID_CHARACTERISTIC, UUID_CHAR_EXTENDED_PROPS:
+			msg = append(msg, uint8(attr.Handle), uint8(attr.Handle>>8))
+			msg = append(msg, attr.Type...)
+			msg = append(msg, attr.Value...)
+		case UUID_CHAR_USER_DESC, UUID_CLIENT_CHAR_CONFIG, UUID_SERVER_CHAR_CONFIG, UUID_CHAR_FORMAT, UUID_CHAR_AGG_FORMAT:
+			msg = append(msg, uint8(attr.Handle), uint8(attr.Handle>>8))
+			msg = append(msg, attr.Type...)
+		}
+	}
+	return crypto.AesCmac(make([]byte, 16), msg)
+}
@@ -0,0 +1,566 @@
+package gatt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hkwi/blugo/att"
+	"github.com/hkwi/blugo/uuid"
+)
+
+var ErrNotSubscribed = errors.New("gatt: not subscribed")
+
+// attUUID returns the 16-bit form of the uuid when possible, or the
+// 128-bit form, as ATT carries no 32-bit UUIDs.
+func attUUID(u uuid.UUID) uuid.UUID {
+	if v, ok := u.Uint16(); ok {
+		return uuid.UUID16(v)
+	}
+	return u.Full()
+}
+
+// LocalService declares a service that Server publishes. Handles are
+// assigned when the service is added.
+type LocalService struct {
+	UUID            uuid.UUID
+	Secondary       bool
+	Includes        []*LocalService // must be added beforehand
+	Characteristics []*LocalCharacteristic
+
+	handle    uint16
+	endHandle uint16
+}
+
+// Handles returns the handle range assigned, or zeros before the service
+// is added.
+func (self *LocalService) Handles() (uint16, uint16) {
+	return self.handle, self.endHandle
+}
+
+// LocalCharacteristic declares a characteristic. Perm is the permission of
+// the value in att.PERM_*, which is derived from Properties when zero; set
+// the encryption or authentication bits to require security of the link.
+// OnRead and OnWrite override the static Value, and may return an
+// att.ErrorCode. Client Characteristic Configuration is added when
+// Properties has PROP_NOTIFY or PROP_INDICATE, and OnSubscribe is called
+// when the client writes it.
+type LocalCharacteristic struct {
+	UUID        uuid.UUID
+	Properties  uint8
+	Perm        uint8
+	Value       []byte
+	Description string // Characteristic User Description, if not empty
+	Descriptors []*LocalDescriptor
+	OnRead      func(conn *ServerConn, offset int) ([]byte, error)
+	OnWrite     func(conn *ServerConn, value []byte) error
+	OnSubscribe func(conn *ServerConn, bits uint16)
+
+	handle      uint16
+	valueHandle uint16
+	cccdHandle  uint16
+}
+
+// ValueHandle returns the handle of the value, or zero before the service
+// is added.
+func (self *LocalCharacteristic) ValueHandle() uint16 {
+	return self.valueHandle
+}
+
+func (self *LocalCharacteristic) perm() uint8 {
+	if self.Perm != 0 {
+		return self.Perm
+	}
+	var perm uint8
+	if self.Properties&PROP_READ != 0 {
+		perm |= att.PERM_READ
+	}
+	if self.Properties&(PROP_WRITE|PROP_WRITE_NO_RSP) != 0 {
+		perm |= att.PERM_WRITE
+	}
+	return perm
+}
+
+// LocalDescriptor declares a characteristic descriptor. Perm defaults to
+// att.PERM_READ.
+type LocalDescriptor struct {
+	UUID    uuid.UUID
+	Perm    uint8
+	Value   []byte
+	OnRead  func(conn *ServerConn, offset int) ([]byte, error)
+	OnWrite func(conn *ServerConn, value []byte) error
+
+	handle uint16
+}
+
+// Handle returns the handle assigned, or zero before the service is added.
+func (self *LocalDescriptor) Handle() uint16 {
+	return self.handle
+}
+
+// Server is the GATT server that publishes the local services to
+// connections. GAP and GATT services are added by NewServer.
+type Server struct {
+	db *att.DB
+
+	lock     sync.Mutex
+	next     uint16
+	services []*LocalService
+	conns    map[*att.Server]*ServerConn
+	hash     []byte
+	changed  *LocalCharacteristic
+}
+
+// ServerConn keeps the client configurations of a connection.
+type ServerConn struct {
+	server *Server
+	att    *att.Server
+
+	lock     sync.Mutex
+	cccd     map[uint16]uint16 // by value handle
+	features []byte
+}
+
+// NewServer makes a server with GAP service of the device name and
+// appearance, and GATT service with Service Changed, Client Supported
+// Features and Database Hash characteristics.
+func NewServer(name string, appearance uint16) *Server {
+	self := &Server{
+		db:    att.NewDB(),
+		next:  1,
+		conns: make(map[*att.Server]*ServerConn),
+	}
+	appearanceValue := make([]byte, 2)
+	binary.LittleEndian.PutUint16(appearanceValue, appearance)
+	self.AddService(&LocalService{
+		UUID: uuid.UUID16(UUID_GAP_SERVICE),
+		Characteristics: []*LocalCharacteristic{{
+			UUID:       uuid.UUID16(UUID_DEVICE_NAME),
+			Properties: PROP_READ,
+			Value:      []byte(name),
+		}, {
+			UUID:       uuid.UUID16(UUID_APPEARANCE),
+			Properties: PROP_READ,
+			Value:      appearanceValue,
+		}},
+	})
+
+	self.changed = &LocalCharacteristic{
+		UUID:       uuid.UUID16(UUID_SERVICE_CHANGED),
+		Properties: PROP_INDICATE,
+	}
+	self.AddService(&LocalService{
+		UUID: uuid.UUID16(UUID_GATT_SERVICE),
+		Characteristics: []*LocalCharacteristic{self.changed, {
+			UUID:       uuid.UUID16(UUID_CLIENT_FEATURES),
+			Properties: PROP_READ | PROP_WRITE,
+			OnRead: func(conn *ServerConn, offset int) ([]byte, error) {
+				conn.lock.Lock()
+				defer conn.lock.Unlock()
+				if offset > len(conn.features) {
+					return nil, att.ECODE_INVALID_OFFSET
+				}
+				return append([]byte(nil), conn.features[offset:]...), nil
+			},
+			OnWrite: func(conn *ServerConn, value []byte) error {
+				conn.lock.Lock()
+				defer conn.lock.Unlock()
+				for i, b := range conn.features {
+					// bits may not be cleared
+					if i >= len(value) || value[i]&b != b {
+						return att.ECODE_VALUE_NOT_ALLOWED
+					}
+				}
+				conn.features = append([]byte(nil), value...)
+				return nil
+			},
+		}, {
+			UUID:       uuid.UUID16(UUID_DATABASE_HASH),
+			Properties: PROP_READ,
+			OnRead: func(conn *ServerConn, offset int) ([]byte, error) {
+				self.lock.Lock()
+				defer self.lock.Unlock()
+				if offset > len(self.hash) {
+					return nil, att.ECODE_INVALID_OFFSET
+				}
+				return append([]byte(nil), self.hash[offset:]...), nil
+			},
+		}},
+	})
+	return self
+}
+
+// DB returns the attribute database of the server.
+func (self *Server) DB() *att.DB {
+	return self.db
+}
+
+// Services returns the services added.
+func (self *Server) Services() []*LocalService {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]*LocalService(nil), self.services...)
+}
+
+// DatabaseHash returns the current value of Database Hash.
+func (self *Server) DatabaseHash() []byte {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]byte(nil), self.hash...)
+}
+
+func (self *Server) conn(server *att.Server) *ServerConn {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	conn := self.conns[server]
+	if conn == nil {
+		conn = &ServerConn{
+			server: self,
+			att:    server,
+			cccd:   make(map[uint16]uint16),
+		}
+		self.conns[server] = conn
+	}
+	return conn
+}
+
+func (self *Server) readFunc(f func(*ServerConn, int) ([]byte, error)) func(*att.Server, int) ([]byte, error) {
+	if f == nil {
+		return nil
+	}
+	return func(server *att.Server, offset int) ([]byte, error) {
+		return f(self.conn(server), offset)
+	}
+}
+
+func (self *Server) writeFunc(f func(*ServerConn, []byte) error) func(*att.Server, []byte) error {
+	if f == nil {
+		return nil
+	}
+	return func(server *att.Server, value []byte) error {
+		return f(self.conn(server), value)
+	}
+}
+
+func handleValue(handle uint16) []byte {
+	ret := make([]byte, 2)
+	binary.LittleEndian.PutUint16(ret, handle)
+	return ret
+}
+
+// AddService assigns the handles to the service and publishes it.
+// Connections that enabled indications of Service Changed are told the
+// handle range.
+func (self *Server) AddService(service *LocalService) error {
+	self.lock.Lock()
+	if service.handle != 0 {
+		self.lock.Unlock()
+		return fmt.Errorf("gatt: service already added")
+	}
+	var attrs []*att.Attribute
+	handle := self.next
+	alloc := func() (uint16, error) {
+		if handle == 0 {
+			return 0, fmt.Errorf("gatt: handles exhausted")
+		}
+		h := handle
+		handle++
+		return h, nil
+	}
+	add := func(attr *att.Attribute) error {
+		if h, err := alloc(); err != nil {
+			return err
+		} else {
+			attr.Handle = h
+			attrs = append(attrs, attr)
+		}
+		return nil
+	}
+
+	typ := uuid.UUID16(UUID_PRIMARY_SERVICE)
+	if service.Secondary {
+		typ = uuid.UUID16(UUID_SECONDARY_SERVICE)
+	}
+	decl := &att.Attribute{
+		Type:  typ,
+		Perm:  att.PERM_READ,
+		Value: attUUID(service.UUID),
+	}
+	err := add(decl)
+	for _, inc := range service.Includes {
+		if err != nil {
+			break
+		} else if inc.handle == 0 {
+			err = fmt.Errorf("gatt: included service not added")
+			break
+		}
+		value := append(handleValue(inc.handle), handleValue(inc.endHandle)...)
+		if u := attUUID(inc.UUID); len(u) == 2 {
+			value = append(value, u...)
+		}
+		err = add(&att.Attribute{
+			Type:  uuid.UUID16(UUID_INCLUDE),
+			Perm:  att.PERM_READ,
+			Value: value,
+		})
+	}
+
+	type assign struct {
+		c                          *LocalCharacteristic
+		handle, valueHandle, cccdH uint16
+	}
+	var assigns []assign
+	var descs []*LocalDescriptor
+	var descHandles []uint16
+	for _, c := range service.Characteristics {
+		if err != nil {
+			break
+		}
+		var a assign
+		a.c = c
+		if a.handle, err = alloc(); err != nil {
+			break
+		} else if a.valueHandle, err = alloc(); err != nil {
+			break
+		}
+		value := []byte{c.Properties}
+		value = append(value, handleValue(a.valueHandle)...)
+		value = append(value, attUUID(c.UUID)...)
+		attrs = append(attrs, &att.Attribute{
+			Handle: a.handle,
+			Type:   uuid.UUID16(UUID_CHARACTERISTIC),
+			Perm:   att.PERM_READ,
+			Value:  value,
+		}, &att.Attribute{
+			Handle: a.valueHandle,
+			Type:   attUUID(c.UUID),
+			Perm:   c.perm(),
+			Value:  append([]byte(nil), c.Value...),
+			Read:   self.readFunc(c.OnRead),
+			Write:  self.writeFunc(c.OnWrite),
+		})
+		if c.Properties&(PROP_NOTIFY|PROP_INDICATE) != 0 {
+			c, valueHandle := c, a.valueHandle
+			writePerm := c.perm() & (att.PERM_WRITE | att.PERM_WRITE_ENCRYPT | att.PERM_WRITE_AUTHEN)
+			if writePerm == 0 {
+				writePerm = att.PERM_WRITE
+			}
+			err = add(&att.Attribute{
+				Type: uuid.UUID16(UUID_CLIENT_CHAR_CONFIG),
+				Perm: att.PERM_READ | writePerm,
+				Read: self.readFunc(func(conn *ServerConn, offset int) ([]byte, error) {
+					value := handleValue(conn.Subscribed(c))
+					if offset > len(value) {
+						return nil, att.ECODE_INVALID_OFFSET
+					}
+					return value[offset:], nil
+				}),
+				Write: self.writeFunc(func(conn *ServerConn, value []byte) error {
+					return conn.configure(c, valueHandle, value)
+				}),
+			})
+			if err == nil {
+				a.cccdH = attrs[len(attrs)-1].Handle
+			}
+		}
+		if err == nil && c.Description != "" {
+			err = add(&att.Attribute{
+				Type:  uuid.UUID16(UUID_CHAR_USER_DESC),
+				Perm:  att.PERM_READ,
+				Value: []byte(c.Description),
+			})
+		}
+		for _, d := range c.Descriptors {
+			if err != nil {
+				break
+			}
+			perm := d.Perm
+			if perm == 0 {
+				perm = att.PERM_READ
+			}
+			if err = add(&att.Attribute{
+				Type:  attUUID(d.UUID),
+				Perm:  perm,
+				Value: append([]byte(nil), d.Value...),
+				Read:  self.readFunc(d.OnRead),
+				Write: self.writeFunc(d.OnWrite),
+			}); err == nil {
+				descs = append(descs, d)
+				descHandles = append(descHandles, attrs[len(attrs)-1].Handle)
+			}
+		}
+		assigns = append(assigns, a)
+	}
+	if err != nil {
+		self.lock.Unlock()
+		return err
+	}
+	decl.EndGroup = attrs[len(attrs)-1].Handle
+
+	for _, attr := range attrs {
+		self.db.Add(attr)
+	}
+	self.next = handle
+	service.handle, service.endHandle = decl.Handle, decl.EndGroup
+	for _, a := range assigns {
+		a.c.handle, a.c.valueHandle, a.c.cccdHandle = a.handle, a.valueHandle, a.cccdH
+	}
+	for i, d := range descs {
+		d.handle = descHandles[i]
+	}
+	self.services = append(self.services, service)
+	self.lock.Unlock()
+
+	self.update(service.handle, service.endHandle)
+	return nil
+}
+
+// RemoveService unpublishes the service. The handles are not reused.
+func (self *Server) RemoveService(service *LocalService) error {
+	self.lock.Lock()
+	found := false
+	for i, s := range self.services {
+		if s == service {
+			self.services = append(self.services[:i], self.services[i+1:]...)
+			found = true
+			break
+		}
+	}
+	self.lock.Unlock()
+	if !found {
+		return fmt.Errorf("gatt: service not added")
+	}
+	self.db.Remove(service.handle, service.endHandle)
+	self.update(service.handle, service.endHandle)
+	return nil
+}
+
+// update recomputes Database Hash and indicates Service Changed.
+func (self *Server) update(start, end uint16) {
+	hash := databaseHash(self.db.Range(1, 0xFFFF))
+
+	self.lock.Lock()
+	self.hash = hash
+	var conns []*ServerConn
+	if self.changed != nil && self.changed.valueHandle != 0 {
+		for _, conn := range self.conns {
+			if conn.Subscribed(self.changed)&CCC_INDICATE != 0 {
+				conns = append(conns, conn)
+			}
+		}
+	}
+	self.lock.Unlock()
+
+	value := append(handleValue(start), handleValue(end)...)
+	for _, conn := range conns {
+		go conn.att.Indicate(context.Background(), self.changed.valueHandle, value)
+	}
+}
+
+// Serve starts the ATT server of the database on the channel.
+func (self *Server) Serve(rw io.ReadWriter) *ServerConn {
+	return self.Attach(att.NewServer(rw, self.db))
+}
+
+// Attach registers the ATT server made on the database of the server, for
+// example one of att.NewPeer.
+func (self *Server) Attach(server *att.Server) *ServerConn {
+	return self.conn(server)
+}
+
+// NotifyAll sends the value to the connections that enabled notifications,
+// or indications without waiting for the confirmations. Closed connections
+// are dropped.
+func (self *Server) NotifyAll(c *LocalCharacteristic, value []byte) {
+	self.lock.Lock()
+	var conns []*ServerConn
+	for server, conn := range self.conns {
+		if server.Err() != nil {
+			delete(self.conns, server)
+		} else {
+			conns = append(conns, conn)
+		}
+	}
+	self.lock.Unlock()
+
+	value = append([]byte(nil), value...)
+	for _, conn := range conns {
+		bits := conn.Subscribed(c)
+		if bits&CCC_NOTIFY != 0 {
+			conn.att.Notify(c.valueHandle, value)
+		} else if bits&CCC_INDICATE != 0 {
+			go conn.att.Indicate(context.Background(), c.valueHandle, value)
+		}
+	}
+}
+
+// ATT returns the underlying ATT server.
+func (self *ServerConn) ATT() *att.Server {
+	return self.att
+}
+
+// Server returns the GATT server of the connection.
+func (self *ServerConn) Server() *Server {
+	return self.server
+}
+
+// Subscribed returns the Client Characteristic Configuration bits of the
+// characteristic.
+func (self *ServerConn) Subscribed(c *LocalCharacteristic) uint16 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.cccd[c.valueHandle]
+}
+
+func (self *ServerConn) configure(c *LocalCharacteristic, valueHandle uint16, value []byte) error {
+	if len(value) != 2 {
+		return att.ECODE_INVALID_ATTR_VALUE_LEN
+	}
+	bits := binary.LittleEndian.Uint16(value)
+	var allowed uint16
+	if c.Properties&PROP_NOTIFY != 0 {
+		allowed |= CCC_NOTIFY
+	}
+	if c.Properties&PROP_INDICATE != 0 {
+		allowed |= CCC_INDICATE
+	}
+	if bits&^allowed != 0 {
+		return att.ECODE_CCCD_IMPROPER
+	}
+	self.lock.Lock()
+	self.cccd[valueHandle] = bits
+	self.lock.Unlock()
+	if c.OnSubscribe != nil {
+		c.OnSubscribe(self, bits)
+	}
+	return nil
+}
+
+// Notify sends the value if the client enabled notifications.
+func (self *ServerConn) Notify(c *LocalCharacteristic, value []byte) error {
+	if self.Subscribed(c)&CCC_NOTIFY == 0 {
+		return ErrNotSubscribed
+	}
+	return self.att.Notify(c.valueHandle, value)
+}
+
+// Indicate sends the value if the client enabled indications, and waits
+// for the confirmation.
+func (self *ServerConn) Indicate(ctx context.Context, c *LocalCharacteristic, value []byte) error {
+	if self.Subscribed(c)&CCC_INDICATE == 0 {
+		return ErrNotSubscribed
+	}
+	return self.att.Indicate(ctx, c.valueHandle, value)
+}
+
+// Close forgets the connection. The ATT channel is left to the caller.
+func (self *ServerConn) Close() {
+	self.server.lock.Lock()
+	defer self.server.lock.Unlock()
+	if self.server.conns[self.att] == self {
+		delete(self.server.conns, self.att)
+	}
+}
@@ -0,0 +1,111 @@
+package gatt
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/att"
+	"github.com/hkwi/blugo/uuid"
+)
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewServer("blugo", 0x0340)
+	written := make(chan []byte, 1)
+	level := &LocalCharacteristic{
+		UUID:        uuid.UUID16(0x2A19),
+		Properties:  PROP_READ | PROP_NOTIFY,
+		Value:       []byte{80},
+		Description: "battery",
+	}
+	secret := &LocalCharacteristic{
+		UUID:       uuid.UUID16(0x2A3D),
+		Properties: PROP_READ | PROP_WRITE,
+		Perm:       att.PERM_READ | att.PERM_WRITE_ENCRYPT,
+		OnWrite: func(conn *ServerConn, value []byte) error {
+			written <- append([]byte(nil), value...)
+			return nil
+		},
+	}
+	battery := &LocalService{
+		UUID:            uuid.UUID16(0x180F),
+		Characteristics: []*LocalCharacteristic{level, secret},
+	}
+	if err := server.AddService(battery); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	conn := server.Serve(b)
+	client := NewClient(att.NewClient(a), "peer", NewMemoryCache())
+	services, err := client.DiscoverServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(services) != 3 {
+		t.Fatalf("got %d services", len(services))
+	}
+	if hash, err := client.DatabaseHash(ctx); err != nil || !bytes.Equal(hash, server.DatabaseHash()) {
+		t.Errorf("hash %x %v", hash, err)
+	}
+	name := client.Service(uuid.UUID16(UUID_GAP_SERVICE)).Characteristic(uuid.UUID16(UUID_DEVICE_NAME))
+	if value, err := client.Read(ctx, name); err != nil || string(value) != "blugo" {
+		t.Errorf("name %q %v", value, err)
+	}
+
+	remote := client.Service(uuid.UUID16(0x180F)).Characteristic(uuid.UUID16(0x2A19))
+	if remote.ValueHandle != level.ValueHandle() || len(remote.Descriptors) != 2 {
+		t.Fatalf("battery level %v", remote)
+	}
+	if err := client.EnableNotification(ctx, remote, CCC_INDICATE); err == nil {
+		t.Error("expected error")
+	} else if e, ok := err.(*att.Error); !ok || e.Code != att.ECODE_CCCD_IMPROPER {
+		t.Errorf("got %v", err)
+	}
+	sub, err := client.Subscribe(ctx, remote)
+	if err != nil {
+		t.Fatal(err)
+	} else if conn.Subscribed(level) != CCC_NOTIFY {
+		t.Errorf("subscribed %d", conn.Subscribed(level))
+	}
+	server.NotifyAll(level, []byte{79})
+	if n := <-sub.C; !bytes.Equal(n.Value, []byte{79}) {
+		t.Errorf("notification %v", n)
+	}
+
+	remoteSecret := client.Service(uuid.UUID16(0x180F)).Characteristic(uuid.UUID16(0x2A3D))
+	if err := client.Write(ctx, remoteSecret, []byte{1}); err == nil || err.(*att.Error).Code != att.ECODE_INSUFFICIENT_ENC {
+		t.Errorf("got %v", err)
+	}
+	conn.ATT().SetSecurity(att.SECURITY_MEDIUM)
+	if err := client.Write(ctx, remoteSecret, []byte{1}); err != nil {
+		t.Error(err)
+	} else if v := <-written; !bytes.Equal(v, []byte{1}) {
+		t.Errorf("written %x", v)
+	}
+
+	changed := client.ServiceChanged()
+	hash := server.DatabaseHash()
+	extra := &LocalService{
+		UUID:     uuid.UUID16(0x180A),
+		Includes: []*LocalService{battery},
+	}
+	if err := server.AddService(extra); err != nil {
+		t.Fatal(err)
+	}
+	start, end := extra.Handles()
+	if r := <-changed; r != [2]uint16{start, end} {
+		t.Errorf("changed %v", r)
+	}
+	if bytes.Equal(hash, server.DatabaseHash()) {
+		t.Error("hash must change")
+	}
+	if services, err := client.DiscoverServices(ctx); err != nil || len(services) != 4 {
+		t.Errorf("rediscovered %d %v", len(services), err)
+	}
+}
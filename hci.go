@@ -5,6 +5,8 @@ package blugo
 import (
 	"encoding/binary"
 	"fmt"
+
+	"github.com/hkwi/blugo/assigned"
 )
 
 // Bluetooth Core speicification, Vol 4, Part A, Section 2
@@ -31,6 +33,17 @@ func (self CommandPkt) Indicator() uint8 {
 	return HCI_COMMAND_PKT
 }
 
+func (self CommandPkt) MarshalBinary() ([]byte, error) {
+	if len(self.Params) > 0xff {
+		return nil, fmt.Errorf("too long")
+	}
+	ret := make([]byte, 4, 4+len(self.Params))
+	ret[0] = HCI_COMMAND_PKT
+	binary.LittleEndian.PutUint16(ret[1:], uint16(self.OpCode))
+	ret[3] = uint8(len(self.Params))
+	return append(ret, self.Params...), nil
+}
+
 type AcldataPkt struct {
 	Handle uint16
 	PB     uint8
@@ -42,6 +55,17 @@ func (self AcldataPkt) Indicator() uint8 {
 	return HCI_ACLDATA_PKT
 }
 
+func (self AcldataPkt) MarshalBinary() ([]byte, error) {
+	if len(self.Data) > 0xffff {
+		return nil, fmt.Errorf("too long")
+	}
+	ret := make([]byte, 5, 5+len(self.Data))
+	ret[0] = HCI_ACLDATA_PKT
+	binary.LittleEndian.PutUint16(ret[1:], self.Handle&0x0FFF|uint16(self.PB&0x3)<<12|uint16(self.BC&0x3)<<14)
+	binary.LittleEndian.PutUint16(ret[3:], uint16(len(self.Data)))
+	return append(ret, self.Data...), nil
+}
+
 type ScodataPkt struct {
 	ConnectionHandle uint16
 	PacketStatusFlag uint8
@@ -52,6 +76,17 @@ func (self ScodataPkt) Indicator() uint8 {
 	return HCI_SCODATA_PKT
 }
 
+func (self ScodataPkt) MarshalBinary() ([]byte, error) {
+	if len(self.Data) > 0xff {
+		return nil, fmt.Errorf("too long")
+	}
+	ret := make([]byte, 4, 4+len(self.Data))
+	ret[0] = HCI_SCODATA_PKT
+	binary.LittleEndian.PutUint16(ret[1:], self.ConnectionHandle&0x0FFF|uint16(self.PacketStatusFlag&0x3)<<12)
+	ret[3] = uint8(len(self.Data))
+	return append(ret, self.Data...), nil
+}
+
 type EventPkt struct {
 	Code   uint8
 	Params []byte
@@ -61,15 +96,101 @@ func (self EventPkt) Indicator() uint8 {
 	return HCI_EVENT_PKT
 }
 
+func (self EventPkt) MarshalBinary() ([]byte, error) {
+	if len(self.Params) > 0xff {
+		return nil, fmt.Errorf("too long")
+	}
+	ret := make([]byte, 3, 3+len(self.Params))
+	ret[0] = HCI_EVENT_PKT
+	ret[1] = self.Code
+	ret[2] = uint8(len(self.Params))
+	return append(ret, self.Params...), nil
+}
+
 // Bluetooth Core specification, Vol 2, Part E, Section 5.2
 
 const (
-	EVT_REMOTE_NAME_REQ_COMPLETE = 0x07
-	EVT_CMD_COMPLETE             = 0x0E
-	EVT_CMD_STATUS               = 0x0F
-	EVT_LE_META_EVENT            = 0x3E
+	EVT_CONN_COMPLETE                 = 0x03
+	EVT_CONN_REQUEST                  = 0x04
+	EVT_DISCONN_COMPLETE              = 0x05
+	EVT_AUTH_COMPLETE                 = 0x06
+	EVT_REMOTE_NAME_REQ_COMPLETE      = 0x07
+	EVT_ENCRYPT_CHANGE                = 0x08
+	EVT_READ_REMOTE_FEATURES_COMPLETE = 0x0B
+	EVT_READ_REMOTE_VERSION_COMPLETE  = 0x0C
+	EVT_CMD_COMPLETE                  = 0x0E
+	EVT_CMD_STATUS                    = 0x0F
+	EVT_ROLE_CHANGE                   = 0x12
+	EVT_NUM_COMP_PKTS                 = 0x13
+	EVT_MODE_CHANGE                   = 0x14
+	EVT_PIN_CODE_REQ                  = 0x16
+	EVT_LINK_KEY_REQ                  = 0x17
+	EVT_LINK_KEY_NOTIFY               = 0x18
+	EVT_READ_CLOCK_OFFSET_COMPLETE    = 0x1C
+	EVT_ENCRYPT_KEY_REFRESH           = 0x30
+	EVT_IO_CAPABILITY_REQUEST         = 0x31
+	EVT_IO_CAPABILITY_RESPONSE        = 0x32
+	EVT_USER_CONFIRM_REQUEST          = 0x33
+	EVT_USER_PASSKEY_REQUEST          = 0x34
+	EVT_REMOTE_OOB_DATA_REQUEST       = 0x35
+	EVT_SIMPLE_PAIRING_COMPLETE       = 0x36
+	EVT_USER_PASSKEY_NOTIFY           = 0x3B
+	EVT_KEYPRESS_NOTIFY               = 0x3C
+	EVT_LE_META_EVENT                 = 0x3E
 )
 
+type EvtConnComplete struct {
+	Status      uint8
+	Handle      uint16
+	Bdaddr      Bdaddr
+	LinkType    LinkType
+	EncryptMode uint8
+}
+
+func (self *EvtConnComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 11 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	copy(self.Bdaddr[:], data[3:])
+	self.LinkType = LinkType(data[9])
+	self.EncryptMode = data[10]
+	return nil
+}
+
+type EvtConnRequest struct {
+	Bdaddr   Bdaddr
+	Class    ClassOfDevice
+	LinkType LinkType
+}
+
+func (self *EvtConnRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Class = ParseClassOfDevice(data[6:])
+	self.LinkType = LinkType(data[9])
+	return nil
+}
+
+type EvtDisconnComplete struct {
+	Status uint8
+	Handle uint16
+	Reason HciError
+}
+
+func (self *EvtDisconnComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.Reason = HciError(data[3])
+	return nil
+}
+
 type EvtRemoteNameReqComplete struct {
 	Status uint8
 	Bdaddr Bdaddr
@@ -86,6 +207,60 @@ func (self *EvtRemoteNameReqComplete) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+type EvtAuthComplete struct {
+	Status uint8
+	Handle uint16
+}
+
+func (self *EvtAuthComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	return nil
+}
+
+type EvtPinCodeReq struct {
+	Bdaddr Bdaddr
+}
+
+func (self *EvtPinCodeReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type EvtLinkKeyReq struct {
+	Bdaddr Bdaddr
+}
+
+func (self *EvtLinkKeyReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type EvtLinkKeyNotify struct {
+	Bdaddr  Bdaddr
+	Key     [16]byte
+	KeyType uint8
+}
+
+func (self *EvtLinkKeyNotify) UnmarshalBinary(data []byte) error {
+	if len(data) < 23 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	copy(self.Key[:], data[6:])
+	self.KeyType = data[22]
+	return nil
+}
+
 type EvtCmdComplete struct {
 	Ncmd   uint8
 	OpCode uint16
@@ -93,23 +268,469 @@ type EvtCmdComplete struct {
 }
 
 func (self *EvtCmdComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return fmt.Errorf("too short")
+	}
 	self.Ncmd = data[0]
 	self.OpCode = binary.LittleEndian.Uint16(data[1:])
 	self.Params = data[3:]
 	return nil
 }
 
+type EvtRoleChange struct {
+	Status uint8
+	Bdaddr Bdaddr
+	Role   uint8
+}
+
+func (self *EvtRoleChange) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	copy(self.Bdaddr[:], data[1:])
+	self.Role = data[7]
+	return nil
+}
+
+type EvtNumCompPkts struct {
+	Handles []uint16
+	Counts  []uint16
+}
+
+func (self *EvtNumCompPkts) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 || len(data) < 1+4*int(data[0]) {
+		return fmt.Errorf("too short")
+	}
+	num := int(data[0])
+	self.Handles = make([]uint16, num)
+	self.Counts = make([]uint16, num)
+	for i := 0; i < num; i++ {
+		self.Handles[i] = binary.LittleEndian.Uint16(data[1+4*i:]) & 0x0FFF
+		self.Counts[i] = binary.LittleEndian.Uint16(data[3+4*i:])
+	}
+	return nil
+}
+
+type EvtModeChange struct {
+	Status   uint8
+	Handle   uint16
+	Mode     ConnMode
+	Interval uint16
+}
+
+func (self *EvtModeChange) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.Mode = ConnMode(data[3])
+	self.Interval = binary.LittleEndian.Uint16(data[4:])
+	return nil
+}
+
+type EvtReadClockOffsetComplete struct {
+	Status      uint8
+	Handle      uint16
+	ClockOffset uint16
+}
+
+func (self *EvtReadClockOffsetComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.ClockOffset = binary.LittleEndian.Uint16(data[3:])
+	return nil
+}
+
+type EvtReadRemoteFeaturesComplete struct {
+	Status   uint8
+	Handle   uint16
+	Features LmpFeatures
+}
+
+func (self *EvtReadRemoteFeaturesComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 11 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	copy(self.Features[:], data[3:])
+	return nil
+}
+
+type EvtReadRemoteVersionComplete struct {
+	Status        uint8
+	Handle        uint16
+	LmpVersion    assigned.CoreVersion
+	Manufacturer  assigned.CompanyID
+	LmpSubversion uint16
+}
+
+func (self *EvtReadRemoteVersionComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.LmpVersion = assigned.CoreVersion(data[3])
+	self.Manufacturer = assigned.CompanyID(binary.LittleEndian.Uint16(data[4:]))
+	self.LmpSubversion = binary.LittleEndian.Uint16(data[6:])
+	return nil
+}
+
+// EvtEncryptChange is Encryption Change, of which Enabled is 0x00 for off,
+// 0x01 for E0 or AES-CCM on LE, and 0x02 for AES-CCM on BR/EDR.
+type EvtEncryptChange struct {
+	Status  uint8
+	Handle  uint16
+	Enabled uint8
+}
+
+func (self *EvtEncryptChange) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.Enabled = data[3]
+	return nil
+}
+
+type EvtEncryptKeyRefresh struct {
+	Status uint8
+	Handle uint16
+}
+
+func (self *EvtEncryptKeyRefresh) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	return nil
+}
+
+// Secure Simple Pairing events, Bluetooth Core specification, Vol 2,
+// Part E, Section 7.7.40 - 7.7.50
+
+type EvtIoCapabilityRequest struct {
+	Bdaddr Bdaddr
+}
+
+func (self *EvtIoCapabilityRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type EvtIoCapabilityResponse struct {
+	Bdaddr         Bdaddr
+	IOCapability   uint8
+	OOBDataPresent uint8
+	AuthReq        uint8
+}
+
+func (self *EvtIoCapabilityResponse) UnmarshalBinary(data []byte) error {
+	if len(data) < 9 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.IOCapability = data[6]
+	self.OOBDataPresent = data[7]
+	self.AuthReq = data[8]
+	return nil
+}
+
+type EvtUserConfirmRequest struct {
+	Bdaddr Bdaddr
+	Value  uint32
+}
+
+func (self *EvtUserConfirmRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Value = binary.LittleEndian.Uint32(data[6:])
+	return nil
+}
+
+type EvtUserPasskeyRequest struct {
+	Bdaddr Bdaddr
+}
+
+func (self *EvtUserPasskeyRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type EvtRemoteOobDataRequest struct {
+	Bdaddr Bdaddr
+}
+
+func (self *EvtRemoteOobDataRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type EvtSimplePairingComplete struct {
+	Status uint8
+	Bdaddr Bdaddr
+}
+
+func (self *EvtSimplePairingComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("too short")
+	}
+	self.Status = data[0]
+	copy(self.Bdaddr[:], data[1:])
+	return nil
+}
+
+type EvtUserPasskeyNotify struct {
+	Bdaddr  Bdaddr
+	Passkey uint32
+}
+
+func (self *EvtUserPasskeyNotify) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Passkey = binary.LittleEndian.Uint32(data[6:])
+	return nil
+}
+
+type EvtKeypressNotify struct {
+	Bdaddr Bdaddr
+	Type   uint8
+}
+
+func (self *EvtKeypressNotify) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Type = data[6]
+	return nil
+}
+
 type EvtLeMetaEvent struct {
 	Subevent uint8
 	Data     []byte
 }
 
 func (self *EvtLeMetaEvent) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("too short")
+	}
 	self.Subevent = data[0]
 	self.Data = data[1:]
 	return nil
 }
 
+// Bluetooth Core specification, Vol 2, Part E, Section 7.7.65
+
+const (
+	EVT_LE_CONN_COMPLETE                       = 0x01
+	EVT_LE_ADVERTISING_REPORT                  = 0x02
+	EVT_LE_CONN_UPDATE_COMPLETE                = 0x03
+	EVT_LE_READ_REMOTE_USED_FEATURES_COMPLETE  = 0x04
+	EVT_LE_LTK_REQUEST                         = 0x05
+	EVT_LE_REMOTE_CONN_PARAM_REQUEST           = 0x06
+	EVT_LE_DATA_LENGTH_CHANGE                  = 0x07
+	EVT_LE_READ_LOCAL_P256_PUBLIC_KEY_COMPLETE = 0x08
+	EVT_LE_GENERATE_DHKEY_COMPLETE             = 0x09
+	EVT_LE_ENHANCED_CONN_COMPLETE              = 0x0A
+	EVT_LE_DIRECT_ADVERTISING_REPORT           = 0x0B
+)
+
+// EvtLeConnComplete is either LE Connection Complete or LE Enhanced
+// Connection Complete. Resolvable private addresses are zero for the former.
+type EvtLeConnComplete struct {
+	Status              uint8
+	Handle              uint16
+	Role                uint8
+	PeerBdaddrType      uint8
+	PeerBdaddr          Bdaddr
+	LocalRpa            Bdaddr
+	PeerRpa             Bdaddr
+	Interval            uint16
+	Latency             uint16
+	SupervisionTimeout  uint16
+	MasterClockAccuracy uint8
+}
+
+// UnmarshalBinary reads LE Connection Complete. LE Enhanced Connection
+// Complete, which carries the resolvable private addresses too, is read by
+// UnmarshalEnhanced.
+func (self *EvtLeConnComplete) UnmarshalBinary(data []byte) error {
+	if len(data) < 18 {
+		return fmt.Errorf("too short")
+	}
+	self.unmarshalPeer(data)
+	self.unmarshalParams(data[11:])
+	return nil
+}
+
+func (self *EvtLeConnComplete) UnmarshalEnhanced(data []byte) error {
+	if len(data) < 30 {
+		return fmt.Errorf("too short")
+	}
+	self.unmarshalPeer(data)
+	copy(self.LocalRpa[:], data[11:])
+	copy(self.PeerRpa[:], data[17:])
+	self.unmarshalParams(data[23:])
+	return nil
+}
+
+func (self *EvtLeConnComplete) unmarshalPeer(data []byte) {
+	self.Status = data[0]
+	self.Handle = binary.LittleEndian.Uint16(data[1:])
+	self.Role = data[3]
+	self.PeerBdaddrType = data[4]
+	copy(self.PeerBdaddr[:], data[5:])
+}
+
+func (self *EvtLeConnComplete) unmarshalParams(data []byte) {
+	self.Interval = binary.LittleEndian.Uint16(data)
+	self.Latency = binary.LittleEndian.Uint16(data[2:])
+	self.SupervisionTimeout = binary.LittleEndian.Uint16(data[4:])
+	self.MasterClockAccuracy = data[6]
+}
+
+// Advertising report event types
+const (
+	ADV_REPORT_IND          = 0x00
+	ADV_REPORT_DIRECT_IND   = 0x01
+	ADV_REPORT_SCAN_IND     = 0x02
+	ADV_REPORT_NONCONN_IND  = 0x03
+	ADV_REPORT_SCAN_RSP     = 0x04
+	ADV_REPORT_RSSI_UNKNOWN = 127 // RSSI not available
+)
+
+// AdvReportType is the event type of the advertising reports.
+type AdvReportType uint8
+
+var advReportTypeNames = map[AdvReportType]string{
+	ADV_REPORT_IND:         "ADV_IND",
+	ADV_REPORT_DIRECT_IND:  "ADV_DIRECT_IND",
+	ADV_REPORT_SCAN_IND:    "ADV_SCAN_IND",
+	ADV_REPORT_NONCONN_IND: "ADV_NONCONN_IND",
+	ADV_REPORT_SCAN_RSP:    "SCAN_RSP",
+}
+
+func (self AdvReportType) String() string {
+	if name, ok := advReportTypeNames[self]; ok {
+		return name
+	}
+	return "Reserved"
+}
+
+type LeAdvertisingReport struct {
+	EventType AdvReportType
+	Addr      LeAddr
+	Data      AdData
+	Rssi      int8
+}
+
+// EvtLeAdvertisingReport holds the reports in the order of the event. The
+// reports are laid out one after another, as the controllers send them.
+type EvtLeAdvertisingReport struct {
+	Reports []LeAdvertisingReport
+}
+
+func (self *EvtLeAdvertisingReport) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("too short")
+	}
+	num := int(data[0])
+	data = data[1:]
+	var reports []LeAdvertisingReport
+	for i := 0; i < num; i++ {
+		if len(data) < 9 || len(data) < 10+int(data[8]) {
+			return fmt.Errorf("too short")
+		}
+		r := LeAdvertisingReport{
+			EventType: AdvReportType(data[0]),
+			Addr:      LeAddr{Type: data[1]},
+		}
+		copy(r.Addr.Addr[:], data[2:8])
+		n := int(data[8])
+		if err := r.Data.UnmarshalBinary(data[9 : 9+n]); err != nil {
+			return err
+		}
+		r.Rssi = int8(data[9+n])
+		reports = append(reports, r)
+		data = data[10+n:]
+	}
+	self.Reports = reports
+	return nil
+}
+
+type EvtLeLtkRequest struct {
+	Handle uint16
+	Rand   uint64
+	EDiv   uint16
+}
+
+func (self *EvtLeLtkRequest) UnmarshalBinary(data []byte) error {
+	if len(data) < 12 {
+		return fmt.Errorf("too short")
+	}
+	self.Handle = binary.LittleEndian.Uint16(data)
+	self.Rand = binary.LittleEndian.Uint64(data[2:])
+	self.EDiv = binary.LittleEndian.Uint16(data[10:])
+	return nil
+}
+
+func (self EvtLeMetaEvent) Parse() (EventPktParams, error) {
+	switch self.Subevent {
+	case EVT_LE_CONN_COMPLETE:
+		params := EvtLeConnComplete{}
+		if err := params.UnmarshalBinary(self.Data); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_LE_ENHANCED_CONN_COMPLETE:
+		params := EvtLeConnComplete{}
+		if err := params.UnmarshalEnhanced(self.Data); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_LE_ADVERTISING_REPORT:
+		params := EvtLeAdvertisingReport{}
+		if err := params.UnmarshalBinary(self.Data); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_LE_LTK_REQUEST:
+		params := EvtLeLtkRequest{}
+		if err := params.UnmarshalBinary(self.Data); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown EVT_LE_ %02x", self.Subevent)
+	}
+}
+
 type EvtCmdStatus struct {
 	Status uint8
 	Ncmd   uint8
@@ -117,6 +738,9 @@ type EvtCmdStatus struct {
 }
 
 func (self *EvtCmdStatus) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("too short")
+	}
 	self.Status = data[0]
 	self.Ncmd = data[1]
 	self.OpCode = binary.LittleEndian.Uint16(data[2:])
@@ -127,6 +751,34 @@ type EventPktParams interface{}
 
 func (self EventPkt) Parse() (EventPktParams, error) {
 	switch self.Code {
+	case EVT_CONN_COMPLETE:
+		params := EvtConnComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_CONN_REQUEST:
+		params := EvtConnRequest{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_DISCONN_COMPLETE:
+		params := EvtDisconnComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_AUTH_COMPLETE:
+		params := EvtAuthComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
 	case EVT_REMOTE_NAME_REQ_COMPLETE:
 		params := EvtRemoteNameReqComplete{}
 		if err := params.UnmarshalBinary(self.Params); err != nil {
@@ -134,6 +786,27 @@ func (self EventPkt) Parse() (EventPktParams, error) {
 		} else {
 			return params, nil
 		}
+	case EVT_PIN_CODE_REQ:
+		params := EvtPinCodeReq{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_LINK_KEY_REQ:
+		params := EvtLinkKeyReq{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_LINK_KEY_NOTIFY:
+		params := EvtLinkKeyNotify{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
 	case EVT_CMD_COMPLETE:
 		params := EvtCmdComplete{}
 		if err := params.UnmarshalBinary(self.Params); err != nil {
@@ -148,8 +821,120 @@ func (self EventPkt) Parse() (EventPktParams, error) {
 		} else {
 			return params, nil
 		}
+	case EVT_ROLE_CHANGE:
+		params := EvtRoleChange{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_NUM_COMP_PKTS:
+		params := EvtNumCompPkts{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_MODE_CHANGE:
+		params := EvtModeChange{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_READ_REMOTE_FEATURES_COMPLETE:
+		params := EvtReadRemoteFeaturesComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_READ_REMOTE_VERSION_COMPLETE:
+		params := EvtReadRemoteVersionComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_READ_CLOCK_OFFSET_COMPLETE:
+		params := EvtReadClockOffsetComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_ENCRYPT_CHANGE:
+		params := EvtEncryptChange{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_ENCRYPT_KEY_REFRESH:
+		params := EvtEncryptKeyRefresh{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_IO_CAPABILITY_REQUEST:
+		params := EvtIoCapabilityRequest{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_IO_CAPABILITY_RESPONSE:
+		params := EvtIoCapabilityResponse{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_USER_CONFIRM_REQUEST:
+		params := EvtUserConfirmRequest{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_USER_PASSKEY_REQUEST:
+		params := EvtUserPasskeyRequest{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_REMOTE_OOB_DATA_REQUEST:
+		params := EvtRemoteOobDataRequest{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_SIMPLE_PAIRING_COMPLETE:
+		params := EvtSimplePairingComplete{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_USER_PASSKEY_NOTIFY:
+		params := EvtUserPasskeyNotify{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
+	case EVT_KEYPRESS_NOTIFY:
+		params := EvtKeypressNotify{}
+		if err := params.UnmarshalBinary(self.Params); err != nil {
+			return nil, err
+		} else {
+			return params, nil
+		}
 	case EVT_LE_META_EVENT:
-		params := EvtRemoteNameReqComplete{}
+		params := EvtLeMetaEvent{}
 		if err := params.UnmarshalBinary(self.Params); err != nil {
 			return nil, err
 		} else {
@@ -196,7 +981,7 @@ func Parse(buf []byte) (Pkt, int) {
 		}, 5 + data_length
 
 	case HCI_SCODATA_PKT:
-		if len(buf) < 3 {
+		if len(buf) < 4 {
 			return nil, 0
 		}
 		data_length := int(buf[3])
@@ -260,6 +1045,8 @@ func (self Parameters) MarshalBinary() ([]byte, error) {
 			ret = append(ret, buf[:8]...)
 		case []byte:
 			ret = append(ret, v...)
+		case Bdaddr:
+			ret = append(ret, v[:]...)
 		default:
 			return nil, fmt.Errorf("unknown type")
 		}
@@ -0,0 +1,351 @@
+package blugo
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// The parameters of the commands that this library sends, for the dissector.
+// Bluetooth Core specification, Vol 2, Part E, Section 7. The other commands
+// stay in hex.
+
+// CmdHandle is the parameter of the commands that take the connection
+// handle only.
+type CmdHandle struct {
+	Handle uint16
+}
+
+func (self *CmdHandle) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("too short")
+	}
+	self.Handle = binary.LittleEndian.Uint16(data)
+	return nil
+}
+
+// CmdBdaddr is the parameter of the commands that take the address only.
+type CmdBdaddr struct {
+	Bdaddr Bdaddr
+}
+
+func (self *CmdBdaddr) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	return nil
+}
+
+type CmdCreateConn struct {
+	Bdaddr          Bdaddr
+	PacketType      uint16
+	PageScanRepMode uint8
+	ClockOffset     uint16
+	AllowRoleSwitch uint8
+}
+
+func (self *CmdCreateConn) UnmarshalBinary(data []byte) error {
+	if len(data) < 13 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.PacketType = binary.LittleEndian.Uint16(data[6:])
+	self.PageScanRepMode = data[8]
+	self.ClockOffset = binary.LittleEndian.Uint16(data[10:])
+	self.AllowRoleSwitch = data[12]
+	return nil
+}
+
+type CmdDisconnect struct {
+	Handle uint16
+	Reason HciError
+}
+
+func (self *CmdDisconnect) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return fmt.Errorf("too short")
+	}
+	self.Handle = binary.LittleEndian.Uint16(data)
+	self.Reason = HciError(data[2])
+	return nil
+}
+
+// CmdAcceptConnReq is also the parameter of Switch Role.
+type CmdAcceptConnReq struct {
+	Bdaddr Bdaddr
+	Role   uint8
+}
+
+func (self *CmdAcceptConnReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Role = data[6]
+	return nil
+}
+
+type CmdRejectConnReq struct {
+	Bdaddr Bdaddr
+	Reason HciError
+}
+
+func (self *CmdRejectConnReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.Reason = HciError(data[6])
+	return nil
+}
+
+type CmdLinkKeyReqReply struct {
+	Bdaddr  Bdaddr
+	LinkKey [16]byte
+}
+
+func (self *CmdLinkKeyReqReply) UnmarshalBinary(data []byte) error {
+	if len(data) < 22 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	copy(self.LinkKey[:], data[6:])
+	return nil
+}
+
+type CmdRemoteNameReq struct {
+	Bdaddr          Bdaddr
+	PageScanRepMode uint8
+	ClockOffset     uint16
+}
+
+func (self *CmdRemoteNameReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Bdaddr[:], data)
+	self.PageScanRepMode = data[6]
+	self.ClockOffset = binary.LittleEndian.Uint16(data[8:])
+	return nil
+}
+
+type CmdWriteLocalName struct {
+	Name string
+}
+
+func (self *CmdWriteLocalName) UnmarshalBinary(data []byte) error {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	self.Name = string(data)
+	return nil
+}
+
+type CmdWriteClassOfDevice struct {
+	Class ClassOfDevice
+}
+
+func (self *CmdWriteClassOfDevice) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 {
+		return fmt.Errorf("too short")
+	}
+	self.Class = ParseClassOfDevice(data)
+	return nil
+}
+
+type CmdLeSetRandomAddress struct {
+	Addr Bdaddr
+}
+
+func (self *CmdLeSetRandomAddress) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("too short")
+	}
+	copy(self.Addr[:], data)
+	return nil
+}
+
+type CmdLeSetAdvertisingParameters struct {
+	IntervalMin  uint16
+	IntervalMax  uint16
+	Type         uint8
+	OwnAddrType  uint8
+	PeerAddr     LeAddr
+	ChannelMap   uint8
+	FilterPolicy uint8
+}
+
+func (self *CmdLeSetAdvertisingParameters) UnmarshalBinary(data []byte) error {
+	if len(data) < 15 {
+		return fmt.Errorf("too short")
+	}
+	self.IntervalMin = binary.LittleEndian.Uint16(data)
+	self.IntervalMax = binary.LittleEndian.Uint16(data[2:])
+	self.Type = data[4]
+	self.OwnAddrType = data[5]
+	self.PeerAddr.Type = data[6]
+	copy(self.PeerAddr.Addr[:], data[7:])
+	self.ChannelMap = data[13]
+	self.FilterPolicy = data[14]
+	return nil
+}
+
+// CmdLeSetAdvertisingData is also the parameter of Set Scan Response Data.
+type CmdLeSetAdvertisingData struct {
+	Data AdData
+}
+
+func (self *CmdLeSetAdvertisingData) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return fmt.Errorf("too short")
+	}
+	return self.Data.UnmarshalBinary(data[1 : 1+int(data[0])])
+}
+
+type CmdLeSetAdvertiseEnable struct {
+	Enable uint8
+}
+
+func (self *CmdLeSetAdvertiseEnable) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("too short")
+	}
+	self.Enable = data[0]
+	return nil
+}
+
+type CmdLeSetScanParameters struct {
+	ScanType     uint8
+	Interval     uint16
+	Window       uint16
+	OwnAddrType  uint8
+	FilterPolicy uint8
+}
+
+func (self *CmdLeSetScanParameters) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("too short")
+	}
+	self.ScanType = data[0]
+	self.Interval = binary.LittleEndian.Uint16(data[1:])
+	self.Window = binary.LittleEndian.Uint16(data[3:])
+	self.OwnAddrType = data[5]
+	self.FilterPolicy = data[6]
+	return nil
+}
+
+type CmdLeSetScanEnable struct {
+	Enable           uint8
+	FilterDuplicates uint8
+}
+
+func (self *CmdLeSetScanEnable) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("too short")
+	}
+	self.Enable = data[0]
+	self.FilterDuplicates = data[1]
+	return nil
+}
+
+type CmdLeStartEncryption struct {
+	Handle uint16
+	Rand   uint64
+	EDiv   uint16
+	LTK    [16]byte
+}
+
+func (self *CmdLeStartEncryption) UnmarshalBinary(data []byte) error {
+	if len(data) < 28 {
+		return fmt.Errorf("too short")
+	}
+	self.Handle = binary.LittleEndian.Uint16(data)
+	self.Rand = binary.LittleEndian.Uint64(data[2:])
+	self.EDiv = binary.LittleEndian.Uint16(data[10:])
+	copy(self.LTK[:], data[12:])
+	return nil
+}
+
+type CmdLeLtkReqReply struct {
+	Handle uint16
+	LTK    [16]byte
+}
+
+func (self *CmdLeLtkReqReply) UnmarshalBinary(data []byte) error {
+	if len(data) < 18 {
+		return fmt.Errorf("too short")
+	}
+	self.Handle = binary.LittleEndian.Uint16(data)
+	copy(self.LTK[:], data[2:])
+	return nil
+}
+
+type CommandPktParams interface{}
+
+// Parse decodes the parameters of the commands listed in this file. It
+// returns nil for the commands without parameters, and an error for the
+// others.
+func (self CommandPkt) Parse() (CommandPktParams, error) {
+	var params encoding.BinaryUnmarshaler
+	switch self.OpCode {
+	case HCI_Read_Remote_Supported_Features,
+		HCI_Read_Remote_Version_Information,
+		HCI_Read_Clock_Offset,
+		HCI_Authentication_Requested,
+		HCI_Role_Discovery,
+		HCI_Read_Link_Policy_Settings,
+		HCI_Read_Link_Quality,
+		HCI_Read_RSSI,
+		HCI_LE_Long_Term_Key_Request_Negative_Reply:
+		params = &CmdHandle{}
+	case HCI_Create_Connection_Cancel,
+		HCI_Remote_Name_Request_Cancel,
+		HCI_Link_Key_Request_Negative_Reply,
+		HCI_Remote_OOB_Data_Request_Negative_Reply:
+		params = &CmdBdaddr{}
+	case HCI_Create_Connection:
+		params = &CmdCreateConn{}
+	case HCI_Disconnect:
+		params = &CmdDisconnect{}
+	case HCI_Accept_Connection_Request, HCI_Switch_Role:
+		params = &CmdAcceptConnReq{}
+	case HCI_Reject_Connection_Request:
+		params = &CmdRejectConnReq{}
+	case HCI_Link_Key_Request_Reply:
+		params = &CmdLinkKeyReqReply{}
+	case HCI_Remote_Name_Request:
+		params = &CmdRemoteNameReq{}
+	case HCI_Write_Local_Name:
+		params = &CmdWriteLocalName{}
+	case HCI_Write_Class_Of_Device:
+		params = &CmdWriteClassOfDevice{}
+	case HCI_LE_Set_Random_Address:
+		params = &CmdLeSetRandomAddress{}
+	case HCI_LE_Set_Advertising_Parameters:
+		params = &CmdLeSetAdvertisingParameters{}
+	case HCI_LE_Set_Advertising_Data, HCI_LE_Set_Scan_Response_Data:
+		params = &CmdLeSetAdvertisingData{}
+	case HCI_LE_Set_Advertise_Enable:
+		params = &CmdLeSetAdvertiseEnable{}
+	case HCI_LE_Set_Scan_Parameters:
+		params = &CmdLeSetScanParameters{}
+	case HCI_LE_Set_Scan_Enable:
+		params = &CmdLeSetScanEnable{}
+	case HCI_LE_Start_Encryption:
+		params = &CmdLeStartEncryption{}
+	case HCI_LE_Long_Term_Key_Request_Reply:
+		params = &CmdLeLtkReqReply{}
+	default:
+		if len(self.Params) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unknown command")
+	}
+	if err := params.UnmarshalBinary(self.Params); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(params).Elem().Interface(), nil
+}
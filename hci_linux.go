@@ -151,6 +151,65 @@ func (self LinkType) String() string {
 	}
 }
 
+const (
+	HCI_ROLE_MASTER = 0x00
+	HCI_ROLE_SLAVE  = 0x01
+)
+
+type LinkPolicy uint16
+
+const (
+	HCI_LP_RSWITCH = 1 << iota
+	HCI_LP_HOLD
+	HCI_LP_SNIFF
+	HCI_LP_PARK
+)
+
+func (self LinkPolicy) String() string {
+	var comps []string
+	if self&HCI_LP_RSWITCH != 0 {
+		comps = append(comps, "RSWITCH")
+	}
+	if self&HCI_LP_HOLD != 0 {
+		comps = append(comps, "HOLD")
+	}
+	if self&HCI_LP_SNIFF != 0 {
+		comps = append(comps, "SNIFF")
+	}
+	if self&HCI_LP_PARK != 0 {
+		comps = append(comps, "PARK")
+	}
+	if len(comps) == 0 {
+		return "NONE"
+	} else {
+		return strings.Join(comps, " ")
+	}
+}
+
+type ConnMode uint8 // current mode reported by Mode Change event
+
+const (
+	HCI_CM_ACTIVE ConnMode = iota
+	HCI_CM_HOLD
+	HCI_CM_SNIFF
+	HCI_CM_PARK
+)
+
+func (self ConnMode) String() string {
+	switch self {
+	case HCI_CM_ACTIVE:
+		return "ACTIVE"
+	case HCI_CM_HOLD:
+		return "HOLD"
+	case HCI_CM_SNIFF:
+		return "SNIFF"
+	case HCI_CM_PARK:
+		return "PARK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // socket option
 const (
 	_ = iota
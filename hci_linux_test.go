@@ -1,6 +1,7 @@
 package blugo
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -57,3 +58,73 @@ func TestConnList(t *testing.T) {
 		}
 	}
 }
+
+func TestEvtUnmarshal(t *testing.T) {
+	addr := Bdaddr{0x06, 0x05, 0x04, 0x03, 0x02, 0x01}
+	cases := []struct {
+		code   uint8
+		params []byte
+		expect EventPktParams
+	}{
+		{
+			EVT_CONN_COMPLETE,
+			[]byte{0x00, 0x40, 0x00, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x01, 0x00},
+			EvtConnComplete{Handle: 0x40, Bdaddr: addr, LinkType: ACL_LINK},
+		},
+		{
+			EVT_CONN_REQUEST,
+			[]byte{0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x0c, 0x01, 0x5a, 0x01},
+			EvtConnRequest{Bdaddr: addr, Class: 0x5a010c, LinkType: ACL_LINK},
+		},
+		{
+			EVT_DISCONN_COMPLETE,
+			[]byte{0x00, 0x40, 0x00, 0x13},
+			EvtDisconnComplete{Handle: 0x40, Reason: HCI_OE_USER_ENDED_CONNECTION},
+		},
+		{
+			EVT_ROLE_CHANGE,
+			[]byte{0x00, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x01},
+			EvtRoleChange{Bdaddr: addr, Role: HCI_ROLE_SLAVE},
+		},
+		{
+			EVT_MODE_CHANGE,
+			[]byte{0x00, 0x40, 0x00, 0x02, 0x20, 0x03},
+			EvtModeChange{Handle: 0x40, Mode: HCI_CM_SNIFF, Interval: 0x0320},
+		},
+		{
+			EVT_READ_CLOCK_OFFSET_COMPLETE,
+			[]byte{0x0c, 0x40, 0x00, 0x34, 0x12},
+			EvtReadClockOffsetComplete{Status: 0x0c, Handle: 0x40, ClockOffset: 0x1234},
+		},
+	}
+	for _, c := range cases {
+		if p, err := (EventPkt{Code: c.code, Params: c.params}).Parse(); err != nil {
+			t.Errorf("0x%02x: %v", c.code, err)
+		} else if !reflect.DeepEqual(p, c.expect) {
+			t.Errorf("0x%02x: got %#v", c.code, p)
+		}
+		if _, err := (EventPkt{Code: c.code, Params: c.params[:len(c.params)-1]}).Parse(); err == nil {
+			t.Errorf("0x%02x: too short accepted", c.code)
+		}
+	}
+	// the layout follows the subevent, not the length
+	rpa := Bdaddr{0x11, 0x12, 0x13, 0x14, 0x15, 0x56}
+	conn := []byte{0x00, 0x40, 0x00, HCI_ROLE_SLAVE, LE_ADDR_PUBLIC, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}
+	params := []byte{0x18, 0x00, 0x00, 0x00, 0x48, 0x00, 0x01}
+	legacy := append(append([]byte{EVT_LE_CONN_COMPLETE}, conn...), params...)
+	enhanced := append(append(append([]byte{EVT_LE_ENHANCED_CONN_COMPLETE}, conn...), make([]byte, 6)...), rpa[:]...)
+	enhanced = append(enhanced, params...)
+	expect := EvtLeConnComplete{Handle: 0x40, Role: HCI_ROLE_SLAVE, PeerBdaddrType: LE_ADDR_PUBLIC, PeerBdaddr: addr,
+		Interval: 0x18, SupervisionTimeout: 0x48, MasterClockAccuracy: 1}
+	for _, data := range [][]byte{legacy, append(legacy, make([]byte, 12)...), enhanced} {
+		e := expect
+		if data[0] == EVT_LE_ENHANCED_CONN_COMPLETE {
+			e.PeerRpa = rpa
+		}
+		if p, err := (EvtLeMetaEvent{Subevent: data[0], Data: data[1:]}).Parse(); err != nil {
+			t.Errorf("%x: %v", data, err)
+		} else if !reflect.DeepEqual(p, e) {
+			t.Errorf("%x: got %#v", data, p)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package blugo
+
+// Names of the commands and the events in the form of the specification.
+
+var opcodeNames = map[OpCode]string{
+	HCI_Inquiry:                                               "Inquiry",
+	HCI_Inquiry_Cancel:                                        "Inquiry Cancel",
+	HCI_Periodic_Inquiry_Mode:                                 "Periodic Inquiry Mode",
+	HCI_Exit_Periodic_Inquiry_Mode:                            "Exit Periodic Inquiry Mode",
+	HCI_Create_Connection:                                     "Create Connection",
+	HCI_Disconnect:                                            "Disconnect",
+	HCI_Create_Connection_Cancel:                              "Create Connection Cancel",
+	HCI_Accept_Connection_Request:                             "Accept Connection Request",
+	HCI_Reject_Connection_Request:                             "Reject Connection Request",
+	HCI_Link_Key_Request_Reply:                                "Link Key Request Reply",
+	HCI_Link_Key_Request_Negative_Reply:                       "Link Key Request Negative Reply",
+	HCI_PIN_Code_Request_Reply:                                "PIN Code Request Reply",
+	HCI_PIN_Code_Request_Negative_Reply:                       "PIN Code Request Negative Reply",
+	HCI_Change_Connection_Packet_Type:                         "Change Connection Packet Type",
+	HCI_Authentication_Requested:                              "Authentication Requested",
+	HCI_Set_Connection_Encryption:                             "Set Connection Encryption",
+	HCI_Change_Connection_Link_Key:                            "Change Connection Link Key",
+	HCI_Master_Link_Key:                                       "Master Link Key",
+	HCI_Remote_Name_Request:                                   "Remote Name Request",
+	HCI_Remote_Name_Request_Cancel:                            "Remote Name Request Cancel",
+	HCI_Read_Remote_Supported_Features:                        "Read Remote Supported Features",
+	HCI_Read_Remote_Extended_Features:                         "Read Remote Extended Features",
+	HCI_Read_Remote_Version_Information:                       "Read Remote Version Information",
+	HCI_Read_Clock_Offset:                                     "Read Clock Offset",
+	HCI_Read_LMP_Handle:                                       "Read LMP Handle",
+	HCI_Setup_Synchronous_Connection:                          "Setup Synchronous Connection",
+	HCI_Accept_Synchronous_Connection_Request:                 "Accept Synchronous Connection Request",
+	HCI_Reject_Synchronous_Connection_Request:                 "Reject Synchronous Connection Request",
+	HCI_IO_Capability_Request_Reply:                           "IO Capability Request Reply",
+	HCI_User_Confirmation_Request_Reply:                       "User Confirmation Request Reply",
+	HCI_User_Confirmation_Request_Negative_Reply:              "User Confirmation Request Negative Reply",
+	HCI_User_Passkey_Request_Reply:                            "User Passkey Request Reply",
+	HCI_User_Passkey_Request_Negative_Reply:                   "User Passkey Request Negative Reply",
+	HCI_Remote_OOB_Data_Request_Reply:                         "Remote OOB Data Request Reply",
+	HCI_Remote_OOB_Data_Request_Negative_Reply:                "Remote OOB Data Request Negative Reply",
+	HCI_IO_Capability_Request_Negative_Reply:                  "IO Capability Request Negative Reply",
+	HCI_Hold_Mode:                                             "Hold Mode",
+	HCI_Sniff_Mode:                                            "Sniff Mode",
+	HCI_Exit_Sniff_Mode:                                       "Exit Sniff Mode",
+	HCI_Park_State:                                            "Park State",
+	HCI_Exit_Park_State:                                       "Exit Park State",
+	HCI_QoS_Setup:                                             "QoS Setup",
+	HCI_Role_Discovery:                                        "Role Discovery",
+	HCI_Switch_Role:                                           "Switch Role",
+	HCI_Read_Link_Policy_Settings:                             "Read Link Policy Settings",
+	HCI_Write_Link_Policy_Settings:                            "Write Link Policy Settings",
+	HCI_Read_Default_Link_Policy_Settings:                     "Read Default Link Policy Settings",
+	HCI_Write_Default_Link_Policy_Settings:                    "Write Default Link Policy Settings",
+	HCI_Flow_Specification:                                    "Flow Specification",
+	HCI_Sniff_Subrating:                                       "Sniff Subrating",
+	HCI_Write_Local_Name:                                      "Write Local Name",
+	HCI_Read_Local_Name:                                       "Read Local Name",
+	HCI_Read_Class_Of_Device:                                  "Read Class Of Device",
+	HCI_Write_Class_Of_Device:                                 "Write Class Of Device",
+	HCI_Write_Simple_Pairing_Mode:                             "Write Simple Pairing Mode",
+	HCI_Read_Local_OOB_Data:                                   "Read Local OOB Data",
+	HCI_Read_Local_Version_Information:                        "Read Local Version Information",
+	HCI_Read_Local_Supported_Commands:                         "Read Local Supported Commands",
+	HCI_Read_Local_Supported_Features:                         "Read Local Supported Features",
+	HCI_Read_Local_Extended_Features:                          "Read Local Extended Features",
+	HCI_Read_Buffer_Size:                                      "Read Buffer Size",
+	HCI_Read_BD_ADDR:                                          "Read BD ADDR",
+	HCI_Read_Data_Block_Size:                                  "Read Data Block Size",
+	HCI_Read_Local_Supported_Codecs:                           "Read Local Supported Codecs",
+	HCI_Read_Failed_Contact_Counter:                           "Read Failed Contact Counter",
+	HCI_Reset_Failed_Contact_Counter:                          "Reset Failed Contact Counter",
+	HCI_Read_Link_Quality:                                     "Read Link Quality",
+	HCI_Read_RSSI:                                             "Read RSSI",
+	HCI_Read_AFH_Channel_Map:                                  "Read AFH Channel Map",
+	HCI_Read_Clock:                                            "Read Clock",
+	HCI_Read_Encryption_Key_Size:                              "Read Encryption Key Size",
+	HCI_Read_Local_AMP_Info:                                   "Read Local AMP Info",
+	HCI_Read_Local_AMP_ASSOC:                                  "Read Local AMP ASSOC",
+	HCI_Write_Remote_AMP_ASSOC:                                "Write Remote AMP ASSOC",
+	HCI_Get_MWS_Transport_Layer_Configuration:                 "Get MWS Transport Layer Configuration",
+	HCI_Set_Triggered_Clock_Capture:                           "Set Triggered Clock Capture",
+	HCI_LE_Set_Event_Mask:                                     "LE Set Event Mask",
+	HCI_LE_Read_Buffer_Size:                                   "LE Read Buffer Size",
+	HCI_LE_Read_Local_Supported_Features:                      "LE Read Local Supported Features",
+	HCI_LE_Set_Random_Address:                                 "LE Set Random Address",
+	HCI_LE_Set_Advertising_Parameters:                         "LE Set Advertising Parameters",
+	HCI_LE_Read_Advertising_Channel_Tx_Power:                  "LE Read Advertising Channel Tx Power",
+	HCI_LE_Set_Advertising_Data:                               "LE Set Advertising Data",
+	HCI_LE_Set_Scan_Response_Data:                             "LE Set Scan Response Data",
+	HCI_LE_Set_Advertise_Enable:                               "LE Set Advertise Enable",
+	HCI_LE_Set_Scan_Parameters:                                "LE Set Scan Parameters",
+	HCI_LE_Set_Scan_Enable:                                    "LE Set Scan Enable",
+	HCI_LE_Create_Connection:                                  "LE Create Connection",
+	HCI_LE_Create_Connection_Cancel:                           "LE Create Connection Cancel",
+	HCI_LE_Read_White_List_Size:                               "LE Read White List Size",
+	HCI_LE_Clear_White_List:                                   "LE Clear White List",
+	HCI_LE_Add_Device_To_White_List:                           "LE Add Device To White List",
+	HCI_LE_Remove_Device_From_White_List:                      "LE Remove Device From White List",
+	HCI_LE_Connection_Update:                                  "LE Connection Update",
+	HCI_LE_Set_Host_Channel_Classification:                    "LE Set Host Channel Classification",
+	HCI_LE_Read_Channel_Map:                                   "LE Read Channel Map",
+	HCI_LE_Read_Remote_Used_Features:                          "LE Read Remote Used Features",
+	HCI_LE_Encrypt:                                            "LE Encrypt",
+	HCI_LE_Rand:                                               "LE Rand",
+	HCI_LE_Start_Encryption:                                   "LE Start Encryption",
+	HCI_LE_Long_Term_Key_Request_Reply:                        "LE Long Term Key Request Reply",
+	HCI_LE_Long_Term_Key_Request_Negative_Reply:               "LE Long Term Key Request Negative Reply",
+	HCI_LE_Read_Supported_States:                              "LE Read Supported States",
+	HCI_LE_Receiver_Test:                                      "LE Receiver Test",
+	HCI_LE_Transmitter_Test:                                   "LE Transmitter Test",
+	HCI_LE_Test_End:                                           "LE Test End",
+	HCI_LE_Remote_Connection_Parameter_Request_Reply:          "LE Remote Connection Parameter Request Reply",
+	HCI_LE_Remote_Connection_Parameter_Request_Negative_Reply: "LE Remote Connection Parameter Request Negative Reply",
+	HCI_LE_Set_Data_Length:                                    "LE Set Data Length",
+	HCI_LE_Read_Suggested_Default_Data_Length:                 "LE Read Suggested Default Data Length",
+	HCI_LE_Write_Suggested_Default_Data_Length:                "LE Write Suggested Default Data Length",
+	HCI_LE_Read_Local_P256_Public_Key:                         "LE Read Local P256 Public Key",
+	HCI_LE_Generate_DHKey:                                     "LE Generate DHKey",
+	HCI_LE_Add_Device_To_Resolving_List:                       "LE Add Device To Resolving List",
+	HCI_LE_Remove_Device_From_Resolving_List:                  "LE Remove Device From Resolving List",
+	HCI_LE_Clear_Resolving_List:                               "LE Clear Resolving List",
+	HCI_LE_Read_Resolving_List_Size:                           "LE Read Resolving List Size",
+	HCI_LE_Read_Peer_Resolvable_Address:                       "LE Read Peer Resolvable Address",
+	HCI_LE_Read_Local_Resolvable_Address:                      "LE Read Local Resolvable Address",
+	HCI_LE_Set_Address_Resolution_Enable:                      "LE Set Address Resolution Enable",
+	HCI_LE_Set_Resolvable_Private_Address_Timeout:             "LE Set Resolvable Private Address Timeout",
+	HCI_LE_Read_Maximum_Data_Length:                           "LE Read Maximum Data Length",
+	HCI_LE_Read_PHY:                                           "LE Read PHY",
+}
+
+var eventNames = map[uint8]string{
+	EVT_CONN_COMPLETE:                 "Connection Complete",
+	EVT_CONN_REQUEST:                  "Connection Request",
+	EVT_DISCONN_COMPLETE:              "Disconnection Complete",
+	EVT_AUTH_COMPLETE:                 "Authentication Complete",
+	EVT_REMOTE_NAME_REQ_COMPLETE:      "Remote Name Request Complete",
+	EVT_READ_REMOTE_FEATURES_COMPLETE: "Read Remote Supported Features Complete",
+	EVT_READ_REMOTE_VERSION_COMPLETE:  "Read Remote Version Information Complete",
+	EVT_ENCRYPT_CHANGE:                "Encryption Change",
+	EVT_CMD_COMPLETE:                  "Command Complete",
+	EVT_CMD_STATUS:                    "Command Status",
+	EVT_ROLE_CHANGE:                   "Role Change",
+	EVT_NUM_COMP_PKTS:                 "Number of Completed Packets",
+	EVT_MODE_CHANGE:                   "Mode Change",
+	EVT_PIN_CODE_REQ:                  "PIN Code Request",
+	EVT_LINK_KEY_REQ:                  "Link Key Request",
+	EVT_LINK_KEY_NOTIFY:               "Link Key Notification",
+	EVT_READ_CLOCK_OFFSET_COMPLETE:    "Read Clock Offset Complete",
+	EVT_ENCRYPT_KEY_REFRESH:           "Encryption Key Refresh Complete",
+	EVT_IO_CAPABILITY_REQUEST:         "IO Capability Request",
+	EVT_IO_CAPABILITY_RESPONSE:        "IO Capability Response",
+	EVT_USER_CONFIRM_REQUEST:          "User Confirmation Request",
+	EVT_USER_PASSKEY_REQUEST:          "User Passkey Request",
+	EVT_REMOTE_OOB_DATA_REQUEST:       "Remote OOB Data Request",
+	EVT_SIMPLE_PAIRING_COMPLETE:       "Simple Pairing Complete",
+	EVT_USER_PASSKEY_NOTIFY:           "User Passkey Notification",
+	EVT_KEYPRESS_NOTIFY:               "Keypress Notification",
+	EVT_LE_META_EVENT:                 "LE Meta Event",
+}
+
+var leEventNames = map[uint8]string{
+	EVT_LE_CONN_COMPLETE:                       "LE Connection Complete",
+	EVT_LE_ADVERTISING_REPORT:                  "LE Advertising Report",
+	EVT_LE_CONN_UPDATE_COMPLETE:                "LE Connection Update Complete",
+	EVT_LE_READ_REMOTE_USED_FEATURES_COMPLETE:  "LE Read Remote Used Features Complete",
+	EVT_LE_LTK_REQUEST:                         "LE Long Term Key Request",
+	EVT_LE_REMOTE_CONN_PARAM_REQUEST:           "LE Remote Connection Parameter Request",
+	EVT_LE_DATA_LENGTH_CHANGE:                  "LE Data Length Change",
+	EVT_LE_READ_LOCAL_P256_PUBLIC_KEY_COMPLETE: "LE Read Local P-256 Public Key Complete",
+	EVT_LE_GENERATE_DHKEY_COMPLETE:             "LE Generate DHKey Complete",
+	EVT_LE_ENHANCED_CONN_COMPLETE:              "LE Enhanced Connection Complete",
+	EVT_LE_DIRECT_ADVERTISING_REPORT:           "LE Direct Advertising Report",
+}
@@ -20,6 +20,117 @@ const (
 	OGF_LE_CTL
 )
 
+// Bluetooth Core specification, Vol 2, Part E, Section 7.1
+
+const (
+	_ = iota | (OGF_LINK_CTL << 10)
+	HCI_Inquiry
+	HCI_Inquiry_Cancel
+	HCI_Periodic_Inquiry_Mode
+	HCI_Exit_Periodic_Inquiry_Mode
+	HCI_Create_Connection
+	HCI_Disconnect
+	_
+	HCI_Create_Connection_Cancel
+	HCI_Accept_Connection_Request
+	HCI_Reject_Connection_Request
+	HCI_Link_Key_Request_Reply
+	HCI_Link_Key_Request_Negative_Reply
+	HCI_PIN_Code_Request_Reply
+	HCI_PIN_Code_Request_Negative_Reply
+	HCI_Change_Connection_Packet_Type
+	_
+	HCI_Authentication_Requested
+	_
+	HCI_Set_Connection_Encryption
+	_
+	HCI_Change_Connection_Link_Key
+	_
+	HCI_Master_Link_Key
+	_
+	HCI_Remote_Name_Request
+	HCI_Remote_Name_Request_Cancel
+	HCI_Read_Remote_Supported_Features
+	HCI_Read_Remote_Extended_Features
+	HCI_Read_Remote_Version_Information
+	_
+	HCI_Read_Clock_Offset
+	HCI_Read_LMP_Handle
+	_
+	_
+	_
+	_
+	_
+	_
+	_
+	HCI_Setup_Synchronous_Connection
+	HCI_Accept_Synchronous_Connection_Request
+	HCI_Reject_Synchronous_Connection_Request
+	HCI_IO_Capability_Request_Reply
+	HCI_User_Confirmation_Request_Reply
+	HCI_User_Confirmation_Request_Negative_Reply
+	HCI_User_Passkey_Request_Reply
+	HCI_User_Passkey_Request_Negative_Reply
+	HCI_Remote_OOB_Data_Request_Reply
+	_
+	_
+	HCI_Remote_OOB_Data_Request_Negative_Reply
+	HCI_IO_Capability_Request_Negative_Reply
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.2
+
+const (
+	_ = iota | (OGF_LINK_POLICY << 10)
+	HCI_Hold_Mode
+	_
+	HCI_Sniff_Mode
+	HCI_Exit_Sniff_Mode
+	HCI_Park_State
+	HCI_Exit_Park_State
+	HCI_QoS_Setup
+	_
+	HCI_Role_Discovery
+	_
+	HCI_Switch_Role
+	HCI_Read_Link_Policy_Settings
+	HCI_Write_Link_Policy_Settings
+	HCI_Read_Default_Link_Policy_Settings
+	HCI_Write_Default_Link_Policy_Settings
+	HCI_Flow_Specification
+	HCI_Sniff_Subrating
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.3
+
+const (
+	HCI_Write_Local_Name          = 0x0013 | (OGF_HOST_CTL << 10)
+	HCI_Read_Local_Name           = 0x0014 | (OGF_HOST_CTL << 10)
+	HCI_Read_Class_Of_Device      = 0x0023 | (OGF_HOST_CTL << 10)
+	HCI_Write_Class_Of_Device     = 0x0024 | (OGF_HOST_CTL << 10)
+	HCI_Write_Simple_Pairing_Mode = 0x0056 | (OGF_HOST_CTL << 10)
+	HCI_Read_Local_OOB_Data       = 0x0057 | (OGF_HOST_CTL << 10)
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.4
+
+const (
+	_ = iota | (OGF_INFO_PARAM << 10)
+	HCI_Read_Local_Version_Information
+	HCI_Read_Local_Supported_Commands
+	HCI_Read_Local_Supported_Features
+	HCI_Read_Local_Extended_Features
+	HCI_Read_Buffer_Size
+	_
+	_
+	_
+	HCI_Read_BD_ADDR
+	HCI_Read_Data_Block_Size
+	HCI_Read_Local_Supported_Codecs
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.5
+
 const (
 	_ = iota | (OGF_STATUS_PARAM << 10)
 	HCI_Read_Failed_Contact_Counter
@@ -37,6 +148,62 @@ const (
 	HCI_Set_Triggered_Clock_Capture
 )
 
+// Bluetooth Core specification, Vol 2, Part E, Section 7.8
+
+const (
+	_ = iota | (OGF_LE_CTL << 10)
+	HCI_LE_Set_Event_Mask
+	HCI_LE_Read_Buffer_Size
+	HCI_LE_Read_Local_Supported_Features
+	_
+	HCI_LE_Set_Random_Address
+	HCI_LE_Set_Advertising_Parameters
+	HCI_LE_Read_Advertising_Channel_Tx_Power
+	HCI_LE_Set_Advertising_Data
+	HCI_LE_Set_Scan_Response_Data
+	HCI_LE_Set_Advertise_Enable
+	HCI_LE_Set_Scan_Parameters
+	HCI_LE_Set_Scan_Enable
+	HCI_LE_Create_Connection
+	HCI_LE_Create_Connection_Cancel
+	HCI_LE_Read_White_List_Size
+	HCI_LE_Clear_White_List
+	HCI_LE_Add_Device_To_White_List
+	HCI_LE_Remove_Device_From_White_List
+	HCI_LE_Connection_Update
+	HCI_LE_Set_Host_Channel_Classification
+	HCI_LE_Read_Channel_Map
+	HCI_LE_Read_Remote_Used_Features
+	HCI_LE_Encrypt
+	HCI_LE_Rand
+	HCI_LE_Start_Encryption
+	HCI_LE_Long_Term_Key_Request_Reply
+	HCI_LE_Long_Term_Key_Request_Negative_Reply
+	HCI_LE_Read_Supported_States
+	HCI_LE_Receiver_Test
+	HCI_LE_Transmitter_Test
+	HCI_LE_Test_End
+	HCI_LE_Remote_Connection_Parameter_Request_Reply
+	HCI_LE_Remote_Connection_Parameter_Request_Negative_Reply
+	HCI_LE_Set_Data_Length
+	HCI_LE_Read_Suggested_Default_Data_Length
+	HCI_LE_Write_Suggested_Default_Data_Length
+	HCI_LE_Read_Local_P256_Public_Key
+	HCI_LE_Generate_DHKey
+	HCI_LE_Add_Device_To_Resolving_List
+	HCI_LE_Remove_Device_From_Resolving_List
+	HCI_LE_Clear_Resolving_List
+	HCI_LE_Read_Resolving_List_Size
+	HCI_LE_Read_Peer_Resolvable_Address
+	HCI_LE_Read_Local_Resolvable_Address
+	HCI_LE_Set_Address_Resolution_Enable
+	HCI_LE_Set_Resolvable_Private_Address_Timeout
+	HCI_LE_Read_Maximum_Data_Length
+	HCI_LE_Read_PHY
+	HCI_LE_Set_Default_PHY
+	HCI_LE_Set_PHY
+)
+
 func (self OpCode) Ogf() uint8 {
 	return uint8(self >> 10)
 }
@@ -45,8 +212,10 @@ func (self OpCode) Ocf() uint16 {
 	return uint16(self) & 0x03ff
 }
 
+// String shows the name with the OGF and the OCF in the form of btmon, such as
+// "Reset (0x03|0x0003)".
 func (self OpCode) String() string {
-	return fmt.Sprintf("ogf=0x%02x,ocf=0x%04x", self.Ogf(), self.Ocf())
+	return fmt.Sprintf("%s (0x%02x|0x%04x)", self.Name(), self.Ogf(), self.Ocf())
 }
 
 func (self OpCode) Native() uint16 {
@@ -70,8 +239,190 @@ func (self OpCode) Response(data []byte) (Parameters, error) {
 			binary.LittleEndian.Uint16(data[1:]),
 			int8(data[3]),
 		}, nil
+	case HCI_Read_Local_Version_Information:
+		if len(data) < 9 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			data[1],
+			binary.LittleEndian.Uint16(data[2:]),
+			data[4],
+			binary.LittleEndian.Uint16(data[5:]),
+			binary.LittleEndian.Uint16(data[7:]),
+		}, nil
+	case HCI_Read_Buffer_Size:
+		if len(data) < 8 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+			data[3],
+			binary.LittleEndian.Uint16(data[4:]),
+			binary.LittleEndian.Uint16(data[6:]),
+		}, nil
+	case HCI_LE_Read_Buffer_Size:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+			data[3],
+		}, nil
+	case HCI_Create_Connection_Cancel, HCI_Read_BD_ADDR:
+		if len(data) < 7 {
+			return nil, fmt.Errorf("too short")
+		}
+		var addr Bdaddr
+		copy(addr[:], data[1:])
+		return Parameters{
+			data[0],
+			addr,
+		}, nil
+	case HCI_Role_Discovery:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+			data[3],
+		}, nil
+	case HCI_Read_Link_Policy_Settings:
+		if len(data) < 5 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+			binary.LittleEndian.Uint16(data[3:]),
+		}, nil
+	case HCI_Write_Link_Policy_Settings, HCI_Sniff_Subrating:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+		}, nil
+	case HCI_Read_Default_Link_Policy_Settings:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+		}, nil
+	case HCI_Write_Default_Link_Policy_Settings,
+		HCI_Write_Local_Name,
+		HCI_Write_Class_Of_Device,
+		HCI_Write_Simple_Pairing_Mode,
+		HCI_LE_Set_Random_Address,
+		HCI_LE_Set_Advertising_Parameters,
+		HCI_LE_Set_Advertising_Data,
+		HCI_LE_Set_Scan_Response_Data,
+		HCI_LE_Set_Advertise_Enable,
+		HCI_LE_Set_Scan_Parameters,
+		HCI_LE_Set_Scan_Enable,
+		HCI_LE_Add_Device_To_Resolving_List,
+		HCI_LE_Remove_Device_From_Resolving_List,
+		HCI_LE_Clear_Resolving_List,
+		HCI_LE_Set_Address_Resolution_Enable,
+		HCI_LE_Set_Resolvable_Private_Address_Timeout:
+		if len(data) < 1 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+		}, nil
+	case HCI_Read_Link_Quality:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+			data[3],
+		}, nil
+	case HCI_Read_Local_Name:
+		if len(data) < 249 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			data[1:249],
+		}, nil
+	case HCI_Read_Class_Of_Device:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			data[1:4],
+		}, nil
+	case HCI_Read_Local_OOB_Data:
+		if len(data) < 33 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			data[1:17],
+			data[17:33],
+		}, nil
+	case HCI_LE_Read_Resolving_List_Size:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			data[1],
+		}, nil
+	case HCI_LE_Long_Term_Key_Request_Reply, HCI_LE_Long_Term_Key_Request_Negative_Reply:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("too short")
+		}
+		return Parameters{
+			data[0],
+			binary.LittleEndian.Uint16(data[1:]),
+		}, nil
 	// XXX: add more opcodes
 	default:
 		return nil, fmt.Errorf("unknown opcode")
 	}
 }
+
+// responseNames are the names of the return parameters of Response, in the
+// order, for the dissector.
+var responseNames = map[OpCode][]string{
+	HCI_Read_RSSI:                               {"Status", "Handle", "Rssi"},
+	HCI_Read_Local_Version_Information:          {"Status", "HciVersion", "HciRevision", "LmpVersion", "Manufacturer", "LmpSubversion"},
+	HCI_Read_Buffer_Size:                        {"Status", "AclMtu", "ScoMtu", "AclPackets", "ScoPackets"},
+	HCI_LE_Read_Buffer_Size:                     {"Status", "AclMtu", "AclPackets"},
+	HCI_Create_Connection_Cancel:                {"Status", "Bdaddr"},
+	HCI_Read_BD_ADDR:                            {"Status", "Bdaddr"},
+	HCI_Role_Discovery:                          {"Status", "Handle", "Role"},
+	HCI_Read_Link_Policy_Settings:               {"Status", "Handle", "Policy"},
+	HCI_Write_Link_Policy_Settings:              {"Status", "Handle"},
+	HCI_Sniff_Subrating:                         {"Status", "Handle"},
+	HCI_Read_Default_Link_Policy_Settings:       {"Status", "Policy"},
+	HCI_Read_Link_Quality:                       {"Status", "Handle", "LinkQuality"},
+	HCI_Read_Local_Name:                         {"Status", "Name"},
+	HCI_Read_Class_Of_Device:                    {"Status", "Class"},
+	HCI_Read_Local_OOB_Data:                     {"Status", "Hash", "Randomizer"},
+	HCI_LE_Read_Resolving_List_Size:             {"Status", "Size"},
+	HCI_LE_Long_Term_Key_Request_Reply:          {"Status", "Handle"},
+	HCI_LE_Long_Term_Key_Request_Negative_Reply: {"Status", "Handle"},
+}
+
+// ResponseName is the name of the i-th return parameter of Response. It is
+// "Status" for the first of the commands that are not listed.
+func (self OpCode) ResponseName(i int) string {
+	if names, ok := responseNames[self]; ok && i < len(names) {
+		return names[i]
+	} else if i == 0 {
+		return "Status"
+	}
+	return ""
+}
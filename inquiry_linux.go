@@ -0,0 +1,74 @@
+// +build linux
+
+package blugo
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.1.1
+// Inquiry through the kernel, which collects the Inquiry Result events.
+
+const (
+	IREQ_CACHE_FLUSH = 0x0001
+	GIAC             = 0x9e8b33 // general inquiry access code
+	LIAC             = 0x9e8b00 // limited inquiry access code
+)
+
+const sizeofInquiryInfo = 14
+
+// InquiryInfo is the response of a device to the inquiry.
+type InquiryInfo struct {
+	Bdaddr          Bdaddr
+	PscanRepMode    uint8
+	PscanPeriodMode uint8
+	PscanMode       uint8
+	Class           ClassOfDevice
+	ClockOffset     uint16
+}
+
+// ConnectOptions gives the page scan repetition mode and the clock offset
+// of the device for Connect and RemoteName.
+func (self InquiryInfo) ConnectOptions() *ConnectOptions {
+	return &ConnectOptions{
+		PageScanRepMode: self.PscanRepMode,
+		ClockOffset:     self.ClockOffset | 0x8000,
+	}
+}
+
+// Inquiry discovers the devices with GIAC for length in 1.28 sec units, up
+// to numRsp devices, or unlimited with zero. flags of IREQ_CACHE_FLUSH
+// drops the results of the previous inquiries that the kernel keeps.
+func (self Hci) Inquiry(devId uint16, length, numRsp uint8, flags uint16) ([]InquiryInfo, error) {
+	max := int(numRsp)
+	if max == 0 {
+		max = 255
+	}
+	buf := make([]byte, SizeofHciInquiryReq+max*sizeofInquiryInfo)
+	req := (*HciInquiryReq)(unsafe.Pointer(&buf[0]))
+	req.Dev_id = devId
+	req.Flags = flags
+	req.Lap = [3]uint8{GIAC & 0xff, (GIAC >> 8) & 0xff, GIAC >> 16}
+	req.Length = length
+	req.Num_rsp = numRsp
+	if err := ioctl(int(self),
+		uintptr(HCIINQUIRY),
+		uintptr(unsafe.Pointer(&buf[0])),
+	); err != nil {
+		return nil, err
+	}
+	var ret []InquiryInfo
+	for i := 0; i < int(req.Num_rsp) && i < max; i++ {
+		info := buf[SizeofHciInquiryReq+i*sizeofInquiryInfo:]
+		var r InquiryInfo
+		copy(r.Bdaddr[:], info)
+		r.PscanRepMode = info[6]
+		r.PscanPeriodMode = info[7]
+		r.PscanMode = info[8]
+		r.Class = ParseClassOfDevice(info[9:12])
+		r.ClockOffset = binary.LittleEndian.Uint16(info[12:])
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
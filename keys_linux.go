@@ -0,0 +1,97 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+
+	"github.com/hkwi/blugo/keystore"
+)
+
+// keyServer answers the key requests of the controller from the store.
+type keyServer struct {
+	dev     HciDev
+	store   keystore.KeyStore
+	adapter Bdaddr
+	peers   map[uint16]Bdaddr // LE connections in the peripheral role
+}
+
+var keyEvents = []int{
+	EVT_LINK_KEY_REQ,
+	EVT_LINK_KEY_NOTIFY,
+	EVT_DISCONN_COMPLETE,
+	EVT_LE_META_EVENT,
+}
+
+func (self *keyServer) handle(p EventPktParams) (bool, error) {
+	switch ev := p.(type) {
+	case EvtLinkKeyReq:
+		if self.store != nil {
+			if bond, err := self.store.Get(self.adapter, ev.Bdaddr); err == nil && bond.LinkKey != nil {
+				return false, self.dev.command(HCI_Link_Key_Request_Reply, []Parameter{ev.Bdaddr, bond.LinkKey.Key[:]})
+			}
+		}
+		return false, self.dev.command(HCI_Link_Key_Request_Negative_Reply, []Parameter{ev.Bdaddr})
+	case EvtLinkKeyNotify:
+		if self.store == nil {
+			return false, nil
+		}
+		// a new bond comes with the peer of ADDR_BREDR
+		return false, keystore.Update(self.store, self.adapter, ev.Bdaddr, func(bond *keystore.Bond) error {
+			bond.LinkKey = &keystore.LinkKey{Key: ev.Key, Type: ev.KeyType}
+			return nil
+		})
+	case EvtDisconnComplete:
+		delete(self.peers, ev.Handle)
+	case EvtLeMetaEvent:
+		sub, err := ev.Parse()
+		if err != nil || self.store == nil {
+			return false, nil
+		}
+		switch sev := sub.(type) {
+		case EvtLeConnComplete:
+			if sev.Status == 0 && sev.Role == HCI_ROLE_SLAVE {
+				self.peers[sev.Handle] = sev.PeerBdaddr
+			}
+		case EvtLeLtkRequest:
+			var bond *keystore.Bond
+			var key [16]byte
+			if sev.EDiv == 0 && sev.Rand == 0 {
+				if peer, ok := self.peers[sev.Handle]; ok {
+					bond, _ = keystore.Resolve(self.store, self.adapter, peer)
+				}
+				if bond != nil && bond.LTK != nil && bond.LTK.SecureConnections {
+					key = bond.LTK.Key
+				} else {
+					bond = nil
+				}
+			} else if bond, _ = keystore.FindLTK(self.store, self.adapter, sev.EDiv, sev.Rand); bond != nil {
+				key = bond.PeripheralLTK.Key
+			}
+			if bond == nil {
+				return false, self.dev.command(HCI_LE_Long_Term_Key_Request_Negative_Reply, []Parameter{sev.Handle})
+			}
+			return false, self.dev.command(HCI_LE_Long_Term_Key_Request_Reply, []Parameter{sev.Handle, key[:]})
+		}
+	}
+	return false, nil
+}
+
+// ServeKeys answers the key requests of the controller from the store
+// until the context is done: Link Key Request of BR/EDR, and LE Long Term
+// Key Request on the connections in the peripheral role. New link keys
+// notified by the controller are stored. adapter is the address of the
+// device that keys the store. Pairing.Serve does the same while serving
+// the pairing.
+//
+// The kernel answers the requests by itself while the adapter is managed by
+// bluetoothd, so this is for the adapters driven by this library alone.
+func (self HciDev) ServeKeys(ctx context.Context, store keystore.KeyStore, adapter Bdaddr) error {
+	keys := &keyServer{
+		dev:     self,
+		store:   store,
+		adapter: adapter,
+		peers:   make(map[uint16]Bdaddr),
+	}
+	return self.exchange(ctx, 0, nil, keyEvents, keys.handle)
+}
@@ -0,0 +1,250 @@
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// info is the key file of a device in BlueZ,
+// /var/lib/bluetooth/<adapter>/<device>/info. The groups and the keys not
+// handled here are kept as they are.
+type info struct {
+	groups []*group
+}
+
+type group struct {
+	name   string
+	keys   []string
+	values map[string]string
+}
+
+func parseInfo(data []byte) (*info, error) {
+	self := &info{}
+	var cur *group
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		} else if line[0] == '[' && line[len(line)-1] == ']' {
+			cur = self.group(line[1:len(line)-1], true)
+		} else if i := strings.IndexByte(line, '='); i < 0 || cur == nil {
+			return nil, fmt.Errorf("keystore: invalid line %q", line)
+		} else {
+			cur.set(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+		}
+	}
+	return self, scanner.Err()
+}
+
+func (self *info) group(name string, create bool) *group {
+	for _, g := range self.groups {
+		if g.name == name {
+			return g
+		}
+	}
+	if !create {
+		return nil
+	}
+	g := &group{name: name, values: make(map[string]string)}
+	self.groups = append(self.groups, g)
+	return g
+}
+
+func (self *info) remove(name string) {
+	for i, g := range self.groups {
+		if g.name == name {
+			self.groups = append(self.groups[:i], self.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+func (self *info) get(name, key string) (string, bool) {
+	if g := self.group(name, false); g != nil {
+		v, ok := g.values[key]
+		return v, ok
+	}
+	return "", false
+}
+
+func (self *group) set(key, value string) {
+	if _, ok := self.values[key]; !ok {
+		self.keys = append(self.keys, key)
+	}
+	self.values[key] = value
+}
+
+func (self *info) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, g := range self.groups {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", g.name)
+		for _, k := range g.keys {
+			fmt.Fprintf(&buf, "%s=%s\n", k, g.values[k])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (self *info) key(name string) (*[16]byte, error) {
+	if v, ok := self.get(name, "Key"); !ok {
+		return nil, nil
+	} else if b, err := hex.DecodeString(v); err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("keystore: invalid key in %s", name)
+	} else {
+		var ret [16]byte
+		copy(ret[:], b)
+		return &ret, nil
+	}
+}
+
+func (self *info) uint(name, key string, bits int) uint64 {
+	if v, ok := self.get(name, key); ok {
+		if n, err := strconv.ParseUint(v, 10, bits); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+func (self *info) ltk(name string) (*LTK, error) {
+	key, err := self.key(name)
+	if key == nil {
+		return nil, err
+	}
+	ltk := &LTK{
+		Key:     *key,
+		EDiv:    uint16(self.uint(name, "EDiv", 16)),
+		Rand:    self.uint(name, "Rand", 64),
+		KeySize: uint8(self.uint(name, "EncSize", 8)),
+	}
+	// mgmt LTK types
+	switch self.uint(name, "Authenticated", 8) {
+	case 1:
+		ltk.Authenticated = true
+	case 2:
+		ltk.SecureConnections = true
+	case 3:
+		ltk.Authenticated, ltk.SecureConnections = true, true
+	}
+	return ltk, nil
+}
+
+// bond reads the keys of the device.
+func (self *info) bond(peer [6]byte) (*Bond, error) {
+	bond := &Bond{Peer: Address{Type: ADDR_BREDR, Addr: peer}}
+	bond.Name, _ = self.get("General", "Name")
+	switch v, _ := self.get("General", "AddressType"); v {
+	case "public":
+		bond.Peer.Type = ADDR_LE_PUBLIC
+	case "static":
+		bond.Peer.Type = ADDR_LE_RANDOM
+	}
+	if key, err := self.key("LinkKey"); err != nil {
+		return nil, err
+	} else if key != nil {
+		bond.LinkKey = &LinkKey{
+			Key:       *key,
+			Type:      uint8(self.uint("LinkKey", "Type", 8)),
+			PINLength: uint8(self.uint("LinkKey", "PINLength", 8)),
+		}
+	}
+	var err error
+	if bond.LTK, err = self.ltk("LongTermKey"); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"PeripheralLongTermKey", "SlaveLongTermKey"} {
+		if bond.PeripheralLTK, err = self.ltk(name); err != nil {
+			return nil, err
+		} else if bond.PeripheralLTK != nil {
+			break
+		}
+	}
+	if bond.IRK, err = self.key("IdentityResolvingKey"); err != nil {
+		return nil, err
+	} else if bond.LocalCSRK, err = self.key("LocalSignatureKey"); err != nil {
+		return nil, err
+	} else if bond.RemoteCSRK, err = self.key("RemoteSignatureKey"); err != nil {
+		return nil, err
+	}
+	return bond, nil
+}
+
+func (self *info) setKey(name string, key *[16]byte) *group {
+	if key == nil {
+		self.remove(name)
+		return nil
+	}
+	g := self.group(name, true)
+	g.set("Key", strings.ToUpper(hex.EncodeToString(key[:])))
+	return g
+}
+
+func (self *info) setLTK(name string, ltk *LTK) {
+	if ltk == nil {
+		self.remove(name)
+		return
+	}
+	g := self.setKey(name, &ltk.Key)
+	var typ int
+	if ltk.Authenticated {
+		typ = 1
+	}
+	if ltk.SecureConnections {
+		typ += 2
+	}
+	g.set("Authenticated", strconv.Itoa(typ))
+	g.set("EncSize", strconv.Itoa(int(ltk.KeySize)))
+	g.set("EDiv", strconv.FormatUint(uint64(ltk.EDiv), 10))
+	g.set("Rand", strconv.FormatUint(ltk.Rand, 10))
+}
+
+// setBond replaces the keys with those of the bond.
+func (self *info) setBond(bond *Bond) {
+	general := self.group("General", true)
+	if bond.Name != "" {
+		general.set("Name", bond.Name)
+	}
+	var tech string
+	if bond.Peer.Type == ADDR_BREDR || bond.LinkKey != nil {
+		tech = "BR/EDR;"
+	}
+	switch bond.Peer.Type {
+	case ADDR_LE_PUBLIC:
+		general.set("AddressType", "public")
+		tech += "LE;"
+	case ADDR_LE_RANDOM:
+		general.set("AddressType", "static")
+		tech += "LE;"
+	}
+	general.set("SupportedTechnologies", tech)
+
+	if bond.LinkKey == nil {
+		self.remove("LinkKey")
+	} else {
+		g := self.setKey("LinkKey", &bond.LinkKey.Key)
+		g.set("Type", strconv.Itoa(int(bond.LinkKey.Type)))
+		g.set("PINLength", strconv.Itoa(int(bond.LinkKey.PINLength)))
+	}
+	self.setLTK("LongTermKey", bond.LTK)
+	self.remove("SlaveLongTermKey")
+	self.setLTK("PeripheralLongTermKey", bond.PeripheralLTK)
+	self.setKey("IdentityResolvingKey", bond.IRK)
+	for i, key := range []*[16]byte{bond.LocalCSRK, bond.RemoteCSRK} {
+		name := []string{"LocalSignatureKey", "RemoteSignatureKey"}[i]
+		if key == nil {
+			self.remove(name)
+		} else if v, _ := self.key(name); v == nil || *v != *key {
+			g := self.setKey(name, key)
+			g.set("Counter", "0")
+			g.set("Authenticated", "false")
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// +build linux
+
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// BLUEZ_DIR is where BlueZ stores the keys.
+const BLUEZ_DIR = "/var/lib/bluetooth"
+
+// FileStore stores the bonds in the files of BlueZ layout,
+// <dir>/<adapter>/<device>/info. Processes sharing the directory are
+// serialized with flock(2) on a lock file of each adapter. BlueZ itself
+// does not take the lock, so bluetoothd should be stopped while the
+// directory is shared with it.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (self *FileStore) lock(adapter [6]byte, exclusive bool) (func(), error) {
+	dir := filepath.Join(self.dir, FormatAddr(adapter))
+	path := filepath.Join(dir, ".lock")
+	var f *os.File
+	var err error
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	} else if f, err = os.Open(path); os.IsNotExist(err) {
+		// no writer has been there, such as a BlueZ directory
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func (self *FileStore) path(adapter, peer [6]byte) string {
+	return filepath.Join(self.dir, FormatAddr(adapter), FormatAddr(peer), "info")
+}
+
+func (self *FileStore) read(adapter, peer [6]byte) (*info, error) {
+	if data, err := ioutil.ReadFile(self.path(adapter, peer)); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else {
+		return parseInfo(data)
+	}
+}
+
+func (self *FileStore) Get(adapter, peer [6]byte) (*Bond, error) {
+	unlock, err := self.lock(adapter, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if inf, err := self.read(adapter, peer); err != nil {
+		return nil, err
+	} else {
+		return inf.bond(peer)
+	}
+}
+
+// Put writes the bond, keeping the other settings of the device in the
+// file. The file is replaced atomically.
+func (self *FileStore) Put(adapter [6]byte, bond *Bond) error {
+	unlock, err := self.lock(adapter, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	inf, err := self.read(adapter, bond.Peer.Addr)
+	if err == ErrNotFound {
+		inf = &info{}
+	} else if err != nil {
+		return err
+	}
+	inf.setBond(bond)
+	return self.write(adapter, bond.Peer.Addr, inf)
+}
+
+// Update reads and writes the bond under the exclusive lock of the adapter.
+func (self *FileStore) Update(adapter, peer [6]byte, update func(*Bond) error) error {
+	unlock, err := self.lock(adapter, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	bond := &Bond{Peer: Address{Type: ADDR_BREDR, Addr: peer}}
+	inf, err := self.read(adapter, peer)
+	if err == ErrNotFound {
+		inf = &info{}
+	} else if err != nil {
+		return err
+	} else if bond, err = inf.bond(peer); err != nil {
+		return err
+	}
+	if err := update(bond); err != nil {
+		return err
+	}
+	inf.setBond(bond)
+	return self.write(adapter, peer, inf)
+}
+
+func (self *FileStore) write(adapter, peer [6]byte, inf *info) error {
+	data, _ := inf.MarshalText()
+
+	path := self.path(adapter, peer)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".info")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete removes the device directory, as BlueZ does on unpairing.
+func (self *FileStore) Delete(adapter, peer [6]byte) error {
+	unlock, err := self.lock(adapter, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dir := filepath.Dir(self.path(adapter, peer))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return os.RemoveAll(dir)
+}
+
+// List returns the devices that have an info file. Devices without keys,
+// which BlueZ keeps for the discovered ones, are skipped.
+func (self *FileStore) List(adapter [6]byte) ([]*Bond, error) {
+	unlock, err := self.lock(adapter, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := ioutil.ReadDir(filepath.Join(self.dir, FormatAddr(adapter)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ret []*Bond
+	for _, e := range entries {
+		peer, err := ParseAddr(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if inf, err := self.read(adapter, peer); err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if bond, err := inf.bond(peer); err != nil {
+			return nil, err
+		} else if bond.LinkKey != nil || bond.LTK != nil || bond.PeripheralLTK != nil || bond.IRK != nil {
+			ret = append(ret, bond)
+		}
+	}
+	return ret, nil
+}
+
+// Adapters returns the adapters found in the directory.
+func (self *FileStore) Adapters() ([][6]byte, error) {
+	entries, err := ioutil.ReadDir(self.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ret [][6]byte
+	for _, e := range entries {
+		if addr, err := ParseAddr(e.Name()); err == nil && e.IsDir() {
+			ret = append(ret, addr)
+		}
+	}
+	return ret, nil
+}
+
+// ImportBlueZ copies the bonds of all the adapters under the BlueZ
+// directory, typically BLUEZ_DIR, into the store. It returns the number of
+// the bonds copied.
+func ImportBlueZ(store KeyStore, dir string) (int, error) {
+	src := NewFileStore(dir)
+	adapters, err := src.Adapters()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, adapter := range adapters {
+		bonds, err := src.List(adapter)
+		if err != nil {
+			return count, err
+		}
+		for _, bond := range bonds {
+			if err := store.Put(adapter, bond); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
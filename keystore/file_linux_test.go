@@ -0,0 +1,66 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	adapter, _ := ParseAddr("00:1A:7D:DA:71:13")
+	peer, _ := ParseAddr("70:81:94:0D:FB:AA")
+	bluez := filepath.Join(dir, "bluez", FormatAddr(adapter), FormatAddr(peer))
+	if err := os.MkdirAll(bluez, 0700); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(bluez, "info"), []byte(bluezInfo), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "bluez", FormatAddr(adapter), "cache"), 0700)
+
+	store := NewFileStore(filepath.Join(dir, "store"))
+	if n, err := ImportBlueZ(store, filepath.Join(dir, "bluez")); err != nil || n != 1 {
+		t.Fatalf("imported %d %v", n, err)
+	}
+	bond, err := store.Get(adapter, peer)
+	if err != nil {
+		t.Fatal(err)
+	} else if bond.LinkKey == nil || bond.IRK == nil || bond.Name != "Phone" {
+		t.Errorf("got %+v", bond)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := *bond
+			b.Peer.Addr[0] = uint8(i)
+			if err := NewFileStore(filepath.Join(dir, "store")).Put(adapter, &b); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if bonds, err := store.List(adapter); err != nil || len(bonds) != 9 {
+		t.Errorf("listed %d %v", len(bonds), err)
+	}
+	if got, err := store.Get(adapter, peer); err != nil || !reflect.DeepEqual(got, bond) {
+		t.Errorf("got %+v %v", got, err)
+	}
+	if err := store.Delete(adapter, peer); err != nil {
+		t.Error(err)
+	} else if err := store.Delete(adapter, peer); err != ErrNotFound {
+		t.Errorf("deleted twice %v", err)
+	}
+
+	testUpdate(t, store)
+}
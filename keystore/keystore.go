@@ -0,0 +1,264 @@
+// Package keystore keeps the keys of the bonded devices per local adapter.
+// The file store uses the layout of BlueZ, so that bonds move between
+// BlueZ and this library.
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/hkwi/blugo/crypto"
+)
+
+var ErrNotFound = errors.New("keystore: not found")
+
+// Address types, same as the kernel sockaddr
+const (
+	ADDR_BREDR     = 0x00
+	ADDR_LE_PUBLIC = 0x01
+	ADDR_LE_RANDOM = 0x02
+)
+
+// Link key types, Bluetooth Core specification, Vol 2, Part E, Section
+// 7.7.24
+const (
+	LINK_KEY_COMBINATION          = 0x00
+	LINK_KEY_DEBUG_COMBINATION    = 0x03
+	LINK_KEY_UNAUTHENTICATED_P192 = 0x04
+	LINK_KEY_AUTHENTICATED_P192   = 0x05
+	LINK_KEY_CHANGED_COMBINATION  = 0x06
+	LINK_KEY_UNAUTHENTICATED_P256 = 0x07
+	LINK_KEY_AUTHENTICATED_P256   = 0x08
+)
+
+// Address is a device address in the little endian order of HCI.
+type Address struct {
+	Type uint8
+	Addr [6]byte
+}
+
+func (self Address) String() string {
+	return FormatAddr(self.Addr)
+}
+
+// FormatAddr formats the address as BlueZ names the directories.
+func FormatAddr(addr [6]byte) string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", addr[5], addr[4], addr[3], addr[2], addr[1], addr[0])
+}
+
+func ParseAddr(s string) ([6]byte, error) {
+	var ret [6]byte
+	if hw, err := net.ParseMAC(s); err != nil {
+		return ret, err
+	} else if len(hw) != 6 {
+		return ret, fmt.Errorf("keystore: invalid address %s", s)
+	} else {
+		copy(ret[:], crypto.Swap(hw))
+		return ret, nil
+	}
+}
+
+// LinkKey is the BR/EDR link key.
+type LinkKey struct {
+	Key       [16]byte
+	Type      uint8
+	PINLength uint8
+}
+
+// LTK is the LE long term key. Keys are in the little endian order.
+type LTK struct {
+	Key               [16]byte
+	EDiv              uint16
+	Rand              uint64
+	Authenticated     bool
+	SecureConnections bool
+	KeySize           uint8
+}
+
+// Bond is the keys of a device bonded with the adapter. Peer is the
+// identity address.
+//
+// LTK encrypts the link as the central, which the peer distributed. With
+// Secure Connections it is used in both roles. PeripheralLTK is the key
+// the local device distributed in legacy pairing, and answers LTK requests
+// as the peripheral.
+type Bond struct {
+	Peer          Address
+	Name          string
+	LinkKey       *LinkKey
+	LTK           *LTK
+	PeripheralLTK *LTK
+	IRK           *[16]byte
+	LocalCSRK     *[16]byte
+	RemoteCSRK    *[16]byte
+}
+
+func (self *Bond) clone() *Bond {
+	ret := *self
+	if self.LinkKey != nil {
+		v := *self.LinkKey
+		ret.LinkKey = &v
+	}
+	if self.LTK != nil {
+		v := *self.LTK
+		ret.LTK = &v
+	}
+	if self.PeripheralLTK != nil {
+		v := *self.PeripheralLTK
+		ret.PeripheralLTK = &v
+	}
+	for _, p := range []**[16]byte{&ret.IRK, &ret.LocalCSRK, &ret.RemoteCSRK} {
+		if *p != nil {
+			v := **p
+			*p = &v
+		}
+	}
+	return &ret
+}
+
+// KeyStore stores the bonds by the adapter address and the peer identity
+// address. Get and Delete return ErrNotFound for unknown devices.
+type KeyStore interface {
+	Get(adapter, peer [6]byte) (*Bond, error)
+	Put(adapter [6]byte, bond *Bond) error
+	Delete(adapter, peer [6]byte) error
+	List(adapter [6]byte) ([]*Bond, error)
+}
+
+// Updater is a KeyStore that reads and writes a bond under a single lock.
+// The bond passed to update is a new one of the peer, typed ADDR_BREDR,
+// when the store has none, and is stored when update returns nil. update
+// must not change the peer address.
+type Updater interface {
+	Update(adapter, peer [6]byte, update func(*Bond) error) error
+}
+
+// Update modifies the bond of the peer. The stores that are not Updater
+// are read and written with Get and Put, which another writer may
+// interleave with.
+func Update(store KeyStore, adapter, peer [6]byte, update func(*Bond) error) error {
+	if u, ok := store.(Updater); ok {
+		return u.Update(adapter, peer, update)
+	}
+	bond, err := store.Get(adapter, peer)
+	if err == ErrNotFound {
+		bond = &Bond{Peer: Address{Type: ADDR_BREDR, Addr: peer}}
+	} else if err != nil {
+		return err
+	}
+	if err := update(bond); err != nil {
+		return err
+	}
+	return store.Put(adapter, bond)
+}
+
+// Resolve finds the bond of the address, which may be a resolvable private
+// address of the peer.
+func Resolve(store KeyStore, adapter, addr [6]byte) (*Bond, error) {
+	if bond, err := store.Get(adapter, addr); err != ErrNotFound {
+		return bond, err
+	}
+	if addr[5]>>6 != 0x01 {
+		return nil, ErrNotFound
+	}
+	bonds, err := store.List(adapter)
+	if err != nil {
+		return nil, err
+	}
+	for _, bond := range bonds {
+		if bond.IRK == nil {
+			continue
+		}
+		hash := crypto.Ah(crypto.Swap(bond.IRK[:]), crypto.Swap(addr[3:]))
+		if bytes.Equal(crypto.Swap(hash), addr[:3]) {
+			return bond, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FindLTK finds the bond that distributed the legacy key identified by
+// EDIV and Rand of LTK request.
+func FindLTK(store KeyStore, adapter [6]byte, ediv uint16, rand uint64) (*Bond, error) {
+	bonds, err := store.List(adapter)
+	if err != nil {
+		return nil, err
+	}
+	for _, bond := range bonds {
+		if ltk := bond.PeripheralLTK; ltk != nil && ltk.EDiv == ediv && ltk.Rand == rand {
+			return bond, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// MemoryStore is a KeyStore of a process.
+type MemoryStore struct {
+	lock  sync.Mutex
+	bonds map[[6]byte]map[[6]byte]*Bond
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		bonds: make(map[[6]byte]map[[6]byte]*Bond),
+	}
+}
+
+func (self *MemoryStore) Get(adapter, peer [6]byte) (*Bond, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if bond, ok := self.bonds[adapter][peer]; ok {
+		return bond.clone(), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (self *MemoryStore) Put(adapter [6]byte, bond *Bond) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.bonds[adapter] == nil {
+		self.bonds[adapter] = make(map[[6]byte]*Bond)
+	}
+	self.bonds[adapter][bond.Peer.Addr] = bond.clone()
+	return nil
+}
+
+func (self *MemoryStore) Update(adapter, peer [6]byte, update func(*Bond) error) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	bond := &Bond{Peer: Address{Type: ADDR_BREDR, Addr: peer}}
+	if b, ok := self.bonds[adapter][peer]; ok {
+		bond = b.clone()
+	}
+	if err := update(bond); err != nil {
+		return err
+	}
+	if self.bonds[adapter] == nil {
+		self.bonds[adapter] = make(map[[6]byte]*Bond)
+	}
+	self.bonds[adapter][peer] = bond.clone()
+	return nil
+}
+
+func (self *MemoryStore) Delete(adapter, peer [6]byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.bonds[adapter][peer]; !ok {
+		return ErrNotFound
+	}
+	delete(self.bonds[adapter], peer)
+	return nil
+}
+
+func (self *MemoryStore) List(adapter [6]byte) ([]*Bond, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []*Bond
+	for _, bond := range self.bonds[adapter] {
+		ret = append(ret, bond.clone())
+	}
+	return ret, nil
+}
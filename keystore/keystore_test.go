@@ -0,0 +1,156 @@
+package keystore
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const bluezInfo = `[General]
+Name=Phone
+AddressType=public
+SupportedTechnologies=BR/EDR;LE;
+Trusted=true
+Blocked=false
+Services=0000110a-0000-1000-8000-00805f9b34fb;
+
+[LinkKey]
+Key=00112233445566778899AABBCCDDEEFF
+Type=8
+PINLength=0
+
+[IdentityResolvingKey]
+Key=9B7D390AA610103405ADC857A33402EC
+
+[LongTermKey]
+Key=0F0E0D0C0B0A09080706050403020100
+Authenticated=3
+EncSize=16
+EDiv=0
+Rand=0
+
+[SlaveLongTermKey]
+Key=101112131415161718191A1B1C1D1E1F
+Authenticated=0
+EncSize=7
+EDiv=4660
+Rand=1311768467463790320
+
+[DeviceID]
+Source=1
+Vendor=76
+`
+
+func TestInfo(t *testing.T) {
+	peer, err := ParseAddr("70:81:94:0d:fb:aa")
+	if err != nil {
+		t.Fatal(err)
+	} else if FormatAddr(peer) != "70:81:94:0D:FB:AA" {
+		t.Errorf("address %s", FormatAddr(peer))
+	}
+	inf, err := parseInfo([]byte(bluezInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bond, err := inf.bond(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bond.Name != "Phone" || bond.Peer.Type != ADDR_LE_PUBLIC {
+		t.Errorf("general %+v", bond)
+	}
+	if bond.LinkKey == nil || bond.LinkKey.Type != LINK_KEY_AUTHENTICATED_P256 || bond.LinkKey.Key[15] != 0xFF {
+		t.Errorf("link key %+v", bond.LinkKey)
+	}
+	if bond.LTK == nil || !bond.LTK.SecureConnections || !bond.LTK.Authenticated || bond.LTK.KeySize != 16 {
+		t.Errorf("ltk %+v", bond.LTK)
+	}
+	if p := bond.PeripheralLTK; p == nil || p.EDiv != 0x1234 || p.Rand != 0x123456789ABCDEF0 || p.KeySize != 7 || p.Authenticated {
+		t.Errorf("peripheral ltk %+v", p)
+	}
+
+	// the settings of BlueZ survive the update
+	bond.RemoteCSRK = &[16]byte{1}
+	inf.setBond(bond)
+	data, _ := inf.MarshalText()
+	for _, s := range []string{"Trusted=true", "[DeviceID]", "[PeripheralLongTermKey]", "[RemoteSignatureKey]"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("%s lost in %s", s, data)
+		}
+	}
+	if strings.Contains(string(data), "SlaveLongTermKey") {
+		t.Errorf("old group remains")
+	}
+	if inf, err := parseInfo(data); err != nil {
+		t.Fatal(err)
+	} else if again, err := inf.bond(peer); err != nil || !reflect.DeepEqual(again, bond) {
+		t.Errorf("got %+v %v", again, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	adapter := [6]byte{1, 2, 3, 4, 5, 6}
+	store := NewMemoryStore()
+	// Bluetooth Core specification, Vol 3, Part H, Appendix D.7
+	irk := [16]byte{0x9b, 0x7d, 0x39, 0x0a, 0xa6, 0x10, 0x10, 0x34, 0x05, 0xad, 0xc8, 0x57, 0xa3, 0x34, 0x02, 0xec}
+	identity := Address{Type: ADDR_LE_PUBLIC, Addr: [6]byte{0xA, 0xB, 0xC, 0xD, 0xE, 0xF}}
+	store.Put(adapter, &Bond{
+		Peer:          identity,
+		IRK:           &irk,
+		PeripheralLTK: &LTK{EDiv: 1, Rand: 2},
+	})
+	rpa, _ := ParseAddr("70:81:94:0d:fb:aa")
+	if bond, err := Resolve(store, adapter, rpa); err != nil || bond.Peer != identity {
+		t.Errorf("resolved %v %v", bond, err)
+	}
+	if _, err := Resolve(store, adapter, [6]byte{1, 2, 3, 4, 5, 0x46}); err != ErrNotFound {
+		t.Errorf("got %v", err)
+	}
+	if bond, err := FindLTK(store, adapter, 1, 2); err != nil || bond.Peer != identity {
+		t.Errorf("ltk %v %v", bond, err)
+	}
+	if err := store.Delete(adapter, identity.Addr); err != nil {
+		t.Error(err)
+	} else if _, err := store.Get(adapter, identity.Addr); err != ErrNotFound {
+		t.Errorf("deleted %v", err)
+	}
+}
+
+// testUpdate updates the bond concurrently, each adding a key of its own
+// and counting in the link key. None of the updates must be lost.
+func testUpdate(t *testing.T, store KeyStore) {
+	adapter := [6]byte{1, 2, 3, 4, 5, 6}
+	peer := [6]byte{0xA, 0xB, 0xC, 0xD, 0xE, 0xF}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := Update(store, adapter, peer, func(bond *Bond) error {
+				if bond.LinkKey == nil {
+					bond.LinkKey = &LinkKey{}
+				}
+				bond.LinkKey.PINLength++
+				if i == 0 {
+					bond.IRK = &[16]byte{1}
+				} else if i == 1 {
+					bond.RemoteCSRK = &[16]byte{2}
+				}
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if bond, err := store.Get(adapter, peer); err != nil {
+		t.Error(err)
+	} else if bond.Peer.Addr != peer || bond.LinkKey.PINLength != 8 || bond.IRK == nil || bond.RemoteCSRK == nil {
+		t.Errorf("got %+v", bond)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	testUpdate(t, NewMemoryStore())
+}
@@ -0,0 +1,440 @@
+package l2cap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	modeFixed = iota
+	modeBasic
+	modeLeCredit
+	modeEcred
+)
+
+const (
+	stateConfig = iota
+	stateOpen
+	stateClosed
+)
+
+type sdu struct {
+	data   []byte
+	frames int
+}
+
+// Channel is an L2CAP channel endpoint. Each Write sends an SDU, and each
+// Read returns the data of a received SDU; an SDU longer than the buffer
+// is returned by the successive reads.
+type Channel struct {
+	conn      *Conn
+	mode      int
+	state     int
+	psm       uint16
+	localCid  uint16
+	remoteCid uint16
+	listener  *Listener
+
+	rxMtu       uint16
+	rxMps       uint16
+	txMtu       uint16
+	txMps       uint16
+	txCredits   int
+	rxCredits   int // credits the peer holds
+	initCredits int
+	consumed    int // credits to be returned to the peer
+
+	confLocal  bool
+	confRemote bool
+
+	rx      []sdu
+	partial []byte
+	sdu     []byte
+	sduLen  int
+	frames  int
+
+	rdeadline time.Time
+	wdeadline time.Time
+	wlock     sync.Mutex
+}
+
+var _ net.Conn = &Channel{}
+
+func newChannel(conn *Conn, mode int) *Channel {
+	return &Channel{
+		conn:  conn,
+		mode:  mode,
+		txMtu: DEFAULT_MTU,
+		rxMtu: DEFAULT_MTU,
+	}
+}
+
+// setCredits configures a credit based channel accepted, with lock held.
+func (self *Channel) setCredits(opts Options, mtu, mps, credits uint16) {
+	self.rxMtu = opts.MTU
+	self.rxMps = opts.MPS
+	self.rxCredits = int(opts.Credits)
+	self.initCredits = int(opts.Credits)
+	self.txMtu = mtu
+	self.txMps = mps
+	self.txCredits = int(credits)
+	self.state = stateOpen
+}
+
+// closeLocked must be called with conn lock held.
+func (self *Channel) closeLocked() {
+	self.state = stateClosed
+	self.conn.cond.Broadcast()
+}
+
+// configured must be called with conn lock held.
+func (self *Channel) configured() {
+	if self.confLocal && self.confRemote && self.state == stateConfig {
+		self.state = stateOpen
+		if l := self.listener; l != nil && !l.closed {
+			l.backlog = append(l.backlog, self)
+		}
+		self.conn.cond.Broadcast()
+	}
+}
+
+// configure sends Configuration Request of basic mode channel.
+func (self *Channel) configure(ctx context.Context) error {
+	conn := self.conn
+	conn.lock.Lock()
+	opts := []byte{CONF_MTU, 2, 0, 0}
+	binary.LittleEndian.PutUint16(opts[2:], self.rxMtu)
+	req := append(put16(self.remoteCid, 0), opts...)
+	conn.lock.Unlock()
+
+	for retry := 0; retry < 2; retry++ {
+		rsp, err := conn.exchange(ctx, CONF_REQ, req)
+		if err != nil {
+			return err
+		} else if len(rsp.data) < 6 {
+			return fmt.Errorf("l2cap: short configuration response")
+		}
+		switch le16(rsp.data[4:]) {
+		case CONF_SUCCESS:
+			conn.lock.Lock()
+			self.confLocal = true
+			self.configured()
+			conn.lock.Unlock()
+			return nil
+		case CONF_UNACCEPT:
+			// fall back to the default MTU
+			conn.lock.Lock()
+			self.rxMtu = DEFAULT_MTU
+			conn.lock.Unlock()
+			req = put16(self.remoteCid, 0)
+		default:
+			return fmt.Errorf("l2cap: configuration failed result=0x%04x", le16(rsp.data[4:]))
+		}
+	}
+	return fmt.Errorf("l2cap: configuration failed")
+}
+
+func (self *Channel) waitOpen(ctx context.Context) error {
+	conn := self.conn
+	stop := context.AfterFunc(ctx, func() {
+		conn.lock.Lock()
+		conn.cond.Broadcast()
+		conn.lock.Unlock()
+	})
+	defer stop()
+
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for self.state == stateConfig && ctx.Err() == nil {
+		conn.cond.Wait()
+	}
+	if self.state == stateOpen {
+		return nil
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+	return conn.closedErr()
+}
+
+// wait waits on conn cond until deadline, with conn lock held. It returns
+// false when the deadline passed.
+func (self *Channel) wait(deadline time.Time) bool {
+	conn := self.conn
+	if deadline.IsZero() {
+		conn.cond.Wait()
+		return true
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return false
+	}
+	timer := time.AfterFunc(d, func() {
+		conn.lock.Lock()
+		conn.cond.Broadcast()
+		conn.lock.Unlock()
+	})
+	conn.cond.Wait()
+	timer.Stop()
+	return true
+}
+
+func (self *Channel) disconnect() {
+	go self.Close()
+}
+
+// receive is called from the conn reader with a frame payload.
+func (self *Channel) receive(payload []byte) {
+	conn := self.conn
+	conn.lock.Lock()
+	credits := self.receiveLocked(payload)
+	conn.lock.Unlock()
+	if credits > 0 {
+		conn.sendCommand(LE_CREDITS, conn.nextIdent(), put16(self.localCid, uint16(credits)))
+	}
+}
+
+// receiveLocked returns the credits to be given to the peer.
+func (self *Channel) receiveLocked(payload []byte) int {
+	if self.state != stateOpen {
+		return 0
+	}
+	switch self.mode {
+	case modeFixed, modeBasic:
+		self.rx = append(self.rx, sdu{data: payload})
+		self.conn.cond.Broadcast()
+	case modeLeCredit, modeEcred:
+		if self.rxCredits == 0 || len(payload) > int(self.rxMps) {
+			self.disconnect()
+			return 0
+		}
+		self.rxCredits--
+		self.frames++
+		if self.sdu == nil {
+			if len(payload) < 2 {
+				self.disconnect()
+				return 0
+			}
+			self.sduLen = int(le16(payload))
+			if self.sduLen > int(self.rxMtu) {
+				self.disconnect()
+				return 0
+			}
+			self.sdu = append(make([]byte, 0, self.sduLen), payload[2:]...)
+		} else {
+			self.sdu = append(self.sdu, payload...)
+		}
+		if len(self.sdu) > self.sduLen {
+			self.disconnect()
+		} else if len(self.sdu) == self.sduLen {
+			self.rx = append(self.rx, sdu{data: self.sdu, frames: self.frames})
+			self.sdu = nil
+			self.frames = 0
+			self.conn.cond.Broadcast()
+		} else if self.rxCredits == 0 {
+			// the peer needs more credits to complete the SDU, which is
+			// bounded by the MTU, so they are given before it is read.
+			credits := self.frames
+			self.frames = 0
+			self.rxCredits += credits
+			return credits
+		}
+	}
+	return 0
+}
+
+func (self *Channel) Read(b []byte) (int, error) {
+	conn := self.conn
+	conn.lock.Lock()
+	for len(self.partial) == 0 && len(self.rx) == 0 && self.state != stateClosed {
+		if !self.wait(self.rdeadline) {
+			conn.lock.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	if len(self.partial) > 0 {
+		n := copy(b, self.partial)
+		self.partial = self.partial[n:]
+		conn.lock.Unlock()
+		return n, nil
+	}
+	if len(self.rx) == 0 {
+		conn.lock.Unlock()
+		return 0, io.EOF
+	}
+	s := self.rx[0]
+	self.rx = self.rx[1:]
+	n := copy(b, s.data)
+	self.partial = s.data[n:]
+
+	var credits int
+	if self.mode != modeFixed && self.mode != modeBasic && self.state == stateOpen {
+		self.consumed += s.frames
+		if self.consumed > 0 && (self.consumed >= (self.initCredits+1)/2 || self.rxCredits == 0) {
+			credits = self.consumed
+			self.rxCredits += credits
+			self.consumed = 0
+		}
+	}
+	conn.lock.Unlock()
+
+	if credits > 0 {
+		conn.sendCommand(LE_CREDITS, conn.nextIdent(), put16(self.localCid, uint16(credits)))
+	}
+	return n, nil
+}
+
+func (self *Channel) Write(b []byte) (int, error) {
+	conn := self.conn
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+
+	conn.lock.Lock()
+	state, mode, mtu, mps := self.state, self.mode, int(self.txMtu), int(self.txMps)
+	conn.lock.Unlock()
+	if state != stateOpen {
+		return 0, io.ErrClosedPipe
+	}
+
+	switch mode {
+	case modeFixed:
+		if err := conn.writeFrame(self.remoteCid, b); err != nil {
+			return 0, err
+		}
+	case modeBasic:
+		if len(b) > mtu {
+			return 0, fmt.Errorf("l2cap: sdu exceeds mtu %d", mtu)
+		}
+		if err := conn.writeFrame(self.remoteCid, b); err != nil {
+			return 0, err
+		}
+	case modeLeCredit, modeEcred:
+		if len(b) > mtu {
+			return 0, fmt.Errorf("l2cap: sdu exceeds mtu %d", mtu)
+		}
+		hdr := put16(uint16(len(b)))
+		for off := 0; off == 0 || off < len(b); {
+			end := off + mps - len(hdr)
+			if end > len(b) {
+				end = len(b)
+			}
+
+			conn.lock.Lock()
+			for self.txCredits == 0 && self.state == stateOpen {
+				if !self.wait(self.wdeadline) {
+					conn.lock.Unlock()
+					return off, os.ErrDeadlineExceeded
+				}
+			}
+			if self.state != stateOpen {
+				conn.lock.Unlock()
+				return off, io.ErrClosedPipe
+			}
+			self.txCredits--
+			conn.lock.Unlock()
+
+			if err := conn.writeFrame(self.remoteCid, append(hdr, b[off:end]...)); err != nil {
+				return off, err
+			}
+			hdr = nil
+			off = end
+		}
+	}
+	return len(b), nil
+}
+
+// Close disconnects the channel.
+func (self *Channel) Close() error {
+	conn := self.conn
+	conn.lock.Lock()
+	state := self.state
+	self.closeLocked()
+	if self.mode == modeFixed {
+		delete(conn.channels, self.localCid)
+	}
+	conn.lock.Unlock()
+
+	if self.mode == modeFixed || state == stateClosed {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := conn.exchange(ctx, DISCONN_REQ, put16(self.remoteCid, self.localCid))
+
+	conn.lock.Lock()
+	if conn.channels[self.localCid] == self {
+		delete(conn.channels, self.localCid)
+	}
+	conn.lock.Unlock()
+	return err
+}
+
+func (self *Channel) LocalAddr() net.Addr {
+	return Addr{
+		PSM: self.psm,
+		CID: self.localCid,
+	}
+}
+
+func (self *Channel) RemoteAddr() net.Addr {
+	return Addr{
+		PSM: self.psm,
+		CID: self.remoteCid,
+	}
+}
+
+func (self *Channel) SetDeadline(t time.Time) error {
+	self.conn.lock.Lock()
+	defer self.conn.lock.Unlock()
+	self.rdeadline = t
+	self.wdeadline = t
+	self.conn.cond.Broadcast()
+	return nil
+}
+
+func (self *Channel) SetReadDeadline(t time.Time) error {
+	self.conn.lock.Lock()
+	defer self.conn.lock.Unlock()
+	self.rdeadline = t
+	self.conn.cond.Broadcast()
+	return nil
+}
+
+func (self *Channel) SetWriteDeadline(t time.Time) error {
+	self.conn.lock.Lock()
+	defer self.conn.lock.Unlock()
+	self.wdeadline = t
+	self.conn.cond.Broadcast()
+	return nil
+}
+
+// SendMTU returns the maximum SDU size that the peer accepts. It is zero
+// for fixed channels, where the protocol on the channel manages its MTU.
+func (self *Channel) SendMTU() int {
+	self.conn.lock.Lock()
+	defer self.conn.lock.Unlock()
+	if self.mode == modeFixed {
+		return 0
+	}
+	return int(self.txMtu)
+}
+
+// ReceiveMTU returns the maximum SDU size to receive.
+func (self *Channel) ReceiveMTU() int {
+	self.conn.lock.Lock()
+	defer self.conn.lock.Unlock()
+	if self.mode == modeFixed {
+		return 0
+	}
+	return int(self.rxMtu)
+}
+
+// Conn returns the connection that the channel belongs to.
+func (self *Channel) Conn() *Conn {
+	return self.conn
+}
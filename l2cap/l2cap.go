@@ -0,0 +1,328 @@
+// Package l2cap implements the Logical Link Control and Adaptation Protocol
+// over an ACL logical link, such as blugo.AclLink.
+//
+// Bluetooth Core specification, Vol 3, Part A
+package l2cap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Link carries L2CAP frames, each beginning with the basic L2CAP header.
+// *blugo.AclLink implements Link.
+type Link interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame([]byte) error
+	Close() error
+}
+
+// Fixed channel identifiers, Section 2.1
+
+const (
+	CID_SIGNALING    = 0x0001
+	CID_CONNLESS     = 0x0002
+	CID_ATT          = 0x0004
+	CID_LE_SIGNALING = 0x0005
+	CID_SMP          = 0x0006
+	CID_SMP_BREDR    = 0x0007
+
+	CID_DYN_START    = 0x0040
+	CID_LE_DYN_END   = 0x007F
+	CID_DYN_END      = 0xFFFF
+	DEFAULT_MTU      = 672
+	LE_DEFAULT_MTU   = 23
+	DEFAULT_TIMEOUT  = 30 * time.Second // RTX timer
+	MAX_ECRED_CHANS  = 5
+	MIN_ECRED_MTU    = 64
+	MIN_LE_COC_MPS   = 23
+	MAX_LE_COC_MPS   = 65533
+	MAX_LE_COC_CREDS = 65535
+)
+
+// Addr is the address of a channel endpoint.
+type Addr struct {
+	PSM uint16
+	CID uint16
+}
+
+func (self Addr) Network() string {
+	return "l2cap"
+}
+
+func (self Addr) String() string {
+	return fmt.Sprintf("psm=0x%04x,cid=0x%04x", self.PSM, self.CID)
+}
+
+// ConnParams is the LE connection parameters carried by Connection
+// Parameter Update Request. Intervals are in 1.25 msec, timeout in 10 msec.
+type ConnParams struct {
+	IntervalMin        uint16
+	IntervalMax        uint16
+	Latency            uint16
+	SupervisionTimeout uint16
+}
+
+// Options of connection oriented channels. Zero values take defaults.
+type Options struct {
+	MTU     uint16 // max SDU size to receive
+	MPS     uint16 // max PDU payload size to receive, credit based modes
+	Credits uint16 // initial credits to give, credit based modes
+}
+
+func (self Options) withDefaults(le bool) Options {
+	if self.MTU == 0 {
+		if le {
+			self.MTU = 512
+		} else {
+			self.MTU = DEFAULT_MTU
+		}
+	}
+	if self.MPS == 0 {
+		self.MPS = 247 - 4
+	}
+	// in int, as MTU+2 overflows uint16
+	mps := int(self.MPS)
+	if mps > int(self.MTU)+2 {
+		mps = int(self.MTU) + 2
+	}
+	if mps < MIN_LE_COC_MPS {
+		mps = MIN_LE_COC_MPS
+	} else if mps > MAX_LE_COC_MPS {
+		mps = MAX_LE_COC_MPS
+	}
+	self.MPS = uint16(mps)
+	if self.Credits == 0 {
+		// enough for two SDUs in flight
+		credits := 2 * ((int(self.MTU) + 2 + mps - 1) / mps)
+		if credits > 0xffff {
+			credits = 0xffff
+		}
+		self.Credits = uint16(credits)
+	}
+	return self
+}
+
+// Conn multiplexes the channels of an ACL logical link.
+type Conn struct {
+	// ConnParamUpdate decides on Connection Parameter Update Request from
+	// the peripheral. Returning true accepts the request; the central
+	// should then issue LE Connection Update. Requests are rejected when nil.
+	ConnParamUpdate func(ConnParams) bool
+
+	link     Link
+	le       bool
+	lock     sync.Mutex
+	cond     *sync.Cond
+	channels map[uint16]*Channel // by local CID
+	psms     map[uint16]*Listener
+	pending  map[uint8]chan command
+	ident    uint8
+	err      error
+}
+
+// NewConn starts serving the link. le tells that the link is LE-U, where
+// LE signaling channel is used. Fixed channels for ATT and SMP are opened
+// immediately so that early frames are kept.
+func NewConn(link Link, le bool) *Conn {
+	self := &Conn{
+		link:     link,
+		le:       le,
+		channels: make(map[uint16]*Channel),
+		psms:     make(map[uint16]*Listener),
+		pending:  make(map[uint8]chan command),
+	}
+	self.cond = sync.NewCond(&self.lock)
+	if le {
+		self.Fixed(CID_ATT)
+		self.Fixed(CID_SMP)
+	} else {
+		self.Fixed(CID_SMP_BREDR)
+	}
+	go self.serve()
+	return self
+}
+
+// LE reports whether the link is LE-U.
+func (self *Conn) LE() bool {
+	return self.le
+}
+
+func (self *Conn) sigCid() uint16 {
+	if self.le {
+		return CID_LE_SIGNALING
+	}
+	return CID_SIGNALING
+}
+
+// Fixed returns the fixed channel of the CID.
+func (self *Conn) Fixed(cid uint16) *Channel {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if ch, ok := self.channels[cid]; ok {
+		return ch
+	}
+	ch := newChannel(self, modeFixed)
+	ch.localCid = cid
+	ch.remoteCid = cid
+	ch.state = stateOpen
+	if self.err != nil {
+		ch.state = stateClosed
+	}
+	self.channels[cid] = ch
+	return ch
+}
+
+// allocCid must be called with lock held.
+func (self *Conn) allocCid() (uint16, error) {
+	end := CID_DYN_END
+	if self.le {
+		end = CID_LE_DYN_END
+	}
+	for cid := CID_DYN_START; cid <= end; cid++ {
+		if _, ok := self.channels[uint16(cid)]; !ok {
+			return uint16(cid), nil
+		}
+	}
+	return 0, fmt.Errorf("l2cap: no free cid")
+}
+
+func (self *Conn) writeFrame(cid uint16, payload []byte) error {
+	frame := make([]byte, 4, 4+len(payload))
+	binary.LittleEndian.PutUint16(frame, uint16(len(payload)))
+	binary.LittleEndian.PutUint16(frame[2:], cid)
+	return self.link.WriteFrame(append(frame, payload...))
+}
+
+func (self *Conn) serve() {
+	for {
+		frame, err := self.link.ReadFrame()
+		if err == nil && len(frame) < 4 {
+			continue
+		}
+		if err != nil {
+			self.lock.Lock()
+			self.err = err
+			for _, ch := range self.channels {
+				ch.closeLocked()
+			}
+			for _, l := range self.psms {
+				l.closed = true
+			}
+			for ident, c := range self.pending {
+				close(c)
+				delete(self.pending, ident)
+			}
+			self.cond.Broadcast()
+			self.lock.Unlock()
+			return
+		}
+		length := int(binary.LittleEndian.Uint16(frame))
+		cid := binary.LittleEndian.Uint16(frame[2:])
+		payload := frame[4:]
+		if len(payload) > length {
+			payload = payload[:length]
+		}
+		switch cid {
+		case CID_SIGNALING, CID_LE_SIGNALING:
+			if cid == self.sigCid() {
+				self.signaling(payload)
+			}
+		default:
+			self.lock.Lock()
+			ch := self.channels[cid]
+			self.lock.Unlock()
+			if ch != nil {
+				ch.receive(payload)
+			}
+		}
+	}
+}
+
+// Close closes all the channels and the link.
+func (self *Conn) Close() error {
+	self.lock.Lock()
+	var chans []*Channel
+	for _, ch := range self.channels {
+		chans = append(chans, ch)
+	}
+	self.lock.Unlock()
+	for _, ch := range chans {
+		if ch.mode != modeFixed {
+			ch.Close()
+		}
+	}
+	return self.link.Close()
+}
+
+func (self *Conn) closedErr() error {
+	if self.err == nil || self.err == io.EOF {
+		return io.ErrClosedPipe
+	}
+	return self.err
+}
+
+// Listener accepts connection oriented channels of a PSM.
+type Listener struct {
+	conn    *Conn
+	psm     uint16
+	opts    Options
+	backlog []*Channel
+	closed  bool
+}
+
+// Listen accepts incoming channels of the PSM in basic mode on BR/EDR, and
+// in LE credit based mode on LE. Enhanced credit based channels are
+// accepted on both.
+func (self *Conn) Listen(psm uint16, opts Options) (*Listener, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return nil, self.closedErr()
+	}
+	if _, ok := self.psms[psm]; ok {
+		return nil, fmt.Errorf("l2cap: psm 0x%04x in use", psm)
+	}
+	l := &Listener{
+		conn: self,
+		psm:  psm,
+		opts: opts.withDefaults(self.le),
+	}
+	self.psms[psm] = l
+	return l, nil
+}
+
+// Accept returns the next channel established.
+func (self *Listener) Accept() (*Channel, error) {
+	conn := self.conn
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for len(self.backlog) == 0 && !self.closed {
+		conn.cond.Wait()
+	}
+	if len(self.backlog) == 0 {
+		return nil, conn.closedErr()
+	}
+	ch := self.backlog[0]
+	self.backlog = self.backlog[1:]
+	return ch, nil
+}
+
+func (self *Listener) Close() error {
+	conn := self.conn
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	self.closed = true
+	if conn.psms[self.psm] == self {
+		delete(conn.psms, self.psm)
+	}
+	conn.cond.Broadcast()
+	return nil
+}
+
+func (self *Listener) Addr() Addr {
+	return Addr{PSM: self.psm}
+}
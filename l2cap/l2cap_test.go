@@ -0,0 +1,270 @@
+package l2cap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pipeLink struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func linkPair() (*pipeLink, *pipeLink) {
+	a := make(chan []byte, 64)
+	b := make(chan []byte, 64)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+	return &pipeLink{in: a, out: b, closed: closed, once: once},
+		&pipeLink{in: b, out: a, closed: closed, once: once}
+}
+
+func (self *pipeLink) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-self.in:
+		return frame, nil
+	case <-self.closed:
+		return nil, io.EOF
+	}
+}
+
+func (self *pipeLink) WriteFrame(frame []byte) error {
+	select {
+	case self.out <- append([]byte(nil), frame...):
+		return nil
+	case <-self.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (self *pipeLink) Close() error {
+	self.once.Do(func() { close(self.closed) })
+	return nil
+}
+
+func connPair(le bool) (*Conn, *Conn) {
+	a, b := linkPair()
+	return NewConn(a, le), NewConn(b, le)
+}
+
+func TestFixedChannel(t *testing.T) {
+	central, peripheral := connPair(true)
+	defer central.Close()
+
+	if _, err := central.Fixed(CID_ATT).Write([]byte{0x02, 0x00, 0x02}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	if n, err := peripheral.Fixed(CID_ATT).Read(buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf[:n], []byte{0x02, 0x00, 0x02}) {
+		t.Errorf("got %x", buf[:n])
+	}
+}
+
+func TestLeCreditChannel(t *testing.T) {
+	central, peripheral := connPair(true)
+	defer central.Close()
+
+	l, err := peripheral.Listen(0x0080, Options{MTU: 200, MPS: 23, Credits: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, err := central.DialLE(ctx, 0x0080, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.SendMTU() != 200 {
+		t.Errorf("mtu=%d", ch.SendMTU())
+	}
+
+	// each SDU takes 5 frames, more than the initial credits
+	sdu := bytes.Repeat([]byte("0123456789"), 10)
+	go func() {
+		for i := 0; i < 3; i++ {
+			if _, err := ch.Write(sdu); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	buf := make([]byte, 256)
+	for i := 0; i < 3; i++ {
+		if n, err := acc.Read(buf); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf[:n], sdu) {
+			t.Errorf("got %q", buf[:n])
+		}
+	}
+
+	if _, err := ch.Write(make([]byte, 201)); err == nil {
+		t.Error("expected mtu error")
+	}
+	if _, err := central.DialLE(ctx, 0x0081, Options{}); err != LE_BAD_PSM {
+		t.Errorf("expected LE_BAD_PSM, got %v", err)
+	}
+
+	ch.Close()
+	if _, err := acc.Read(buf); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestEnhancedChannels(t *testing.T) {
+	central, peripheral := connPair(true)
+	defer central.Close()
+
+	l, err := peripheral.Listen(0x0027, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chans, err := central.DialEnhanced(ctx, 0x0027, 3, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range chans {
+		acc, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte{byte(i)}
+		ch.Write(msg)
+		buf := make([]byte, 8)
+		if n, err := acc.Read(buf); err != nil || !bytes.Equal(buf[:n], msg) {
+			t.Errorf("channel %d: %x %v", i, buf[:n], err)
+		}
+	}
+	if err := central.Reconfigure(ctx, 1024, 512, chans...); err != nil {
+		t.Error(err)
+	} else if chans[0].ReceiveMTU() != 1024 {
+		t.Errorf("mtu=%d", chans[0].ReceiveMTU())
+	}
+}
+
+func TestEnhancedPartialRefusal(t *testing.T) {
+	a, b := linkPair()
+	peripheral := NewConn(b, true)
+	defer peripheral.Close()
+	defer a.Close()
+	if _, err := peripheral.Listen(0x0027, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second source cid is out of the dynamic range
+	req := []byte{ECRED_CONN_REQ, 1, 12, 0}
+	req = append(req, put16(0x0027, 64, 64, 1, 0x0040, 0x0001)...)
+	frame := append(put16(uint16(len(req)), CID_LE_SIGNALING), req...)
+	if err := a.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := a.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp) < 20 || rsp[4] != ECRED_CONN_RSP {
+		t.Fatalf("got %x", rsp)
+	}
+	data := rsp[8:]
+	if result := LeResult(le16(data[6:])); result != LE_INVALID_SCID {
+		t.Errorf("result %v", result)
+	}
+	if le16(data[8:]) == 0 || le16(data[10:]) != 0 {
+		t.Errorf("dcids %x", data[8:])
+	}
+}
+
+func TestBasicChannel(t *testing.T) {
+	a, b := connPair(false)
+	defer a.Close()
+
+	l, err := b.Listen(0x1001, Options{MTU: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, err := a.Dial(ctx, 0x1001, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.SendMTU() != 100 || acc.SendMTU() != DEFAULT_MTU {
+		t.Errorf("mtu=%d/%d", ch.SendMTU(), acc.SendMTU())
+	}
+	if _, err := acc.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if n, _ := ch.Read(buf); string(buf[:n]) != "hel" {
+		t.Errorf("got %q", buf[:n])
+	}
+	if n, _ := ch.Read(buf); string(buf[:n]) != "lo" {
+		t.Errorf("got %q", buf[:n])
+	}
+
+	ch.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := ch.Read(buf); err == nil {
+		t.Error("expected timeout")
+	}
+
+	if data, err := a.Echo(ctx, []byte("ping")); err != nil || string(data) != "ping" {
+		t.Errorf("echo %q %v", data, err)
+	}
+}
+
+func TestConnParamUpdate(t *testing.T) {
+	central, peripheral := connPair(true)
+	defer central.Close()
+
+	var got ConnParams
+	central.ConnParamUpdate = func(params ConnParams) bool {
+		got = params
+		return params.IntervalMax <= 40
+	}
+	ctx := context.Background()
+	params := ConnParams{IntervalMin: 24, IntervalMax: 40, SupervisionTimeout: 400}
+	if err := peripheral.UpdateConnParams(ctx, params); err != nil {
+		t.Error(err)
+	} else if got != params {
+		t.Errorf("got %v", got)
+	}
+	params.IntervalMax = 80
+	if err := peripheral.UpdateConnParams(ctx, params); err == nil {
+		t.Error("expected rejection")
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	cases := []struct {
+		opts    Options
+		mps     uint16
+		credits uint16
+	}{
+		{Options{MTU: 512}, 243, 6},
+		{Options{MTU: 100}, 102, 2},
+		{Options{MTU: 65535}, 243, 540},
+		{Options{MTU: 65535, MPS: 65535}, MAX_LE_COC_MPS, 4},
+		{Options{MTU: 23, MPS: 10}, MIN_LE_COC_MPS, 4},
+	}
+	for _, c := range cases {
+		if opts := c.opts.withDefaults(true); opts.MPS != c.mps || opts.Credits != c.credits {
+			t.Errorf("%+v: got MPS %d credits %d", c.opts, opts.MPS, opts.Credits)
+		}
+	}
+}
@@ -0,0 +1,883 @@
+package l2cap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Signaling commands, Section 4
+
+const (
+	COMMAND_REJ           = 0x01
+	CONN_REQ              = 0x02
+	CONN_RSP              = 0x03
+	CONF_REQ              = 0x04
+	CONF_RSP              = 0x05
+	DISCONN_REQ           = 0x06
+	DISCONN_RSP           = 0x07
+	ECHO_REQ              = 0x08
+	ECHO_RSP              = 0x09
+	INFO_REQ              = 0x0A
+	INFO_RSP              = 0x0B
+	CONN_PARAM_UPDATE_REQ = 0x12
+	CONN_PARAM_UPDATE_RSP = 0x13
+	LE_CONN_REQ           = 0x14
+	LE_CONN_RSP           = 0x15
+	LE_CREDITS            = 0x16
+	ECRED_CONN_REQ        = 0x17
+	ECRED_CONN_RSP        = 0x18
+	ECRED_RECONF_REQ      = 0x19
+	ECRED_RECONF_RSP      = 0x1A
+)
+
+// Command Reject reasons
+const (
+	REJ_NOT_UNDERSTOOD = 0x0000
+	REJ_MTU_EXCEEDED   = 0x0001
+	REJ_INVALID_CID    = 0x0002
+)
+
+// ConnResult is the result of Connection Response, used for BR/EDR
+// basic mode channels.
+type ConnResult uint16
+
+const (
+	CR_SUCCESS ConnResult = iota
+	CR_PEND
+	CR_BAD_PSM
+	CR_SEC_BLOCK
+	CR_NO_MEM
+	_
+	CR_INVALID_SCID
+	CR_SCID_IN_USE
+)
+
+func (self ConnResult) Error() string {
+	switch self {
+	case CR_SUCCESS:
+		return "l2cap: connection successful"
+	case CR_PEND:
+		return "l2cap: connection pending"
+	case CR_BAD_PSM:
+		return "l2cap: psm not supported"
+	case CR_SEC_BLOCK:
+		return "l2cap: security block"
+	case CR_NO_MEM:
+		return "l2cap: no resources available"
+	case CR_INVALID_SCID:
+		return "l2cap: invalid source cid"
+	case CR_SCID_IN_USE:
+		return "l2cap: source cid already allocated"
+	default:
+		return fmt.Sprintf("l2cap: connection result 0x%04x", uint16(self))
+	}
+}
+
+// LeResult is the result of LE Credit Based Connection Response and
+// Credit Based Connection Response.
+type LeResult uint16
+
+const (
+	LE_SUCCESS LeResult = iota
+	_
+	LE_BAD_PSM
+	_
+	LE_NO_MEM
+	LE_AUTHENTICATION
+	LE_AUTHORIZATION
+	LE_BAD_KEY_SIZE
+	LE_ENCRYPTION
+	LE_INVALID_SCID
+	LE_SCID_IN_USE
+	LE_UNACCEPT_PARAMS
+	LE_INVALID_PARAMS
+)
+
+func (self LeResult) Error() string {
+	switch self {
+	case LE_SUCCESS:
+		return "l2cap: connection successful"
+	case LE_BAD_PSM:
+		return "l2cap: spsm not supported"
+	case LE_NO_MEM:
+		return "l2cap: no resources available"
+	case LE_AUTHENTICATION:
+		return "l2cap: insufficient authentication"
+	case LE_AUTHORIZATION:
+		return "l2cap: insufficient authorization"
+	case LE_BAD_KEY_SIZE:
+		return "l2cap: insufficient encryption key size"
+	case LE_ENCRYPTION:
+		return "l2cap: insufficient encryption"
+	case LE_INVALID_SCID:
+		return "l2cap: invalid source cid"
+	case LE_SCID_IN_USE:
+		return "l2cap: source cid already allocated"
+	case LE_UNACCEPT_PARAMS:
+		return "l2cap: unacceptable parameters"
+	case LE_INVALID_PARAMS:
+		return "l2cap: invalid parameters"
+	default:
+		return fmt.Sprintf("l2cap: connection result 0x%04x", uint16(self))
+	}
+}
+
+// Configuration results and options, Section 4.5 and 5
+
+const (
+	CONF_SUCCESS  = 0x0000
+	CONF_UNACCEPT = 0x0001
+	CONF_REJECT   = 0x0002
+	CONF_UNKNOWN  = 0x0003
+	CONF_PENDING  = 0x0004
+
+	CONF_MTU   = 0x01
+	CONF_FLUSH = 0x02
+	CONF_QOS   = 0x03
+	CONF_RFC   = 0x04
+	CONF_FCS   = 0x05
+	CONF_EFS   = 0x06
+	CONF_EWS   = 0x07
+	CONF_HINT  = 0x80
+
+	MODE_BASIC = 0x00
+)
+
+// Information request types
+const (
+	INFO_CONNLESS_MTU  = 0x0001
+	INFO_FEAT_MASK     = 0x0002
+	INFO_FIXED_CHAN    = 0x0003
+	FEAT_FIXED_CHAN    = 0x00000080
+	INFO_SUCCESS       = 0x0000
+	INFO_NOT_SUPPORTED = 0x0001
+)
+
+type command struct {
+	code  uint8
+	ident uint8
+	data  []byte
+}
+
+func le16(b []byte) uint16 {
+	return binary.LittleEndian.Uint16(b)
+}
+
+func put16(vs ...uint16) []byte {
+	ret := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint16(ret[2*i:], v)
+	}
+	return ret
+}
+
+func (self *Conn) sendCommand(code, ident uint8, data []byte) error {
+	buf := make([]byte, 4, 4+len(data))
+	buf[0] = code
+	buf[1] = ident
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(data)))
+	return self.writeFrame(self.sigCid(), append(buf, data...))
+}
+
+// nextIdentLocked must be called with lock held.
+func (self *Conn) nextIdentLocked() uint8 {
+	for {
+		self.ident++
+		if self.ident == 0 {
+			continue
+		}
+		if _, ok := self.pending[self.ident]; !ok {
+			return self.ident
+		}
+	}
+}
+
+func (self *Conn) nextIdent() uint8 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.nextIdentLocked()
+}
+
+// request sends a signaling request and returns the channel that the
+// responses of the identifier are delivered to. done must be called when
+// the exchange finished.
+func (self *Conn) request(code uint8, data []byte) (<-chan command, func(), error) {
+	self.lock.Lock()
+	if self.err != nil {
+		self.lock.Unlock()
+		return nil, nil, self.closedErr()
+	}
+	ident := self.nextIdentLocked()
+	c := make(chan command, 4)
+	self.pending[ident] = c
+	self.lock.Unlock()
+
+	done := func() {
+		self.lock.Lock()
+		if self.pending[ident] == c {
+			delete(self.pending, ident)
+		}
+		self.lock.Unlock()
+	}
+	if err := self.sendCommand(code, ident, data); err != nil {
+		done()
+		return nil, nil, err
+	}
+	return c, done, nil
+}
+
+func (self *Conn) response(ctx context.Context, c <-chan command) (command, error) {
+	timer := time.NewTimer(DEFAULT_TIMEOUT)
+	defer timer.Stop()
+	select {
+	case rsp, ok := <-c:
+		if !ok {
+			return rsp, self.closedErr()
+		} else if rsp.code == COMMAND_REJ {
+			if len(rsp.data) >= 2 {
+				return rsp, fmt.Errorf("l2cap: command rejected reason=0x%04x", le16(rsp.data))
+			}
+			return rsp, fmt.Errorf("l2cap: command rejected")
+		}
+		return rsp, nil
+	case <-timer.C:
+		return command{}, fmt.Errorf("l2cap: signaling timeout")
+	case <-ctx.Done():
+		return command{}, ctx.Err()
+	}
+}
+
+// exchange sends a request and waits for a response.
+func (self *Conn) exchange(ctx context.Context, code uint8, data []byte) (command, error) {
+	c, done, err := self.request(code, data)
+	if err != nil {
+		return command{}, err
+	}
+	defer done()
+	return self.response(ctx, c)
+}
+
+func (self *Conn) signaling(payload []byte) {
+	for len(payload) >= 4 {
+		cmd := command{
+			code:  payload[0],
+			ident: payload[1],
+		}
+		length := int(le16(payload[2:]))
+		if len(payload) < 4+length {
+			return
+		}
+		cmd.data = payload[4 : 4+length]
+		payload = payload[4+length:]
+
+		switch cmd.code {
+		case COMMAND_REJ, CONN_RSP, CONF_RSP, DISCONN_RSP, ECHO_RSP, INFO_RSP,
+			CONN_PARAM_UPDATE_RSP, LE_CONN_RSP, ECRED_CONN_RSP, ECRED_RECONF_RSP:
+			self.lock.Lock()
+			if c, ok := self.pending[cmd.ident]; ok {
+				select {
+				case c <- cmd:
+				default:
+				}
+			}
+			self.lock.Unlock()
+		default:
+			if err := self.handleRequest(cmd); err != nil {
+				self.sendCommand(COMMAND_REJ, cmd.ident, put16(REJ_NOT_UNDERSTOOD))
+			}
+		}
+	}
+}
+
+var errNotUnderstood = fmt.Errorf("l2cap: command not understood")
+
+func (self *Conn) handleRequest(cmd command) error {
+	d := cmd.data
+	switch cmd.code {
+	case CONN_REQ:
+		if self.le || len(d) < 4 {
+			return errNotUnderstood
+		}
+		self.connReq(cmd.ident, le16(d), le16(d[2:]))
+	case CONF_REQ:
+		if self.le || len(d) < 4 {
+			return errNotUnderstood
+		}
+		self.confReq(cmd.ident, le16(d), le16(d[2:]), d[4:])
+	case DISCONN_REQ:
+		if len(d) < 4 {
+			return errNotUnderstood
+		}
+		dcid, scid := le16(d), le16(d[2:])
+		self.lock.Lock()
+		ch, ok := self.channels[dcid]
+		if ok && ch.mode != modeFixed && ch.remoteCid == scid {
+			ch.closeLocked()
+			delete(self.channels, dcid)
+		}
+		self.lock.Unlock()
+		if !ok || ch.mode == modeFixed {
+			return self.sendCommand(COMMAND_REJ, cmd.ident, append(put16(REJ_INVALID_CID), d[:4]...))
+		}
+		return self.sendCommand(DISCONN_RSP, cmd.ident, put16(dcid, scid))
+	case ECHO_REQ:
+		if self.le {
+			return errNotUnderstood
+		}
+		return self.sendCommand(ECHO_RSP, cmd.ident, d)
+	case INFO_REQ:
+		if self.le || len(d) < 2 {
+			return errNotUnderstood
+		}
+		switch le16(d) {
+		case INFO_CONNLESS_MTU:
+			return self.sendCommand(INFO_RSP, cmd.ident, put16(INFO_CONNLESS_MTU, INFO_SUCCESS, DEFAULT_MTU))
+		case INFO_FEAT_MASK:
+			return self.sendCommand(INFO_RSP, cmd.ident, put16(INFO_FEAT_MASK, INFO_SUCCESS, FEAT_FIXED_CHAN, 0))
+		case INFO_FIXED_CHAN:
+			return self.sendCommand(INFO_RSP, cmd.ident, append(put16(INFO_FIXED_CHAN, INFO_SUCCESS),
+				1<<CID_SIGNALING|1<<CID_SMP_BREDR, 0, 0, 0, 0, 0, 0, 0))
+		default:
+			return self.sendCommand(INFO_RSP, cmd.ident, put16(le16(d), INFO_NOT_SUPPORTED))
+		}
+	case CONN_PARAM_UPDATE_REQ:
+		if !self.le || len(d) < 8 {
+			return errNotUnderstood
+		}
+		params := ConnParams{
+			IntervalMin:        le16(d),
+			IntervalMax:        le16(d[2:]),
+			Latency:            le16(d[4:]),
+			SupervisionTimeout: le16(d[6:]),
+		}
+		var result uint16 = 0x0001 // rejected
+		if self.ConnParamUpdate != nil && self.ConnParamUpdate(params) {
+			result = 0x0000
+		}
+		return self.sendCommand(CONN_PARAM_UPDATE_RSP, cmd.ident, put16(result))
+	case LE_CONN_REQ:
+		if !self.le || len(d) < 10 {
+			return errNotUnderstood
+		}
+		self.leConnReq(cmd.ident, le16(d), le16(d[2:]), le16(d[4:]), le16(d[6:]), le16(d[8:]))
+	case LE_CREDITS:
+		if len(d) < 4 {
+			return errNotUnderstood
+		}
+		self.credits(le16(d), le16(d[2:]))
+	case ECRED_CONN_REQ:
+		if len(d) < 8 {
+			return errNotUnderstood
+		}
+		var scids []uint16
+		for i := 8; i+2 <= len(d); i += 2 {
+			scids = append(scids, le16(d[i:]))
+		}
+		self.ecredConnReq(cmd.ident, le16(d), le16(d[2:]), le16(d[4:]), le16(d[6:]), scids)
+	case ECRED_RECONF_REQ:
+		if len(d) < 6 {
+			return errNotUnderstood
+		}
+		var cids []uint16
+		for i := 4; i+2 <= len(d); i += 2 {
+			cids = append(cids, le16(d[i:]))
+		}
+		self.ecredReconfReq(cmd.ident, le16(d), le16(d[2:]), cids)
+	default:
+		return errNotUnderstood
+	}
+	return nil
+}
+
+// remoteCidInUse must be called with lock held.
+func (self *Conn) remoteCidInUse(cid uint16) bool {
+	for _, ch := range self.channels {
+		if ch.mode != modeFixed && ch.remoteCid == cid {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Conn) connReq(ident uint8, psm, scid uint16) {
+	self.lock.Lock()
+	l, ok := self.psms[psm]
+	var result ConnResult
+	var ch *Channel
+	if !ok {
+		result = CR_BAD_PSM
+	} else if scid < CID_DYN_START {
+		result = CR_INVALID_SCID
+	} else if self.remoteCidInUse(scid) {
+		result = CR_SCID_IN_USE
+	} else if cid, err := self.allocCid(); err != nil {
+		result = CR_NO_MEM
+	} else {
+		ch = newChannel(self, modeBasic)
+		ch.psm = psm
+		ch.localCid = cid
+		ch.remoteCid = scid
+		ch.rxMtu = l.opts.MTU
+		ch.listener = l
+		self.channels[cid] = ch
+	}
+	self.lock.Unlock()
+
+	if ch == nil {
+		self.sendCommand(CONN_RSP, ident, put16(0, scid, uint16(result), 0))
+		return
+	}
+	self.sendCommand(CONN_RSP, ident, put16(ch.localCid, scid, uint16(CR_SUCCESS), 0))
+	go func() {
+		if err := ch.configure(context.Background()); err != nil {
+			ch.Close()
+		}
+	}()
+}
+
+func (self *Conn) confReq(ident uint8, dcid, flags uint16, opts []byte) {
+	self.lock.Lock()
+	ch, ok := self.channels[dcid]
+	if !ok || ch.mode != modeBasic {
+		self.lock.Unlock()
+		self.sendCommand(COMMAND_REJ, ident, put16(REJ_INVALID_CID, dcid, 0))
+		return
+	}
+	scid := ch.remoteCid
+	mtu := uint16(DEFAULT_MTU)
+	var unknown, unaccept []byte
+	for len(opts) >= 2 {
+		typ, length := opts[0], int(opts[1])
+		if len(opts) < 2+length {
+			break
+		}
+		value := opts[2 : 2+length]
+		switch typ &^ CONF_HINT {
+		case CONF_MTU:
+			if length >= 2 {
+				mtu = le16(value)
+			}
+		case CONF_RFC:
+			if length >= 1 && value[0] != MODE_BASIC {
+				unaccept = append(unaccept, CONF_RFC, 9, MODE_BASIC, 0, 0, 0, 0, 0, 0, 0, 0)
+			}
+		case CONF_FLUSH, CONF_QOS, CONF_FCS, CONF_EFS, CONF_EWS:
+		default:
+			if typ&CONF_HINT == 0 {
+				unknown = append(unknown, typ)
+			}
+		}
+		opts = opts[2+length:]
+	}
+	result := uint16(CONF_SUCCESS)
+	var rspOpts []byte
+	if len(unknown) > 0 {
+		result = CONF_UNKNOWN
+		rspOpts = unknown
+	} else if len(unaccept) > 0 {
+		result = CONF_UNACCEPT
+		rspOpts = unaccept
+	} else {
+		ch.txMtu = mtu
+		if flags&0x0001 == 0 {
+			ch.confRemote = true
+			ch.configured()
+		}
+	}
+	self.lock.Unlock()
+	self.sendCommand(CONF_RSP, ident, append(put16(scid, flags&0x0001, result), rspOpts...))
+}
+
+func (self *Conn) leConnReq(ident uint8, psm, scid, mtu, mps, credits uint16) {
+	self.lock.Lock()
+	l, ok := self.psms[psm]
+	var result LeResult
+	var ch *Channel
+	if !ok {
+		result = LE_BAD_PSM
+	} else if scid < CID_DYN_START || scid > CID_LE_DYN_END {
+		result = LE_INVALID_SCID
+	} else if self.remoteCidInUse(scid) {
+		result = LE_SCID_IN_USE
+	} else if mtu < LE_DEFAULT_MTU || mps < MIN_LE_COC_MPS || mps > MAX_LE_COC_MPS {
+		result = LE_UNACCEPT_PARAMS
+	} else if cid, err := self.allocCid(); err != nil {
+		result = LE_NO_MEM
+	} else {
+		ch = newChannel(self, modeLeCredit)
+		ch.psm = psm
+		ch.localCid = cid
+		ch.remoteCid = scid
+		ch.setCredits(l.opts, mtu, mps, credits)
+		self.channels[cid] = ch
+	}
+	self.lock.Unlock()
+
+	if ch == nil {
+		self.sendCommand(LE_CONN_RSP, ident, put16(0, 0, 0, 0, uint16(result)))
+		return
+	}
+	self.sendCommand(LE_CONN_RSP, ident, put16(ch.localCid, ch.rxMtu, ch.rxMps, uint16(ch.rxCredits), uint16(LE_SUCCESS)))
+
+	self.lock.Lock()
+	l.backlog = append(l.backlog, ch)
+	self.cond.Broadcast()
+	self.lock.Unlock()
+}
+
+func (self *Conn) ecredConnReq(ident uint8, psm, mtu, mps, credits uint16, scids []uint16) {
+	self.lock.Lock()
+	l, ok := self.psms[psm]
+	var result LeResult
+	var chans []*Channel
+	dcids := make([]uint16, len(scids))
+	if !ok {
+		result = LE_BAD_PSM
+	} else if len(scids) == 0 || len(scids) > MAX_ECRED_CHANS {
+		result = LE_INVALID_PARAMS
+	} else if mtu < MIN_ECRED_MTU || mps < MIN_ECRED_MTU || mps > MAX_LE_COC_MPS {
+		result = LE_UNACCEPT_PARAMS
+	} else {
+		for i, scid := range scids {
+			if scid < CID_DYN_START || (self.le && scid > CID_LE_DYN_END) {
+				result = LE_INVALID_SCID
+			} else if self.remoteCidInUse(scid) {
+				result = LE_SCID_IN_USE
+			} else if cid, err := self.allocCid(); err != nil {
+				result = LE_NO_MEM
+			} else {
+				ch := newChannel(self, modeEcred)
+				ch.psm = psm
+				ch.localCid = cid
+				ch.remoteCid = scid
+				ch.setCredits(l.opts, mtu, mps, credits)
+				self.channels[cid] = ch
+				chans = append(chans, ch)
+				dcids[i] = cid
+			}
+		}
+	}
+	self.lock.Unlock()
+
+	opts := Options{}
+	if l != nil {
+		opts = l.opts
+	}
+	rsp := put16(opts.MTU, opts.MPS, opts.Credits, uint16(result))
+	if len(chans) > 0 {
+		rsp = put16(chans[0].rxMtu, chans[0].rxMps, uint16(chans[0].rxCredits), uint16(result))
+	}
+	self.sendCommand(ECRED_CONN_RSP, ident, append(rsp, put16(dcids...)...))
+
+	if len(chans) > 0 {
+		self.lock.Lock()
+		l.backlog = append(l.backlog, chans...)
+		self.cond.Broadcast()
+		self.lock.Unlock()
+	}
+}
+
+func (self *Conn) ecredReconfReq(ident uint8, mtu, mps uint16, cids []uint16) {
+	self.lock.Lock()
+	var chans []*Channel
+	var result uint16
+	for _, cid := range cids {
+		var found *Channel
+		for _, ch := range self.channels {
+			if ch.mode == modeEcred && ch.remoteCid == cid {
+				found = ch
+			}
+		}
+		if found == nil {
+			result = 0x0003 // invalid destination cid
+			break
+		} else if mtu < found.txMtu {
+			result = 0x0001 // reduction in size of mtu not allowed
+			break
+		} else if len(cids) > 1 && mps < found.txMps {
+			result = 0x0002 // reduction in size of mps not allowed
+			break
+		}
+		chans = append(chans, found)
+	}
+	if mtu < MIN_ECRED_MTU || mps < MIN_ECRED_MTU {
+		result = 0x0004 // unacceptable parameters
+	}
+	if result == 0 {
+		for _, ch := range chans {
+			ch.txMtu = mtu
+			ch.txMps = mps
+		}
+	}
+	self.lock.Unlock()
+	self.sendCommand(ECRED_RECONF_RSP, ident, put16(result))
+}
+
+func (self *Conn) credits(cid, credits uint16) {
+	self.lock.Lock()
+	var found *Channel
+	for _, ch := range self.channels {
+		if (ch.mode == modeLeCredit || ch.mode == modeEcred) && ch.remoteCid == cid {
+			found = ch
+		}
+	}
+	overflow := false
+	if found != nil {
+		found.txCredits += int(credits)
+		overflow = found.txCredits > MAX_LE_COC_CREDS
+		self.cond.Broadcast()
+	}
+	self.lock.Unlock()
+	if overflow {
+		go found.Close()
+	}
+}
+
+// UpdateConnParams requests the central to update the LE connection
+// parameters. It is used by the peripheral.
+func (self *Conn) UpdateConnParams(ctx context.Context, params ConnParams) error {
+	if !self.le {
+		return fmt.Errorf("l2cap: not an LE link")
+	}
+	rsp, err := self.exchange(ctx, CONN_PARAM_UPDATE_REQ, put16(
+		params.IntervalMin,
+		params.IntervalMax,
+		params.Latency,
+		params.SupervisionTimeout))
+	if err != nil {
+		return err
+	} else if rsp.code != CONN_PARAM_UPDATE_RSP || len(rsp.data) < 2 {
+		return fmt.Errorf("l2cap: unexpected response")
+	} else if le16(rsp.data) != 0 {
+		return fmt.Errorf("l2cap: connection parameters rejected")
+	}
+	return nil
+}
+
+// Echo sends an Echo Request on BR/EDR signaling channel and returns the
+// data of the response.
+func (self *Conn) Echo(ctx context.Context, data []byte) ([]byte, error) {
+	if self.le {
+		return nil, fmt.Errorf("l2cap: not a BR/EDR link")
+	}
+	rsp, err := self.exchange(ctx, ECHO_REQ, data)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.data, nil
+}
+
+// Dial opens a basic mode channel on BR/EDR.
+func (self *Conn) Dial(ctx context.Context, psm uint16, opts Options) (*Channel, error) {
+	if self.le {
+		return nil, fmt.Errorf("l2cap: basic mode is not available on LE")
+	}
+	opts = opts.withDefaults(false)
+
+	self.lock.Lock()
+	cid, err := self.allocCid()
+	if err != nil {
+		self.lock.Unlock()
+		return nil, err
+	}
+	ch := newChannel(self, modeBasic)
+	ch.psm = psm
+	ch.localCid = cid
+	ch.rxMtu = opts.MTU
+	self.channels[cid] = ch
+	self.lock.Unlock()
+
+	fail := func(err error) (*Channel, error) {
+		self.lock.Lock()
+		ch.closeLocked()
+		delete(self.channels, cid)
+		self.lock.Unlock()
+		return nil, err
+	}
+
+	c, done, err := self.request(CONN_REQ, put16(psm, cid))
+	if err != nil {
+		return fail(err)
+	}
+	for {
+		rsp, err := self.response(ctx, c)
+		if err != nil {
+			done()
+			return fail(err)
+		} else if len(rsp.data) < 8 {
+			done()
+			return fail(fmt.Errorf("l2cap: short connection response"))
+		} else if result := ConnResult(le16(rsp.data[4:])); result == CR_PEND {
+			continue
+		} else if result != CR_SUCCESS {
+			done()
+			return fail(result)
+		} else {
+			done()
+			self.lock.Lock()
+			ch.remoteCid = le16(rsp.data)
+			self.lock.Unlock()
+			break
+		}
+	}
+	if err := ch.configure(ctx); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := ch.waitOpen(ctx); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// DialLE opens an LE credit based channel.
+func (self *Conn) DialLE(ctx context.Context, psm uint16, opts Options) (*Channel, error) {
+	if !self.le {
+		return nil, fmt.Errorf("l2cap: not an LE link")
+	}
+	opts = opts.withDefaults(true)
+
+	self.lock.Lock()
+	cid, err := self.allocCid()
+	if err != nil {
+		self.lock.Unlock()
+		return nil, err
+	}
+	ch := newChannel(self, modeLeCredit)
+	ch.psm = psm
+	ch.localCid = cid
+	ch.rxMtu = opts.MTU
+	ch.rxMps = opts.MPS
+	ch.rxCredits = int(opts.Credits)
+	ch.initCredits = int(opts.Credits)
+	self.channels[cid] = ch
+	self.lock.Unlock()
+
+	rsp, err := self.exchange(ctx, LE_CONN_REQ, put16(psm, cid, opts.MTU, opts.MPS, opts.Credits))
+	if err == nil && len(rsp.data) < 10 {
+		err = fmt.Errorf("l2cap: short connection response")
+	}
+	if err == nil {
+		if result := LeResult(le16(rsp.data[8:])); result != LE_SUCCESS {
+			err = result
+		}
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err != nil {
+		ch.closeLocked()
+		delete(self.channels, cid)
+		return nil, err
+	}
+	ch.remoteCid = le16(rsp.data)
+	ch.txMtu = le16(rsp.data[2:])
+	ch.txMps = le16(rsp.data[4:])
+	ch.txCredits = int(le16(rsp.data[6:]))
+	ch.state = stateOpen
+	return ch, nil
+}
+
+// DialEnhanced opens up to 5 enhanced credit based channels at once.
+// Channels refused by the peer are nil in the result; an error is returned
+// only when none was established.
+func (self *Conn) DialEnhanced(ctx context.Context, psm uint16, count int, opts Options) ([]*Channel, error) {
+	if count < 1 || count > MAX_ECRED_CHANS {
+		return nil, fmt.Errorf("l2cap: invalid channel count %d", count)
+	}
+	opts = opts.withDefaults(self.le)
+	if opts.MTU < MIN_ECRED_MTU {
+		opts.MTU = MIN_ECRED_MTU
+	}
+	if opts.MPS < MIN_ECRED_MTU {
+		opts.MPS = MIN_ECRED_MTU
+	}
+
+	self.lock.Lock()
+	chans := make([]*Channel, count)
+	req := put16(psm, opts.MTU, opts.MPS, opts.Credits)
+	for i := range chans {
+		cid, err := self.allocCid()
+		if err != nil {
+			for _, ch := range chans[:i] {
+				delete(self.channels, ch.localCid)
+			}
+			self.lock.Unlock()
+			return nil, err
+		}
+		ch := newChannel(self, modeEcred)
+		ch.psm = psm
+		ch.localCid = cid
+		ch.rxMtu = opts.MTU
+		ch.rxMps = opts.MPS
+		ch.rxCredits = int(opts.Credits)
+		ch.initCredits = int(opts.Credits)
+		self.channels[cid] = ch
+		chans[i] = ch
+		req = append(req, put16(cid)...)
+	}
+	self.lock.Unlock()
+
+	rsp, err := self.exchange(ctx, ECRED_CONN_REQ, req)
+	if err == nil && len(rsp.data) < 8+2*count {
+		err = fmt.Errorf("l2cap: short connection response")
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	opened := 0
+	if err == nil {
+		for i, ch := range chans {
+			if dcid := le16(rsp.data[8+2*i:]); dcid != 0 {
+				ch.remoteCid = dcid
+				ch.txMtu = le16(rsp.data)
+				ch.txMps = le16(rsp.data[2:])
+				ch.txCredits = int(le16(rsp.data[4:]))
+				ch.state = stateOpen
+				opened++
+			}
+		}
+		if opened == 0 {
+			err = LeResult(le16(rsp.data[6:]))
+		}
+	}
+	for i, ch := range chans {
+		if ch.state != stateOpen {
+			ch.closeLocked()
+			delete(self.channels, ch.localCid)
+			chans[i] = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chans, nil
+}
+
+// Reconfigure raises the receive MTU and MPS of enhanced credit based
+// channels.
+func (self *Conn) Reconfigure(ctx context.Context, mtu, mps uint16, chans ...*Channel) error {
+	req := put16(mtu, mps)
+	for _, ch := range chans {
+		if ch.mode != modeEcred {
+			return fmt.Errorf("l2cap: not an enhanced credit based channel")
+		}
+		req = append(req, put16(ch.localCid)...)
+	}
+	rsp, err := self.exchange(ctx, ECRED_RECONF_REQ, req)
+	if err != nil {
+		return err
+	} else if len(rsp.data) < 2 {
+		return fmt.Errorf("l2cap: short reconfigure response")
+	} else if result := le16(rsp.data); result != 0 {
+		return fmt.Errorf("l2cap: reconfigure failed result=0x%04x", result)
+	}
+	self.lock.Lock()
+	for _, ch := range chans {
+		ch.rxMtu = mtu
+		ch.rxMps = mps
+	}
+	self.lock.Unlock()
+	return nil
+}
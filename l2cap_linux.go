@@ -0,0 +1,274 @@
+// +build linux
+
+//go:generate sh gen.sh l2cap linux_seed $GOOS $GOARCH
+
+package blugo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// L2capAddr is the address of kernel L2CAP socket. PSM is used for
+// connection oriented channels, and CID for fixed channels such as ATT.
+type L2capAddr struct {
+	Bdaddr Bdaddr
+	Type   uint8 // BDADDR_BREDR, BDADDR_LE_PUBLIC or BDADDR_LE_RANDOM
+	PSM    uint16
+	CID    uint16
+}
+
+func (self L2capAddr) Network() string {
+	return "l2cap"
+}
+
+func (self L2capAddr) String() string {
+	if self.CID != 0 {
+		return fmt.Sprintf("%v/%d cid=0x%04x", self.Bdaddr, self.Type, self.CID)
+	}
+	return fmt.Sprintf("%v/%d psm=0x%04x", self.Bdaddr, self.Type, self.PSM)
+}
+
+func (self L2capAddr) le() bool {
+	return self.Type == BDADDR_LE_PUBLIC || self.Type == BDADDR_LE_RANDOM
+}
+
+func (self L2capAddr) sockaddr() SockaddrL2 {
+	return SockaddrL2{
+		Family:      syscall.AF_BLUETOOTH,
+		Psm:         self.PSM,
+		Bdaddr:      self.Bdaddr,
+		Cid:         self.CID,
+		Bdaddr_type: self.Type,
+	}
+}
+
+func l2capAddr(sa SockaddrL2) L2capAddr {
+	return L2capAddr{
+		Bdaddr: sa.Bdaddr,
+		Type:   sa.Bdaddr_type,
+		PSM:    sa.Psm,
+		CID:    sa.Cid,
+	}
+}
+
+// L2capConfig holds the socket options applied before connecting or
+// listening.
+type L2capConfig struct {
+	// Local binds the socket to the adapter address. Any adapter of
+	// the transport of the peer is used when nil.
+	Local *L2capAddr
+
+	Security uint8  // BT_SECURITY_*
+	Mode     uint8  // BT_MODE_*, applied unless BT_MODE_BASIC
+	MTU      uint16 // receive MTU, kernel default when zero
+}
+
+func newL2capSocket(cfg *L2capConfig, local L2capAddr) (int, error) {
+	fd, err := btSocket(syscall.SOCK_SEQPACKET, BTPROTO_L2CAP)
+	if err != nil {
+		return -1, err
+	}
+	sa := local.sockaddr()
+	if err := sockaddrCall(syscall.SYS_BIND, fd, unsafe.Pointer(&sa), SizeofSockaddrL2); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	if cfg.Security != BT_SECURITY_SDP {
+		if err := setBtSecurity(fd, cfg.Security); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	if cfg.Mode != BT_MODE_BASIC {
+		mode := cfg.Mode
+		if err := setsockopt(fd, SOL_BLUETOOTH, BT_MODE, unsafe.Pointer(&mode), 1); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	if cfg.MTU != 0 {
+		if local.le() {
+			mtu := cfg.MTU
+			err = setsockopt(fd, SOL_BLUETOOTH, BT_RCVMTU, unsafe.Pointer(&mtu), 2)
+		} else {
+			var opts L2capOptions
+			if err = getsockopt(fd, SOL_L2CAP, L2CAP_OPTIONS, unsafe.Pointer(&opts), SizeofL2capOptions); err == nil {
+				opts.Imtu = cfg.MTU
+				err = setsockopt(fd, SOL_L2CAP, L2CAP_OPTIONS, unsafe.Pointer(&opts), SizeofL2capOptions)
+			}
+		}
+		if err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	return fd, nil
+}
+
+// L2capConn is a connected kernel L2CAP socket. Each Write sends an SDU
+// and each Read receives an SDU.
+type L2capConn struct {
+	btConn
+}
+
+// DialL2CAP connects to the PSM or the fixed CID of the peer.
+func DialL2CAP(ctx context.Context, raddr L2capAddr, cfg *L2capConfig) (*L2capConn, error) {
+	if cfg == nil {
+		cfg = &L2capConfig{}
+	}
+	local := L2capAddr{Type: BDADDR_BREDR}
+	if cfg.Local != nil {
+		local = *cfg.Local
+		local.PSM = 0
+		local.CID = 0
+	} else if raddr.le() {
+		local.Type = BDADDR_LE_PUBLIC
+	}
+	if raddr.CID != 0 {
+		local.CID = raddr.CID // fixed channel
+	}
+	fd, err := newL2capSocket(cfg, local)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "l2cap")
+
+	sa := raddr.sockaddr()
+	var peer SockaddrL2
+	if err := btConnect(ctx, file, unsafe.Pointer(&sa), SizeofSockaddrL2, unsafe.Pointer(&peer)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	ret := &L2capConn{btConn{
+		file:  file,
+		raddr: raddr,
+	}}
+	ret.control(func(fd int) error {
+		var name SockaddrL2
+		if err := sockname(syscall.SYS_GETSOCKNAME, fd, unsafe.Pointer(&name), SizeofSockaddrL2); err != nil {
+			return err
+		}
+		ret.laddr = l2capAddr(name)
+		return nil
+	})
+	if ret.laddr == nil {
+		ret.laddr = local
+	}
+	return ret, nil
+}
+
+func (self *L2capConn) le() bool {
+	if addr, ok := self.laddr.(L2capAddr); ok {
+		return addr.le()
+	}
+	return false
+}
+
+func (self *L2capConn) mtu(out bool) (int, error) {
+	var ret int
+	err := self.control(func(fd int) error {
+		if self.le() {
+			var mtu uint16
+			opt := BT_RCVMTU
+			if out {
+				opt = BT_SNDMTU
+			}
+			if err := getsockopt(fd, SOL_BLUETOOTH, opt, unsafe.Pointer(&mtu), 2); err != nil {
+				return err
+			}
+			ret = int(mtu)
+		} else {
+			var opts L2capOptions
+			if err := getsockopt(fd, SOL_L2CAP, L2CAP_OPTIONS, unsafe.Pointer(&opts), SizeofL2capOptions); err != nil {
+				return err
+			}
+			if out {
+				ret = int(opts.Omtu)
+			} else {
+				ret = int(opts.Imtu)
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// SendMTU returns the maximum SDU size that the peer accepts.
+func (self *L2capConn) SendMTU() (int, error) {
+	return self.mtu(true)
+}
+
+// ReceiveMTU returns the maximum SDU size to receive.
+func (self *L2capConn) ReceiveMTU() (int, error) {
+	return self.mtu(false)
+}
+
+// Handle returns the HCI connection handle of the underlying link.
+func (self *L2capConn) Handle() (uint16, error) {
+	var info L2capConninfo
+	err := self.control(func(fd int) error {
+		return getsockopt(fd, SOL_L2CAP, L2CAP_CONNINFO, unsafe.Pointer(&info), SizeofL2capConninfo)
+	})
+	return info.Hci_handle, err
+}
+
+var _ net.Conn = &L2capConn{}
+
+// L2capListener accepts kernel L2CAP connections.
+type L2capListener struct {
+	btListener
+}
+
+var _ net.Listener = &L2capListener{}
+
+// ListenL2CAP listens on the PSM, or the fixed CID, of laddr. Type of laddr
+// selects the transport; BDADDR_LE_PUBLIC listens for LE credit based
+// channels or LE fixed channels.
+func ListenL2CAP(laddr L2capAddr, cfg *L2capConfig) (*L2capListener, error) {
+	if cfg == nil {
+		cfg = &L2capConfig{}
+	}
+	fd, err := newL2capSocket(cfg, laddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &L2capListener{btListener{
+		file:  os.NewFile(uintptr(fd), "l2cap"),
+		laddr: laddr,
+	}}, nil
+}
+
+func (self *L2capListener) AcceptL2CAP() (*L2capConn, error) {
+	var sa SockaddrL2
+	file, err := self.accept("l2cap", unsafe.Pointer(&sa), SizeofSockaddrL2)
+	if err != nil {
+		return nil, err
+	}
+	ret := &L2capConn{btConn{
+		file:  file,
+		laddr: self.laddr,
+		raddr: l2capAddr(sa),
+	}}
+	ret.control(func(fd int) error {
+		var name SockaddrL2
+		if err := sockname(syscall.SYS_GETSOCKNAME, fd, unsafe.Pointer(&name), SizeofSockaddrL2); err != nil {
+			return err
+		}
+		ret.laddr = l2capAddr(name)
+		return nil
+	})
+	return ret, nil
+}
+
+func (self *L2capListener) Accept() (net.Conn, error) {
+	return self.AcceptL2CAP()
+}
@@ -0,0 +1,48 @@
+// Created by cgo -godefs - DO NOT EDIT
+// cgo -godefs -- -funsigned-char l2cap_linux_seed.go
+
+package blugo
+
+const (
+	L2CAP_OPTIONS  = 0x1
+	L2CAP_CONNINFO = 0x2
+	L2CAP_LM       = 0x3
+)
+
+type SockaddrL2 struct {
+	Family      uint16
+	Psm         uint16
+	Bdaddr      Bdaddr /* endian! */
+	Cid         uint16
+	Bdaddr_type uint8
+	Pad_cgo_0   [1]byte
+}
+
+type L2capOptions struct {
+	Omtu       uint16
+	Imtu       uint16
+	Flush_to   uint16
+	Mode       uint8
+	Fcs        uint8
+	Max_tx     uint8
+	Pad_cgo_0  [1]byte
+	Txwin_size uint16
+}
+
+type L2capConninfo struct {
+	Hci_handle uint16
+	Dev_class  [3]uint8
+	Pad_cgo_0  [1]byte
+}
+
+type BtSecurity struct {
+	Level    uint8
+	Key_size uint8
+}
+
+const (
+	SizeofSockaddrL2    = 0xe
+	SizeofL2capOptions  = 0xc
+	SizeofL2capConninfo = 0x6
+	SizeofBtSecurity    = 0x2
+)
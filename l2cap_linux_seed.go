@@ -0,0 +1,33 @@
+// +build ignore
+
+// +godefs map bdaddr_t Bdaddr /* endian! */
+
+package blugo
+
+// #cgo pkg-config: bluez
+// #include <sys/socket.h>
+// #include <bluetooth/bluetooth.h>
+// #include <bluetooth/l2cap.h>
+import "C"
+
+const (
+	L2CAP_OPTIONS  = C.L2CAP_OPTIONS
+	L2CAP_CONNINFO = C.L2CAP_CONNINFO
+	L2CAP_LM       = C.L2CAP_LM
+)
+
+// Psm and Cid are little endian
+type SockaddrL2 C.struct_sockaddr_l2
+
+type L2capOptions C.struct_l2cap_options
+
+type L2capConninfo C.struct_l2cap_conninfo
+
+type BtSecurity C.struct_bt_security
+
+const (
+	SizeofSockaddrL2    = C.sizeof_struct_sockaddr_l2
+	SizeofL2capOptions  = C.sizeof_struct_l2cap_options
+	SizeofL2capConninfo = C.sizeof_struct_l2cap_conninfo
+	SizeofBtSecurity    = C.sizeof_struct_bt_security
+)
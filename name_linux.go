@@ -0,0 +1,37 @@
+// +build linux
+
+package blugo
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.3.11 - 7.3.12
+
+const HCI_MAX_NAME_LENGTH = 248
+
+func (self HciDev) ReadLocalName() (string, error) {
+	if ret, err := self.Request(HCI_Read_Local_Name); err != nil {
+		return "", err
+	} else if err := statusError(ret); err != nil {
+		return "", err
+	} else {
+		name := ret[1].([]byte)
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		return string(name), nil
+	}
+}
+
+// WriteLocalName sets the user friendly name of the adapter, in UTF-8 of
+// up to 248 octets.
+func (self HciDev) WriteLocalName(name string) error {
+	if len(name) > HCI_MAX_NAME_LENGTH {
+		return fmt.Errorf("too long")
+	}
+	buf := make([]byte, HCI_MAX_NAME_LENGTH)
+	copy(buf, name)
+	return self.requestStatus(HCI_Write_Local_Name, buf)
+}
@@ -0,0 +1,263 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hkwi/blugo/keystore"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.1.10 - 7.1.36 and
+// Vol 3, Part C, Section 5.2.2
+// BR/EDR pairing, Secure Simple Pairing and legacy PIN pairing.
+
+// IO capabilities of Secure Simple Pairing
+const (
+	IO_CAP_DISPLAY_ONLY    = 0x00
+	IO_CAP_DISPLAY_YESNO   = 0x01
+	IO_CAP_KEYBOARD_ONLY   = 0x02
+	IO_CAP_NO_INPUT_OUTPUT = 0x03
+)
+
+// Authentication requirements of Secure Simple Pairing
+const (
+	AUTH_REQ_NO_BONDING             = 0x00
+	AUTH_REQ_NO_BONDING_MITM        = 0x01
+	AUTH_REQ_DEDICATED_BONDING      = 0x02
+	AUTH_REQ_DEDICATED_BONDING_MITM = 0x03
+	AUTH_REQ_GENERAL_BONDING        = 0x04
+	AUTH_REQ_GENERAL_BONDING_MITM   = 0x05
+)
+
+// PairingAgent interacts with the user during pairing. Returning false or
+// an error rejects the pairing. The requests may block for the user input.
+type PairingAgent interface {
+	// RequestPinCode returns the PIN of legacy pairing, 1 to 16 octets.
+	RequestPinCode(ctx context.Context, addr Bdaddr) (string, error)
+	// DisplayPasskey shows the passkey that the peer enters.
+	DisplayPasskey(addr Bdaddr, passkey uint32)
+	RequestPasskey(ctx context.Context, addr Bdaddr) (uint32, error)
+	// RequestConfirmation asks that the number shown on both devices match.
+	RequestConfirmation(ctx context.Context, addr Bdaddr, number uint32) (bool, error)
+	// RequestAuthorization asks to accept the pairing without
+	// authentication, just works.
+	RequestAuthorization(ctx context.Context, addr Bdaddr) (bool, error)
+}
+
+// Pairing answers the pairing events of the controller with the agent.
+// Without Agent the pairing is rejected with HCI_PAIRING_NOT_ALLOWED.
+// Link keys are answered from and saved to Store, if given.
+type Pairing struct {
+	Dev     HciDev
+	IOCap   uint8
+	AuthReq uint8
+	Agent   PairingAgent
+	Store   keystore.KeyStore
+	Adapter Bdaddr
+	// OOB returns the out of band data received from the device, the hash
+	// C and the randomizer R.
+	OOB func(addr Bdaddr) (c, r [16]byte, ok bool)
+	// OnComplete is called on Simple Pairing Complete.
+	OnComplete func(addr Bdaddr, err error)
+
+	lock   sync.Mutex
+	remote map[Bdaddr]EvtIoCapabilityResponse
+}
+
+var pairingEvents = []int{
+	EVT_PIN_CODE_REQ,
+	EVT_IO_CAPABILITY_REQUEST,
+	EVT_IO_CAPABILITY_RESPONSE,
+	EVT_USER_CONFIRM_REQUEST,
+	EVT_USER_PASSKEY_REQUEST,
+	EVT_REMOTE_OOB_DATA_REQUEST,
+	EVT_SIMPLE_PAIRING_COMPLETE,
+	EVT_USER_PASSKEY_NOTIFY,
+}
+
+// EnableSimplePairing turns Secure Simple Pairing on in the controller,
+// which can not be turned off again until reset.
+func (self *Pairing) EnableSimplePairing() error {
+	return self.Dev.requestStatus(HCI_Write_Simple_Pairing_Mode, uint8(1))
+}
+
+// ReadLocalOOB returns the local hash C and randomizer R, which are passed
+// to the peer out of band.
+func (self *Pairing) ReadLocalOOB() ([16]byte, [16]byte, error) {
+	var c, r [16]byte
+	if ret, err := self.Dev.Request(HCI_Read_Local_OOB_Data); err != nil {
+		return c, r, err
+	} else if err := statusError(ret); err != nil {
+		return c, r, err
+	} else {
+		copy(c[:], ret[1].([]byte))
+		copy(r[:], ret[2].([]byte))
+		return c, r, nil
+	}
+}
+
+// Serve answers the pairing and key events until the context is done.
+// Pairings initiated by the peers are served here.
+func (self *Pairing) Serve(ctx context.Context) error {
+	handle := self.handler(ctx)
+	return self.Dev.exchange(ctx, 0, nil, append(pairingEvents, keyEvents...), handle)
+}
+
+// Authenticate authenticates the connection, pairing when no link key is
+// stored, and answers the events of the pairing by itself. A failure of
+// the pairing is returned as HciError, such as HCI_PIN_OR_KEY_MISSING,
+// HCI_AUTHENTICATION_FAILURE or HCI_PAIRING_NOT_ALLOWED.
+//
+// Serve must not be running on the adapter meanwhile, as both would reply.
+func (self *Pairing) Authenticate(ctx context.Context, handle uint16) error {
+	events := self.handler(ctx)
+	return self.Dev.exchange(ctx, HCI_Authentication_Requested, []Parameter{
+		handle,
+	}, append([]int{EVT_AUTH_COMPLETE}, append(pairingEvents, keyEvents...)...), func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtAuthComplete); ok {
+			if ev.Handle != handle {
+				return false, nil
+			} else if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			return true, nil
+		}
+		return events(p)
+	})
+}
+
+func (self *Pairing) handler(ctx context.Context) func(EventPktParams) (bool, error) {
+	keys := &keyServer{
+		dev:     self.Dev,
+		store:   self.Store,
+		adapter: self.Adapter,
+		peers:   make(map[uint16]Bdaddr),
+	}
+	return func(p EventPktParams) (bool, error) {
+		switch ev := p.(type) {
+		case EvtIoCapabilityRequest:
+			if self.Agent == nil {
+				return false, self.Dev.command(HCI_IO_Capability_Request_Negative_Reply, []Parameter{
+					ev.Bdaddr,
+					uint8(HCI_PAIRING_NOT_ALLOWED),
+				})
+			}
+			var oob uint8
+			if self.OOB != nil {
+				if _, _, ok := self.OOB(ev.Bdaddr); ok {
+					oob = 1
+				}
+			}
+			return false, self.Dev.command(HCI_IO_Capability_Request_Reply, []Parameter{
+				ev.Bdaddr,
+				self.IOCap,
+				oob,
+				self.AuthReq,
+			})
+		case EvtIoCapabilityResponse:
+			self.lock.Lock()
+			if self.remote == nil {
+				self.remote = make(map[Bdaddr]EvtIoCapabilityResponse)
+			}
+			self.remote[ev.Bdaddr] = ev
+			self.lock.Unlock()
+		case EvtUserConfirmRequest:
+			justWorks := self.justWorks(ev.Bdaddr)
+			go self.reply(ev.Bdaddr, HCI_User_Confirmation_Request_Reply, HCI_User_Confirmation_Request_Negative_Reply, func() ([]Parameter, error) {
+				var ok bool
+				var err error
+				if self.Agent == nil {
+					return nil, HCI_PAIRING_NOT_ALLOWED
+				} else if justWorks {
+					ok, err = self.Agent.RequestAuthorization(ctx, ev.Bdaddr)
+				} else {
+					ok, err = self.Agent.RequestConfirmation(ctx, ev.Bdaddr, ev.Value)
+				}
+				if err == nil && !ok {
+					err = HCI_PAIRING_NOT_ALLOWED
+				}
+				return nil, err
+			})
+		case EvtUserPasskeyRequest:
+			go self.reply(ev.Bdaddr, HCI_User_Passkey_Request_Reply, HCI_User_Passkey_Request_Negative_Reply, func() ([]Parameter, error) {
+				if self.Agent == nil {
+					return nil, HCI_PAIRING_NOT_ALLOWED
+				} else if passkey, err := self.Agent.RequestPasskey(ctx, ev.Bdaddr); err != nil {
+					return nil, err
+				} else if passkey > 999999 {
+					return nil, fmt.Errorf("passkey out of range")
+				} else {
+					return []Parameter{passkey}, nil
+				}
+			})
+		case EvtUserPasskeyNotify:
+			if self.Agent != nil {
+				self.Agent.DisplayPasskey(ev.Bdaddr, ev.Passkey)
+			}
+		case EvtRemoteOobDataRequest:
+			if self.OOB != nil {
+				if c, r, ok := self.OOB(ev.Bdaddr); ok {
+					return false, self.Dev.command(HCI_Remote_OOB_Data_Request_Reply, []Parameter{ev.Bdaddr, c[:], r[:]})
+				}
+			}
+			return false, self.Dev.command(HCI_Remote_OOB_Data_Request_Negative_Reply, []Parameter{ev.Bdaddr})
+		case EvtPinCodeReq:
+			go self.reply(ev.Bdaddr, HCI_PIN_Code_Request_Reply, HCI_PIN_Code_Request_Negative_Reply, func() ([]Parameter, error) {
+				if self.Agent == nil {
+					return nil, HCI_PAIRING_NOT_ALLOWED
+				} else if pin, err := self.Agent.RequestPinCode(ctx, ev.Bdaddr); err != nil {
+					return nil, err
+				} else if len(pin) < 1 || len(pin) > 16 {
+					return nil, fmt.Errorf("pin length out of range")
+				} else {
+					code := make([]byte, 16)
+					copy(code, pin)
+					return []Parameter{uint8(len(pin)), code}, nil
+				}
+			})
+		case EvtSimplePairingComplete:
+			self.lock.Lock()
+			delete(self.remote, ev.Bdaddr)
+			self.lock.Unlock()
+			if self.OnComplete != nil {
+				var err error
+				if ev.Status != 0 {
+					err = HciError(ev.Status)
+				}
+				self.OnComplete(ev.Bdaddr, err)
+			}
+		default:
+			return keys.handle(p)
+		}
+		return false, nil
+	}
+}
+
+// justWorks tells whether the association model of the user confirmation
+// is just works, Vol 3, Part C, Section 5.2.2.6, where the number is not
+// meaningful to the user.
+func (self *Pairing) justWorks(addr Bdaddr) bool {
+	self.lock.Lock()
+	remote, ok := self.remote[addr]
+	self.lock.Unlock()
+	if self.IOCap == IO_CAP_DISPLAY_ONLY || self.IOCap == IO_CAP_NO_INPUT_OUTPUT {
+		return true
+	} else if !ok {
+		return false
+	}
+	return remote.IOCapability == IO_CAP_NO_INPUT_OUTPUT || remote.IOCapability == IO_CAP_DISPLAY_ONLY ||
+		(self.AuthReq&0x01 == 0 && remote.AuthReq&0x01 == 0)
+}
+
+// reply asks the agent and answers the request with the parameters
+// following the address, or rejects it.
+func (self *Pairing) reply(addr Bdaddr, opcode, negative OpCode, ask func() ([]Parameter, error)) {
+	if params, err := ask(); err != nil {
+		self.Dev.command(negative, []Parameter{addr})
+	} else {
+		self.Dev.command(opcode, append([]Parameter{addr}, params...))
+	}
+}
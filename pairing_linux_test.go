@@ -0,0 +1,39 @@
+package blugo
+
+import (
+	"testing"
+)
+
+func TestSspEvents(t *testing.T) {
+	addr := Bdaddr{1, 2, 3, 4, 5, 6}
+	for _, v := range []struct {
+		pkt    EventPkt
+		expect EventPktParams
+	}{
+		{EventPkt{Code: EVT_IO_CAPABILITY_RESPONSE, Params: []byte{1, 2, 3, 4, 5, 6, IO_CAP_DISPLAY_YESNO, 0, AUTH_REQ_GENERAL_BONDING_MITM}},
+			EvtIoCapabilityResponse{Bdaddr: addr, IOCapability: IO_CAP_DISPLAY_YESNO, AuthReq: AUTH_REQ_GENERAL_BONDING_MITM}},
+		{EventPkt{Code: EVT_USER_CONFIRM_REQUEST, Params: []byte{1, 2, 3, 4, 5, 6, 0x40, 0xE2, 0x01, 0x00}},
+			EvtUserConfirmRequest{Bdaddr: addr, Value: 123456}},
+		{EventPkt{Code: EVT_SIMPLE_PAIRING_COMPLETE, Params: []byte{uint8(HCI_AUTHENTICATION_FAILURE), 1, 2, 3, 4, 5, 6}},
+			EvtSimplePairingComplete{Status: uint8(HCI_AUTHENTICATION_FAILURE), Bdaddr: addr}},
+		{EventPkt{Code: EVT_PIN_CODE_REQ, Params: []byte{1, 2, 3, 4, 5, 6}},
+			EvtPinCodeReq{Bdaddr: addr}},
+	} {
+		if p, err := v.pkt.Parse(); err != nil {
+			t.Error(err)
+		} else if p != v.expect {
+			t.Errorf("got %+v", p)
+		}
+	}
+
+	p := &Pairing{IOCap: IO_CAP_DISPLAY_YESNO, AuthReq: AUTH_REQ_GENERAL_BONDING_MITM}
+	if p.justWorks(addr) {
+		t.Error("numeric comparison expected without the response")
+	}
+	p.remote = map[Bdaddr]EvtIoCapabilityResponse{
+		addr: {Bdaddr: addr, IOCapability: IO_CAP_NO_INPUT_OUTPUT},
+	}
+	if !p.justWorks(addr) {
+		t.Error("just works expected with a headless peer")
+	}
+}
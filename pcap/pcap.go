@@ -0,0 +1,462 @@
+// Package pcap reads and writes pcap and pcapng files of the Bluetooth link
+// types, to be opened in Wireshark. The writers put each packet in a single
+// write without buffering, so that they stream to a named pipe as well as
+// to a file.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Link types, https://www.tcpdump.org/linktypes.html
+const (
+	// H4 packet after the 4 octets of the direction, 0 for sent and 1 for
+	// received.
+	LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR = 201
+	// Linux monitor payload after the adapter index and the opcode of
+	// 2 octets each, the opcodes of btsnoop.MONITOR_*.
+	LINKTYPE_BLUETOOTH_LINUX_MONITOR = 254
+)
+
+// Pseudo header directions of LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR
+const (
+	DIRECTION_SENT     = 0
+	DIRECTION_RECEIVED = 1
+)
+
+// DEFAULT_SNAPLEN is the snapshot length that the writers declare.
+const DEFAULT_SNAPLEN = 0xFFFF + 5 + 4
+
+var ErrFormat = errors.New("pcap: invalid format")
+
+// The pseudo headers are big endian.
+
+// H4Packet prepends the direction pseudo header to the H4 packet.
+func H4Packet(received bool, h4 []byte) []byte {
+	ret := make([]byte, 4, 4+len(h4))
+	if received {
+		binary.BigEndian.PutUint32(ret, DIRECTION_RECEIVED)
+	}
+	return append(ret, h4...)
+}
+
+// ParseH4Packet returns the direction and the H4 packet.
+func ParseH4Packet(data []byte) (bool, []byte, error) {
+	if len(data) < 5 {
+		return false, nil, fmt.Errorf("pcap: too short")
+	}
+	return binary.BigEndian.Uint32(data)&DIRECTION_RECEIVED != 0, data[4:], nil
+}
+
+// MonitorPacket prepends the pseudo header of the adapter index and the
+// opcode to the payload.
+func MonitorPacket(index, opcode uint16, payload []byte) []byte {
+	ret := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint16(ret, index)
+	binary.BigEndian.PutUint16(ret[2:], opcode)
+	return append(ret, payload...)
+}
+
+// ParseMonitorPacket returns the adapter index, the opcode and the payload.
+func ParseMonitorPacket(data []byte) (uint16, uint16, []byte, error) {
+	if len(data) < 4 {
+		return 0, 0, nil, fmt.Errorf("pcap: too short")
+	}
+	return binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]), data[4:], nil
+}
+
+// Packet is a captured packet with the pseudo header of the link type.
+type Packet struct {
+	Time           time.Time
+	LinkType       uint32
+	OriginalLength uint32 // zero means len(Data) in writing
+	Data           []byte
+}
+
+// PacketWriter is either Writer or NgWriter.
+type PacketWriter interface {
+	WritePacket(t time.Time, data []byte) error
+}
+
+// pcap
+
+const (
+	MAGIC_USEC = 0xA1B2C3D4
+	MAGIC_NSEC = 0xA1B23C4D
+)
+
+// Writer writes pcap with microsecond timestamps, in little endian.
+type Writer struct {
+	w        io.Writer
+	LinkType uint32
+}
+
+// NewWriter writes the file header.
+func NewWriter(w io.Writer, linkType uint32) (*Writer, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr, MAGIC_USEC)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], DEFAULT_SNAPLEN)
+	binary.LittleEndian.PutUint32(hdr[20:], linkType)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, LinkType: linkType}, nil
+}
+
+func (self *Writer) WritePacket(t time.Time, data []byte) error {
+	return self.Write(Packet{Time: t, Data: data})
+}
+
+func (self *Writer) Write(pkt Packet) error {
+	length := pkt.OriginalLength
+	if length == 0 {
+		length = uint32(len(pkt.Data))
+	}
+	us := pkt.Time.UnixNano() / 1000
+	buf := make([]byte, 16, 16+len(pkt.Data))
+	binary.LittleEndian.PutUint32(buf, uint32(us/1000000))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(us%1000000))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(len(pkt.Data)))
+	binary.LittleEndian.PutUint32(buf[12:], length)
+	_, err := self.w.Write(append(buf, pkt.Data...))
+	return err
+}
+
+// pcapng, https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+
+// Block types
+const (
+	BLOCK_SECTION_HEADER  = 0x0A0D0D0A
+	BLOCK_INTERFACE       = 0x00000001
+	BLOCK_SIMPLE_PACKET   = 0x00000003
+	BLOCK_ENHANCED_PACKET = 0x00000006
+)
+
+const BYTE_ORDER_MAGIC = 0x1A2B3C4D
+
+// Options
+const (
+	OPTION_END          = 0
+	OPTION_SHB_USERAPPL = 4
+	OPTION_IF_TSRESOL   = 9
+)
+
+const (
+	ngMinimumBlockLen = 12
+	ngMaxBlockLen     = 1 << 24
+	ngDefaultTsresol  = 6 // microseconds
+)
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func ngBlock(typ uint32, body []byte) []byte {
+	n := 12 + pad4(len(body))
+	buf := make([]byte, n)
+	binary.LittleEndian.PutUint32(buf, typ)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(n))
+	copy(buf[8:], body)
+	binary.LittleEndian.PutUint32(buf[n-4:], uint32(n))
+	return buf
+}
+
+func ngOption(code uint16, value []byte) []byte {
+	buf := make([]byte, 4+pad4(len(value)))
+	binary.LittleEndian.PutUint16(buf, code)
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(value)))
+	copy(buf[4:], value)
+	return buf
+}
+
+// NgWriter writes pcapng of a section with an interface of the link type,
+// in little endian and with microsecond timestamps.
+type NgWriter struct {
+	w        io.Writer
+	LinkType uint32
+}
+
+// NewNgWriter writes the section header and the interface description.
+func NewNgWriter(w io.Writer, linkType uint32) (*NgWriter, error) {
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb, BYTE_ORDER_MAGIC)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], 0xFFFFFFFFFFFFFFFF) // unknown section length
+	shb = append(shb, ngOption(OPTION_SHB_USERAPPL, []byte("blugo"))...)
+	shb = append(shb, ngOption(OPTION_END, nil)...)
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb, uint16(linkType))
+	binary.LittleEndian.PutUint32(idb[4:], DEFAULT_SNAPLEN)
+	idb = append(idb, ngOption(OPTION_IF_TSRESOL, []byte{ngDefaultTsresol})...)
+	idb = append(idb, ngOption(OPTION_END, nil)...)
+
+	if _, err := w.Write(append(ngBlock(BLOCK_SECTION_HEADER, shb), ngBlock(BLOCK_INTERFACE, idb)...)); err != nil {
+		return nil, err
+	}
+	return &NgWriter{w: w, LinkType: linkType}, nil
+}
+
+func (self *NgWriter) WritePacket(t time.Time, data []byte) error {
+	return self.Write(Packet{Time: t, Data: data})
+}
+
+func (self *NgWriter) Write(pkt Packet) error {
+	length := pkt.OriginalLength
+	if length == 0 {
+		length = uint32(len(pkt.Data))
+	}
+	ts := uint64(pkt.Time.UnixNano() / 1000)
+	body := make([]byte, 20, 20+len(pkt.Data))
+	binary.LittleEndian.PutUint32(body, 0) // interface
+	binary.LittleEndian.PutUint32(body[4:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(pkt.Data)))
+	binary.LittleEndian.PutUint32(body[16:], length)
+	_, err := self.w.Write(ngBlock(BLOCK_ENHANCED_PACKET, append(body, pkt.Data...)))
+	return err
+}
+
+// Reader reads either pcap or pcapng, telling by the magic.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+
+	// pcap
+	linkType uint32
+	nsec     bool
+
+	// pcapng interfaces of the section
+	interfaces []ngInterface
+}
+
+type ngInterface struct {
+	linkType uint32
+	units    uint64 // timestamp units per second
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	self := &Reader{r: bufio.NewReader(r)}
+	magic, err := self.r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(magic) == BLOCK_SECTION_HEADER {
+		// the byte order comes in the block
+		self.ng = true
+		if err := self.readBlocks(); err != nil {
+			return nil, err
+		}
+		return self, nil
+	}
+
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(self.r, hdr); err != nil {
+		return nil, ErrFormat
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(hdr) {
+		case MAGIC_USEC:
+			self.order = order
+		case MAGIC_NSEC:
+			self.order = order
+			self.nsec = true
+		}
+	}
+	if self.order == nil {
+		return nil, ErrFormat
+	}
+	self.linkType = self.order.Uint32(hdr[20:]) & 0x0FFFFFFF
+	return self, nil
+}
+
+// LinkType returns the link type of the file, or of the first interface of
+// pcapng.
+func (self *Reader) LinkType() uint32 {
+	if self.ng {
+		if len(self.interfaces) > 0 {
+			return self.interfaces[0].linkType
+		}
+		return 0
+	}
+	return self.linkType
+}
+
+// Next returns the next packet, and io.EOF at the end of the file.
+func (self *Reader) Next() (Packet, error) {
+	if self.ng {
+		return self.nextNg()
+	}
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(self.r, hdr); err == io.ErrUnexpectedEOF {
+		return Packet{}, ErrFormat
+	} else if err != nil {
+		return Packet{}, err
+	}
+	sec := int64(self.order.Uint32(hdr))
+	frac := int64(self.order.Uint32(hdr[4:]))
+	if !self.nsec {
+		frac *= 1000
+	}
+	captured := self.order.Uint32(hdr[8:])
+	if captured > ngMaxBlockLen {
+		return Packet{}, ErrFormat
+	}
+	pkt := Packet{
+		Time:           time.Unix(sec, frac),
+		LinkType:       self.linkType,
+		OriginalLength: self.order.Uint32(hdr[12:]),
+		Data:           make([]byte, captured),
+	}
+	if _, err := io.ReadFull(self.r, pkt.Data); err != nil {
+		return Packet{}, ErrFormat
+	}
+	return pkt, nil
+}
+
+// readBlock returns the type and the body of the next block.
+func (self *Reader) readBlock() (uint32, []byte, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(self.r, hdr); err == io.ErrUnexpectedEOF {
+		return 0, nil, ErrFormat
+	} else if err != nil {
+		return 0, nil, err
+	}
+	typ := binary.LittleEndian.Uint32(hdr)
+	if typ == BLOCK_SECTION_HEADER {
+		// the byte order of the section follows
+		magic, err := self.r.Peek(4)
+		if err != nil {
+			return 0, nil, ErrFormat
+		}
+		switch binary.LittleEndian.Uint32(magic) {
+		case BYTE_ORDER_MAGIC:
+			self.order = binary.LittleEndian
+		case 0x4D3C2B1A:
+			self.order = binary.BigEndian
+		default:
+			return 0, nil, ErrFormat
+		}
+		self.interfaces = nil
+	} else if self.order == nil {
+		return 0, nil, ErrFormat
+	}
+	typ = self.order.Uint32(hdr)
+	n := self.order.Uint32(hdr[4:])
+	if n < ngMinimumBlockLen || n%4 != 0 || n > ngMaxBlockLen {
+		return 0, nil, ErrFormat
+	}
+	body := make([]byte, n-8)
+	if _, err := io.ReadFull(self.r, body); err != nil {
+		return 0, nil, ErrFormat
+	}
+	return typ, body[:len(body)-4], nil
+}
+
+// readBlocks reads the blocks up to the first packet, which is left
+// unread.
+func (self *Reader) readBlocks() error {
+	for {
+		if data, err := self.r.Peek(4); err != nil {
+			return err
+		} else if t := binary.LittleEndian.Uint32(data); self.order != nil &&
+			(self.order.Uint32(data) == BLOCK_ENHANCED_PACKET || self.order.Uint32(data) == BLOCK_SIMPLE_PACKET) {
+			return nil
+		} else if self.order == nil && t != BLOCK_SECTION_HEADER {
+			return ErrFormat
+		}
+		if typ, body, err := self.readBlock(); err != nil {
+			return err
+		} else if typ == BLOCK_INTERFACE {
+			if len(body) < 8 {
+				return ErrFormat
+			}
+			iface := ngInterface{
+				linkType: uint32(self.order.Uint16(body)),
+				units:    1000000,
+			}
+			for opts := body[8:]; len(opts) >= 4; {
+				code := self.order.Uint16(opts)
+				n := int(self.order.Uint16(opts[2:]))
+				if code == OPTION_END || len(opts) < 4+n {
+					break
+				}
+				if code == OPTION_IF_TSRESOL && n >= 1 {
+					iface.units = tsresol(opts[4])
+				}
+				opts = opts[4+pad4(n):]
+			}
+			self.interfaces = append(self.interfaces, iface)
+		}
+	}
+}
+
+func tsresol(v uint8) uint64 {
+	units := uint64(1)
+	for i := uint8(0); i < v&0x7F && units < 1e18; i++ {
+		if v&0x80 != 0 {
+			units *= 2
+		} else {
+			units *= 10
+		}
+	}
+	return units
+}
+
+func (self *Reader) nextNg() (Packet, error) {
+	if err := self.readBlocks(); err != nil {
+		return Packet{}, err
+	}
+	typ, body, err := self.readBlock()
+	if err != nil {
+		return Packet{}, err
+	}
+	switch typ {
+	case BLOCK_ENHANCED_PACKET:
+		if len(body) < 20 {
+			return Packet{}, ErrFormat
+		}
+		id := self.order.Uint32(body)
+		captured := self.order.Uint32(body[12:])
+		if int(id) >= len(self.interfaces) || int(captured) > len(body)-20 {
+			return Packet{}, ErrFormat
+		}
+		iface := self.interfaces[id]
+		ts := uint64(self.order.Uint32(body[4:]))<<32 | uint64(self.order.Uint32(body[8:]))
+		frac := ts % iface.units
+		if iface.units <= 1e9 {
+			frac = frac * 1e9 / iface.units
+		} else {
+			frac = frac / (iface.units / 1e9)
+		}
+		return Packet{
+			Time:           time.Unix(int64(ts/iface.units), int64(frac)),
+			LinkType:       iface.linkType,
+			OriginalLength: self.order.Uint32(body[16:]),
+			Data:           body[20 : 20+captured],
+		}, nil
+	default: // BLOCK_SIMPLE_PACKET
+		if len(body) < 4 || len(self.interfaces) == 0 {
+			return Packet{}, ErrFormat
+		}
+		length := self.order.Uint32(body)
+		data := body[4:]
+		if int(length) < len(data) {
+			data = data[:length]
+		}
+		return Packet{
+			LinkType:       self.interfaces[0].linkType,
+			OriginalLength: length,
+			Data:           data,
+		}, nil
+	}
+}
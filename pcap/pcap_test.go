@@ -0,0 +1,113 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPseudoHeader(t *testing.T) {
+	data := H4Packet(true, []byte{0x04, 0x0e, 0x00})
+	if hex.EncodeToString(data) != "00000001040e00" {
+		t.Errorf("got %x", data)
+	}
+	if received, h4, err := ParseH4Packet(data); err != nil || !received || len(h4) != 3 {
+		t.Errorf("got %v %x %v", received, h4, err)
+	}
+	data = MonitorPacket(1, 3, []byte{0x0e, 0x00})
+	if hex.EncodeToString(data) != "000100030e00" {
+		t.Errorf("got %x", data)
+	}
+	if index, opcode, payload, err := ParseMonitorPacket(data); err != nil || index != 1 || opcode != 3 || len(payload) != 2 {
+		t.Errorf("got %d %d %x %v", index, opcode, payload, err)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	packets := [][]byte{
+		H4Packet(false, []byte{0x01, 0x03, 0x0c, 0x00}),
+		H4Packet(true, []byte{0x04, 0x0e, 0x04, 0x01, 0x03, 0x0c, 0x00}),
+		MonitorPacket(0, 12, []byte("note")),
+	}
+	for _, ng := range []bool{false, true} {
+		var buf bytes.Buffer
+		var w PacketWriter
+		var err error
+		if ng {
+			w, err = NewNgWriter(&buf, LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR)
+		} else {
+			w, err = NewWriter(&buf, LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range packets {
+			if err := w.WritePacket(base.Add(time.Duration(i)*time.Second), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ng && buf.Len()%4 != 0 {
+			t.Error("blocks not aligned")
+		}
+
+		data := buf.Bytes()
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil || r.LinkType() != LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR {
+			t.Fatal(ng, err)
+		}
+		for i, p := range packets {
+			if pkt, err := r.Next(); err != nil {
+				t.Fatal(ng, err)
+			} else if !bytes.Equal(pkt.Data, p) || int(pkt.OriginalLength) != len(p) || !pkt.Time.Equal(base.Add(time.Duration(i)*time.Second)) {
+				t.Errorf("%v got %v", ng, pkt)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%v got %v", ng, err)
+		}
+		r, _ = NewReader(bytes.NewReader(data[:len(data)-2]))
+		for err == nil {
+			_, err = r.Next()
+		}
+		if err != ErrFormat {
+			t.Errorf("%v truncated file got %v", ng, err)
+		}
+	}
+}
+
+func TestReadBigEndian(t *testing.T) {
+	// nanosecond pcap of another byte order
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{MAGIC_NSEC, 0x00020004, 0, 0, 0xFFFF, LINKTYPE_BLUETOOTH_LINUX_MONITOR})
+	binary.Write(&buf, binary.BigEndian, []uint32{1, 500, 5, 5})
+	buf.Write(MonitorPacket(0, 3, []byte{0x0e}))
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt, err := r.Next(); err != nil || pkt.LinkType != LINKTYPE_BLUETOOTH_LINUX_MONITOR || !pkt.Time.Equal(time.Unix(1, 500)) {
+		t.Errorf("got %v %v", pkt, err)
+	}
+
+	// pcapng of nanosecond timestamps
+	buf.Reset()
+	binary.Write(&buf, binary.BigEndian, []uint32{BLOCK_SECTION_HEADER, 28, BYTE_ORDER_MAGIC, 0x00010000, 0xFFFFFFFF, 0xFFFFFFFF, 28})
+	binary.Write(&buf, binary.BigEndian, []uint32{BLOCK_INTERFACE, 28, LINKTYPE_BLUETOOTH_LINUX_MONITOR << 16, 0})
+	binary.Write(&buf, binary.BigEndian, []uint16{OPTION_IF_TSRESOL, 1})
+	binary.Write(&buf, binary.BigEndian, []uint32{0x09000000, 28})
+	binary.Write(&buf, binary.BigEndian, []uint32{BLOCK_ENHANCED_PACKET, 40, 0, 0, 1000000123, 5, 5})
+	buf.Write(MonitorPacket(0, 3, []byte{0x0e}))
+	binary.Write(&buf, binary.BigEndian, []uint8{0, 0, 0})
+	binary.Write(&buf, binary.BigEndian, []uint32{40})
+	r, err = NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt, err := r.Next(); err != nil || pkt.LinkType != LINKTYPE_BLUETOOTH_LINUX_MONITOR || !pkt.Time.Equal(time.Unix(1, 123)) {
+		t.Errorf("got %v %v", pkt, err)
+	}
+}
@@ -0,0 +1,17 @@
+// +build linux
+
+package pcap
+
+import (
+	"os"
+	"syscall"
+)
+
+// OpenPipe makes the named pipe unless it exists, and opens it for
+// writing, which waits for a reader such as "wireshark -k -i path".
+func OpenPipe(path string) (*os.File, error) {
+	if err := syscall.Mkfifo(path, 0600); err != nil && err != syscall.EEXIST {
+		return nil, &os.PathError{Op: "mkfifo", Path: path, Err: err}
+	}
+	return os.OpenFile(path, os.O_WRONLY, 0)
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package blugo
+
+import (
+	"bytes"
+	"context"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.1.19 - 7.1.25
+// Information of the remote devices.
+
+// RemoteName asks the user friendly name of the remote device, paging it
+// unless connected. opts gives the page scan repetition mode and the clock
+// offset from the inquiry, and may be nil.
+func (self HciDev) RemoteName(ctx context.Context, addr Bdaddr, opts *ConnectOptions) (string, error) {
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+	rep := opts.PageScanRepMode
+	if rep == 0 {
+		rep = 0x02
+	}
+	var name string
+	err := self.exchange(ctx, HCI_Remote_Name_Request, []Parameter{
+		addr,
+		rep,
+		uint8(0), // reserved
+		opts.ClockOffset,
+	}, []int{EVT_REMOTE_NAME_REQ_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtRemoteNameReqComplete); ok && ev.Bdaddr == addr {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			name = ev.Name
+			if i := bytes.IndexByte([]byte(name), 0); i >= 0 {
+				name = name[:i]
+			}
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		self.Request(HCI_Remote_Name_Request_Cancel, addr)
+	}
+	return name, err
+}
+
+func (self HciDev) ReadRemoteFeatures(ctx context.Context, handle uint16) (LmpFeatures, error) {
+	var features LmpFeatures
+	err := self.exchange(ctx, HCI_Read_Remote_Supported_Features, []Parameter{
+		handle,
+	}, []int{EVT_READ_REMOTE_FEATURES_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtReadRemoteFeaturesComplete); ok && ev.Handle == handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			features = ev.Features
+			return true, nil
+		}
+		return false, nil
+	})
+	return features, err
+}
+
+func (self HciDev) ReadRemoteVersion(ctx context.Context, handle uint16) (EvtReadRemoteVersionComplete, error) {
+	var version EvtReadRemoteVersionComplete
+	err := self.exchange(ctx, HCI_Read_Remote_Version_Information, []Parameter{
+		handle,
+	}, []int{EVT_READ_REMOTE_VERSION_COMPLETE}, func(p EventPktParams) (bool, error) {
+		if ev, ok := p.(EvtReadRemoteVersionComplete); ok && ev.Handle == handle {
+			if ev.Status != 0 {
+				return true, HciError(ev.Status)
+			}
+			version = ev
+			return true, nil
+		}
+		return false, nil
+	})
+	return version, err
+}
+
+// ReadLinkQuality reads the link quality of the connection, from 0 to 255
+// in the measure of the controller.
+func (self HciDev) ReadLinkQuality(handle uint16) (uint8, error) {
+	if ret, err := self.Request(HCI_Read_Link_Quality, handle); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return ret[2].(uint8), nil
+	}
+}
+
+// ConnHandle returns the handle of the ACL connection to the remote device.
+func (self HciDev) ConnHandle(addr Bdaddr) (uint16, error) {
+	if info, err := self.getConnInfo(addr); err != nil {
+		return 0, err
+	} else {
+		return info.Handle, nil
+	}
+}
@@ -0,0 +1,65 @@
+// +build linux
+
+package blugo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.8.38 - 7.8.45
+// The resolving list of the controller. The list can not be modified while
+// address resolution is enabled and advertising, scanning or initiating is
+// in progress; disable the resolution first.
+
+// AddToResolvingList adds the peer identity with the IRKs. Zero IRKs mean
+// that the side does not use resolvable private addresses.
+func (self HciDev) AddToResolvingList(peer LeAddr, peerIrk, localIrk [16]byte) error {
+	return self.requestStatus(HCI_LE_Add_Device_To_Resolving_List,
+		peer.Type,
+		peer.Addr,
+		peerIrk[:],
+		localIrk[:],
+	)
+}
+
+func (self HciDev) RemoveFromResolvingList(peer LeAddr) error {
+	return self.requestStatus(HCI_LE_Remove_Device_From_Resolving_List, peer.Type, peer.Addr)
+}
+
+func (self HciDev) ClearResolvingList() error {
+	return self.requestStatus(HCI_LE_Clear_Resolving_List)
+}
+
+// ResolvingListSize returns the number of the entries the controller can
+// hold.
+func (self HciDev) ResolvingListSize() (int, error) {
+	if ret, err := self.Request(HCI_LE_Read_Resolving_List_Size); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return int(ret[1].(uint8)), nil
+	}
+}
+
+// SetAddressResolution enables or disables the resolution in the
+// controller.
+func (self HciDev) SetAddressResolution(enable bool) error {
+	var v uint8
+	if enable {
+		v = 1
+	}
+	return self.requestStatus(HCI_LE_Set_Address_Resolution_Enable, v)
+}
+
+// SetRpaTimeout sets the interval the controller regenerates the local
+// resolvable private addresses, in the range of 1 sec to about 11.5 hours.
+// The default is 15 minutes.
+func (self HciDev) SetRpaTimeout(timeout time.Duration) error {
+	secs := timeout / time.Second
+	if secs < 1 || secs > 0xA1B8 {
+		return fmt.Errorf("rpa timeout out of range")
+	}
+	return self.requestStatus(HCI_LE_Set_Resolvable_Private_Address_Timeout, uint16(secs))
+}
@@ -0,0 +1,308 @@
+package rfcomm
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	stateConnecting = iota
+	stateOpen
+	stateClosed
+)
+
+// Conn is a data link connection, which is a byte stream with the modem
+// status signals.
+type Conn struct {
+	session  *Session
+	dlci     uint8
+	state    int
+	listener *Listener
+
+	cfc       bool
+	txMtu     int
+	txCredits int
+	rxCredits int // credits the peer holds
+	consumed  int // credits to be returned to the peer
+
+	localSignals  uint8
+	remoteSignals uint8
+	lineStatus    uint8
+
+	rx        [][]byte
+	rdeadline time.Time
+	wdeadline time.Time
+	wlock     sync.Mutex
+}
+
+var _ net.Conn = &Conn{}
+
+func newConn(session *Session, dlci uint8) *Conn {
+	return &Conn{
+		session:      session,
+		dlci:         dlci,
+		txMtu:        DEFAULT_MTU,
+		localSignals: MSC_RTC | MSC_RTR | MSC_DV,
+	}
+}
+
+// closeLocked must be called with session lock held.
+func (self *Conn) closeLocked() {
+	self.state = stateClosed
+	self.session.cond.Broadcast()
+}
+
+// receiveLocked must be called with session lock held.
+func (self *Conn) receiveLocked(f frame) {
+	if self.state != stateOpen {
+		return
+	}
+	info := f.info
+	if self.cfc && f.pf {
+		if len(info) == 0 {
+			return
+		}
+		self.txCredits += int(info[0])
+		info = info[1:]
+		self.session.cond.Broadcast()
+	}
+	if len(info) > 0 {
+		if self.cfc {
+			self.rxCredits--
+		}
+		self.rx = append(self.rx, info)
+		self.session.cond.Broadcast()
+	}
+}
+
+// wait waits on session cond until deadline, with session lock held. It
+// returns false when the deadline passed.
+func (self *Conn) wait(deadline time.Time) bool {
+	s := self.session
+	if deadline.IsZero() {
+		s.cond.Wait()
+		return true
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return false
+	}
+	timer := time.AfterFunc(d, func() {
+		s.lock.Lock()
+		s.cond.Broadcast()
+		s.lock.Unlock()
+	})
+	s.cond.Wait()
+	timer.Stop()
+	return true
+}
+
+func (self *Conn) Read(b []byte) (int, error) {
+	s := self.session
+	s.lock.Lock()
+	for len(self.rx) == 0 && self.state == stateOpen {
+		if !self.wait(self.rdeadline) {
+			s.lock.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	if len(self.rx) == 0 {
+		s.lock.Unlock()
+		return 0, io.EOF
+	}
+	n := copy(b, self.rx[0])
+	if n < len(self.rx[0]) {
+		self.rx[0] = self.rx[0][n:]
+		s.lock.Unlock()
+		return n, nil
+	}
+	self.rx = self.rx[1:]
+
+	var credits int
+	if self.cfc && self.state == stateOpen {
+		self.consumed++
+		if self.consumed >= (DEFAULT_CREDITS+1)/2 || self.rxCredits <= 0 {
+			credits = self.consumed
+			self.rxCredits += credits
+			self.consumed = 0
+		}
+	}
+	s.lock.Unlock()
+
+	if credits > 0 {
+		s.send(frame{
+			dlci:    self.dlci,
+			cr:      s.cr(),
+			control: UIH,
+			pf:      true,
+			info:    []byte{uint8(credits)},
+		})
+	}
+	return n, nil
+}
+
+func (self *Conn) Write(b []byte) (int, error) {
+	s := self.session
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+
+	for off := 0; off < len(b); {
+		s.lock.Lock()
+		for self.state == stateOpen && self.blockedLocked() {
+			if !self.wait(self.wdeadline) {
+				s.lock.Unlock()
+				return off, os.ErrDeadlineExceeded
+			}
+		}
+		if self.state != stateOpen {
+			s.lock.Unlock()
+			return off, io.ErrClosedPipe
+		}
+		end := off + self.txMtu
+		if end > len(b) {
+			end = len(b)
+		}
+		if self.cfc {
+			self.txCredits--
+		}
+		s.lock.Unlock()
+
+		if err := s.send(frame{
+			dlci:    self.dlci,
+			cr:      s.cr(),
+			control: UIH,
+			info:    b[off:end],
+		}); err != nil {
+			return off, err
+		}
+		off = end
+	}
+	return len(b), nil
+}
+
+// blockedLocked tells whether the flow control stops sending.
+func (self *Conn) blockedLocked() bool {
+	if self.cfc {
+		return self.txCredits <= 0
+	}
+	return self.session.fcOff || self.remoteSignals&MSC_FC != 0
+}
+
+// Close disconnects the data link connection.
+func (self *Conn) Close() error {
+	s := self.session
+	s.lock.Lock()
+	state := self.state
+	self.closeLocked()
+	s.lock.Unlock()
+	if state != stateOpen {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := s.frameExchange(ctx, self.dlci, DISC)
+
+	s.lock.Lock()
+	if s.dlcs[self.dlci] == self {
+		delete(s.dlcs, self.dlci)
+	}
+	s.lock.Unlock()
+	return err
+}
+
+// SetModemStatus sends the local V.24 signals, MSC_*, by Modem Status
+// Command. MSC_FC stops the peer sending unless credit based flow control
+// is in use.
+func (self *Conn) SetModemStatus(ctx context.Context, signals uint8) error {
+	s := self.session
+	s.lock.Lock()
+	self.localSignals = signals &^ 1
+	s.lock.Unlock()
+	_, err := s.mccExchange(ctx, MCC_MSC, []byte{1 | 2 | self.dlci<<2, 1 | signals})
+	return err
+}
+
+// ModemStatus returns the V.24 signals, MSC_*, that the peer sent last.
+func (self *Conn) ModemStatus() uint8 {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return self.remoteSignals
+}
+
+// LineStatus returns the line status that the peer sent last by Remote
+// Line Status command.
+func (self *Conn) LineStatus() uint8 {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return self.lineStatus
+}
+
+// MTU returns the max frame payload size to send.
+func (self *Conn) MTU() int {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return self.txMtu
+}
+
+func (self *Conn) LocalAddr() net.Addr {
+	addr := Addr{Channel: self.dlci >> 1}
+	if link, ok := self.session.link.(interface {
+		LocalAddr() net.Addr
+	}); ok {
+		addr.Link = link.LocalAddr()
+	}
+	return addr
+}
+
+// RemoteAddr tells the peer by the remote end of the L2CAP channel, as the
+// server channel is the same on both ends.
+func (self *Conn) RemoteAddr() net.Addr {
+	addr := Addr{Channel: self.dlci >> 1}
+	if link, ok := self.session.link.(interface {
+		RemoteAddr() net.Addr
+	}); ok {
+		addr.Link = link.RemoteAddr()
+	}
+	return addr
+}
+
+func (self *Conn) SetDeadline(t time.Time) error {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	self.rdeadline = t
+	self.wdeadline = t
+	s.cond.Broadcast()
+	return nil
+}
+
+func (self *Conn) SetReadDeadline(t time.Time) error {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	self.rdeadline = t
+	s.cond.Broadcast()
+	return nil
+}
+
+func (self *Conn) SetWriteDeadline(t time.Time) error {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	self.wdeadline = t
+	s.cond.Broadcast()
+	return nil
+}
+
+// Session returns the multiplexer session that the connection belongs to.
+func (self *Conn) Session() *Session {
+	return self.session
+}
@@ -0,0 +1,230 @@
+// Package rfcomm implements RFCOMM, the TS 07.10 multiplexer with the
+// Bluetooth adaptations, over an L2CAP channel such as *l2cap.Channel.
+// Credit based flow control is negotiated, and aggregate flow control by
+// FCon/FCoff is honored when the peer refuses it.
+//
+// Bluetooth RFCOMM specification 1.2, ETSI TS 07.10
+package rfcomm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// PSM of RFCOMM.
+const PSM = 0x0003
+
+// Frame types, control field without P/F bit
+const (
+	SABM = 0x2F
+	UA   = 0x63
+	DM   = 0x0F
+	DISC = 0x43
+	UIH  = 0xEF
+	PF   = 0x10
+)
+
+// Multiplexer control command types, TS 07.10 Section 5.4.6.3
+const (
+	MCC_NSC   = 0x04
+	MCC_TEST  = 0x08
+	MCC_PSC   = 0x10
+	MCC_RLS   = 0x14
+	MCC_FCOFF = 0x18
+	MCC_PN    = 0x20
+	MCC_RPN   = 0x24
+	MCC_FCON  = 0x28
+	MCC_CLD   = 0x30
+	MCC_MSC   = 0x38
+)
+
+// V.24 signals of Modem Status Command
+const (
+	MSC_FC  = 0x02
+	MSC_RTC = 0x04
+	MSC_RTR = 0x08
+	MSC_IC  = 0x40
+	MSC_DV  = 0x80
+)
+
+// Convergence layer of Parameter Negotiation, request and response of
+// credit based flow control.
+const (
+	PN_CFC_REQ = 0xF0
+	PN_CFC_RSP = 0xE0
+)
+
+const (
+	MAX_CHANNEL     = 30
+	DEFAULT_MTU     = 127
+	MAX_MTU         = 32767
+	DEFAULT_CREDITS = 7
+	DEFAULT_TIMEOUT = 20 * time.Second // T1 and T2
+)
+
+// Addr is the address of a data link connection. Channel is the server
+// channel, which is the same on both ends; Link tells the end of the
+// underlying L2CAP channel when the link has one.
+type Addr struct {
+	Channel uint8
+	Link    net.Addr
+}
+
+func (self Addr) Network() string {
+	return "rfcomm"
+}
+
+func (self Addr) String() string {
+	if self.Link != nil {
+		return fmt.Sprintf("%v,channel=%d", self.Link, self.Channel)
+	}
+	return fmt.Sprintf("channel=%d", self.Channel)
+}
+
+var crcTable [256]uint8
+
+func init() {
+	for i := range crcTable {
+		c := uint8(i)
+		for j := 0; j < 8; j++ {
+			if c&1 != 0 {
+				c = (c >> 1) ^ 0xE0
+			} else {
+				c >>= 1
+			}
+		}
+		crcTable[i] = c
+	}
+}
+
+// fcs calculates the frame check sequence, TS 07.10 Annex B.
+func fcs(data []byte) uint8 {
+	crc := uint8(0xFF)
+	for _, b := range data {
+		crc = crcTable[crc^b]
+	}
+	return 0xFF - crc
+}
+
+type frame struct {
+	dlci    uint8
+	cr      bool
+	control uint8 // without P/F
+	pf      bool
+	info    []byte
+}
+
+func putLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{uint8(n<<1) | 1}
+	}
+	return []byte{uint8(n << 1), uint8(n >> 7)}
+}
+
+func (self frame) MarshalBinary() ([]byte, error) {
+	addr := 1 | self.dlci<<2
+	if self.cr {
+		addr |= 2
+	}
+	ctrl := self.control
+	if self.pf {
+		ctrl |= PF
+	}
+	if len(self.info) > MAX_MTU+1 {
+		return nil, fmt.Errorf("rfcomm: frame too long")
+	}
+	ret := append([]byte{addr, ctrl}, putLength(len(self.info))...)
+	hdr := len(ret)
+	if self.control == UIH {
+		hdr = 2
+	}
+	ret = append(ret, self.info...)
+	return append(ret, fcs(ret[:hdr])), nil
+}
+
+func (self *frame) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("rfcomm: too short")
+	}
+	self.dlci = data[0] >> 2
+	self.cr = data[0]&2 != 0
+	self.control = data[1] &^ PF
+	self.pf = data[1]&PF != 0
+
+	length := int(data[2] >> 1)
+	hdr := 3
+	if data[2]&1 == 0 {
+		length |= int(data[3]) << 7
+		hdr = 4
+	}
+	if len(data) != hdr+length+1 {
+		return fmt.Errorf("rfcomm: length mismatch")
+	}
+	covered := hdr
+	if self.control == UIH {
+		covered = 2
+	}
+	if fcs(data[:covered]) != data[len(data)-1] {
+		return fmt.Errorf("rfcomm: fcs error")
+	}
+	self.info = data[hdr : hdr+length]
+	return nil
+}
+
+func marshalMcc(typ uint8, cr bool, values []byte) []byte {
+	t := 1 | typ<<2
+	if cr {
+		t |= 2
+	}
+	return append(append([]byte{t}, putLength(len(values))...), values...)
+}
+
+func unmarshalMcc(info []byte) (uint8, bool, []byte, error) {
+	if len(info) < 2 {
+		return 0, false, nil, fmt.Errorf("rfcomm: too short")
+	}
+	typ := info[0] >> 2
+	cr := info[0]&2 != 0
+	length := int(info[1] >> 1)
+	hdr := 2
+	if info[1]&1 == 0 {
+		if len(info) < 3 {
+			return 0, false, nil, fmt.Errorf("rfcomm: too short")
+		}
+		length |= int(info[2]) << 7
+		hdr = 3
+	}
+	if len(info) < hdr+length {
+		return 0, false, nil, fmt.Errorf("rfcomm: too short")
+	}
+	return typ, cr, info[hdr : hdr+length], nil
+}
+
+// pn is the values of Parameter Negotiation.
+type pn struct {
+	dlci     uint8
+	cl       uint8
+	priority uint8
+	mtu      uint16
+	credits  uint8
+}
+
+func (self pn) MarshalBinary() ([]byte, error) {
+	ret := []byte{self.dlci, self.cl, self.priority, 0, 0, 0, 0, self.credits & 7}
+	binary.LittleEndian.PutUint16(ret[4:], self.mtu)
+	return ret, nil
+}
+
+func (self *pn) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return fmt.Errorf("rfcomm: too short")
+	}
+	self.dlci = data[0] & 0x3F
+	self.cl = data[1] & 0xF0
+	self.priority = data[2] & 0x3F
+	self.mtu = binary.LittleEndian.Uint16(data[4:])
+	self.credits = data[7] & 7
+	return nil
+}
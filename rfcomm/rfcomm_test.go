@@ -0,0 +1,181 @@
+package rfcomm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// packetPipe keeps the write boundaries, like an L2CAP channel.
+type packetPipe struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   *sync.Once
+	local  pipeAddr
+	remote pipeAddr
+}
+
+type pipeAddr string
+
+func (self pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (self pipeAddr) String() string {
+	return string(self)
+}
+
+func pipePair() (*packetPipe, *packetPipe) {
+	a := make(chan []byte, 64)
+	b := make(chan []byte, 64)
+	closed := make(chan struct{})
+	once := &sync.Once{}
+	return &packetPipe{in: a, out: b, closed: closed, once: once, local: "a", remote: "b"},
+		&packetPipe{in: b, out: a, closed: closed, once: once, local: "b", remote: "a"}
+}
+
+func (self *packetPipe) LocalAddr() net.Addr {
+	return self.local
+}
+
+func (self *packetPipe) RemoteAddr() net.Addr {
+	return self.remote
+}
+
+func (self *packetPipe) Read(b []byte) (int, error) {
+	select {
+	case p := <-self.in:
+		return copy(b, p), nil
+	case <-self.closed:
+		return 0, io.EOF
+	}
+}
+
+func (self *packetPipe) Write(b []byte) (int, error) {
+	select {
+	case self.out <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-self.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (self *packetPipe) Close() error {
+	self.once.Do(func() { close(self.closed) })
+	return nil
+}
+
+func TestFrame(t *testing.T) {
+	for _, c := range []struct {
+		f    frame
+		data []byte
+	}{
+		{frame{cr: true, control: SABM, pf: true}, []byte{0x03, 0x3F, 0x01, 0x1C}},
+		{frame{cr: true, control: UA, pf: true}, []byte{0x03, 0x73, 0x01, 0xD7}},
+		{frame{cr: true, control: DISC, pf: true}, []byte{0x03, 0x53, 0x01, 0xFD}},
+	} {
+		if data, err := c.f.MarshalBinary(); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(data, c.data) {
+			t.Errorf("got %x, expected %x", data, c.data)
+		}
+		var f frame
+		if err := f.UnmarshalBinary(c.data); err != nil {
+			t.Error(err)
+		} else if f.control != c.f.control || f.dlci != c.f.dlci || f.cr != c.f.cr || !f.pf {
+			t.Errorf("got %v", f)
+		}
+	}
+
+	long := frame{dlci: 4, control: UIH, info: make([]byte, 200)}
+	data, _ := long.MarshalBinary()
+	var f frame
+	if err := f.UnmarshalBinary(data); err != nil || len(f.info) != 200 {
+		t.Errorf("long frame %d %v", len(f.info), err)
+	}
+	data[len(data)-1] ^= 1
+	if err := f.UnmarshalBinary(data); err == nil {
+		t.Error("expected fcs error")
+	}
+}
+
+func sessionPair(t *testing.T) (*Session, *Session) {
+	a, b := pipePair()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	responder, err := NewSession(ctx, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator, err := NewSession(ctx, a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return initiator, responder
+}
+
+func TestSession(t *testing.T) {
+	initiator, responder := sessionPair(t)
+	defer initiator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	l, err := responder.Listen(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := initiator.Dial(ctx, 4); err != ErrConnRefused {
+		t.Errorf("expected refusal, got %v", err)
+	}
+	c, err := initiator.Dial(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RemoteAddr() != acc.LocalAddr() || c.LocalAddr() != acc.RemoteAddr() {
+		t.Errorf("addr %v %v", c.RemoteAddr(), acc.LocalAddr())
+	} else if s := c.RemoteAddr().String(); s != "b,channel=3" {
+		t.Errorf("remote addr %s", s)
+	}
+	if c.ModemStatus()&MSC_RTC == 0 {
+		t.Errorf("modem status %02x", c.ModemStatus())
+	}
+
+	// more frames than the initial credits
+	msg := bytes.Repeat([]byte("0123456789"), 100)
+	go func() {
+		if _, err := c.Write(msg); err != nil {
+			t.Error(err)
+		}
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(acc, got); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, msg) {
+		t.Error("data mismatch")
+	}
+
+	if err := acc.SetModemStatus(ctx, MSC_RTC|MSC_IC); err != nil {
+		t.Error(err)
+	} else if c.ModemStatus() != MSC_RTC|MSC_IC {
+		t.Errorf("modem status %02x", c.ModemStatus())
+	}
+
+	if data, err := responder.Test(ctx, []byte("ping")); err != nil || string(data) != "ping" {
+		t.Errorf("test %q %v", data, err)
+	}
+
+	c.Close()
+	if _, err := acc.Read(got); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
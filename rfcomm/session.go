@@ -0,0 +1,622 @@
+package rfcomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hkwi/blugo/l2cap"
+)
+
+var (
+	ErrConnRefused = errors.New("rfcomm: connection refused")
+	ErrTimeout     = errors.New("rfcomm: response timeout")
+)
+
+// Session is an RFCOMM multiplexer session over an L2CAP channel.
+type Session struct {
+	link      io.ReadWriteCloser
+	initiator bool
+	mtu       int
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	dlcs    map[uint8]*Conn
+	servers map[uint8]*Listener
+	pending map[uint16]chan frame // by dlci, or 0x100 | mcc type
+	open    bool
+	fcOff   bool
+	err     error
+
+	wlock   sync.Mutex
+	mccLock sync.Mutex
+}
+
+func pendingMcc(typ uint8) uint16 {
+	return 0x100 | uint16(typ)
+}
+
+// NewSession starts the multiplexer on the link. The initiator, which
+// opened the L2CAP channel, establishes DLCI 0 before it returns; the
+// responder waits for the peer.
+func NewSession(ctx context.Context, link io.ReadWriteCloser, initiator bool) (*Session, error) {
+	self := &Session{
+		link:      link,
+		initiator: initiator,
+		mtu:       DEFAULT_MTU,
+		dlcs:      make(map[uint8]*Conn),
+		servers:   make(map[uint8]*Listener),
+		pending:   make(map[uint16]chan frame),
+	}
+	self.cond = sync.NewCond(&self.lock)
+	if ch, ok := link.(interface {
+		SendMTU() int
+		ReceiveMTU() int
+	}); ok {
+		mtu := ch.SendMTU()
+		if r := ch.ReceiveMTU(); r < mtu {
+			mtu = r
+		}
+		// address, control, two length octets, credits and fcs
+		if mtu -= 6; mtu > MAX_MTU {
+			self.mtu = MAX_MTU
+		} else if mtu > 0 {
+			self.mtu = mtu
+		}
+	}
+	go self.serve()
+
+	if initiator {
+		if ctrl, err := self.frameExchange(ctx, 0, SABM); err != nil {
+			self.link.Close()
+			return nil, err
+		} else if ctrl != UA {
+			self.link.Close()
+			return nil, ErrConnRefused
+		}
+		self.lock.Lock()
+		self.open = true
+		self.lock.Unlock()
+	}
+	return self, nil
+}
+
+// Dial opens the RFCOMM channel on the BR/EDR connection and starts the
+// session as the initiator.
+func Dial(ctx context.Context, conn *l2cap.Conn) (*Session, error) {
+	ch, err := conn.Dial(ctx, PSM, l2cap.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(ctx, ch, true)
+}
+
+// cr returns C/R bit of commands and UIH frames sent.
+func (self *Session) cr() bool {
+	return self.initiator
+}
+
+func (self *Session) send(f frame) error {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+	_, err = self.link.Write(data)
+	return err
+}
+
+func (self *Session) respond(dlci, control uint8) error {
+	return self.send(frame{
+		dlci:    dlci,
+		cr:      !self.cr(),
+		control: control,
+		pf:      true,
+	})
+}
+
+func (self *Session) sendMcc(typ uint8, cr bool, values []byte) error {
+	return self.send(frame{
+		cr:      self.cr(),
+		control: UIH,
+		info:    marshalMcc(typ, cr, values),
+	})
+}
+
+func (self *Session) await(ctx context.Context, key uint16, c chan frame) (frame, error) {
+	defer func() {
+		self.lock.Lock()
+		if self.pending[key] == c {
+			delete(self.pending, key)
+		}
+		self.lock.Unlock()
+	}()
+	timer := time.NewTimer(DEFAULT_TIMEOUT)
+	defer timer.Stop()
+	select {
+	case f, ok := <-c:
+		if !ok {
+			return f, self.closedErr()
+		}
+		return f, nil
+	case <-timer.C:
+		return frame{}, ErrTimeout
+	case <-ctx.Done():
+		return frame{}, ctx.Err()
+	}
+}
+
+func (self *Session) register(key uint16) (chan frame, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return nil, self.closedErr()
+	} else if _, ok := self.pending[key]; ok {
+		return nil, fmt.Errorf("rfcomm: command in progress")
+	}
+	c := make(chan frame, 1)
+	self.pending[key] = c
+	return c, nil
+}
+
+// frameExchange sends SABM or DISC, returning UA or DM.
+func (self *Session) frameExchange(ctx context.Context, dlci, control uint8) (uint8, error) {
+	c, err := self.register(uint16(dlci))
+	if err != nil {
+		return 0, err
+	}
+	if err := self.send(frame{
+		dlci:    dlci,
+		cr:      self.cr(),
+		control: control,
+		pf:      true,
+	}); err != nil {
+		self.lock.Lock()
+		delete(self.pending, uint16(dlci))
+		self.lock.Unlock()
+		return 0, err
+	}
+	f, err := self.await(ctx, uint16(dlci), c)
+	return f.control, err
+}
+
+// mccExchange sends a multiplexer control command and returns the values
+// of the response.
+func (self *Session) mccExchange(ctx context.Context, typ uint8, values []byte) ([]byte, error) {
+	self.mccLock.Lock()
+	defer self.mccLock.Unlock()
+
+	key := pendingMcc(typ)
+	c, err := self.register(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := self.sendMcc(typ, true, values); err != nil {
+		self.lock.Lock()
+		delete(self.pending, key)
+		self.lock.Unlock()
+		return nil, err
+	}
+	f, err := self.await(ctx, key, c)
+	if err != nil {
+		return nil, err
+	} else if f.control == DM {
+		return nil, ErrConnRefused
+	} else if f.control != UIH {
+		return nil, fmt.Errorf("rfcomm: command not supported")
+	}
+	return f.info, nil
+}
+
+// Test sends Test command and returns the echoed data.
+func (self *Session) Test(ctx context.Context, data []byte) ([]byte, error) {
+	return self.mccExchange(ctx, MCC_TEST, data)
+}
+
+// deliver passes a response to the waiter.
+func (self *Session) deliver(key uint16, f frame) {
+	self.lock.Lock()
+	c := self.pending[key]
+	delete(self.pending, key)
+	self.lock.Unlock()
+	if c != nil {
+		c <- f
+	}
+}
+
+func (self *Session) serve() {
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := self.link.Read(buf)
+		if err != nil {
+			self.shutdown(err)
+			return
+		}
+		var f frame
+		if err := f.UnmarshalBinary(append([]byte(nil), buf[:n]...)); err != nil {
+			continue // invalid frames are discarded
+		}
+		if f.dlci == 0 {
+			self.control(f)
+		} else {
+			self.dlc(f)
+		}
+	}
+}
+
+func (self *Session) control(f frame) {
+	switch f.control {
+	case SABM:
+		self.lock.Lock()
+		self.open = true
+		self.lock.Unlock()
+		self.respond(0, UA)
+	case DISC:
+		self.respond(0, UA)
+		self.shutdown(io.EOF)
+		self.link.Close()
+	case UA, DM:
+		self.deliver(0, f)
+	case UIH:
+		typ, cr, values, err := unmarshalMcc(f.info)
+		if err != nil {
+			return
+		}
+		if !cr {
+			if typ == MCC_NSC && len(values) > 0 {
+				self.deliver(pendingMcc(values[0]>>2), frame{})
+			} else {
+				self.deliver(pendingMcc(typ), frame{control: UIH, info: values})
+			}
+			return
+		}
+		self.mcc(typ, values)
+	}
+}
+
+func (self *Session) mcc(typ uint8, values []byte) {
+	switch typ {
+	case MCC_PN:
+		var req pn
+		if err := req.UnmarshalBinary(values); err != nil {
+			return
+		}
+		rsp := self.negotiate(req)
+		data, _ := rsp.MarshalBinary()
+		self.sendMcc(MCC_PN, false, data)
+	case MCC_MSC:
+		if len(values) < 2 {
+			return
+		}
+		self.lock.Lock()
+		if c := self.dlcs[values[0]>>2]; c != nil {
+			c.remoteSignals = values[1] &^ 1
+			self.cond.Broadcast()
+		}
+		self.lock.Unlock()
+		self.sendMcc(MCC_MSC, false, values)
+	case MCC_RPN:
+		if len(values) == 1 {
+			// 9600 baud, 8 data bits, 1 stop bit, no parity, no flow control
+			values = []byte{values[0], 0x03, 0x03, 0x00, 0x11, 0x13, 0x7F, 0x3F}
+		}
+		self.sendMcc(MCC_RPN, false, values)
+	case MCC_RLS:
+		if len(values) < 2 {
+			return
+		}
+		self.lock.Lock()
+		if c := self.dlcs[values[0]>>2]; c != nil {
+			c.lineStatus = values[1] &^ 1
+		}
+		self.lock.Unlock()
+		self.sendMcc(MCC_RLS, false, values)
+	case MCC_TEST:
+		self.sendMcc(MCC_TEST, false, values)
+	case MCC_FCON, MCC_FCOFF:
+		self.lock.Lock()
+		self.fcOff = typ == MCC_FCOFF
+		self.cond.Broadcast()
+		self.lock.Unlock()
+		self.sendMcc(typ, false, nil)
+	case MCC_CLD:
+		self.sendMcc(MCC_CLD, false, nil)
+		self.shutdown(io.EOF)
+		self.link.Close()
+	default:
+		self.sendMcc(MCC_NSC, false, []byte{1 | 2 | typ<<2})
+	}
+}
+
+// negotiate answers Parameter Negotiation from the peer.
+func (self *Session) negotiate(req pn) pn {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	c := self.dlcs[req.dlci]
+	if c == nil {
+		c = newConn(self, req.dlci)
+		self.dlcs[req.dlci] = c
+	}
+	if c.state == stateConnecting {
+		c.txMtu = self.mtu
+		if req.mtu != 0 && int(req.mtu) < c.txMtu {
+			c.txMtu = int(req.mtu)
+		}
+		c.cfc = req.cl == PN_CFC_REQ
+		if c.cfc {
+			c.txCredits = int(req.credits)
+			c.rxCredits = DEFAULT_CREDITS
+		}
+	}
+	rsp := pn{
+		dlci:     req.dlci,
+		priority: req.priority,
+		mtu:      uint16(c.txMtu),
+	}
+	if c.cfc {
+		rsp.cl = PN_CFC_RSP
+		rsp.credits = uint8(c.rxCredits)
+	}
+	return rsp
+}
+
+func (self *Session) dlc(f frame) {
+	switch f.control {
+	case SABM:
+		self.lock.Lock()
+		l := self.servers[f.dlci>>1]
+		c := self.dlcs[f.dlci]
+		ok := l != nil && !l.closed && f.dlci&1 == self.serverBit() && (c == nil || c.state == stateConnecting)
+		if ok {
+			if c == nil {
+				c = newConn(self, f.dlci)
+				self.dlcs[f.dlci] = c
+			}
+			c.state = stateOpen
+			c.listener = l
+		} else if c != nil && c.state == stateConnecting && f.dlci&1 == self.serverBit() {
+			delete(self.dlcs, f.dlci) // negotiated by PN
+		}
+		self.lock.Unlock()
+		if !ok {
+			self.respond(f.dlci, DM)
+			return
+		}
+		self.respond(f.dlci, UA)
+		go func() {
+			c.SetModemStatus(context.Background(), c.localSignals)
+			self.lock.Lock()
+			if !l.closed && c.state == stateOpen {
+				l.backlog = append(l.backlog, c)
+				self.cond.Broadcast()
+			}
+			self.lock.Unlock()
+		}()
+	case DISC:
+		self.lock.Lock()
+		c := self.dlcs[f.dlci]
+		if c != nil {
+			delete(self.dlcs, f.dlci)
+			c.closeLocked()
+		}
+		self.lock.Unlock()
+		if c != nil {
+			self.respond(f.dlci, UA)
+		} else {
+			self.respond(f.dlci, DM)
+		}
+	case UA:
+		self.deliver(uint16(f.dlci), f)
+	case DM:
+		self.lock.Lock()
+		c := self.dlcs[f.dlci]
+		connecting := c != nil && c.state == stateConnecting
+		if c != nil && c.state == stateOpen {
+			delete(self.dlcs, f.dlci)
+			c.closeLocked()
+		}
+		self.lock.Unlock()
+		self.deliver(uint16(f.dlci), f)
+		if connecting {
+			// the peer may refuse Parameter Negotiation by DM
+			self.deliver(pendingMcc(MCC_PN), f)
+		}
+	case UIH:
+		self.lock.Lock()
+		c := self.dlcs[f.dlci]
+		if c != nil {
+			c.receiveLocked(f)
+		}
+		self.lock.Unlock()
+	}
+}
+
+// serverBit is the direction bit of DLCI of the local server channels.
+func (self *Session) serverBit() uint8 {
+	if self.initiator {
+		return 1
+	}
+	return 0
+}
+
+func (self *Session) shutdown(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return
+	}
+	self.err = err
+	for _, c := range self.dlcs {
+		c.closeLocked()
+	}
+	for _, l := range self.servers {
+		l.closed = true
+	}
+	for key, c := range self.pending {
+		close(c)
+		delete(self.pending, key)
+	}
+	self.cond.Broadcast()
+}
+
+func (self *Session) closedErr() error {
+	if self.err == nil || self.err == io.EOF {
+		return io.ErrClosedPipe
+	}
+	return self.err
+}
+
+// Close closes the multiplexer and the underlying channel.
+func (self *Session) Close() error {
+	self.lock.Lock()
+	open := self.open && self.err == nil
+	self.lock.Unlock()
+	if open {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		self.frameExchange(ctx, 0, DISC)
+		cancel()
+	}
+	self.shutdown(io.EOF)
+	return self.link.Close()
+}
+
+// Dial opens a data link connection to the server channel of the peer.
+func (self *Session) Dial(ctx context.Context, channel uint8) (*Conn, error) {
+	if channel == 0 || channel > MAX_CHANNEL {
+		return nil, fmt.Errorf("rfcomm: invalid channel %d", channel)
+	}
+	dlci := channel<<1 | (1 - self.serverBit())
+
+	self.lock.Lock()
+	if self.err != nil {
+		self.lock.Unlock()
+		return nil, self.closedErr()
+	} else if _, ok := self.dlcs[dlci]; ok {
+		self.lock.Unlock()
+		return nil, fmt.Errorf("rfcomm: channel %d in use", channel)
+	}
+	c := newConn(self, dlci)
+	self.dlcs[dlci] = c
+	self.lock.Unlock()
+
+	fail := func(err error) (*Conn, error) {
+		self.lock.Lock()
+		if self.dlcs[dlci] == c {
+			delete(self.dlcs, dlci)
+		}
+		self.lock.Unlock()
+		return nil, err
+	}
+
+	req, _ := pn{
+		dlci:     dlci,
+		cl:       PN_CFC_REQ,
+		priority: 7,
+		mtu:      uint16(self.mtu),
+		credits:  DEFAULT_CREDITS,
+	}.MarshalBinary()
+	if data, err := self.mccExchange(ctx, MCC_PN, req); err != nil {
+		return fail(err)
+	} else {
+		var rsp pn
+		if err := rsp.UnmarshalBinary(data); err != nil {
+			return fail(err)
+		}
+		self.lock.Lock()
+		c.txMtu = int(rsp.mtu)
+		if c.txMtu == 0 || c.txMtu > self.mtu {
+			c.txMtu = self.mtu
+		}
+		c.cfc = rsp.cl == PN_CFC_RSP
+		if c.cfc {
+			c.txCredits = int(rsp.credits)
+			c.rxCredits = DEFAULT_CREDITS
+		}
+		self.lock.Unlock()
+	}
+
+	if ctrl, err := self.frameExchange(ctx, dlci, SABM); err != nil {
+		return fail(err)
+	} else if ctrl != UA {
+		return fail(ErrConnRefused)
+	}
+	self.lock.Lock()
+	c.state = stateOpen
+	self.lock.Unlock()
+
+	if err := c.SetModemStatus(ctx, c.localSignals); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Listener accepts data link connections of a server channel.
+type Listener struct {
+	session *Session
+	channel uint8
+	backlog []*Conn
+	closed  bool
+}
+
+// Listen accepts the connections to the local server channel.
+func (self *Session) Listen(channel uint8) (*Listener, error) {
+	if channel == 0 || channel > MAX_CHANNEL {
+		return nil, fmt.Errorf("rfcomm: invalid channel %d", channel)
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return nil, self.closedErr()
+	} else if _, ok := self.servers[channel]; ok {
+		return nil, fmt.Errorf("rfcomm: channel %d in use", channel)
+	}
+	l := &Listener{
+		session: self,
+		channel: channel,
+	}
+	self.servers[channel] = l
+	return l, nil
+}
+
+func (self *Listener) Accept() (*Conn, error) {
+	s := self.session
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for len(self.backlog) == 0 && !self.closed {
+		s.cond.Wait()
+	}
+	if len(self.backlog) == 0 {
+		return nil, s.closedErr()
+	}
+	c := self.backlog[0]
+	self.backlog = self.backlog[1:]
+	return c, nil
+}
+
+func (self *Listener) Close() error {
+	s := self.session
+	s.lock.Lock()
+	self.closed = true
+	if s.servers[self.channel] == self {
+		delete(s.servers, self.channel)
+	}
+	s.cond.Broadcast()
+	backlog := self.backlog
+	self.backlog = nil
+	s.lock.Unlock()
+
+	for _, c := range backlog {
+		c.Close()
+	}
+	return nil
+}
+
+func (self *Listener) Addr() Addr {
+	return Addr{Channel: self.channel}
+}
@@ -0,0 +1,151 @@
+// +build linux
+
+//go:generate sh gen.sh rfcomm linux_seed $GOOS $GOARCH
+
+package blugo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// RfcommAddr is the address of kernel RFCOMM socket.
+type RfcommAddr struct {
+	Bdaddr  Bdaddr
+	Channel uint8
+}
+
+func (self RfcommAddr) Network() string {
+	return "rfcomm"
+}
+
+func (self RfcommAddr) String() string {
+	return fmt.Sprintf("%v/%d", self.Bdaddr, self.Channel)
+}
+
+func (self RfcommAddr) sockaddr() SockaddrRc {
+	return SockaddrRc{
+		Family:  syscall.AF_BLUETOOTH,
+		Bdaddr:  self.Bdaddr,
+		Channel: self.Channel,
+	}
+}
+
+// RfcommConn is a connected kernel RFCOMM socket, which is a byte stream.
+type RfcommConn struct {
+	btConn
+}
+
+var _ net.Conn = &RfcommConn{}
+
+func (self *RfcommConn) fillLocal() {
+	self.control(func(fd int) error {
+		var name SockaddrRc
+		if err := sockname(syscall.SYS_GETSOCKNAME, fd, unsafe.Pointer(&name), SizeofSockaddrRc); err != nil {
+			return err
+		}
+		self.laddr = RfcommAddr{
+			Bdaddr:  name.Bdaddr,
+			Channel: name.Channel,
+		}
+		return nil
+	})
+}
+
+// Handle returns the HCI connection handle of the underlying link.
+func (self *RfcommConn) Handle() (uint16, error) {
+	var info RfcommConninfo
+	err := self.control(func(fd int) error {
+		return getsockopt(fd, SOL_RFCOMM, RFCOMM_CONNINFO, unsafe.Pointer(&info), SizeofRfcommConninfo)
+	})
+	return info.Hci_handle, err
+}
+
+// DialRFCOMM connects to the server channel of the peer, through any
+// adapter. The kernel connection timeout applies.
+func DialRFCOMM(addr Bdaddr, channel uint8) (*RfcommConn, error) {
+	fd, err := btSocket(syscall.SOCK_STREAM, BTPROTO_RFCOMM)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "rfcomm")
+
+	raddr := RfcommAddr{
+		Bdaddr:  addr,
+		Channel: channel,
+	}
+	sa := raddr.sockaddr()
+	var peer SockaddrRc
+	if err := btConnect(context.Background(), file, unsafe.Pointer(&sa), SizeofSockaddrRc, unsafe.Pointer(&peer)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	ret := &RfcommConn{btConn{
+		file:  file,
+		raddr: raddr,
+	}}
+	ret.fillLocal()
+	return ret, nil
+}
+
+// RfcommListener accepts kernel RFCOMM connections.
+type RfcommListener struct {
+	btListener
+}
+
+var _ net.Listener = &RfcommListener{}
+
+// ListenRFCOMM listens on the server channel of all adapters. Channel 0
+// takes a free channel, which Addr tells.
+func ListenRFCOMM(channel uint8) (*RfcommListener, error) {
+	fd, err := btSocket(syscall.SOCK_STREAM, BTPROTO_RFCOMM)
+	if err != nil {
+		return nil, err
+	}
+	sa := RfcommAddr{Channel: channel}.sockaddr()
+	if err := sockaddrCall(syscall.SYS_BIND, fd, unsafe.Pointer(&sa), SizeofSockaddrRc); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := sockname(syscall.SYS_GETSOCKNAME, fd, unsafe.Pointer(&sa), SizeofSockaddrRc); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &RfcommListener{btListener{
+		file: os.NewFile(uintptr(fd), "rfcomm"),
+		laddr: RfcommAddr{
+			Bdaddr:  sa.Bdaddr,
+			Channel: sa.Channel,
+		},
+	}}, nil
+}
+
+func (self *RfcommListener) AcceptRFCOMM() (*RfcommConn, error) {
+	var sa SockaddrRc
+	file, err := self.accept("rfcomm", unsafe.Pointer(&sa), SizeofSockaddrRc)
+	if err != nil {
+		return nil, err
+	}
+	ret := &RfcommConn{btConn{
+		file:  file,
+		laddr: self.laddr,
+		raddr: RfcommAddr{
+			Bdaddr:  sa.Bdaddr,
+			Channel: sa.Channel,
+		},
+	}}
+	ret.fillLocal()
+	return ret, nil
+}
+
+func (self *RfcommListener) Accept() (net.Conn, error) {
+	return self.AcceptRFCOMM()
+}
@@ -0,0 +1,27 @@
+// Created by cgo -godefs - DO NOT EDIT
+// cgo -godefs -- -funsigned-char rfcomm_linux_seed.go
+
+package blugo
+
+const (
+	RFCOMM_CONNINFO = 0x2
+	RFCOMM_LM       = 0x3
+)
+
+type SockaddrRc struct {
+	Family    uint16
+	Bdaddr    Bdaddr /* endian! */
+	Channel   uint8
+	Pad_cgo_0 [1]byte
+}
+
+type RfcommConninfo struct {
+	Hci_handle uint16
+	Dev_class  [3]uint8
+	Pad_cgo_0  [1]byte
+}
+
+const (
+	SizeofSockaddrRc     = 0xa
+	SizeofRfcommConninfo = 0x6
+)
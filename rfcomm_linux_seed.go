@@ -0,0 +1,25 @@
+// +build ignore
+
+// +godefs map bdaddr_t Bdaddr /* endian! */
+
+package blugo
+
+// #cgo pkg-config: bluez
+// #include <sys/socket.h>
+// #include <bluetooth/bluetooth.h>
+// #include <bluetooth/rfcomm.h>
+import "C"
+
+const (
+	RFCOMM_CONNINFO = C.RFCOMM_CONNINFO
+	RFCOMM_LM       = C.RFCOMM_LM
+)
+
+type SockaddrRc C.struct_sockaddr_rc
+
+type RfcommConninfo C.struct_rfcomm_conninfo
+
+const (
+	SizeofSockaddrRc     = C.sizeof_struct_sockaddr_rc
+	SizeofRfcommConninfo = C.sizeof_struct_rfcomm_conninfo
+)
@@ -0,0 +1,229 @@
+package blugo
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RssiFilter smooths the RSSI samples of a device.
+type RssiFilter interface {
+	Filter(rssi float64) float64
+}
+
+// EmaFilter is the exponential moving average. Alpha is the weight of the
+// new sample, between 0 and 1.
+type EmaFilter struct {
+	Alpha float64
+	value float64
+	init  bool
+}
+
+func NewEmaFilter(alpha float64) *EmaFilter {
+	return &EmaFilter{Alpha: alpha}
+}
+
+func (self *EmaFilter) Filter(rssi float64) float64 {
+	if !self.init {
+		self.value = rssi
+		self.init = true
+	} else {
+		self.value += self.Alpha * (rssi - self.value)
+	}
+	return self.value
+}
+
+// KalmanFilter is the one dimensional Kalman filter of a constant level.
+// ProcessNoise is how much the level moves between the samples and
+// MeasurementNoise is the variance of the samples, both in dB^2.
+type KalmanFilter struct {
+	ProcessNoise     float64
+	MeasurementNoise float64
+	value            float64
+	variance         float64
+	init             bool
+}
+
+func NewKalmanFilter(processNoise, measurementNoise float64) *KalmanFilter {
+	return &KalmanFilter{
+		ProcessNoise:     processNoise,
+		MeasurementNoise: measurementNoise,
+	}
+}
+
+func (self *KalmanFilter) Filter(rssi float64) float64 {
+	if !self.init {
+		self.value = rssi
+		self.variance = self.MeasurementNoise
+		self.init = true
+		return self.value
+	}
+	self.variance += self.ProcessNoise
+	gain := self.variance / (self.variance + self.MeasurementNoise)
+	self.value += gain * (rssi - self.value)
+	self.variance *= 1 - gain
+	return self.value
+}
+
+// RSSI_LOSS_1M is the free space path loss at 1 m in the 2.4 GHz band.
+const RSSI_LOSS_1M = 41
+
+// PathLossDistance estimates the distance in meters from the RSSI and the
+// RSSI at 1 m, with the path loss exponent that is 2 in free space and
+// larger indoors.
+func PathLossDistance(rssi, rssi1m, exponent float64) float64 {
+	return math.Pow(10, (rssi1m-rssi)/(10*exponent))
+}
+
+// RssiDevice is the state of a tracked device.
+type RssiDevice struct {
+	Addr       LeAddr
+	Rssi       int8    // the last sample
+	Smoothed   float64 // the filtered RSSI
+	TxPower    int8    // AD_TX_POWER of the device
+	HasTxPower bool
+	LastSeen   time.Time
+	Present    bool
+	filter     RssiFilter
+}
+
+// Distance estimates the distance in meters by the TX power of the
+// advertising data.
+func (self RssiDevice) Distance(exponent float64) (float64, bool) {
+	if !self.HasTxPower {
+		return 0, false
+	}
+	return PathLossDistance(self.Smoothed, float64(self.TxPower)-RSSI_LOSS_1M, exponent), true
+}
+
+// PresenceEvent reports that a device entered or left the range.
+type PresenceEvent struct {
+	Device  RssiDevice
+	Present bool
+}
+
+// RssiTracker follows the RSSI of the devices, fed by the advertising
+// reports and by polling the connections. A device enters when the
+// smoothed RSSI reaches EnterRssi, and exits when it falls below ExitRssi,
+// or when no sample is seen for Timeout. EnterRssi above ExitRssi gives
+// the hysteresis.
+type RssiTracker struct {
+	NewFilter func() RssiFilter // nil does no smoothing
+	EnterRssi float64
+	ExitRssi  float64
+	Timeout   time.Duration
+	lock      sync.Mutex
+	devices   map[LeAddr]*RssiDevice
+}
+
+func NewRssiTracker() *RssiTracker {
+	return &RssiTracker{
+		NewFilter: func() RssiFilter { return NewEmaFilter(0.3) },
+		EnterRssi: -70,
+		ExitRssi:  -80,
+		Timeout:   10 * time.Second,
+		devices:   make(map[LeAddr]*RssiDevice),
+	}
+}
+
+func (self *RssiTracker) device(addr LeAddr) *RssiDevice {
+	if self.devices == nil {
+		self.devices = make(map[LeAddr]*RssiDevice)
+	}
+	dev, ok := self.devices[addr]
+	if !ok {
+		dev = &RssiDevice{Addr: addr}
+		if self.NewFilter != nil {
+			dev.filter = self.NewFilter()
+		}
+		self.devices[addr] = dev
+	}
+	return dev
+}
+
+func (self *RssiTracker) update(dev *RssiDevice, rssi int8, now time.Time) []PresenceEvent {
+	dev.Rssi = rssi
+	dev.LastSeen = now
+	if dev.filter != nil {
+		dev.Smoothed = dev.filter.Filter(float64(rssi))
+	} else {
+		dev.Smoothed = float64(rssi)
+	}
+	if !dev.Present && dev.Smoothed >= self.EnterRssi {
+		dev.Present = true
+		return []PresenceEvent{{Device: *dev, Present: true}}
+	} else if dev.Present && dev.Smoothed < self.ExitRssi {
+		dev.Present = false
+		return []PresenceEvent{{Device: *dev, Present: false}}
+	}
+	return nil
+}
+
+// Update adds the RSSI sample of the device, such as by ReadRSSI of the
+// connection.
+func (self *RssiTracker) Update(addr LeAddr, rssi int8, now time.Time) []PresenceEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.update(self.device(addr), rssi, now)
+}
+
+// Report adds the advertising report, taking the TX power from the data.
+func (self *RssiTracker) Report(report LeAdvertisingReport, now time.Time) []PresenceEvent {
+	if report.Rssi == ADV_REPORT_RSSI_UNKNOWN {
+		return nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	dev := self.device(report.Addr)
+	if tx, ok := report.Data.TxPower(); ok {
+		dev.TxPower = tx
+		dev.HasTxPower = true
+	}
+	return self.update(dev, report.Rssi, now)
+}
+
+// Expire reports the exits of the devices not seen for Timeout, and
+// forgets them.
+func (self *RssiTracker) Expire(now time.Time) []PresenceEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []PresenceEvent
+	for addr, dev := range self.devices {
+		if now.Sub(dev.LastSeen) < self.Timeout {
+			continue
+		}
+		if dev.Present {
+			dev.Present = false
+			ret = append(ret, PresenceEvent{Device: *dev, Present: false})
+		}
+		delete(self.devices, addr)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Device.LastSeen.Before(ret[j].Device.LastSeen)
+	})
+	return ret
+}
+
+func (self *RssiTracker) Device(addr LeAddr) (RssiDevice, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if dev, ok := self.devices[addr]; ok {
+		return *dev, true
+	}
+	return RssiDevice{}, false
+}
+
+// Devices returns the tracked devices, the strongest first.
+func (self *RssiTracker) Devices() []RssiDevice {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []RssiDevice
+	for _, dev := range self.devices {
+		ret = append(ret, *dev)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Smoothed > ret[j].Smoothed
+	})
+	return ret
+}
@@ -0,0 +1,77 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ReadRSSI reads the RSSI of the connection. It is in dBm for LE, and
+// relative to the golden receive power range for BR/EDR.
+func (self HciDev) ReadRSSI(handle uint16) (int8, error) {
+	if ret, err := self.Request(HCI_Read_RSSI, handle); err != nil {
+		return 0, err
+	} else if err := statusError(ret); err != nil {
+		return 0, err
+	} else {
+		return ret[2].(int8), nil
+	}
+}
+
+// Poll feeds the RSSI of the connection to the tracker at the interval
+// until the context is done or the read fails.
+func (self *RssiTracker) Poll(ctx context.Context, dev HciDev, handle uint16, addr LeAddr, interval time.Duration, events func(PresenceEvent)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if rssi, err := dev.ReadRSSI(handle); err != nil {
+			return err
+		} else {
+			for _, ev := range self.Update(addr, rssi, time.Now()) {
+				events(ev)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan feeds the advertising reports of the running scanner to the
+// tracker, and expires the devices, until the context is done. The events
+// are passed one at a time.
+func (self *RssiTracker) Scan(ctx context.Context, scanner *Scanner, events func(PresenceEvent)) error {
+	var lock sync.Mutex
+	emit := func(evs []PresenceEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, ev := range evs {
+			events(ev)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if period := self.Timeout / 4; period > 0 {
+		go func() {
+			ticker := time.NewTicker(period)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					emit(self.Expire(now))
+				}
+			}
+		}()
+	}
+	return scanner.Reports(ctx, func(r LeAdvertisingReport) error {
+		emit(self.Report(r, time.Now()))
+		return nil
+	})
+}
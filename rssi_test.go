@@ -0,0 +1,103 @@
+package blugo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRssiFilter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, f := range []RssiFilter{NewEmaFilter(0.1), NewKalmanFilter(0.01, 16)} {
+		var value, deviation float64
+		for i := 0; i < 300; i++ {
+			value = f.Filter(-60 + 4*rnd.NormFloat64())
+			if i >= 100 {
+				deviation += math.Abs(value+60) / 200
+			}
+		}
+		// the samples deviate 3.2 on average
+		if deviation > 1.5 {
+			t.Errorf("%T deviates %v", f, deviation)
+		}
+		// follows a step
+		for i := 0; i < 300; i++ {
+			value = f.Filter(-80)
+		}
+		if math.Abs(value+80) > 1 {
+			t.Errorf("%T got %v", f, value)
+		}
+	}
+}
+
+func TestRssiDistance(t *testing.T) {
+	if d := PathLossDistance(-59, -59, 2); math.Abs(d-1) > 1e-9 {
+		t.Errorf("got %v", d)
+	}
+	if d := PathLossDistance(-79, -59, 2); math.Abs(d-10) > 1e-9 {
+		t.Errorf("got %v", d)
+	}
+	dev := RssiDevice{Smoothed: -61, TxPower: 0, HasTxPower: true}
+	if d, ok := dev.Distance(2); !ok || math.Abs(d-10) > 1e-9 {
+		t.Errorf("got %v", d)
+	}
+}
+
+func TestRssiTracker(t *testing.T) {
+	tracker := NewRssiTracker()
+	tracker.NewFilter = nil
+	addr := LeAddr{Type: LE_ADDR_RANDOM, Addr: Bdaddr{1, 2, 3, 4, 5, 0xc6}}
+	now := time.Unix(1000, 0)
+
+	var enter, exit int
+	feed := func(evs []PresenceEvent) {
+		for _, ev := range evs {
+			if ev.Device.Addr != addr {
+				t.Errorf("got %v", ev.Device.Addr)
+			} else if ev.Present {
+				enter++
+			} else {
+				exit++
+			}
+		}
+	}
+	for i, rssi := range []int8{-90, -75, -69, -75, -79, -72, -81, -75, -60} {
+		now = now.Add(time.Second)
+		feed(tracker.Update(addr, rssi, now))
+		if i == 2 && enter != 1 || i == 5 && exit != 0 || i == 6 && exit != 1 {
+			t.Errorf("%d: enter %d exit %d", i, enter, exit)
+		}
+	}
+	if enter != 2 || exit != 1 {
+		t.Errorf("enter %d exit %d", enter, exit)
+	}
+
+	var ev EvtLeAdvertisingReport
+	if err := ev.UnmarshalBinary([]byte{
+		0x02,
+		ADV_REPORT_NONCONN_IND, LE_ADDR_RANDOM, 1, 2, 3, 4, 5, 0xc6, 0x03, 0x02, AD_TX_POWER, 0xf8, 0xbc,
+		ADV_REPORT_IND, LE_ADDR_PUBLIC, 6, 5, 4, 3, 2, 1, 0x00, ADV_REPORT_RSSI_UNKNOWN,
+	}); err != nil || len(ev.Reports) != 2 {
+		t.Fatalf("got %v %v", ev, err)
+	}
+	now = now.Add(time.Second)
+	for _, r := range ev.Reports {
+		feed(tracker.Report(r, now))
+	}
+	if dev, ok := tracker.Device(addr); !ok || dev.Rssi != -68 || !dev.HasTxPower || dev.TxPower != -8 {
+		t.Errorf("got %v", dev)
+	}
+	if len(tracker.Devices()) != 1 {
+		t.Error("unknown RSSI tracked")
+	}
+
+	feed(tracker.Expire(now.Add(5 * time.Second)))
+	if exit != 1 {
+		t.Error("expired early")
+	}
+	feed(tracker.Expire(now.Add(10 * time.Second)))
+	if exit != 2 || len(tracker.Devices()) != 0 {
+		t.Errorf("exit %d", exit)
+	}
+}
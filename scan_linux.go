@@ -0,0 +1,76 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+)
+
+// Bluetooth Core specification, Vol 2, Part E, Section 7.8.10 - 7.8.11
+// Legacy scanning of the LE controller.
+
+// Scanner configures and runs LE scanning. Interval and Window are in
+// 0.625 msec units.
+type Scanner struct {
+	dev              HciDev
+	Active           bool // sends scan requests for the scan responses
+	Interval         uint16
+	Window           uint16
+	OwnAddrType      uint8
+	FilterPolicy     uint8
+	FilterDuplicates bool // the controller reports each device once
+}
+
+func NewScanner(dev HciDev) *Scanner {
+	return &Scanner{
+		dev:      dev,
+		Interval: 0x0010,
+		Window:   0x0010,
+	}
+}
+
+// Start configures the parameters and enables scanning.
+func (self *Scanner) Start() error {
+	var scanType uint8
+	if self.Active {
+		scanType = 1
+	}
+	if err := self.dev.requestStatus(HCI_LE_Set_Scan_Parameters,
+		scanType,
+		self.Interval,
+		self.Window,
+		self.OwnAddrType,
+		self.FilterPolicy,
+	); err != nil {
+		return err
+	}
+	var dup uint8
+	if self.FilterDuplicates {
+		dup = 1
+	}
+	return self.dev.requestStatus(HCI_LE_Set_Scan_Enable, uint8(1), dup)
+}
+
+// Stop disables scanning.
+func (self *Scanner) Stop() error {
+	return self.dev.requestStatus(HCI_LE_Set_Scan_Enable, uint8(0), uint8(0))
+}
+
+// Reports passes the advertising reports to handle until the context is
+// done or handle returns an error.
+func (self *Scanner) Reports(ctx context.Context, handle func(LeAdvertisingReport) error) error {
+	return self.dev.exchange(ctx, 0, nil, []int{EVT_LE_META_EVENT}, func(p EventPktParams) (bool, error) {
+		if meta, ok := p.(EvtLeMetaEvent); !ok {
+			return false, nil
+		} else if sub, err := meta.Parse(); err != nil {
+			return false, nil
+		} else if ev, ok := sub.(EvtLeAdvertisingReport); ok {
+			for _, r := range ev.Reports {
+				if err := handle(r); err != nil {
+					return true, err
+				}
+			}
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,256 @@
+package sdp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Client issues requests to the SDP server of the peer. Requests are
+// serialized, and the continuation is followed until the response is
+// complete.
+type Client struct {
+	rw io.ReadWriter
+	// MaxBytes is of the attribute requests, limited to the MTU.
+	MaxBytes uint16
+
+	sem     chan struct{}
+	lock    sync.Mutex
+	tid     uint16
+	pending chan PDU
+	timer   *time.Timer
+	err     error
+	done    chan struct{}
+}
+
+// NewClient serves the client on the channel, reading it in background
+// until it is closed.
+func NewClient(rw io.ReadWriter) *Client {
+	self := &Client{
+		rw:       rw,
+		MaxBytes: DEFAULT_MTU - 10,
+		sem:      make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go self.serve()
+	return self
+}
+
+func (self *Client) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err == nil {
+		self.err = err
+		close(self.done)
+	}
+}
+
+// Err returns the error that closed the client.
+func (self *Client) Err() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err == io.EOF {
+		return ErrClosed
+	}
+	return self.err
+}
+
+func (self *Client) serve() {
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := self.rw.Read(buf)
+		if err != nil {
+			self.fail(err)
+			return
+		}
+		tid, pdu, err := Parse(buf[:n])
+		if err != nil {
+			continue
+		}
+		self.lock.Lock()
+		c := self.pending
+		if c == nil || tid != self.tid {
+			self.lock.Unlock()
+			continue
+		}
+		self.pending = nil
+		self.timer.Stop()
+		self.lock.Unlock()
+
+		c <- pdu
+		<-self.sem
+	}
+}
+
+// do sends the request and waits for the response. The transaction
+// continues after ctx is done, so that the next request waits for it.
+func (self *Client) do(ctx context.Context, req PDU) (PDU, error) {
+	select {
+	case self.sem <- struct{}{}:
+	case <-self.done:
+		return nil, self.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c := make(chan PDU, 1)
+	self.lock.Lock()
+	self.tid++
+	tid := self.tid
+	self.pending = c
+	self.timer = time.AfterFunc(TRANSACTION_TIMEOUT, func() {
+		self.fail(ErrTimeout)
+	})
+	self.lock.Unlock()
+
+	data, err := Encode(tid, req)
+	if err == nil {
+		_, err = self.rw.Write(data)
+	}
+	if err != nil {
+		self.lock.Lock()
+		self.pending = nil
+		self.timer.Stop()
+		self.lock.Unlock()
+		<-self.sem
+		return nil, err
+	}
+
+	select {
+	case pdu := <-c:
+		if e, ok := pdu.(ErrorRsp); ok {
+			return nil, e.Code
+		} else if pdu.PduID() != req.PduID()+1 {
+			return nil, fmt.Errorf("sdp: unexpected pdu 0x%02x", pdu.PduID())
+		}
+		return pdu, nil
+	case <-self.done:
+		return nil, self.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ServiceSearch returns the handles of the service records that have all
+// the UUIDs of the pattern.
+func (self *Client) ServiceSearch(ctx context.Context, pattern ...uuid.UUID) ([]uint32, error) {
+	var ret []uint32
+	req := ServiceSearchReq{Pattern: pattern, MaxCount: 0xFFFF}
+	for {
+		if rsp, err := self.do(ctx, req); err != nil {
+			return nil, err
+		} else {
+			p := rsp.(ServiceSearchRsp)
+			ret = append(ret, p.Handles...)
+			if len(p.Cont) == 0 {
+				return ret, nil
+			}
+			req.Cont = p.Cont
+		}
+	}
+}
+
+// collect follows the continuation of the attribute requests, and decodes
+// the whole data element.
+func (self *Client) collect(ctx context.Context, req PDU, next func(cont []byte) PDU) (Element, error) {
+	var data []byte
+	for {
+		rsp, err := self.do(ctx, req)
+		if err != nil {
+			return Element{}, err
+		}
+		var cont []byte
+		switch p := rsp.(type) {
+		case ServiceAttrRsp:
+			data, cont = append(data, p.Attrs...), p.Cont
+		case ServiceSearchAttrRsp:
+			data, cont = append(data, p.Attrs...), p.Cont
+		}
+		if len(cont) == 0 {
+			break
+		}
+		req = next(cont)
+	}
+	if e, n, err := ParseElement(data); err != nil {
+		return Element{}, err
+	} else if n != len(data) {
+		return Element{}, fmt.Errorf("sdp: trailing attribute data")
+	} else {
+		return e, nil
+	}
+}
+
+func rangesOrAll(ranges []AttrRange) []AttrRange {
+	if len(ranges) == 0 {
+		return []AttrRange{ALL_ATTRS}
+	}
+	return ranges
+}
+
+// ServiceAttributes returns the attributes of the service record in the
+// ranges, or all of them without ranges.
+func (self *Client) ServiceAttributes(ctx context.Context, handle uint32, ranges ...AttrRange) (Record, error) {
+	req := ServiceAttrReq{
+		Handle:   handle,
+		MaxBytes: self.MaxBytes,
+		Attrs:    rangesOrAll(ranges),
+	}
+	if e, err := self.collect(ctx, req, func(cont []byte) PDU {
+		req.Cont = cont
+		return req
+	}); err != nil {
+		return nil, err
+	} else {
+		return ParseRecord(e)
+	}
+}
+
+// ServiceSearchAttributes returns the attributes of the service records
+// that have all the UUIDs of the pattern, in one transaction.
+func (self *Client) ServiceSearchAttributes(ctx context.Context, pattern []uuid.UUID, ranges ...AttrRange) ([]Record, error) {
+	req := ServiceSearchAttrReq{
+		Pattern:  pattern,
+		MaxBytes: self.MaxBytes,
+		Attrs:    rangesOrAll(ranges),
+	}
+	e, err := self.collect(ctx, req, func(cont []byte) PDU {
+		req.Cont = cont
+		return req
+	})
+	if err != nil {
+		return nil, err
+	}
+	lists, ok := e.Seq()
+	if !ok {
+		return nil, fmt.Errorf("sdp: invalid attribute lists")
+	}
+	var ret []Record
+	for _, l := range lists {
+		if rec, err := ParseRecord(l); err != nil {
+			return nil, err
+		} else {
+			ret = append(ret, rec)
+		}
+	}
+	return ret, nil
+}
+
+// RFCOMMChannel searches the service class, and returns the RFCOMM server
+// channel of the first record found.
+func (self *Client) RFCOMMChannel(ctx context.Context, class uuid.UUID) (uint8, error) {
+	recs, err := self.ServiceSearchAttributes(ctx, []uuid.UUID{class},
+		AttrRange{ATTR_PROTOCOL_DESCRIPTOR_LIST, ATTR_PROTOCOL_DESCRIPTOR_LIST})
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range recs {
+		if ch, ok := rec.RFCOMMChannel(); ok {
+			return ch, nil
+		}
+	}
+	return 0, fmt.Errorf("sdp: no rfcomm channel of %v", class)
+}
@@ -0,0 +1,456 @@
+package sdp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// Data element type descriptors, Section 3.2
+const (
+	TYPE_NIL  = 0
+	TYPE_UINT = 1
+	TYPE_INT  = 2
+	TYPE_UUID = 3
+	TYPE_TEXT = 4
+	TYPE_BOOL = 5
+	TYPE_SEQ  = 6
+	TYPE_ALT  = 7
+	TYPE_URL  = 8
+)
+
+// Element is a data element. Value is of the Go type by Type:
+//
+//	TYPE_NIL   nil
+//	TYPE_UINT  uint8, uint16, uint32, uint64, or []byte of 16 octets
+//	TYPE_INT   int8, int16, int32, int64, or []byte of 16 octets
+//	TYPE_UUID  uuid.UUID, octets in the little endian order
+//	TYPE_TEXT  string
+//	TYPE_BOOL  bool
+//	TYPE_SEQ   []Element
+//	TYPE_ALT   []Element
+//	TYPE_URL   string
+type Element struct {
+	Type  uint8
+	Value interface{}
+}
+
+func Uint8(v uint8) Element    { return Element{TYPE_UINT, v} }
+func Uint16(v uint16) Element  { return Element{TYPE_UINT, v} }
+func Uint32(v uint32) Element  { return Element{TYPE_UINT, v} }
+func Uint64(v uint64) Element  { return Element{TYPE_UINT, v} }
+func Int8(v int8) Element      { return Element{TYPE_INT, v} }
+func Int16(v int16) Element    { return Element{TYPE_INT, v} }
+func Int32(v int32) Element    { return Element{TYPE_INT, v} }
+func Int64(v int64) Element    { return Element{TYPE_INT, v} }
+func Uuid(v uuid.UUID) Element { return Element{TYPE_UUID, v} }
+func Text(v string) Element    { return Element{TYPE_TEXT, v} }
+func Bool(v bool) Element      { return Element{TYPE_BOOL, v} }
+func Url(v string) Element     { return Element{TYPE_URL, v} }
+func Seq(v ...Element) Element {
+	return Element{TYPE_SEQ, append([]Element{}, v...)}
+}
+func Alt(v ...Element) Element {
+	return Element{TYPE_ALT, append([]Element{}, v...)}
+}
+
+// Uint returns the unsigned integer value up to 64 bits.
+func (self Element) Uint() (uint64, bool) {
+	if self.Type != TYPE_UINT {
+		return 0, false
+	}
+	switch v := self.Value.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Int returns the signed integer value up to 64 bits.
+func (self Element) Int() (int64, bool) {
+	if self.Type != TYPE_INT {
+		return 0, false
+	}
+	switch v := self.Value.(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (self Element) UUID() (uuid.UUID, bool) {
+	v, ok := self.Value.(uuid.UUID)
+	return v, ok && self.Type == TYPE_UUID
+}
+
+// Text returns the value of text strings and URLs.
+func (self Element) Text() (string, bool) {
+	v, ok := self.Value.(string)
+	return v, ok && (self.Type == TYPE_TEXT || self.Type == TYPE_URL)
+}
+
+func (self Element) Bool() (bool, bool) {
+	v, ok := self.Value.(bool)
+	return v, ok && self.Type == TYPE_BOOL
+}
+
+// Seq returns the elements of sequences and alternatives.
+func (self Element) Seq() ([]Element, bool) {
+	v, ok := self.Value.([]Element)
+	return v, ok && (self.Type == TYPE_SEQ || self.Type == TYPE_ALT)
+}
+
+func (self Element) String() string {
+	switch self.Type {
+	case TYPE_NIL:
+		return "nil"
+	case TYPE_UINT, TYPE_INT:
+		if b, ok := self.Value.([]byte); ok {
+			return fmt.Sprintf("0x%x", b)
+		}
+		return fmt.Sprintf("%d", self.Value)
+	case TYPE_TEXT, TYPE_URL:
+		return fmt.Sprintf("%q", self.Value)
+	case TYPE_SEQ, TYPE_ALT:
+		s := "("
+		if self.Type == TYPE_ALT {
+			s = "<"
+		}
+		elems, _ := self.Seq()
+		for i, e := range elems {
+			if i > 0 {
+				s += " "
+			}
+			s += e.String()
+		}
+		if self.Type == TYPE_ALT {
+			return s + ">"
+		}
+		return s + ")"
+	default:
+		return fmt.Sprintf("%v", self.Value)
+	}
+}
+
+// header returns the descriptor with the size index for the fixed sizes of
+// 1 to 16 octets, or the length field for the variable ones.
+func header(typ uint8, size int, variable bool) ([]byte, error) {
+	if !variable {
+		for i, s := range []int{1, 2, 4, 8, 16} {
+			if s == size {
+				return []byte{typ<<3 | uint8(i)}, nil
+			}
+		}
+		return nil, fmt.Errorf("sdp: invalid size %d", size)
+	}
+	switch {
+	case size <= 0xFF:
+		return []byte{typ<<3 | 5, uint8(size)}, nil
+	case size <= 0xFFFF:
+		return []byte{typ<<3 | 6, uint8(size >> 8), uint8(size)}, nil
+	default:
+		return []byte{typ<<3 | 7, uint8(size >> 24), uint8(size >> 16), uint8(size >> 8), uint8(size)}, nil
+	}
+}
+
+func (self Element) MarshalBinary() ([]byte, error) {
+	var body []byte
+	variable := false
+	switch v := self.Value.(type) {
+	case nil:
+		if self.Type != TYPE_NIL {
+			return nil, fmt.Errorf("sdp: nil value")
+		}
+		return []byte{0}, nil
+	case uint8:
+		body = []byte{v}
+	case int8:
+		body = []byte{uint8(v)}
+	case uint16:
+		body = make([]byte, 2)
+		binary.BigEndian.PutUint16(body, v)
+	case int16:
+		body = make([]byte, 2)
+		binary.BigEndian.PutUint16(body, uint16(v))
+	case uint32:
+		body = make([]byte, 4)
+		binary.BigEndian.PutUint32(body, v)
+	case int32:
+		body = make([]byte, 4)
+		binary.BigEndian.PutUint32(body, uint32(v))
+	case uint64:
+		body = make([]byte, 8)
+		binary.BigEndian.PutUint64(body, v)
+	case int64:
+		body = make([]byte, 8)
+		binary.BigEndian.PutUint64(body, uint64(v))
+	case []byte:
+		body = v
+	case uuid.UUID:
+		body = v.BigEndian()
+	case bool:
+		body = []byte{0}
+		if v {
+			body[0] = 1
+		}
+	case string:
+		body = []byte(v)
+		variable = true
+	case []Element:
+		for _, e := range v {
+			if b, err := e.MarshalBinary(); err != nil {
+				return nil, err
+			} else {
+				body = append(body, b...)
+			}
+		}
+		variable = true
+	default:
+		return nil, fmt.Errorf("sdp: unknown value type %T", v)
+	}
+	if h, err := header(self.Type, len(body), variable); err != nil {
+		return nil, err
+	} else {
+		return append(h, body...), nil
+	}
+}
+
+// ParseElement decodes a data element, and returns the length consumed.
+func ParseElement(data []byte) (Element, int, error) {
+	var ret Element
+	if len(data) < 1 {
+		return ret, 0, fmt.Errorf("sdp: too short")
+	}
+	ret.Type = data[0] >> 3
+	index := data[0] & 0x07
+	n, size := 1, 0
+	switch index {
+	case 0, 1, 2, 3, 4:
+		size = []int{1, 2, 4, 8, 16}[index]
+		if ret.Type == TYPE_NIL {
+			size = 0
+		}
+	case 5:
+		if len(data) < 2 {
+			return ret, 0, fmt.Errorf("sdp: too short")
+		}
+		size, n = int(data[1]), 2
+	case 6:
+		if len(data) < 3 {
+			return ret, 0, fmt.Errorf("sdp: too short")
+		}
+		size, n = int(binary.BigEndian.Uint16(data[1:])), 3
+	case 7:
+		if len(data) < 5 {
+			return ret, 0, fmt.Errorf("sdp: too short")
+		}
+		size, n = int(binary.BigEndian.Uint32(data[1:])), 5
+	}
+	if size < 0 || len(data)-n < size {
+		return ret, 0, fmt.Errorf("sdp: too short")
+	}
+	body := data[n : n+size]
+	fixed := index < 5
+
+	switch ret.Type {
+	case TYPE_NIL:
+		if index != 0 {
+			return ret, 0, fmt.Errorf("sdp: invalid nil size")
+		}
+	case TYPE_UINT, TYPE_INT:
+		if !fixed {
+			return ret, 0, fmt.Errorf("sdp: invalid integer size")
+		}
+		signed := ret.Type == TYPE_INT
+		switch size {
+		case 1:
+			if signed {
+				ret.Value = int8(body[0])
+			} else {
+				ret.Value = body[0]
+			}
+		case 2:
+			if v := binary.BigEndian.Uint16(body); signed {
+				ret.Value = int16(v)
+			} else {
+				ret.Value = v
+			}
+		case 4:
+			if v := binary.BigEndian.Uint32(body); signed {
+				ret.Value = int32(v)
+			} else {
+				ret.Value = v
+			}
+		case 8:
+			if v := binary.BigEndian.Uint64(body); signed {
+				ret.Value = int64(v)
+			} else {
+				ret.Value = v
+			}
+		default:
+			ret.Value = append([]byte(nil), body...)
+		}
+	case TYPE_UUID:
+		if !fixed || (size != 2 && size != 4 && size != 16) {
+			return ret, 0, fmt.Errorf("sdp: invalid uuid size")
+		}
+		ret.Value, _ = uuid.FromBigEndian(body)
+	case TYPE_BOOL:
+		if index != 0 {
+			return ret, 0, fmt.Errorf("sdp: invalid boolean size")
+		}
+		ret.Value = body[0] != 0
+	case TYPE_TEXT, TYPE_URL:
+		if fixed {
+			return ret, 0, fmt.Errorf("sdp: invalid string size")
+		}
+		ret.Value = string(body)
+	case TYPE_SEQ, TYPE_ALT:
+		if fixed {
+			return ret, 0, fmt.Errorf("sdp: invalid sequence size")
+		}
+		elems := []Element{}
+		for len(body) > 0 {
+			if e, m, err := ParseElement(body); err != nil {
+				return ret, 0, err
+			} else {
+				elems = append(elems, e)
+				body = body[m:]
+			}
+		}
+		ret.Value = elems
+	default:
+		return ret, 0, fmt.Errorf("sdp: unknown type %d", ret.Type)
+	}
+	return ret, n + size, nil
+}
+
+// Record is a service record, attribute values by the attribute IDs.
+type Record map[uint16]Element
+
+// Handle returns ServiceRecordHandle.
+func (self Record) Handle() uint32 {
+	v, _ := self[ATTR_SERVICE_RECORD_HANDLE].Uint()
+	return uint32(v)
+}
+
+// Element encodes the record as the attribute list, a sequence of the IDs
+// and the values in the ascending order.
+func (self Record) Element() Element {
+	var ids []int
+	for id := range self {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	elems := []Element{}
+	for _, id := range ids {
+		elems = append(elems, Uint16(uint16(id)), self[uint16(id)])
+	}
+	return Seq(elems...)
+}
+
+// ParseRecord decodes the attribute list.
+func ParseRecord(e Element) (Record, error) {
+	elems, ok := e.Seq()
+	if !ok || len(elems)%2 != 0 {
+		return nil, fmt.Errorf("sdp: invalid attribute list")
+	}
+	ret := make(Record)
+	for i := 0; i < len(elems); i += 2 {
+		if id, ok := elems[i].Value.(uint16); !ok || elems[i].Type != TYPE_UINT {
+			return nil, fmt.Errorf("sdp: invalid attribute id")
+		} else {
+			ret[id] = elems[i+1]
+		}
+	}
+	return ret, nil
+}
+
+// UUIDs returns all the UUIDs in the values, which service search patterns
+// match against.
+func (self Record) UUIDs() []uuid.UUID {
+	var ret []uuid.UUID
+	var walk func(e Element)
+	walk = func(e Element) {
+		if u, ok := e.UUID(); ok {
+			ret = append(ret, u)
+		} else if elems, ok := e.Seq(); ok {
+			for _, c := range elems {
+				walk(c)
+			}
+		}
+	}
+	for _, e := range self {
+		walk(e)
+	}
+	return ret
+}
+
+// RFCOMMChannel returns the server channel in ProtocolDescriptorList.
+func (self Record) RFCOMMChannel() (uint8, bool) {
+	protocols, _ := self[ATTR_PROTOCOL_DESCRIPTOR_LIST].Seq()
+	for _, p := range protocols {
+		if params, ok := p.Seq(); !ok || len(params) < 2 {
+			continue
+		} else if u, ok := params[0].UUID(); !ok || !u.Equal(uuid.UUID16(UUID_RFCOMM)) {
+			continue
+		} else if ch, ok := params[1].Uint(); ok {
+			return uint8(ch), true
+		}
+	}
+	return 0, false
+}
+
+// L2CAPPSM returns the PSM in ProtocolDescriptorList.
+func (self Record) L2CAPPSM() (uint16, bool) {
+	protocols, _ := self[ATTR_PROTOCOL_DESCRIPTOR_LIST].Seq()
+	for _, p := range protocols {
+		if params, ok := p.Seq(); !ok || len(params) < 2 {
+			continue
+		} else if u, ok := params[0].UUID(); !ok || !u.Equal(uuid.UUID16(UUID_L2CAP)) {
+			continue
+		} else if psm, ok := params[1].Uint(); ok {
+			return uint16(psm), true
+		}
+	}
+	return 0, false
+}
+
+// Name returns ServiceName in the primary language.
+func (self Record) Name() string {
+	s, _ := self[ATTR_SERVICE_NAME].Text()
+	return s
+}
+
+// RFCOMMRecord makes the record of a service on the RFCOMM server channel,
+// browsable from the public browse root.
+func RFCOMMRecord(class uuid.UUID, channel uint8, name string) Record {
+	return Record{
+		ATTR_SERVICE_CLASS_ID_LIST: Seq(Uuid(class)),
+		ATTR_PROTOCOL_DESCRIPTOR_LIST: Seq(
+			Seq(Uuid(uuid.UUID16(UUID_L2CAP))),
+			Seq(Uuid(uuid.UUID16(UUID_RFCOMM)), Uint8(channel)),
+		),
+		ATTR_BROWSE_GROUP_LIST: Seq(Uuid(uuid.UUID16(UUID_PUBLIC_BROWSE_ROOT))),
+		ATTR_LANGUAGE_BASE_ATTR_ID_LIST: Seq(
+			Uint16(0x656e), // "en"
+			Uint16(0x006a), // UTF-8
+			Uint16(0x0100),
+		),
+		ATTR_SERVICE_NAME: Text(name),
+	}
+}
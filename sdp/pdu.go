@@ -0,0 +1,419 @@
+package sdp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// PDU is an SDP PDU. MarshalBinary encodes the parameters only; Encode adds
+// the header with the transaction ID.
+type PDU interface {
+	PduID() uint8
+	MarshalBinary() ([]byte, error)
+}
+
+func tooShort(id uint8) error {
+	return fmt.Errorf("sdp: too short pdu 0x%02x", id)
+}
+
+// AttrRange is an attribute ID range of the request, inclusive. A single
+// attribute ID is of Start == End.
+type AttrRange struct {
+	Start uint16
+	End   uint16
+}
+
+// ALL_ATTRS requests every attribute.
+var ALL_ATTRS = AttrRange{0x0000, 0xFFFF}
+
+func (self AttrRange) Contains(id uint16) bool {
+	return self.Start <= id && id <= self.End
+}
+
+func (self AttrRange) element() Element {
+	if self.Start == self.End {
+		return Uint16(self.Start)
+	}
+	return Uint32(uint32(self.Start)<<16 | uint32(self.End))
+}
+
+// Encode makes the PDU with the header.
+func Encode(tid uint16, pdu PDU) ([]byte, error) {
+	if params, err := pdu.MarshalBinary(); err != nil {
+		return nil, err
+	} else if len(params) > 0xFFFF {
+		return nil, fmt.Errorf("sdp: too long pdu")
+	} else {
+		ret := []byte{pdu.PduID(), uint8(tid >> 8), uint8(tid), uint8(len(params) >> 8), uint8(len(params))}
+		return append(ret, params...), nil
+	}
+}
+
+func putCont(b []byte, cont []byte) ([]byte, error) {
+	if len(cont) > MAX_CONTINUATION {
+		return nil, fmt.Errorf("sdp: too long continuation state")
+	}
+	return append(append(b, uint8(len(cont))), cont...), nil
+}
+
+func parseCont(id uint8, data []byte) ([]byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, tooShort(id)
+	} else if data[0] > MAX_CONTINUATION {
+		return nil, ECODE_INVALID_CONTINUATION
+	} else if data[0] == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), data[1:1+data[0]]...), nil
+}
+
+func marshalPattern(pattern []uuid.UUID) ([]byte, error) {
+	if len(pattern) == 0 || len(pattern) > MAX_PATTERN {
+		return nil, fmt.Errorf("sdp: %d UUIDs in the pattern", len(pattern))
+	}
+	var elems []Element
+	for _, u := range pattern {
+		elems = append(elems, Uuid(u))
+	}
+	return Seq(elems...).MarshalBinary()
+}
+
+func parsePattern(data []byte) ([]uuid.UUID, int, error) {
+	e, n, err := ParseElement(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	elems, ok := e.Seq()
+	if !ok || len(elems) == 0 || len(elems) > MAX_PATTERN {
+		return nil, 0, ECODE_INVALID_SYNTAX
+	}
+	var ret []uuid.UUID
+	for _, u := range elems {
+		if v, ok := u.UUID(); !ok {
+			return nil, 0, ECODE_INVALID_SYNTAX
+		} else {
+			ret = append(ret, v)
+		}
+	}
+	return ret, n, nil
+}
+
+func marshalRanges(ranges []AttrRange) ([]byte, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("sdp: empty attribute id list")
+	}
+	var elems []Element
+	for _, r := range ranges {
+		elems = append(elems, r.element())
+	}
+	return Seq(elems...).MarshalBinary()
+}
+
+func parseRanges(data []byte) ([]AttrRange, int, error) {
+	e, n, err := ParseElement(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	elems, ok := e.Seq()
+	if !ok || len(elems) == 0 {
+		return nil, 0, ECODE_INVALID_SYNTAX
+	}
+	var ret []AttrRange
+	for _, r := range elems {
+		switch v := r.Value.(type) {
+		case uint16:
+			ret = append(ret, AttrRange{v, v})
+		case uint32:
+			ret = append(ret, AttrRange{uint16(v >> 16), uint16(v)})
+		default:
+			return nil, 0, ECODE_INVALID_SYNTAX
+		}
+	}
+	return ret, n, nil
+}
+
+// Section 4.4.1
+type ErrorRsp struct {
+	Code ErrorCode
+}
+
+func (self ErrorRsp) PduID() uint8 { return ERROR_RSP }
+
+func (self ErrorRsp) MarshalBinary() ([]byte, error) {
+	return []byte{uint8(self.Code >> 8), uint8(self.Code)}, nil
+}
+
+func (self *ErrorRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return tooShort(ERROR_RSP)
+	}
+	self.Code = ErrorCode(binary.BigEndian.Uint16(data))
+	return nil
+}
+
+// Section 4.5.1
+type ServiceSearchReq struct {
+	Pattern  []uuid.UUID
+	MaxCount uint16
+	Cont     []byte
+}
+
+func (self ServiceSearchReq) PduID() uint8 { return SERVICE_SEARCH_REQ }
+
+func (self ServiceSearchReq) MarshalBinary() ([]byte, error) {
+	if ret, err := marshalPattern(self.Pattern); err != nil {
+		return nil, err
+	} else {
+		return putCont(append(ret, uint8(self.MaxCount>>8), uint8(self.MaxCount)), self.Cont)
+	}
+}
+
+func (self *ServiceSearchReq) UnmarshalBinary(data []byte) error {
+	pattern, n, err := parsePattern(data)
+	if err != nil {
+		return err
+	}
+	data = data[n:]
+	if len(data) < 2 {
+		return tooShort(SERVICE_SEARCH_REQ)
+	}
+	self.Pattern = pattern
+	self.MaxCount = binary.BigEndian.Uint16(data)
+	self.Cont, err = parseCont(SERVICE_SEARCH_REQ, data[2:])
+	return err
+}
+
+// Section 4.5.2. CurrentServiceRecordCount is of len(Handles).
+type ServiceSearchRsp struct {
+	Total   uint16
+	Handles []uint32
+	Cont    []byte
+}
+
+func (self ServiceSearchRsp) PduID() uint8 { return SERVICE_SEARCH_RSP }
+
+func (self ServiceSearchRsp) MarshalBinary() ([]byte, error) {
+	ret := make([]byte, 4+4*len(self.Handles))
+	binary.BigEndian.PutUint16(ret, self.Total)
+	binary.BigEndian.PutUint16(ret[2:], uint16(len(self.Handles)))
+	for i, h := range self.Handles {
+		binary.BigEndian.PutUint32(ret[4+4*i:], h)
+	}
+	return putCont(ret, self.Cont)
+}
+
+func (self *ServiceSearchRsp) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return tooShort(SERVICE_SEARCH_RSP)
+	}
+	self.Total = binary.BigEndian.Uint16(data)
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	data = data[4:]
+	if len(data) < 4*count {
+		return tooShort(SERVICE_SEARCH_RSP)
+	}
+	self.Handles = make([]uint32, count)
+	for i := range self.Handles {
+		self.Handles[i] = binary.BigEndian.Uint32(data[4*i:])
+	}
+	var err error
+	self.Cont, err = parseCont(SERVICE_SEARCH_RSP, data[4*count:])
+	return err
+}
+
+// Section 4.6.1
+type ServiceAttrReq struct {
+	Handle   uint32
+	MaxBytes uint16
+	Attrs    []AttrRange
+	Cont     []byte
+}
+
+func (self ServiceAttrReq) PduID() uint8 { return SERVICE_ATTR_REQ }
+
+func (self ServiceAttrReq) MarshalBinary() ([]byte, error) {
+	ret := make([]byte, 6)
+	binary.BigEndian.PutUint32(ret, self.Handle)
+	binary.BigEndian.PutUint16(ret[4:], self.MaxBytes)
+	if attrs, err := marshalRanges(self.Attrs); err != nil {
+		return nil, err
+	} else {
+		return putCont(append(ret, attrs...), self.Cont)
+	}
+}
+
+func (self *ServiceAttrReq) UnmarshalBinary(data []byte) error {
+	if len(data) < 6 {
+		return tooShort(SERVICE_ATTR_REQ)
+	}
+	self.Handle = binary.BigEndian.Uint32(data)
+	self.MaxBytes = binary.BigEndian.Uint16(data[4:])
+	attrs, n, err := parseRanges(data[6:])
+	if err != nil {
+		return err
+	}
+	self.Attrs = attrs
+	self.Cont, err = parseCont(SERVICE_ATTR_REQ, data[6+n:])
+	return err
+}
+
+// Section 4.6.2. Attrs is a fragment of the encoded attribute list, which
+// is complete when concatenated up to the response without Cont.
+type ServiceAttrRsp struct {
+	Attrs []byte
+	Cont  []byte
+}
+
+func (self ServiceAttrRsp) PduID() uint8 { return SERVICE_ATTR_RSP }
+
+func (self ServiceAttrRsp) MarshalBinary() ([]byte, error) {
+	return putCont(append([]byte{uint8(len(self.Attrs) >> 8), uint8(len(self.Attrs))}, self.Attrs...), self.Cont)
+}
+
+func (self *ServiceAttrRsp) UnmarshalBinary(data []byte) error {
+	attrs, cont, err := unmarshalAttrRsp(SERVICE_ATTR_RSP, data)
+	self.Attrs, self.Cont = attrs, cont
+	return err
+}
+
+func unmarshalAttrRsp(id uint8, data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, tooShort(id)
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return nil, nil, tooShort(id)
+	}
+	cont, err := parseCont(id, data[2+n:])
+	return append([]byte(nil), data[2:2+n]...), cont, err
+}
+
+// Section 4.7.1
+type ServiceSearchAttrReq struct {
+	Pattern  []uuid.UUID
+	MaxBytes uint16
+	Attrs    []AttrRange
+	Cont     []byte
+}
+
+func (self ServiceSearchAttrReq) PduID() uint8 { return SERVICE_SEARCH_ATTR_REQ }
+
+func (self ServiceSearchAttrReq) MarshalBinary() ([]byte, error) {
+	ret, err := marshalPattern(self.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, uint8(self.MaxBytes>>8), uint8(self.MaxBytes))
+	if attrs, err := marshalRanges(self.Attrs); err != nil {
+		return nil, err
+	} else {
+		return putCont(append(ret, attrs...), self.Cont)
+	}
+}
+
+func (self *ServiceSearchAttrReq) UnmarshalBinary(data []byte) error {
+	pattern, n, err := parsePattern(data)
+	if err != nil {
+		return err
+	}
+	data = data[n:]
+	if len(data) < 2 {
+		return tooShort(SERVICE_SEARCH_ATTR_REQ)
+	}
+	self.Pattern = pattern
+	self.MaxBytes = binary.BigEndian.Uint16(data)
+	attrs, n, err := parseRanges(data[2:])
+	if err != nil {
+		return err
+	}
+	self.Attrs = attrs
+	self.Cont, err = parseCont(SERVICE_SEARCH_ATTR_REQ, data[2+n:])
+	return err
+}
+
+// Section 4.7.2. Attrs is a fragment of the encoded sequence of the
+// attribute lists.
+type ServiceSearchAttrRsp struct {
+	Attrs []byte
+	Cont  []byte
+}
+
+func (self ServiceSearchAttrRsp) PduID() uint8 { return SERVICE_SEARCH_ATTR_RSP }
+
+func (self ServiceSearchAttrRsp) MarshalBinary() ([]byte, error) {
+	return putCont(append([]byte{uint8(len(self.Attrs) >> 8), uint8(len(self.Attrs))}, self.Attrs...), self.Cont)
+}
+
+func (self *ServiceSearchAttrRsp) UnmarshalBinary(data []byte) error {
+	attrs, cont, err := unmarshalAttrRsp(SERVICE_SEARCH_ATTR_RSP, data)
+	self.Attrs, self.Cont = attrs, cont
+	return err
+}
+
+// Parse decodes the PDU, and returns the transaction ID.
+func Parse(data []byte) (uint16, PDU, error) {
+	if len(data) < 5 {
+		return 0, nil, fmt.Errorf("sdp: too short pdu header")
+	}
+	tid := binary.BigEndian.Uint16(data[1:])
+	plen := int(binary.BigEndian.Uint16(data[3:]))
+	if len(data)-5 != plen {
+		return tid, nil, ECODE_INVALID_PDU_SIZE
+	}
+	params := data[5:]
+	switch data[0] {
+	case ERROR_RSP:
+		pdu := ErrorRsp{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_SEARCH_REQ:
+		pdu := ServiceSearchReq{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_SEARCH_RSP:
+		pdu := ServiceSearchRsp{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_ATTR_REQ:
+		pdu := ServiceAttrReq{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_ATTR_RSP:
+		pdu := ServiceAttrRsp{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_SEARCH_ATTR_REQ:
+		pdu := ServiceSearchAttrReq{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	case SERVICE_SEARCH_ATTR_RSP:
+		pdu := ServiceSearchAttrRsp{}
+		if err := pdu.UnmarshalBinary(params); err != nil {
+			return tid, nil, err
+		} else {
+			return tid, pdu, nil
+		}
+	default:
+		return tid, nil, fmt.Errorf("sdp: unknown pdu 0x%02x", data[0])
+	}
+}
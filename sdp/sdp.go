@@ -0,0 +1,118 @@
+// Package sdp implements the Service Discovery Protocol over an L2CAP
+// channel of PSM 1, such as *l2cap.Channel or blugo.L2capConn, that keeps the
+// PDU boundaries. Values on the wire are big endian, unlike the other
+// protocols.
+//
+// Bluetooth Core specification, Vol 3, Part B
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PSM of SDP.
+const PSM = 0x0001
+
+// PDU IDs, Section 4.2
+const (
+	ERROR_RSP               = 0x01
+	SERVICE_SEARCH_REQ      = 0x02
+	SERVICE_SEARCH_RSP      = 0x03
+	SERVICE_ATTR_REQ        = 0x04
+	SERVICE_ATTR_RSP        = 0x05
+	SERVICE_SEARCH_ATTR_REQ = 0x06
+	SERVICE_SEARCH_ATTR_RSP = 0x07
+)
+
+const (
+	DEFAULT_MTU         = 672 // L2CAP default
+	MAX_PATTERN         = 12
+	MAX_CONTINUATION    = 16
+	TRANSACTION_TIMEOUT = 30 * time.Second
+)
+
+// Universal attribute IDs, Section 5.1
+const (
+	ATTR_SERVICE_RECORD_HANDLE               = 0x0000
+	ATTR_SERVICE_CLASS_ID_LIST               = 0x0001
+	ATTR_SERVICE_RECORD_STATE                = 0x0002
+	ATTR_SERVICE_ID                          = 0x0003
+	ATTR_PROTOCOL_DESCRIPTOR_LIST            = 0x0004
+	ATTR_BROWSE_GROUP_LIST                   = 0x0005
+	ATTR_LANGUAGE_BASE_ATTR_ID_LIST          = 0x0006
+	ATTR_SERVICE_INFO_TIME_TO_LIVE           = 0x0007
+	ATTR_SERVICE_AVAILABILITY                = 0x0008
+	ATTR_BLUETOOTH_PROFILE_DESCRIPTOR_LIST   = 0x0009
+	ATTR_DOCUMENTATION_URL                   = 0x000A
+	ATTR_CLIENT_EXECUTABLE_URL               = 0x000B
+	ATTR_ICON_URL                            = 0x000C
+	ATTR_ADDITIONAL_PROTOCOL_DESCRIPTOR_LIST = 0x000D
+
+	// offsets from the primary language base 0x0100
+	ATTR_SERVICE_NAME        = 0x0100
+	ATTR_SERVICE_DESCRIPTION = 0x0101
+	ATTR_PROVIDER_NAME       = 0x0102
+
+	// SDP server service
+	ATTR_VERSION_NUMBER_LIST    = 0x0200
+	ATTR_SERVICE_DATABASE_STATE = 0x0201
+)
+
+// Protocol and service class UUIDs of the assigned numbers
+const (
+	UUID_SDP                = 0x0001
+	UUID_RFCOMM             = 0x0003
+	UUID_OBEX               = 0x0008
+	UUID_L2CAP              = 0x0100
+	UUID_SDP_SERVER         = 0x1000
+	UUID_PUBLIC_BROWSE_ROOT = 0x1002
+	UUID_SERIAL_PORT        = 0x1101
+	UUID_DIALUP_NETWORKING  = 0x1103
+	UUID_OBEX_OBJECT_PUSH   = 0x1105
+	UUID_HANDSFREE          = 0x111E
+	UUID_HANDSFREE_GATEWAY  = 0x111F
+	UUID_PNP_INFORMATION    = 0x1200
+)
+
+var (
+	ErrTimeout = errors.New("sdp: transaction timeout")
+	ErrClosed  = errors.New("sdp: channel closed")
+)
+
+// ErrorCode is the code of Error Response, Section 4.4.1
+type ErrorCode uint16
+
+const (
+	_ ErrorCode = iota
+	ECODE_INVALID_VERSION
+	ECODE_INVALID_RECORD_HANDLE
+	ECODE_INVALID_SYNTAX
+	ECODE_INVALID_PDU_SIZE
+	ECODE_INVALID_CONTINUATION
+	ECODE_INSUFFICIENT_RESOURCES
+)
+
+func (self ErrorCode) String() string {
+	switch self {
+	case ECODE_INVALID_VERSION:
+		return "invalid SDP version"
+	case ECODE_INVALID_RECORD_HANDLE:
+		return "invalid service record handle"
+	case ECODE_INVALID_SYNTAX:
+		return "invalid request syntax"
+	case ECODE_INVALID_PDU_SIZE:
+		return "invalid PDU size"
+	case ECODE_INVALID_CONTINUATION:
+		return "invalid continuation state"
+	case ECODE_INSUFFICIENT_RESOURCES:
+		return "insufficient resources"
+	default:
+		return fmt.Sprintf("error code 0x%04x", uint16(self))
+	}
+}
+
+func (self ErrorCode) Error() string {
+	return "sdp: " + self.String()
+}
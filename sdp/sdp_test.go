@@ -0,0 +1,180 @@
+package sdp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+func TestElement(t *testing.T) {
+	be128 := []byte{0x00, 0x00, 0x11, 0x01, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0x80, 0x5F, 0x9B, 0x34, 0xFB}
+	uuid128, _ := uuid.FromBigEndian(be128)
+	for _, v := range []struct {
+		elem Element
+		data []byte
+	}{
+		{Element{TYPE_NIL, nil}, []byte{0x00}},
+		{Uint8(0x12), []byte{0x08, 0x12}},
+		{Uint16(0x1234), []byte{0x09, 0x12, 0x34}},
+		{Uint32(0x12345678), []byte{0x0A, 0x12, 0x34, 0x56, 0x78}},
+		{Uint64(1), []byte{0x0B, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{Element{TYPE_UINT, bytes.Repeat([]byte{1}, 16)}, append([]byte{0x0C}, bytes.Repeat([]byte{1}, 16)...)},
+		{Int8(-1), []byte{0x10, 0xFF}},
+		{Int16(-2), []byte{0x11, 0xFF, 0xFE}},
+		{Int32(-3), []byte{0x12, 0xFF, 0xFF, 0xFF, 0xFD}},
+		{Int64(-4), []byte{0x13, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFC}},
+		{Element{TYPE_INT, bytes.Repeat([]byte{2}, 16)}, append([]byte{0x14}, bytes.Repeat([]byte{2}, 16)...)},
+		{Uuid(uuid.UUID16(UUID_SERIAL_PORT)), []byte{0x19, 0x11, 0x01}},
+		{Uuid(uuid.UUID32(0x1101)), []byte{0x1A, 0, 0, 0x11, 0x01}},
+		{Uuid(uuid128), append([]byte{0x1C}, be128...)},
+		{Text("COM"), []byte{0x25, 3, 'C', 'O', 'M'}},
+		{Text(strings.Repeat("a", 256)), append([]byte{0x26, 0x01, 0x00}, strings.Repeat("a", 256)...)},
+		{Text(strings.Repeat("b", 0x10000)), append([]byte{0x27, 0x00, 0x01, 0x00, 0x00}, strings.Repeat("b", 0x10000)...)},
+		{Bool(true), []byte{0x28, 0x01}},
+		{Seq(Uint8(1), Seq()), []byte{0x35, 4, 0x08, 1, 0x35, 0}},
+		{Alt(Bool(false)), []byte{0x3D, 2, 0x28, 0}},
+		{Url("http://a"), []byte{0x45, 8, 'h', 't', 't', 'p', ':', '/', '/', 'a'}},
+	} {
+		if data, err := v.elem.MarshalBinary(); err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(data, v.data) {
+			t.Errorf("%v encoded %x", v.elem, data)
+		}
+		if e, n, err := ParseElement(v.data); err != nil {
+			t.Error(err)
+		} else if n != len(v.data) || !reflect.DeepEqual(e, v.elem) {
+			t.Errorf("%x decoded %v", v.data, e)
+		}
+	}
+
+	// variable sizes accepted in the longer forms
+	if e, _, err := ParseElement([]byte{0x37, 0, 0, 0, 2, 0x08, 7}); err != nil {
+		t.Error(err)
+	} else if s, _ := e.Seq(); len(s) != 1 {
+		t.Errorf("got %v", e)
+	}
+	for _, data := range [][]byte{
+		{0x01},                         // nil of size index 1
+		{0x1B, 0, 0, 0, 0, 0, 0, 0, 0}, // uuid of 8 octets
+		{0x0D, 1, 0},                   // integer of variable size
+		{0x35, 3, 0x08, 1},             // truncated
+		{0x48, 0},                      // url of fixed size
+		{0x50},                         // reserved type
+	} {
+		if _, _, err := ParseElement(data); err == nil {
+			t.Errorf("%x accepted", data)
+		}
+	}
+
+	if !uuid.UUID16(UUID_SERIAL_PORT).Equal(uuid128) || uuid.UUID16(UUID_SERIAL_PORT).Equal(uuid.UUID16(UUID_RFCOMM)) {
+		t.Error("uuid comparison")
+	}
+	if s := Uuid(uuid128).String(); s != "1101" {
+		t.Errorf("got %s", s)
+	}
+}
+
+func TestPDU(t *testing.T) {
+	for _, pdu := range []PDU{
+		ErrorRsp{Code: ECODE_INVALID_RECORD_HANDLE},
+		ServiceSearchReq{Pattern: []uuid.UUID{uuid.UUID16(UUID_L2CAP)}, MaxCount: 10, Cont: []byte{0, 1}},
+		ServiceSearchRsp{Total: 2, Handles: []uint32{0x10000, 0x10001}},
+		ServiceAttrReq{Handle: 0x10000, MaxBytes: 100, Attrs: []AttrRange{{1, 1}, {0x100, 0x1FF}}},
+		ServiceAttrRsp{Attrs: []byte{0x35, 0}, Cont: []byte{1, 2, 3}},
+		ServiceSearchAttrReq{Pattern: []uuid.UUID{uuid.UUID16(UUID_SERIAL_PORT)}, MaxBytes: 100, Attrs: []AttrRange{ALL_ATTRS}},
+		ServiceSearchAttrRsp{Attrs: []byte{0x35, 0}},
+	} {
+		data, err := Encode(0x1234, pdu)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if tid, p, err := Parse(data); err != nil {
+			t.Error(err)
+		} else if tid != 0x1234 || !reflect.DeepEqual(p, pdu) {
+			t.Errorf("%x decoded %+v", data, p)
+		}
+	}
+	// Core specification example, Vol 3, Part B, Section 4.5.1
+	if data, _ := Encode(0x0001, ServiceAttrReq{Handle: 0x10000, MaxBytes: 0x40, Attrs: []AttrRange{{4, 4}}}); !bytes.Equal(data,
+		[]byte{0x04, 0, 1, 0, 0x0C, 0, 1, 0, 0, 0, 0x40, 0x35, 3, 0x09, 0, 4, 0}) {
+		t.Errorf("got %x", data)
+	}
+	if _, _, err := Parse([]byte{SERVICE_SEARCH_REQ, 0, 1, 0, 9}); err != ECODE_INVALID_PDU_SIZE {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	server := NewServer()
+	spp := server.Add(RFCOMMRecord(uuid.UUID16(UUID_SERIAL_PORT), 3, "Serial Port"))
+	long := RFCOMMRecord(uuid.UUID16(UUID_DIALUP_NETWORKING), 5, strings.Repeat("n", 1000))
+	dun := server.Add(long)
+	for i := 0; i < 200; i++ {
+		server.Add(Record{ATTR_SERVICE_CLASS_ID_LIST: Seq(Uuid(uuid.UUID16(UUID_OBEX_OBJECT_PUSH)))})
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	go server.Serve(b)
+	client := NewClient(a)
+	client.MaxBytes = 100
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if handles, err := client.ServiceSearch(ctx, uuid.UUID16(UUID_L2CAP)); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(handles, []uint32{0, spp, dun}) {
+		t.Errorf("got %v", handles)
+	}
+	// split by the continuation
+	if handles, err := client.ServiceSearch(ctx, uuid.UUID16(UUID_OBEX_OBJECT_PUSH)); err != nil {
+		t.Error(err)
+	} else if len(handles) != 200 {
+		t.Errorf("got %d handles", len(handles))
+	}
+
+	if rec, err := client.ServiceAttributes(ctx, dun); err != nil {
+		t.Error(err)
+	} else if rec.Name() != long.Name() || rec.Handle() != dun {
+		t.Errorf("got %v", rec)
+	} else if ch, ok := rec.RFCOMMChannel(); !ok || ch != 5 {
+		t.Errorf("channel %d", ch)
+	}
+	if rec, err := client.ServiceAttributes(ctx, spp, AttrRange{ATTR_SERVICE_NAME, ATTR_SERVICE_NAME}); err != nil {
+		t.Error(err)
+	} else if len(rec) != 1 || rec.Name() != "Serial Port" {
+		t.Errorf("got %v", rec)
+	}
+	if _, err := client.ServiceAttributes(ctx, 0x20000); err != ECODE_INVALID_RECORD_HANDLE {
+		t.Errorf("got %v", err)
+	}
+
+	if recs, err := client.ServiceSearchAttributes(ctx, []uuid.UUID{uuid.UUID16(UUID_RFCOMM)}); err != nil {
+		t.Error(err)
+	} else if len(recs) != 2 || recs[1].Name() != long.Name() {
+		t.Errorf("got %v", recs)
+	}
+	if ch, err := client.RFCOMMChannel(ctx, uuid.UUID16(UUID_SERIAL_PORT)); err != nil || ch != 3 {
+		t.Errorf("channel %d %v", ch, err)
+	}
+	if _, err := client.RFCOMMChannel(ctx, uuid.UUID16(UUID_HANDSFREE)); err == nil {
+		t.Error("no channel expected")
+	}
+
+	if err := server.Remove(spp); err != nil {
+		t.Error(err)
+	} else if handles, err := client.ServiceSearch(ctx, uuid.UUID16(UUID_SERIAL_PORT)); err != nil || len(handles) != 0 {
+		t.Errorf("got %v %v", handles, err)
+	}
+	if err := server.Remove(0); err == nil {
+		t.Error("sdp server record removed")
+	}
+}
@@ -0,0 +1,275 @@
+package sdp
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hkwi/blugo/uuid"
+)
+
+// first handle of the records added, those below are reserved
+const firstHandle = 0x00010000
+
+// Server hosts the service records, which the servers of many connections
+// share. The record of handle 0 is of the SDP server itself.
+type Server struct {
+	// MTU of the channels, that the responses are split by.
+	MTU int
+
+	lock    sync.RWMutex
+	records map[uint32]Record
+	next    uint32
+	state   uint32
+}
+
+func NewServer() *Server {
+	self := &Server{
+		MTU:     DEFAULT_MTU,
+		records: make(map[uint32]Record),
+		next:    firstHandle,
+	}
+	self.records[0] = Record{
+		ATTR_SERVICE_RECORD_HANDLE: Uint32(0),
+		ATTR_SERVICE_CLASS_ID_LIST: Seq(Uuid(uuid.UUID16(UUID_SDP_SERVER))),
+		ATTR_PROTOCOL_DESCRIPTOR_LIST: Seq(
+			Seq(Uuid(uuid.UUID16(UUID_L2CAP)), Uint16(PSM)),
+			Seq(Uuid(uuid.UUID16(UUID_SDP))),
+		),
+		ATTR_BROWSE_GROUP_LIST:   Seq(Uuid(uuid.UUID16(UUID_PUBLIC_BROWSE_ROOT))),
+		ATTR_VERSION_NUMBER_LIST: Seq(Uint16(0x0100)),
+	}
+	self.updated()
+	return self
+}
+
+// updated must be called with the lock held.
+func (self *Server) updated() {
+	self.state++
+	self.records[0][ATTR_SERVICE_DATABASE_STATE] = Uint32(self.state)
+}
+
+// Add hosts the record, and returns the handle assigned, which is set to
+// ServiceRecordHandle.
+func (self *Server) Add(rec Record) uint32 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	handle := self.next
+	self.next++
+	copied := make(Record)
+	for id, e := range rec {
+		copied[id] = e
+	}
+	copied[ATTR_SERVICE_RECORD_HANDLE] = Uint32(handle)
+	self.records[handle] = copied
+	self.updated()
+	return handle
+}
+
+// Remove withdraws the record.
+func (self *Server) Remove(handle uint32) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if _, ok := self.records[handle]; !ok || handle < firstHandle {
+		return ECODE_INVALID_RECORD_HANDLE
+	}
+	delete(self.records, handle)
+	self.updated()
+	return nil
+}
+
+// Record returns the record of the handle, which must not be modified.
+func (self *Server) Record(handle uint32) (Record, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	rec, ok := self.records[handle]
+	return rec, ok
+}
+
+// search returns the handles of the records that have all the UUIDs of the
+// pattern, Section 2.5.2, in the ascending order.
+func (self *Server) search(pattern []uuid.UUID) []uint32 {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	var ret []uint32
+	for handle, rec := range self.records {
+		uuids := rec.UUIDs()
+		matched := true
+		for _, p := range pattern {
+			found := false
+			for _, u := range uuids {
+				if p.Equal(u) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ret = append(ret, handle)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// attributes returns the record filtered by the ranges.
+func (self *Server) attributes(handle uint32, ranges []AttrRange) (Element, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	rec, ok := self.records[handle]
+	if !ok {
+		return Element{}, false
+	}
+	filtered := make(Record)
+	for id, e := range rec {
+		for _, r := range ranges {
+			if r.Contains(id) {
+				filtered[id] = e
+				break
+			}
+		}
+	}
+	return filtered.Element(), true
+}
+
+// Serve answers the requests on the channel until it is closed.
+func (self *Server) Serve(rw io.ReadWriter) error {
+	buf := make([]byte, 0x10000)
+	for {
+		n, err := rw.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		tid, rsp := self.handle(buf[:n])
+		if data, err := Encode(tid, rsp); err != nil {
+			return err
+		} else if _, err := rw.Write(data); err != nil {
+			return err
+		}
+	}
+}
+
+func (self *Server) handle(data []byte) (uint16, PDU) {
+	tid, pdu, err := Parse(data)
+	if err != nil {
+		if code, ok := err.(ErrorCode); ok {
+			return tid, ErrorRsp{Code: code}
+		}
+		return tid, ErrorRsp{Code: ECODE_INVALID_SYNTAX}
+	}
+	if rsp, err := self.respond(pdu); err != nil {
+		if code, ok := err.(ErrorCode); ok {
+			return tid, ErrorRsp{Code: code}
+		}
+		return tid, ErrorRsp{Code: ECODE_INSUFFICIENT_RESOURCES}
+	} else {
+		return tid, rsp
+	}
+}
+
+func (self *Server) mtu() int {
+	if self.MTU < DEFAULT_MTU {
+		return DEFAULT_MTU
+	}
+	return self.MTU
+}
+
+func (self *Server) respond(pdu PDU) (PDU, error) {
+	// taken before the records, so that the continuation fails if they
+	// change meanwhile
+	self.lock.RLock()
+	state := self.state
+	self.lock.RUnlock()
+
+	switch req := pdu.(type) {
+	case ServiceSearchReq:
+		handles := self.search(req.Pattern)
+		if len(handles) > int(req.MaxCount) {
+			handles = handles[:req.MaxCount]
+		}
+		offset := 0
+		if req.Cont != nil {
+			if len(req.Cont) != 2 {
+				return nil, ECODE_INVALID_CONTINUATION
+			} else if offset = int(binary.BigEndian.Uint16(req.Cont)); offset > len(handles) {
+				return nil, ECODE_INVALID_CONTINUATION
+			}
+		}
+		// header, total and current count, and the continuation
+		max := (self.mtu() - 5 - 4 - 3) / 4
+		rsp := ServiceSearchRsp{
+			Total:   uint16(len(handles)),
+			Handles: handles[offset:],
+		}
+		if len(rsp.Handles) > max {
+			rsp.Handles = rsp.Handles[:max]
+			rsp.Cont = []byte{uint8((offset + max) >> 8), uint8(offset + max)}
+		}
+		return rsp, nil
+	case ServiceAttrReq:
+		if e, ok := self.attributes(req.Handle, req.Attrs); !ok {
+			return nil, ECODE_INVALID_RECORD_HANDLE
+		} else if attrs, cont, err := self.fragment(e, state, req.MaxBytes, req.Cont); err != nil {
+			return nil, err
+		} else {
+			return ServiceAttrRsp{Attrs: attrs, Cont: cont}, nil
+		}
+	case ServiceSearchAttrReq:
+		lists := []Element{}
+		for _, handle := range self.search(req.Pattern) {
+			if e, ok := self.attributes(handle, req.Attrs); ok {
+				lists = append(lists, e)
+			}
+		}
+		if attrs, cont, err := self.fragment(Seq(lists...), state, req.MaxBytes, req.Cont); err != nil {
+			return nil, err
+		} else {
+			return ServiceSearchAttrRsp{Attrs: attrs, Cont: cont}, nil
+		}
+	default:
+		return nil, ECODE_INVALID_SYNTAX
+	}
+}
+
+// fragment encodes the element, and returns the part from the offset of
+// the continuation state up to maxBytes. The continuation state is of the
+// offset next, and the database state that the offset is valid in.
+func (self *Server) fragment(e Element, state uint32, maxBytes uint16, cont []byte) ([]byte, []byte, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offset := 0
+	if cont != nil {
+		if len(cont) != 8 || binary.BigEndian.Uint32(cont[4:]) != state {
+			return nil, nil, ECODE_INVALID_CONTINUATION
+		} else if offset = int(binary.BigEndian.Uint32(cont)); offset > len(data) {
+			return nil, nil, ECODE_INVALID_CONTINUATION
+		}
+	}
+	// header, byte count and the continuation
+	max := self.mtu() - 5 - 2 - 9
+	if int(maxBytes) < max {
+		max = int(maxBytes)
+	}
+	if max < 7 {
+		return nil, nil, ECODE_INVALID_SYNTAX
+	}
+	data = data[offset:]
+	if len(data) <= max {
+		return data, nil, nil
+	}
+	next := make([]byte, 8)
+	binary.BigEndian.PutUint32(next, uint32(offset+max))
+	binary.BigEndian.PutUint32(next[4:], state)
+	return data[:max], next, nil
+}
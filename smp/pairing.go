@@ -0,0 +1,1014 @@
+package smp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hkwi/blugo/crypto"
+	"github.com/hkwi/blugo/keystore"
+)
+
+// Address is an LE device address, in the little endian order of
+// blugo.Bdaddr.
+type Address struct {
+	Type uint8 // ADDR_PUBLIC or ADDR_RANDOM
+	Addr [6]byte
+}
+
+// a returns the 56 bit address value used in f5 and f6.
+func (self Address) a() []byte {
+	return append([]byte{self.Type}, crypto.Swap(self.Addr[:])...)
+}
+
+// LTK is the long term key with EDIV and Rand that identify it. Keys are
+// in the little endian order of HCI.
+type LTK struct {
+	Key  [16]byte
+	EDiv uint16
+	Rand uint64
+}
+
+// Keys are the keys that a device distributed.
+type Keys struct {
+	LTK      *LTK
+	IRK      *[16]byte
+	Identity *Address
+	CSRK     *[16]byte
+}
+
+// Result is the outcome of pairing. With Secure Connections LTK of both
+// Local and Peer is the derived key. With legacy pairing Peer.LTK
+// encrypts the link when the local device is the central, and Local.LTK
+// is replied to LTK request when it is the peripheral.
+type Result struct {
+	SecureConnections bool
+	Authenticated     bool
+	Bonded            bool
+	KeySize           uint8
+	Local             Keys
+	Peer              Keys
+}
+
+// Agent interacts with the user. Passkeys are 6 digit decimal numbers.
+type Agent interface {
+	DisplayPasskey(passkey uint32)
+	RequestPasskey(ctx context.Context) (uint32, error)
+	ConfirmNumber(ctx context.Context, number uint32) (bool, error)
+}
+
+// OOBData is the data exchanged out of band. TK is used by LE legacy
+// pairing. For Secure Connections Key is the local key pair, and Random
+// and Confirm are given to the peer; NewOOBData makes them. Peer tells
+// that the peer's data is available, which is TK or PeerRandom and
+// PeerConfirm.
+type OOBData struct {
+	TK          [16]byte
+	Key         *ecdh.PrivateKey
+	Random      [16]byte
+	Confirm     [16]byte
+	Peer        bool
+	PeerRandom  [16]byte
+	PeerConfirm [16]byte
+}
+
+// NewOOBData generates the local out of band data of Secure Connections.
+func NewOOBData() (*OOBData, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	self := &OOBData{Key: key}
+	if _, err := rand.Read(self.Random[:]); err != nil {
+		return nil, err
+	}
+	x, _ := crypto.PublicKeyXY(key)
+	copy(self.Confirm[:], crypto.Swap(crypto.F4(x, x, crypto.Swap(self.Random[:]), 0)))
+	return self, nil
+}
+
+// Link encrypts the connection on the controller. blugo.LeEncryption
+// implements Link.
+type Link interface {
+	// StartEncryption is called on the central, and returns when the link
+	// is encrypted.
+	StartEncryption(ctx context.Context, ltk [16]byte, ediv uint16, rand uint64) error
+	// WaitEncryption is called on the peripheral with the key that answers
+	// LTK request, and returns when the link is encrypted.
+	WaitEncryption(ctx context.Context, ltk [16]byte) error
+}
+
+// Config of pairing. KeyDist fields are the keys requested or accepted.
+// Local IRK and Identity default to zero IRK and the local address, and
+// CSRK is generated when not given. The keys of bonding are saved in
+// Store, if given, under the adapter address.
+type Config struct {
+	IOCap       uint8
+	AuthReq     uint8
+	MaxKeySize  uint8 // 0 means MAX_KEY_SIZE
+	InitKeyDist uint8
+	RespKeyDist uint8
+	OOB         *OOBData
+	Agent       Agent
+	Local       Keys
+	Store       keystore.KeyStore
+	Adapter     [6]byte
+}
+
+func (self Config) features() PairingFeatures {
+	f := PairingFeatures{
+		IOCap:       self.IOCap,
+		AuthReq:     self.AuthReq,
+		MaxKeySize:  self.MaxKeySize,
+		InitKeyDist: self.InitKeyDist &^ KEY_LINK,
+		RespKeyDist: self.RespKeyDist &^ KEY_LINK,
+	}
+	if f.MaxKeySize == 0 {
+		f.MaxKeySize = MAX_KEY_SIZE
+	}
+	if self.OOB != nil && self.OOB.Peer {
+		f.OOB = 1
+	}
+	if f.AuthReq&AUTH_BONDING == 0 {
+		f.InitKeyDist, f.RespKeyDist = 0, 0
+	}
+	return f
+}
+
+// Manager runs SMP on the fixed channel of a connection. Each Read of the
+// channel must return a command.
+type Manager struct {
+	rw      io.ReadWriter
+	link    Link
+	central bool
+	local   Address
+	peer    Address
+	config  Config
+
+	wlock      sync.Mutex
+	lock       sync.Mutex
+	busy       bool
+	rx         chan PDU
+	requests   chan PairingReq
+	onSecurity func(authReq uint8)
+	err        error
+	done       chan struct{}
+}
+
+// NewManager starts serving the channel. central tells the role of the
+// local device on the connection, which takes the initiator role of
+// pairing.
+func NewManager(rw io.ReadWriter, link Link, central bool, local, peer Address, config Config) *Manager {
+	self := &Manager{
+		rw:       rw,
+		link:     link,
+		central:  central,
+		local:    local,
+		peer:     peer,
+		config:   config,
+		rx:       make(chan PDU, 16),
+		requests: make(chan PairingReq, 1),
+		done:     make(chan struct{}),
+	}
+	go self.serve()
+	return self
+}
+
+// OnSecurityRequest sets the handler of Security Request on the central,
+// which would pair, or encrypt the link with the stored key. Without the
+// handler the request is rejected.
+func (self *Manager) OnSecurityRequest(f func(authReq uint8)) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.onSecurity = f
+}
+
+// Err returns the error that stopped the manager.
+func (self *Manager) Err() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.err
+}
+
+func (self *Manager) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err == nil {
+		self.err = err
+		close(self.done)
+	}
+}
+
+func (self *Manager) send(pdu PDU) error {
+	data, err := pdu.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	self.wlock.Lock()
+	defer self.wlock.Unlock()
+	_, err = self.rw.Write(data)
+	return err
+}
+
+func (self *Manager) serve() {
+	buf := make([]byte, 128)
+	for {
+		n, err := self.rw.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClosed
+			}
+			self.fail(err)
+			return
+		} else if n == 0 {
+			continue
+		}
+		pdu, err := Parse(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			if buf[0] > PAIRING_KEYPRESS {
+				self.send(PairingFailed{Reason: REASON_COMMAND_NOT_SUPPORTED})
+			} else {
+				self.send(PairingFailed{Reason: REASON_INVALID_PARAMETERS})
+			}
+			continue
+		}
+
+		self.lock.Lock()
+		busy, onSecurity := self.busy, self.onSecurity
+		self.lock.Unlock()
+		switch p := pdu.(type) {
+		case PairingReq:
+			if self.central {
+				self.send(PairingFailed{Reason: REASON_COMMAND_NOT_SUPPORTED})
+			} else if busy {
+				select {
+				case self.rx <- p:
+				default:
+				}
+			} else {
+				select {
+				case self.requests <- p:
+				default:
+				}
+			}
+		case SecurityReq:
+			if !self.central {
+				self.send(PairingFailed{Reason: REASON_COMMAND_NOT_SUPPORTED})
+			} else if busy {
+				// pairing already
+			} else if onSecurity != nil {
+				go onSecurity(p.AuthReq)
+			} else {
+				self.send(PairingFailed{Reason: REASON_PAIRING_NOT_SUPPORTED})
+			}
+		case PairingKeypress:
+			// progress of the peer's input
+		default:
+			if busy {
+				select {
+				case self.rx <- p:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (self *Manager) begin() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return self.err
+	} else if self.busy {
+		return fmt.Errorf("smp: pairing in progress")
+	}
+	self.busy = true
+	for {
+		select {
+		case <-self.rx:
+		default:
+			return nil
+		}
+	}
+}
+
+func (self *Manager) end() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.busy = false
+}
+
+// Pair pairs with the peer. The central sends Pairing Request, and the
+// peripheral sends Security Request and waits for the pairing.
+func (self *Manager) Pair(ctx context.Context) (*Result, error) {
+	if !self.central {
+		if err := self.send(SecurityReq{AuthReq: self.config.features().AuthReq}); err != nil {
+			return nil, err
+		}
+		return self.Accept(ctx)
+	}
+	if err := self.begin(); err != nil {
+		return nil, err
+	}
+	defer self.end()
+	return self.run(ctx, nil)
+}
+
+// Accept waits for Pairing Request on the peripheral and pairs.
+func (self *Manager) Accept(ctx context.Context) (*Result, error) {
+	if self.central {
+		return nil, fmt.Errorf("smp: not a peripheral")
+	}
+	select {
+	case req := <-self.requests:
+		if err := self.begin(); err != nil {
+			return nil, err
+		}
+		defer self.end()
+		return self.run(ctx, &req)
+	case <-self.done:
+		return nil, self.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (self *Manager) run(ctx context.Context, req *PairingReq) (*Result, error) {
+	tctx, cancel := context.WithTimeout(ctx, TIMEOUT)
+	defer cancel()
+	p := &pairing{
+		Manager: self,
+		ctx:     tctx,
+	}
+	result, err := p.run(req)
+	if err != nil {
+		switch e := err.(type) {
+		case Reason:
+			self.send(PairingFailed{Reason: e})
+		case *RemoteError:
+		default:
+			if err == context.DeadlineExceeded && ctx.Err() == nil {
+				err = ErrTimeout
+				self.fail(err) // no more commands after the timeout
+			} else if self.Err() == nil {
+				self.send(PairingFailed{Reason: REASON_UNSPECIFIED})
+			}
+		}
+		return nil, err
+	}
+	if result.Bonded && self.config.Store != nil {
+		if err := self.save(result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// save stores the keys of the result, keeping the other keys of the peer
+// such as the BR/EDR link key.
+func (self *Manager) save(result *Result) error {
+	peer := self.peer
+	if result.Peer.Identity != nil {
+		peer = *result.Peer.Identity
+	}
+	return keystore.Update(self.config.Store, self.config.Adapter, peer.Addr, func(bond *keystore.Bond) error {
+		bond.Peer = keystore.Address{Type: keystore.ADDR_LE_PUBLIC, Addr: peer.Addr}
+		if peer.Type == ADDR_RANDOM {
+			bond.Peer.Type = keystore.ADDR_LE_RANDOM
+		}
+		ltk := func(k *LTK) *keystore.LTK {
+			if k == nil {
+				return nil
+			}
+			return &keystore.LTK{
+				Key:               k.Key,
+				EDiv:              k.EDiv,
+				Rand:              k.Rand,
+				Authenticated:     result.Authenticated,
+				SecureConnections: result.SecureConnections,
+				KeySize:           result.KeySize,
+			}
+		}
+		bond.LTK = ltk(result.Peer.LTK)
+		bond.PeripheralLTK = nil
+		if !result.SecureConnections {
+			bond.PeripheralLTK = ltk(result.Local.LTK)
+		}
+		bond.IRK = result.Peer.IRK
+		bond.LocalCSRK = result.Local.CSRK
+		bond.RemoteCSRK = result.Peer.CSRK
+		return nil
+	})
+}
+
+// Encrypt encrypts the link with the key stored for the peer, instead of
+// pairing. The central starts the encryption, and the peripheral waits for
+// the central to start. It returns keystore.ErrNotFound when the peer has
+// no key for the role.
+func (self *Manager) Encrypt(ctx context.Context) (*keystore.Bond, error) {
+	if self.config.Store == nil {
+		return nil, keystore.ErrNotFound
+	}
+	bond, err := keystore.Resolve(self.config.Store, self.config.Adapter, self.peer.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if self.central {
+		if ltk := bond.LTK; ltk == nil {
+			return nil, keystore.ErrNotFound
+		} else {
+			return bond, self.link.StartEncryption(ctx, ltk.Key, ltk.EDiv, ltk.Rand)
+		}
+	}
+	ltk := bond.PeripheralLTK
+	if bond.LTK != nil && bond.LTK.SecureConnections {
+		ltk = bond.LTK
+	}
+	if ltk == nil {
+		return nil, keystore.ErrNotFound
+	}
+	return bond, self.link.WaitEncryption(ctx, ltk.Key)
+}
+
+// Association models
+const (
+	justWorks = iota
+	numericComparison
+	passkeyInitDisplay // the initiator displays and the responder inputs
+	passkeyRespDisplay
+	passkeyInput // both input
+	outOfBand
+)
+
+// methods by the initiator and the responder IO capabilities, Section
+// 2.3.5.1, of LE legacy pairing and of Secure Connections.
+var methods = [2][5][5]int{{
+	{justWorks, justWorks, passkeyInitDisplay, justWorks, passkeyInitDisplay},
+	{justWorks, justWorks, passkeyInitDisplay, justWorks, passkeyInitDisplay},
+	{passkeyRespDisplay, passkeyRespDisplay, passkeyInput, justWorks, passkeyRespDisplay},
+	{justWorks, justWorks, justWorks, justWorks, justWorks},
+	{passkeyRespDisplay, passkeyRespDisplay, passkeyInitDisplay, justWorks, passkeyRespDisplay},
+}, {
+	{justWorks, justWorks, passkeyInitDisplay, justWorks, passkeyInitDisplay},
+	{justWorks, numericComparison, passkeyInitDisplay, justWorks, numericComparison},
+	{passkeyRespDisplay, passkeyRespDisplay, passkeyInput, justWorks, passkeyRespDisplay},
+	{justWorks, justWorks, justWorks, justWorks, justWorks},
+	{passkeyRespDisplay, numericComparison, passkeyInitDisplay, justWorks, numericComparison},
+}}
+
+// pairing is the state of a pairing procedure. Values are kept in the
+// order of the cryptographic functions.
+type pairing struct {
+	*Manager
+	ctx       context.Context
+	preq      PairingFeatures
+	pres      PairingFeatures
+	sc        bool
+	method    int
+	keySize   uint8
+	initiator Address
+	responder Address
+}
+
+func (self *pairing) recv() (PDU, error) {
+	select {
+	case pdu := <-self.rx:
+		if f, ok := pdu.(PairingFailed); ok {
+			return nil, &RemoteError{Reason: f.Reason}
+		}
+		return pdu, nil
+	case <-self.done:
+		return nil, self.Err()
+	case <-self.ctx.Done():
+		return nil, self.ctx.Err()
+	}
+}
+
+func (self *pairing) recvValue(code uint8) ([]byte, error) {
+	pdu, err := self.recv()
+	if err != nil {
+		return nil, err
+	} else if pdu.Code() != code {
+		return nil, REASON_UNSPECIFIED
+	}
+	var v [16]byte
+	switch p := pdu.(type) {
+	case PairingConfirm:
+		v = p.Value
+	case PairingRandom:
+		v = p.Value
+	case PairingDHKeyCheck:
+		v = p.Value
+	}
+	return crypto.Swap(v[:]), nil
+}
+
+func (self *pairing) sendValue(code uint8, value []byte) error {
+	var v [16]byte
+	copy(v[:], crypto.Swap(value))
+	switch code {
+	case PAIRING_CONFIRM:
+		return self.send(PairingConfirm{Value: v})
+	case PAIRING_RANDOM:
+		return self.send(PairingRandom{Value: v})
+	default:
+		return self.send(PairingDHKeyCheck{Value: v})
+	}
+}
+
+func random(n int) []byte {
+	ret := make([]byte, n)
+	if _, err := rand.Read(ret); err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func (self *pairing) isInitiator() bool {
+	return self.central
+}
+
+func (self *pairing) negotiate(req *PairingReq) error {
+	local := self.config.features()
+	if req == nil {
+		self.preq = local
+		self.initiator, self.responder = self.local, self.peer
+		if err := self.send(PairingReq(local)); err != nil {
+			return err
+		}
+		pdu, err := self.recv()
+		if err != nil {
+			return err
+		} else if rsp, ok := pdu.(PairingRsp); !ok {
+			return REASON_UNSPECIFIED
+		} else {
+			self.pres = PairingFeatures(rsp)
+		}
+		if self.pres.InitKeyDist&^self.preq.InitKeyDist != 0 || self.pres.RespKeyDist&^self.preq.RespKeyDist != 0 {
+			return REASON_INVALID_PARAMETERS
+		}
+	} else {
+		self.preq = PairingFeatures(*req)
+		self.initiator, self.responder = self.peer, self.local
+		rsp := local
+		rsp.InitKeyDist &= self.preq.InitKeyDist
+		rsp.RespKeyDist &= self.preq.RespKeyDist
+		self.pres = rsp
+	}
+	if self.preq.IOCap > IO_KEYBOARD_DISPLAY || self.pres.IOCap > IO_KEYBOARD_DISPLAY {
+		return REASON_INVALID_PARAMETERS
+	}
+	self.keySize = self.preq.MaxKeySize
+	if self.pres.MaxKeySize < self.keySize {
+		self.keySize = self.pres.MaxKeySize
+	}
+	if self.keySize < MIN_KEY_SIZE || self.keySize > MAX_KEY_SIZE {
+		return REASON_ENCRYPTION_KEY_SIZE
+	}
+	if self.preq.AuthReq&self.pres.AuthReq&AUTH_BONDING == 0 {
+		self.pres.InitKeyDist, self.pres.RespKeyDist = 0, 0
+	}
+	self.sc = self.preq.AuthReq&self.pres.AuthReq&AUTH_SC != 0
+
+	if self.sc && (self.preq.OOB != 0 || self.pres.OOB != 0) {
+		self.method = outOfBand
+	} else if !self.sc && self.preq.OOB != 0 && self.pres.OOB != 0 {
+		self.method = outOfBand
+	} else if (self.preq.AuthReq|self.pres.AuthReq)&AUTH_MITM == 0 {
+		self.method = justWorks
+	} else if self.sc {
+		self.method = methods[1][self.preq.IOCap][self.pres.IOCap]
+	} else {
+		self.method = methods[0][self.preq.IOCap][self.pres.IOCap]
+	}
+	if self.method == justWorks && self.config.AuthReq&AUTH_MITM != 0 {
+		return REASON_AUTH_REQUIREMENTS
+	}
+
+	if req != nil {
+		return self.send(PairingRsp(self.pres))
+	}
+	return nil
+}
+
+// passkey displays or asks the passkey for the local role.
+func (self *pairing) passkey() (uint32, error) {
+	display := self.method == passkeyInitDisplay && self.isInitiator() ||
+		self.method == passkeyRespDisplay && !self.isInitiator()
+	if self.config.Agent == nil {
+		return 0, REASON_PASSKEY_ENTRY_FAILED
+	} else if display {
+		passkey := binary.BigEndian.Uint32(random(4)) % 1000000
+		self.config.Agent.DisplayPasskey(passkey)
+		return passkey, nil
+	} else if passkey, err := self.config.Agent.RequestPasskey(self.ctx); err != nil {
+		return 0, err
+	} else if passkey > 999999 {
+		return 0, REASON_PASSKEY_ENTRY_FAILED
+	} else {
+		return passkey, nil
+	}
+}
+
+func (self *pairing) run(req *PairingReq) (*Result, error) {
+	if err := self.negotiate(req); err != nil {
+		return nil, err
+	}
+	var key []byte
+	var err error
+	if self.sc {
+		key, err = self.secureConnections()
+	} else {
+		key, err = self.legacy()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := int(self.keySize); i < 16; i++ {
+		key[i] = 0
+	}
+	var ltk [16]byte
+	copy(ltk[:], key)
+	if self.isInitiator() {
+		err = self.link.StartEncryption(self.ctx, ltk, 0, 0)
+	} else {
+		err = self.link.WaitEncryption(self.ctx, ltk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		SecureConnections: self.sc,
+		Authenticated:     self.method != justWorks,
+		Bonded:            self.preq.AuthReq&self.pres.AuthReq&AUTH_BONDING != 0,
+		KeySize:           self.keySize,
+	}
+	if self.sc {
+		result.Local.LTK = &LTK{Key: ltk}
+		result.Peer.LTK = &LTK{Key: ltk}
+	}
+	localDist, peerDist := self.pres.RespKeyDist, self.pres.InitKeyDist
+	if self.isInitiator() {
+		localDist, peerDist = peerDist, localDist
+		if err := self.recvKeys(peerDist, &result.Peer); err != nil {
+			return nil, err
+		} else if err := self.sendKeys(localDist, &result.Local); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := self.sendKeys(localDist, &result.Local); err != nil {
+			return nil, err
+		} else if err := self.recvKeys(peerDist, &result.Peer); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// legacy runs the phase 2 of LE legacy pairing and returns STK.
+func (self *pairing) legacy() ([]byte, error) {
+	tk := make([]byte, 16)
+	switch self.method {
+	case outOfBand:
+		tk = crypto.Swap(self.config.OOB.TK[:])
+	case passkeyInitDisplay, passkeyRespDisplay, passkeyInput:
+		if passkey, err := self.passkey(); err != nil {
+			return nil, err
+		} else {
+			binary.BigEndian.PutUint32(tk[12:], passkey)
+		}
+	}
+	preq := crypto.Swap(PairingFeatures(self.preq).marshal(PAIRING_REQUEST))
+	pres := crypto.Swap(PairingFeatures(self.pres).marshal(PAIRING_RESPONSE))
+	confirm := func(r []byte) []byte {
+		return crypto.C1(tk, r, preq, pres,
+			self.initiator.Type, crypto.Swap(self.initiator.Addr[:]),
+			self.responder.Type, crypto.Swap(self.responder.Addr[:]))
+	}
+
+	local := random(16)
+	var peerConfirm, peer []byte
+	var err error
+	if self.isInitiator() {
+		if err = self.sendValue(PAIRING_CONFIRM, confirm(local)); err != nil {
+			return nil, err
+		} else if peerConfirm, err = self.recvValue(PAIRING_CONFIRM); err != nil {
+			return nil, err
+		} else if err = self.sendValue(PAIRING_RANDOM, local); err != nil {
+			return nil, err
+		} else if peer, err = self.recvValue(PAIRING_RANDOM); err != nil {
+			return nil, err
+		} else if !bytes.Equal(confirm(peer), peerConfirm) {
+			return nil, REASON_CONFIRM_VALUE_FAILED
+		}
+		return crypto.Swap(crypto.S1(tk, peer, local)), nil
+	}
+	if peerConfirm, err = self.recvValue(PAIRING_CONFIRM); err != nil {
+		return nil, err
+	} else if err = self.sendValue(PAIRING_CONFIRM, confirm(local)); err != nil {
+		return nil, err
+	} else if peer, err = self.recvValue(PAIRING_RANDOM); err != nil {
+		return nil, err
+	} else if !bytes.Equal(confirm(peer), peerConfirm) {
+		return nil, REASON_CONFIRM_VALUE_FAILED
+	} else if err = self.sendValue(PAIRING_RANDOM, local); err != nil {
+		return nil, err
+	}
+	return crypto.Swap(crypto.S1(tk, local, peer)), nil
+}
+
+func (self *pairing) exchangeKeys() (*ecdh.PrivateKey, []byte, []byte, error) {
+	var key *ecdh.PrivateKey
+	if self.config.OOB != nil && self.config.OOB.Key != nil {
+		key = self.config.OOB.Key
+	} else if k, err := crypto.GenerateKey(); err != nil {
+		return nil, nil, nil, err
+	} else {
+		key = k
+	}
+	x, y := crypto.PublicKeyXY(key)
+	var local PairingPublicKey
+	copy(local.X[:], crypto.Swap(x))
+	copy(local.Y[:], crypto.Swap(y))
+
+	recvKey := func() (*ecdh.PublicKey, error) {
+		pdu, err := self.recv()
+		if err != nil {
+			return nil, err
+		} else if p, ok := pdu.(PairingPublicKey); !ok {
+			return nil, REASON_UNSPECIFIED
+		} else if p == local {
+			return nil, REASON_DHKEY_CHECK_FAILED
+		} else {
+			if peer, err := crypto.ParsePublicKey(crypto.Swap(p.X[:]), crypto.Swap(p.Y[:])); err != nil {
+				return nil, REASON_DHKEY_CHECK_FAILED
+			} else {
+				return peer, nil
+			}
+		}
+	}
+	var peer *ecdh.PublicKey
+	var err error
+	if self.isInitiator() {
+		if err = self.send(local); err == nil {
+			peer, err = recvKey()
+		}
+	} else if peer, err = recvKey(); err == nil {
+		err = self.send(local)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dhkey, err := crypto.DHKey(key, peer)
+	if err != nil {
+		return nil, nil, nil, REASON_DHKEY_CHECK_FAILED
+	}
+	return key, peer.Bytes()[1:33], dhkey, nil
+}
+
+// secureConnections runs the phase 2 of LE Secure Connections and returns
+// LTK.
+func (self *pairing) secureConnections() ([]byte, error) {
+	key, peerX, dhkey, err := self.exchangeKeys()
+	if err != nil {
+		return nil, err
+	}
+	pka, pkb := key.PublicKey().Bytes()[1:33], peerX
+	if !self.isInitiator() {
+		pka, pkb = pkb, pka
+	}
+
+	var na, nb []byte
+	ra, rb := make([]byte, 16), make([]byte, 16)
+	switch self.method {
+	case justWorks, numericComparison:
+		if self.isInitiator() {
+			na = random(16)
+			if cb, err := self.recvValue(PAIRING_CONFIRM); err != nil {
+				return nil, err
+			} else if err := self.sendValue(PAIRING_RANDOM, na); err != nil {
+				return nil, err
+			} else if nb, err = self.recvValue(PAIRING_RANDOM); err != nil {
+				return nil, err
+			} else if !bytes.Equal(crypto.F4(pkb, pka, nb, 0), cb) {
+				return nil, REASON_CONFIRM_VALUE_FAILED
+			}
+		} else {
+			nb = random(16)
+			if err := self.sendValue(PAIRING_CONFIRM, crypto.F4(pkb, pka, nb, 0)); err != nil {
+				return nil, err
+			} else if na, err = self.recvValue(PAIRING_RANDOM); err != nil {
+				return nil, err
+			} else if err := self.sendValue(PAIRING_RANDOM, nb); err != nil {
+				return nil, err
+			}
+		}
+		if self.method == numericComparison {
+			if self.config.Agent == nil {
+				return nil, REASON_NUMERIC_COMPARISON_FAILED
+			} else if ok, err := self.config.Agent.ConfirmNumber(self.ctx, crypto.G2(pka, pkb, na, nb)%1000000); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, REASON_NUMERIC_COMPARISON_FAILED
+			}
+		}
+	case outOfBand:
+		oob := self.config.OOB
+		var localFlag, peerFlag uint8 = self.preq.OOB, self.pres.OOB
+		pkPeer := pkb
+		if !self.isInitiator() {
+			localFlag, peerFlag = peerFlag, localFlag
+			pkPeer = pka
+		}
+		localR, peerR := make([]byte, 16), make([]byte, 16)
+		if localFlag != 0 {
+			peerR = crypto.Swap(oob.PeerRandom[:])
+			if !bytes.Equal(crypto.F4(pkPeer, pkPeer, peerR, 0), crypto.Swap(oob.PeerConfirm[:])) {
+				return nil, REASON_CONFIRM_VALUE_FAILED
+			}
+		}
+		if peerFlag != 0 {
+			if oob == nil || oob.Key == nil {
+				return nil, REASON_OOB_NOT_AVAILABLE
+			}
+			localR = crypto.Swap(oob.Random[:])
+		}
+		if self.isInitiator() {
+			ra, rb = localR, peerR
+			na = random(16)
+			if err := self.sendValue(PAIRING_RANDOM, na); err != nil {
+				return nil, err
+			} else if nb, err = self.recvValue(PAIRING_RANDOM); err != nil {
+				return nil, err
+			}
+		} else {
+			ra, rb = peerR, localR
+			nb = random(16)
+			if na, err = self.recvValue(PAIRING_RANDOM); err != nil {
+				return nil, err
+			} else if err := self.sendValue(PAIRING_RANDOM, nb); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		passkey, err := self.passkey()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < 20; i++ {
+			r := uint8(0x80 | (passkey>>uint(i))&1)
+			if self.isInitiator() {
+				na = random(16)
+				if err := self.sendValue(PAIRING_CONFIRM, crypto.F4(pka, pkb, na, r)); err != nil {
+					return nil, err
+				} else if cb, err := self.recvValue(PAIRING_CONFIRM); err != nil {
+					return nil, err
+				} else if err := self.sendValue(PAIRING_RANDOM, na); err != nil {
+					return nil, err
+				} else if nb, err = self.recvValue(PAIRING_RANDOM); err != nil {
+					return nil, err
+				} else if !bytes.Equal(crypto.F4(pkb, pka, nb, r), cb) {
+					return nil, REASON_CONFIRM_VALUE_FAILED
+				}
+			} else {
+				nb = random(16)
+				if ca, err := self.recvValue(PAIRING_CONFIRM); err != nil {
+					return nil, err
+				} else if err := self.sendValue(PAIRING_CONFIRM, crypto.F4(pkb, pka, nb, r)); err != nil {
+					return nil, err
+				} else if na, err = self.recvValue(PAIRING_RANDOM); err != nil {
+					return nil, err
+				} else if !bytes.Equal(crypto.F4(pka, pkb, na, r), ca) {
+					return nil, REASON_CONFIRM_VALUE_FAILED
+				} else if err := self.sendValue(PAIRING_RANDOM, nb); err != nil {
+					return nil, err
+				}
+			}
+		}
+		binary.BigEndian.PutUint32(ra[12:], passkey)
+		copy(rb, ra)
+	}
+
+	a, b := self.initiator.a(), self.responder.a()
+	macKey, ltk := crypto.F5(dhkey, na, nb, a, b)
+	ioCapA := []byte{self.preq.AuthReq, self.preq.OOB, self.preq.IOCap}
+	ioCapB := []byte{self.pres.AuthReq, self.pres.OOB, self.pres.IOCap}
+	ea := crypto.F6(macKey, na, nb, rb, ioCapA, a, b)
+	eb := crypto.F6(macKey, nb, na, ra, ioCapB, b, a)
+	if self.isInitiator() {
+		if err := self.sendValue(PAIRING_DHKEY_CHECK, ea); err != nil {
+			return nil, err
+		} else if check, err := self.recvValue(PAIRING_DHKEY_CHECK); err != nil {
+			return nil, err
+		} else if !bytes.Equal(check, eb) {
+			return nil, REASON_DHKEY_CHECK_FAILED
+		}
+	} else {
+		if check, err := self.recvValue(PAIRING_DHKEY_CHECK); err != nil {
+			return nil, err
+		} else if !bytes.Equal(check, ea) {
+			return nil, REASON_DHKEY_CHECK_FAILED
+		} else if err := self.sendValue(PAIRING_DHKEY_CHECK, eb); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.Swap(ltk), nil
+}
+
+func (self *pairing) sendKeys(dist uint8, keys *Keys) error {
+	if dist&KEY_ENC != 0 && !self.sc {
+		ltk := &LTK{
+			EDiv: binary.LittleEndian.Uint16(random(2)),
+			Rand: binary.LittleEndian.Uint64(random(8)),
+		}
+		copy(ltk.Key[:self.keySize], random(int(self.keySize)))
+		if err := self.send(EncryptionInfo{LTK: ltk.Key}); err != nil {
+			return err
+		} else if err := self.send(CentralIdent{EDiv: ltk.EDiv, Rand: ltk.Rand}); err != nil {
+			return err
+		}
+		keys.LTK = ltk
+	}
+	if dist&KEY_ID != 0 {
+		irk, identity := self.config.Local.IRK, self.config.Local.Identity
+		if irk == nil {
+			irk = new([16]byte)
+		}
+		if identity == nil {
+			identity = &self.local
+		}
+		if err := self.send(IdentityInfo{IRK: *irk}); err != nil {
+			return err
+		} else if err := self.send(IdentityAddrInfo{Address: *identity}); err != nil {
+			return err
+		}
+		keys.IRK, keys.Identity = irk, identity
+	}
+	if dist&KEY_SIGN != 0 {
+		csrk := self.config.Local.CSRK
+		if csrk == nil {
+			csrk = new([16]byte)
+			copy(csrk[:], random(16))
+		}
+		if err := self.send(SigningInfo{CSRK: *csrk}); err != nil {
+			return err
+		}
+		keys.CSRK = csrk
+	}
+	return nil
+}
+
+func (self *pairing) recvKeys(dist uint8, keys *Keys) error {
+	expect := func(code uint8) (PDU, error) {
+		if pdu, err := self.recv(); err != nil {
+			return nil, err
+		} else if pdu.Code() != code {
+			return nil, REASON_UNSPECIFIED
+		} else {
+			return pdu, nil
+		}
+	}
+	if dist&KEY_ENC != 0 && !self.sc {
+		info, err := expect(ENCRYPTION_INFO)
+		if err != nil {
+			return err
+		}
+		ident, err := expect(CENTRAL_IDENT)
+		if err != nil {
+			return err
+		}
+		keys.LTK = &LTK{
+			Key:  info.(EncryptionInfo).LTK,
+			EDiv: ident.(CentralIdent).EDiv,
+			Rand: ident.(CentralIdent).Rand,
+		}
+	}
+	if dist&KEY_ID != 0 {
+		info, err := expect(IDENTITY_INFO)
+		if err != nil {
+			return err
+		}
+		addr, err := expect(IDENTITY_ADDR_INFO)
+		if err != nil {
+			return err
+		}
+		irk := info.(IdentityInfo).IRK
+		identity := addr.(IdentityAddrInfo).Address
+		keys.IRK, keys.Identity = &irk, &identity
+	}
+	if dist&KEY_SIGN != 0 {
+		info, err := expect(SIGNING_INFO)
+		if err != nil {
+			return err
+		}
+		csrk := info.(SigningInfo).CSRK
+		keys.CSRK = &csrk
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+// Package smp implements the Security Manager Protocol of LE, which pairs
+// devices and distributes the keys over the SMP fixed channel.
+//
+// Bluetooth Core specification, Vol 3, Part H
+package smp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Command codes, Section 3.3
+const (
+	PAIRING_REQUEST     = 0x01
+	PAIRING_RESPONSE    = 0x02
+	PAIRING_CONFIRM     = 0x03
+	PAIRING_RANDOM      = 0x04
+	PAIRING_FAILED      = 0x05
+	ENCRYPTION_INFO     = 0x06
+	CENTRAL_IDENT       = 0x07
+	IDENTITY_INFO       = 0x08
+	IDENTITY_ADDR_INFO  = 0x09
+	SIGNING_INFO        = 0x0A
+	SECURITY_REQUEST    = 0x0B
+	PAIRING_PUBLIC_KEY  = 0x0C
+	PAIRING_DHKEY_CHECK = 0x0D
+	PAIRING_KEYPRESS    = 0x0E
+)
+
+// IO capabilities, Section 3.5.1
+const (
+	IO_DISPLAY_ONLY     = 0x00
+	IO_DISPLAY_YESNO    = 0x01
+	IO_KEYBOARD_ONLY    = 0x02
+	IO_NO_INPUT_OUTPUT  = 0x03
+	IO_KEYBOARD_DISPLAY = 0x04
+)
+
+// Authentication requirements flags
+const (
+	AUTH_BONDING  = 0x01
+	AUTH_MITM     = 0x04
+	AUTH_SC       = 0x08
+	AUTH_KEYPRESS = 0x10
+	AUTH_CT2      = 0x20
+)
+
+// Key distribution bits
+const (
+	KEY_ENC  = 0x01
+	KEY_ID   = 0x02
+	KEY_SIGN = 0x04
+	KEY_LINK = 0x08
+)
+
+// Address types of Identity Address Information
+const (
+	ADDR_PUBLIC = 0x00
+	ADDR_RANDOM = 0x01
+)
+
+const (
+	MIN_KEY_SIZE = 7
+	MAX_KEY_SIZE = 16
+	TIMEOUT      = 30 * time.Second
+)
+
+// Reason is the reason of Pairing Failed, Section 3.5.5
+type Reason uint8
+
+const (
+	_ Reason = iota
+	REASON_PASSKEY_ENTRY_FAILED
+	REASON_OOB_NOT_AVAILABLE
+	REASON_AUTH_REQUIREMENTS
+	REASON_CONFIRM_VALUE_FAILED
+	REASON_PAIRING_NOT_SUPPORTED
+	REASON_ENCRYPTION_KEY_SIZE
+	REASON_COMMAND_NOT_SUPPORTED
+	REASON_UNSPECIFIED
+	REASON_REPEATED_ATTEMPTS
+	REASON_INVALID_PARAMETERS
+	REASON_DHKEY_CHECK_FAILED
+	REASON_NUMERIC_COMPARISON_FAILED
+	REASON_BREDR_PAIRING_IN_PROGRESS
+	REASON_CROSS_TRANSPORT_NOT_ALLOWED
+	REASON_KEY_REJECTED
+)
+
+func (self Reason) String() string {
+	switch self {
+	case REASON_PASSKEY_ENTRY_FAILED:
+		return "REASON_PASSKEY_ENTRY_FAILED"
+	case REASON_OOB_NOT_AVAILABLE:
+		return "REASON_OOB_NOT_AVAILABLE"
+	case REASON_AUTH_REQUIREMENTS:
+		return "REASON_AUTH_REQUIREMENTS"
+	case REASON_CONFIRM_VALUE_FAILED:
+		return "REASON_CONFIRM_VALUE_FAILED"
+	case REASON_PAIRING_NOT_SUPPORTED:
+		return "REASON_PAIRING_NOT_SUPPORTED"
+	case REASON_ENCRYPTION_KEY_SIZE:
+		return "REASON_ENCRYPTION_KEY_SIZE"
+	case REASON_COMMAND_NOT_SUPPORTED:
+		return "REASON_COMMAND_NOT_SUPPORTED"
+	case REASON_UNSPECIFIED:
+		return "REASON_UNSPECIFIED"
+	case REASON_REPEATED_ATTEMPTS:
+		return "REASON_REPEATED_ATTEMPTS"
+	case REASON_INVALID_PARAMETERS:
+		return "REASON_INVALID_PARAMETERS"
+	case REASON_DHKEY_CHECK_FAILED:
+		return "REASON_DHKEY_CHECK_FAILED"
+	case REASON_NUMERIC_COMPARISON_FAILED:
+		return "REASON_NUMERIC_COMPARISON_FAILED"
+	case REASON_BREDR_PAIRING_IN_PROGRESS:
+		return "REASON_BREDR_PAIRING_IN_PROGRESS"
+	case REASON_CROSS_TRANSPORT_NOT_ALLOWED:
+		return "REASON_CROSS_TRANSPORT_NOT_ALLOWED"
+	case REASON_KEY_REJECTED:
+		return "REASON_KEY_REJECTED"
+	default:
+		return fmt.Sprintf("REASON_0x%02x", uint8(self))
+	}
+}
+
+func (self Reason) Error() string {
+	return "smp: " + self.String()
+}
+
+// RemoteError is Pairing Failed sent by the peer.
+type RemoteError struct {
+	Reason Reason
+}
+
+func (self *RemoteError) Error() string {
+	return fmt.Sprintf("smp: peer failed %v", self.Reason)
+}
+
+var (
+	ErrTimeout = errors.New("smp: timeout")
+	ErrClosed  = errors.New("smp: channel closed")
+)
+
+// PDU is an SMP command.
+type PDU interface {
+	Code() uint8
+	MarshalBinary() ([]byte, error)
+}
+
+// PairingFeatures is the parameters of Pairing Request and Response.
+type PairingFeatures struct {
+	IOCap       uint8
+	OOB         uint8
+	AuthReq     uint8
+	MaxKeySize  uint8
+	InitKeyDist uint8
+	RespKeyDist uint8
+}
+
+func (self PairingFeatures) marshal(code uint8) []byte {
+	return []byte{code, self.IOCap, self.OOB, self.AuthReq, self.MaxKeySize, self.InitKeyDist, self.RespKeyDist}
+}
+
+func (self *PairingFeatures) unmarshal(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("smp: too short")
+	}
+	self.IOCap = data[1]
+	self.OOB = data[2]
+	self.AuthReq = data[3]
+	self.MaxKeySize = data[4]
+	self.InitKeyDist = data[5]
+	self.RespKeyDist = data[6]
+	return nil
+}
+
+type PairingReq PairingFeatures
+
+func (self PairingReq) Code() uint8 { return PAIRING_REQUEST }
+
+func (self PairingReq) MarshalBinary() ([]byte, error) {
+	return PairingFeatures(self).marshal(PAIRING_REQUEST), nil
+}
+
+type PairingRsp PairingFeatures
+
+func (self PairingRsp) Code() uint8 { return PAIRING_RESPONSE }
+
+func (self PairingRsp) MarshalBinary() ([]byte, error) {
+	return PairingFeatures(self).marshal(PAIRING_RESPONSE), nil
+}
+
+// value128 is the command of a 128 bit value, which is kept in the
+// little endian order of the PDU.
+func value128(code uint8, v [16]byte) []byte {
+	return append([]byte{code}, v[:]...)
+}
+
+type PairingConfirm struct {
+	Value [16]byte
+}
+
+func (self PairingConfirm) Code() uint8 { return PAIRING_CONFIRM }
+
+func (self PairingConfirm) MarshalBinary() ([]byte, error) {
+	return value128(PAIRING_CONFIRM, self.Value), nil
+}
+
+type PairingRandom struct {
+	Value [16]byte
+}
+
+func (self PairingRandom) Code() uint8 { return PAIRING_RANDOM }
+
+func (self PairingRandom) MarshalBinary() ([]byte, error) {
+	return value128(PAIRING_RANDOM, self.Value), nil
+}
+
+type PairingFailed struct {
+	Reason Reason
+}
+
+func (self PairingFailed) Code() uint8 { return PAIRING_FAILED }
+
+func (self PairingFailed) MarshalBinary() ([]byte, error) {
+	return []byte{PAIRING_FAILED, uint8(self.Reason)}, nil
+}
+
+type EncryptionInfo struct {
+	LTK [16]byte
+}
+
+func (self EncryptionInfo) Code() uint8 { return ENCRYPTION_INFO }
+
+func (self EncryptionInfo) MarshalBinary() ([]byte, error) {
+	return value128(ENCRYPTION_INFO, self.LTK), nil
+}
+
+type CentralIdent struct {
+	EDiv uint16
+	Rand uint64
+}
+
+func (self CentralIdent) Code() uint8 { return CENTRAL_IDENT }
+
+func (self CentralIdent) MarshalBinary() ([]byte, error) {
+	ret := make([]byte, 11)
+	ret[0] = CENTRAL_IDENT
+	binary.LittleEndian.PutUint16(ret[1:], self.EDiv)
+	binary.LittleEndian.PutUint64(ret[3:], self.Rand)
+	return ret, nil
+}
+
+type IdentityInfo struct {
+	IRK [16]byte
+}
+
+func (self IdentityInfo) Code() uint8 { return IDENTITY_INFO }
+
+func (self IdentityInfo) MarshalBinary() ([]byte, error) {
+	return value128(IDENTITY_INFO, self.IRK), nil
+}
+
+type IdentityAddrInfo struct {
+	Address Address
+}
+
+func (self IdentityAddrInfo) Code() uint8 { return IDENTITY_ADDR_INFO }
+
+func (self IdentityAddrInfo) MarshalBinary() ([]byte, error) {
+	return append([]byte{IDENTITY_ADDR_INFO, self.Address.Type}, self.Address.Addr[:]...), nil
+}
+
+type SigningInfo struct {
+	CSRK [16]byte
+}
+
+func (self SigningInfo) Code() uint8 { return SIGNING_INFO }
+
+func (self SigningInfo) MarshalBinary() ([]byte, error) {
+	return value128(SIGNING_INFO, self.CSRK), nil
+}
+
+type SecurityReq struct {
+	AuthReq uint8
+}
+
+func (self SecurityReq) Code() uint8 { return SECURITY_REQUEST }
+
+func (self SecurityReq) MarshalBinary() ([]byte, error) {
+	return []byte{SECURITY_REQUEST, self.AuthReq}, nil
+}
+
+// PairingPublicKey carries the P-256 public key, each coordinate in the
+// little endian order.
+type PairingPublicKey struct {
+	X [32]byte
+	Y [32]byte
+}
+
+func (self PairingPublicKey) Code() uint8 { return PAIRING_PUBLIC_KEY }
+
+func (self PairingPublicKey) MarshalBinary() ([]byte, error) {
+	ret := append([]byte{PAIRING_PUBLIC_KEY}, self.X[:]...)
+	return append(ret, self.Y[:]...), nil
+}
+
+type PairingDHKeyCheck struct {
+	Value [16]byte
+}
+
+func (self PairingDHKeyCheck) Code() uint8 { return PAIRING_DHKEY_CHECK }
+
+func (self PairingDHKeyCheck) MarshalBinary() ([]byte, error) {
+	return value128(PAIRING_DHKEY_CHECK, self.Value), nil
+}
+
+// Keypress notification types
+const (
+	KEYPRESS_STARTED   = 0x00
+	KEYPRESS_ENTERED   = 0x01
+	KEYPRESS_ERASED    = 0x02
+	KEYPRESS_CLEARED   = 0x03
+	KEYPRESS_COMPLETED = 0x04
+)
+
+type PairingKeypress struct {
+	Type uint8
+}
+
+func (self PairingKeypress) Code() uint8 { return PAIRING_KEYPRESS }
+
+func (self PairingKeypress) MarshalBinary() ([]byte, error) {
+	return []byte{PAIRING_KEYPRESS, self.Type}, nil
+}
+
+func array16(data []byte) (ret [16]byte, err error) {
+	if len(data) < 17 {
+		return ret, fmt.Errorf("smp: too short")
+	}
+	copy(ret[:], data[1:])
+	return ret, nil
+}
+
+// Parse decodes the command.
+func Parse(data []byte) (PDU, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("smp: empty")
+	}
+	switch data[0] {
+	case PAIRING_REQUEST:
+		var f PairingFeatures
+		if err := f.unmarshal(data); err != nil {
+			return nil, err
+		}
+		return PairingReq(f), nil
+	case PAIRING_RESPONSE:
+		var f PairingFeatures
+		if err := f.unmarshal(data); err != nil {
+			return nil, err
+		}
+		return PairingRsp(f), nil
+	case PAIRING_CONFIRM:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return PairingConfirm{Value: v}, nil
+		}
+	case PAIRING_RANDOM:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return PairingRandom{Value: v}, nil
+		}
+	case PAIRING_FAILED:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		return PairingFailed{Reason: Reason(data[1])}, nil
+	case ENCRYPTION_INFO:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return EncryptionInfo{LTK: v}, nil
+		}
+	case CENTRAL_IDENT:
+		if len(data) < 11 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		return CentralIdent{
+			EDiv: binary.LittleEndian.Uint16(data[1:]),
+			Rand: binary.LittleEndian.Uint64(data[3:]),
+		}, nil
+	case IDENTITY_INFO:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return IdentityInfo{IRK: v}, nil
+		}
+	case IDENTITY_ADDR_INFO:
+		if len(data) < 8 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		var ret IdentityAddrInfo
+		ret.Address.Type = data[1]
+		copy(ret.Address.Addr[:], data[2:])
+		return ret, nil
+	case SIGNING_INFO:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return SigningInfo{CSRK: v}, nil
+		}
+	case SECURITY_REQUEST:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		return SecurityReq{AuthReq: data[1]}, nil
+	case PAIRING_PUBLIC_KEY:
+		if len(data) < 65 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		var ret PairingPublicKey
+		copy(ret.X[:], data[1:])
+		copy(ret.Y[:], data[33:])
+		return ret, nil
+	case PAIRING_DHKEY_CHECK:
+		if v, err := array16(data); err != nil {
+			return nil, err
+		} else {
+			return PairingDHKeyCheck{Value: v}, nil
+		}
+	case PAIRING_KEYPRESS:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("smp: too short")
+		}
+		return PairingKeypress{Type: data[1]}, nil
+	default:
+		return nil, fmt.Errorf("smp: unknown code 0x%02x", data[0])
+	}
+}
@@ -0,0 +1,204 @@
+package smp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/keystore"
+)
+
+type testLink struct {
+	c chan [16]byte
+}
+
+func (self testLink) StartEncryption(ctx context.Context, ltk [16]byte, ediv uint16, rand uint64) error {
+	self.c <- ltk
+	return nil
+}
+
+func (self testLink) WaitEncryption(ctx context.Context, ltk [16]byte) error {
+	if got := <-self.c; got != ltk {
+		return REASON_UNSPECIFIED
+	}
+	return nil
+}
+
+type testAgent struct {
+	passkey chan uint32
+	number  chan uint32
+}
+
+func (self testAgent) DisplayPasskey(passkey uint32) {
+	self.passkey <- passkey
+}
+
+func (self testAgent) RequestPasskey(ctx context.Context) (uint32, error) {
+	return <-self.passkey, nil
+}
+
+func (self testAgent) ConfirmNumber(ctx context.Context, number uint32) (bool, error) {
+	self.number <- number
+	return true, nil
+}
+
+func TestPairing(t *testing.T) {
+	central := Address{Type: ADDR_PUBLIC, Addr: [6]byte{1, 2, 3, 4, 5, 6}}
+	peripheral := Address{Type: ADDR_RANDOM, Addr: [6]byte{6, 5, 4, 3, 2, 0xC1}}
+	irk := [16]byte{0xAA}
+	for _, v := range []struct {
+		name    string
+		sc      uint8
+		init    uint8
+		resp    uint8
+		auth    bool
+		numbers int
+	}{
+		{"legacy just works", 0, IO_NO_INPUT_OUTPUT, IO_DISPLAY_YESNO, false, 0},
+		{"legacy passkey", 0, IO_KEYBOARD_ONLY, IO_DISPLAY_ONLY, true, 0},
+		{"sc numeric comparison", AUTH_SC, IO_DISPLAY_YESNO, IO_KEYBOARD_DISPLAY, true, 2},
+		{"sc passkey", AUTH_SC, IO_KEYBOARD_DISPLAY, IO_KEYBOARD_ONLY, true, 0},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a, b := net.Pipe()
+		link := testLink{make(chan [16]byte, 1)}
+		agent := testAgent{make(chan uint32, 1), make(chan uint32, 2)}
+		auth := uint8(AUTH_BONDING) | v.sc
+		if v.auth {
+			auth |= AUTH_MITM
+		}
+		m := NewManager(a, link, true, central, peripheral, Config{
+			IOCap:       v.init,
+			AuthReq:     auth,
+			InitKeyDist: KEY_ENC | KEY_SIGN,
+			RespKeyDist: KEY_ENC | KEY_ID,
+			Agent:       agent,
+		})
+		s := NewManager(b, link, false, peripheral, central, Config{
+			IOCap:       v.resp,
+			AuthReq:     auth,
+			InitKeyDist: KEY_ENC | KEY_ID | KEY_SIGN,
+			RespKeyDist: KEY_ENC | KEY_ID | KEY_SIGN,
+			Agent:       agent,
+			Local:       Keys{IRK: &irk},
+		})
+
+		type ret struct {
+			r   *Result
+			err error
+		}
+		initiated, accepted := make(chan ret, 1), make(chan ret, 1)
+		m.OnSecurityRequest(func(authReq uint8) {
+			r, err := m.Pair(ctx)
+			initiated <- ret{r, err}
+		})
+		go func() {
+			r, err := s.Pair(ctx)
+			accepted <- ret{r, err}
+		}()
+		rc, rp := <-initiated, <-accepted
+		if rc.err != nil || rp.err != nil {
+			t.Errorf("%s: %v %v", v.name, rc.err, rp.err)
+			cancel()
+			continue
+		}
+		if rc.r.Authenticated != v.auth || rp.r.Authenticated != v.auth {
+			t.Errorf("%s: authenticated %v", v.name, rc.r.Authenticated)
+		}
+		if rc.r.SecureConnections != (v.sc != 0) || !rc.r.Bonded {
+			t.Errorf("%s: result %+v", v.name, rc.r)
+		}
+		if len(agent.number) != v.numbers {
+			t.Errorf("%s: %d numbers", v.name, len(agent.number))
+		} else if v.numbers == 2 && <-agent.number != <-agent.number {
+			t.Errorf("%s: numbers differ", v.name)
+		}
+		if rc.r.Peer.IRK == nil || *rc.r.Peer.IRK != irk || *rc.r.Peer.Identity != peripheral {
+			t.Errorf("%s: identity %v", v.name, rc.r.Peer)
+		}
+		if rp.r.Peer.CSRK == nil || *rp.r.Peer.CSRK != *rc.r.Local.CSRK || rp.r.Peer.IRK != nil {
+			t.Errorf("%s: signing key %v", v.name, rp.r.Peer)
+		}
+		if v.sc == 0 && (rc.r.Peer.LTK == nil || *rc.r.Peer.LTK != *rp.r.Local.LTK) {
+			t.Errorf("%s: ltk %v", v.name, rc.r.Peer.LTK)
+		} else if v.sc != 0 && rc.r.Peer.LTK.Key != rp.r.Local.LTK.Key {
+			t.Errorf("%s: ltk differs", v.name)
+		}
+		a.Close()
+		cancel()
+	}
+}
+
+func TestPairingFailed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a, b := net.Pipe()
+	defer a.Close()
+	link := testLink{make(chan [16]byte, 1)}
+	m := NewManager(a, link, true, Address{}, Address{Addr: [6]byte{1}}, Config{
+		IOCap:   IO_NO_INPUT_OUTPUT,
+		AuthReq: AUTH_BONDING,
+	})
+	s := NewManager(b, link, false, Address{Addr: [6]byte{1}}, Address{}, Config{
+		IOCap:   IO_NO_INPUT_OUTPUT,
+		AuthReq: AUTH_BONDING | AUTH_MITM,
+	})
+	go s.Accept(ctx)
+	if _, err := m.Pair(ctx); err == nil {
+		t.Error("expected error")
+	} else if e, ok := err.(*RemoteError); !ok || e.Reason != REASON_AUTH_REQUIREMENTS {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestBondStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	central := Address{Type: ADDR_PUBLIC, Addr: [6]byte{1, 2, 3, 4, 5, 6}}
+	peripheral := Address{Type: ADDR_RANDOM, Addr: [6]byte{6, 5, 4, 3, 2, 0xC1}}
+	for _, sc := range []uint8{0, AUTH_SC} {
+		a, b := net.Pipe()
+		link := testLink{make(chan [16]byte, 1)}
+		cstore, pstore := keystore.NewMemoryStore(), keystore.NewMemoryStore()
+		m := NewManager(a, link, true, central, peripheral, Config{
+			IOCap:       IO_NO_INPUT_OUTPUT,
+			AuthReq:     AUTH_BONDING | sc,
+			InitKeyDist: KEY_ENC,
+			RespKeyDist: KEY_ENC | KEY_ID,
+			Store:       cstore,
+			Adapter:     central.Addr,
+		})
+		s := NewManager(b, link, false, peripheral, central, Config{
+			IOCap:       IO_NO_INPUT_OUTPUT,
+			AuthReq:     AUTH_BONDING | sc,
+			InitKeyDist: KEY_ENC,
+			RespKeyDist: KEY_ENC | KEY_ID,
+			Store:       pstore,
+			Adapter:     peripheral.Addr,
+		})
+		errs := make(chan error, 1)
+		go func() {
+			_, err := s.Accept(ctx)
+			errs <- err
+		}()
+		if _, err := m.Pair(ctx); err != nil {
+			t.Fatal(err)
+		} else if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		if bond, err := cstore.Get(central.Addr, peripheral.Addr); err != nil || bond.LTK == nil || bond.IRK == nil || bond.Peer.Type != keystore.ADDR_LE_RANDOM {
+			t.Errorf("sc=%d central bond %+v %v", sc, bond, err)
+		}
+		go func() {
+			_, err := s.Encrypt(ctx)
+			errs <- err
+		}()
+		if _, err := m.Encrypt(ctx); err != nil {
+			t.Errorf("sc=%d central %v", sc, err)
+		} else if err := <-errs; err != nil {
+			t.Errorf("sc=%d peripheral %v", sc, err)
+		}
+		a.Close()
+	}
+}
@@ -0,0 +1,39 @@
+package blugo
+
+import (
+	"io"
+
+	"github.com/hkwi/blugo/btsnoop"
+)
+
+// SnoopPacket is a record of the btsnoop file with the packet parsed. Pkt
+// is nil for the records of no packet, such as the monitor notes, and for
+// the packets that Parse does not take.
+type SnoopPacket struct {
+	btsnoop.Record
+	Pkt Pkt
+}
+
+// BtsnoopReader reads the btsnoop file as HCI packets.
+type BtsnoopReader struct {
+	*btsnoop.Reader
+}
+
+// ReadBtsnoop reads the file header.
+func ReadBtsnoop(r io.Reader) (BtsnoopReader, error) {
+	if sr, err := btsnoop.NewReader(r); err != nil {
+		return BtsnoopReader{}, err
+	} else {
+		return BtsnoopReader{sr}, nil
+	}
+}
+
+// Next reads the next record, and returns io.EOF at the end of the file.
+func (self BtsnoopReader) Next() (SnoopPacket, error) {
+	if rec, err := self.Reader.Next(); err != nil {
+		return SnoopPacket{}, err
+	} else {
+		pkt, _ := Parse(rec.Packet())
+		return SnoopPacket{Record: rec, Pkt: pkt}, nil
+	}
+}
@@ -0,0 +1,36 @@
+package blugo
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/btsnoop"
+)
+
+func TestReadBtsnoop(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := btsnoop.NewWriter(&buf, btsnoop.DATALINK_H4)
+	now := time.Now()
+	w.WritePacket(now, false, []byte{HCI_COMMAND_PKT, 0x03, 0x0c, 0x00})
+	w.WritePacket(now, true, []byte{HCI_EVENT_PKT, EVT_CMD_COMPLETE, 0x04, 0x01, 0x03, 0x0c, 0x00})
+
+	r, err := ReadBtsnoop(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := r.Next(); err != nil {
+		t.Error(err)
+	} else if cmd, ok := p.Pkt.(CommandPkt); !ok || cmd.OpCode != HCI_Reset || p.Received {
+		t.Errorf("got %v", p)
+	}
+	if p, err := r.Next(); err != nil {
+		t.Error(err)
+	} else if ev, ok := p.Pkt.(EventPkt); !ok || ev.Code != EVT_CMD_COMPLETE || !p.Received {
+		t.Errorf("got %v", p)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// +build linux
+
+package blugo
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Kernel managed bluetooth sockets, wrapped in os.File so that the runtime
+// poller serves the deadlines.
+
+func btSocket(typ, proto int) (int, error) {
+	return syscall.Socket(syscall.AF_BLUETOOTH, typ|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, proto)
+}
+
+func sockaddrCall(trap uintptr, fd int, sa unsafe.Pointer, size uintptr) error {
+	if _, _, errno := syscall.Syscall(trap, uintptr(fd), uintptr(sa), size); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sockname(trap uintptr, fd int, sa unsafe.Pointer, size uintptr) error {
+	l := uint32(size)
+	if _, _, errno := syscall.Syscall(trap, uintptr(fd), uintptr(sa), uintptr(unsafe.Pointer(&l))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func getsockopt(fd, level, opt int, val unsafe.Pointer, size uintptr) error {
+	l := uint32(size)
+	if _, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT,
+		uintptr(fd),
+		uintptr(level),
+		uintptr(opt),
+		uintptr(val),
+		uintptr(unsafe.Pointer(&l)),
+		0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setsockopt(fd, level, opt int, val unsafe.Pointer, size uintptr) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT,
+		uintptr(fd),
+		uintptr(level),
+		uintptr(opt),
+		uintptr(val),
+		size,
+		0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setBtSecurity(fd int, level uint8) error {
+	sec := BtSecurity{
+		Level: level,
+	}
+	return setsockopt(fd, SOL_BLUETOOTH, BT_SECURITY, unsafe.Pointer(&sec), SizeofBtSecurity)
+}
+
+// btConnect connects the nonblocking socket, waiting for completion until
+// ctx is done. peer receives getpeername result.
+func btConnect(ctx context.Context, file *os.File, sa unsafe.Pointer, size uintptr, peer unsafe.Pointer) error {
+	rc, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cerr error
+	if err := rc.Control(func(fd uintptr) {
+		cerr = sockaddrCall(syscall.SYS_CONNECT, int(fd), sa, size)
+	}); err != nil {
+		return err
+	}
+	if cerr == nil {
+		return nil
+	} else if cerr != syscall.EINPROGRESS {
+		return cerr
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		file.SetWriteDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		file.SetWriteDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+	defer file.SetWriteDeadline(time.Time{})
+
+	// The first call comes before waiting. getpeername succeeds already in
+	// BT_CONNECT, so the socket is checked only after it gets writable.
+	waited := false
+	err = rc.Write(func(fd uintptr) bool {
+		if !waited {
+			waited = true
+			return false
+		}
+		if v, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR); err != nil {
+			cerr = err
+		} else if v != 0 {
+			cerr = syscall.Errno(v)
+		} else {
+			cerr = sockname(syscall.SYS_GETPEERNAME, int(fd), peer, size)
+		}
+		return true
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return cerr
+}
+
+type btConn struct {
+	file  *os.File
+	laddr net.Addr
+	raddr net.Addr
+}
+
+func (self *btConn) control(f func(fd int) error) error {
+	rc, err := self.file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) {
+		ferr = f(int(fd))
+	}); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func (self *btConn) Read(b []byte) (int, error) {
+	return self.file.Read(b)
+}
+
+func (self *btConn) Write(b []byte) (int, error) {
+	return self.file.Write(b)
+}
+
+func (self *btConn) Close() error {
+	return self.file.Close()
+}
+
+func (self *btConn) LocalAddr() net.Addr {
+	return self.laddr
+}
+
+func (self *btConn) RemoteAddr() net.Addr {
+	return self.raddr
+}
+
+func (self *btConn) SetDeadline(t time.Time) error {
+	return self.file.SetDeadline(t)
+}
+
+func (self *btConn) SetReadDeadline(t time.Time) error {
+	return self.file.SetReadDeadline(t)
+}
+
+func (self *btConn) SetWriteDeadline(t time.Time) error {
+	return self.file.SetWriteDeadline(t)
+}
+
+// SetSecurity raises the security level of the link, BT_SECURITY_*, which
+// may start pairing.
+func (self *btConn) SetSecurity(level uint8) error {
+	return self.control(func(fd int) error {
+		return setBtSecurity(fd, level)
+	})
+}
+
+// Security returns the security level and the encryption key size.
+func (self *btConn) Security() (uint8, uint8, error) {
+	var sec BtSecurity
+	err := self.control(func(fd int) error {
+		return getsockopt(fd, SOL_BLUETOOTH, BT_SECURITY, unsafe.Pointer(&sec), SizeofBtSecurity)
+	})
+	return sec.Level, sec.Key_size, err
+}
+
+type btListener struct {
+	file  *os.File
+	laddr net.Addr
+}
+
+// accept waits for a connection, storing the peer address into sa.
+func (self *btListener) accept(name string, sa unsafe.Pointer, size uintptr) (*os.File, error) {
+	rc, err := self.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var nfd int
+	var aerr error
+	if err := rc.Read(func(fd uintptr) bool {
+		l := uint32(size)
+		r, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4,
+			fd,
+			uintptr(sa),
+			uintptr(unsafe.Pointer(&l)),
+			syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC,
+			0, 0)
+		if errno == syscall.EAGAIN {
+			return false
+		} else if errno != 0 {
+			aerr = errno
+		} else {
+			nfd = int(r)
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	} else if aerr != nil {
+		return nil, aerr
+	}
+	return os.NewFile(uintptr(nfd), name), nil
+}
+
+func (self *btListener) Close() error {
+	return self.file.Close()
+}
+
+func (self *btListener) Addr() net.Addr {
+	return self.laddr
+}
@@ -0,0 +1,90 @@
+package blugo
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/hkwi/blugo/btsnoop"
+	"github.com/hkwi/blugo/pcap"
+)
+
+// TapSink receives the HCI packets in the H4 form, the packet indicator
+// first. The packet is valid only during the call, and is to be copied to
+// be kept.
+type TapSink interface {
+	Tap(t time.Time, received bool, pkt []byte)
+}
+
+type TapFunc func(t time.Time, received bool, pkt []byte)
+
+func (self TapFunc) Tap(t time.Time, received bool, pkt []byte) {
+	self(t, received, pkt)
+}
+
+// BtsnoopTap writes the packets to the btsnoop file. Errors are ignored.
+func BtsnoopTap(w *btsnoop.Writer) TapSink {
+	return TapFunc(func(t time.Time, received bool, pkt []byte) {
+		w.WritePacket(t, received, pkt)
+	})
+}
+
+// PcapTap writes the packets to pcap or pcapng of
+// LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR. Errors are ignored.
+func PcapTap(w pcap.PacketWriter) TapSink {
+	return TapFunc(func(t time.Time, received bool, pkt []byte) {
+		w.WritePacket(t, pcap.H4Packet(received, pkt))
+	})
+}
+
+// LogTap logs the packets in hex, "<" for sent and ">" for received.
+func LogTap(logger *log.Logger) TapSink {
+	return TapFunc(func(t time.Time, received bool, pkt []byte) {
+		dir := "<"
+		if received {
+			dir = ">"
+		}
+		logger.Printf("%s %x", dir, pkt)
+	})
+}
+
+type TapPacket struct {
+	Time     time.Time
+	Received bool
+	Data     []byte
+}
+
+// ChanTap sends the copies of the packets to the channel, dropping them
+// when the channel is full rather than blocking the device.
+func ChanTap(ch chan<- TapPacket) TapSink {
+	return TapFunc(func(t time.Time, received bool, pkt []byte) {
+		select {
+		case ch <- TapPacket{Time: t, Received: received, Data: append([]byte(nil), pkt...)}:
+		default:
+		}
+	})
+}
+
+// TapReadWriter mirrors the HCI packets that pass through a transport in
+// the H4 form, such as a serial line to the controller. Each Read and Write
+// is taken as a whole packet.
+type TapReadWriter struct {
+	io.ReadWriter
+	Sink TapSink
+}
+
+func (self TapReadWriter) Read(p []byte) (int, error) {
+	n, err := self.ReadWriter.Read(p)
+	if n > 0 && self.Sink != nil {
+		self.Sink.Tap(time.Now(), true, p[:n])
+	}
+	return n, err
+}
+
+func (self TapReadWriter) Write(p []byte) (int, error) {
+	n, err := self.ReadWriter.Write(p)
+	if n > 0 && self.Sink != nil {
+		self.Sink.Tap(time.Now(), false, p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,43 @@
+// +build linux
+
+package blugo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The taps of the sockets. HciDev is a plain descriptor, so they are kept
+// aside; tapCount spares the lookup while no tap is set.
+var (
+	tapLock  sync.RWMutex
+	tapSinks = make(map[HciDev]TapSink)
+	tapCount int32
+)
+
+// SetTap mirrors the packets that the socket writes and reads to the sink,
+// including the commands of Request and the events it waits for. A nil
+// sink removes the tap. The tap is also removed by Close.
+func (self HciDev) SetTap(sink TapSink) {
+	tapLock.Lock()
+	defer tapLock.Unlock()
+	if sink == nil {
+		delete(tapSinks, self)
+	} else {
+		tapSinks[self] = sink
+	}
+	atomic.StoreInt32(&tapCount, int32(len(tapSinks)))
+}
+
+func (self HciDev) tap(received bool, pkt []byte) {
+	if atomic.LoadInt32(&tapCount) == 0 {
+		return
+	}
+	tapLock.RLock()
+	sink := tapSinks[self]
+	tapLock.RUnlock()
+	if sink != nil {
+		sink.Tap(time.Now(), received, pkt)
+	}
+}
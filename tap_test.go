@@ -0,0 +1,71 @@
+package blugo
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hkwi/blugo/btsnoop"
+	"github.com/hkwi/blugo/pcap"
+)
+
+func TestTapDev(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, peer := HciDev(fds[0]), HciDev(fds[1])
+	defer dev.Close()
+	defer peer.Close()
+
+	ch := make(chan TapPacket, 4)
+	dev.SetTap(ChanTap(ch))
+	reset := []byte{HCI_COMMAND_PKT, 0x03, 0x0c, 0x00}
+	complete := []byte{HCI_EVENT_PKT, EVT_CMD_COMPLETE, 0x04, 0x01, 0x03, 0x0c, 0x00}
+	dev.Write(reset)
+	peer.Write(complete)
+	buf := make([]byte, 16)
+	if n, err := dev.Read(buf); err != nil || n != len(complete) {
+		t.Fatal(n, err)
+	}
+	if p := <-ch; p.Received || !bytes.Equal(p.Data, reset) {
+		t.Errorf("got %v", p)
+	}
+	if p := <-ch; !p.Received || !bytes.Equal(p.Data, complete) {
+		t.Errorf("got %v", p)
+	}
+
+	dev.SetTap(nil)
+	dev.Write(reset)
+	select {
+	case p := <-ch:
+		t.Errorf("got %v after removal", p)
+	default:
+	}
+}
+
+func TestTapSinks(t *testing.T) {
+	var snoop, capture bytes.Buffer
+	sw, _ := btsnoop.NewWriter(&snoop, btsnoop.DATALINK_H4)
+	pw, _ := pcap.NewNgWriter(&capture, pcap.LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR)
+	var wire bytes.Buffer
+	rw := TapReadWriter{&wire, TapFunc(func(t time.Time, received bool, pkt []byte) {
+		BtsnoopTap(sw).Tap(t, received, pkt)
+		PcapTap(pw).Tap(t, received, pkt)
+	})}
+	reset := []byte{HCI_COMMAND_PKT, 0x03, 0x0c, 0x00}
+	rw.Write(reset)
+	rw.Read(make([]byte, 16))
+
+	r, _ := btsnoop.NewReader(&snoop)
+	for _, received := range []bool{false, true} {
+		if rec, err := r.Next(); err != nil || rec.Received != received || !bytes.Equal(rec.Packet(), reset) {
+			t.Errorf("got %v %v", rec, err)
+		}
+	}
+	pr, _ := pcap.NewReader(&capture)
+	if pkt, err := pr.Next(); err != nil || !bytes.Equal(pkt.Data, pcap.H4Packet(false, reset)) {
+		t.Errorf("got %v %v", pkt, err)
+	}
+}
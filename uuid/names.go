@@ -0,0 +1,77 @@
+package uuid
+
+import (
+	"github.com/hkwi/blugo/assigned"
+)
+
+// Kind is the category of the assigned numbers that a UUID belongs to.
+type Kind uint8
+
+const (
+	UNKNOWN Kind = iota
+	PROTOCOL
+	SERVICE_CLASS // of SDP
+	SERVICE       // GATT service
+	DECLARATION   // GATT attribute types
+	DESCRIPTOR
+	CHARACTERISTIC
+	UNIT
+	MEMBER // 16-bit UUIDs of the SIG members
+)
+
+func (self Kind) String() string {
+	switch self {
+	case PROTOCOL:
+		return "protocol"
+	case SERVICE_CLASS:
+		return "service class"
+	case SERVICE:
+		return "service"
+	case DECLARATION:
+		return "declaration"
+	case DESCRIPTOR:
+		return "descriptor"
+	case CHARACTERISTIC:
+		return "characteristic"
+	case UNIT:
+		return "unit"
+	case MEMBER:
+		return "member"
+	default:
+		return "unknown"
+	}
+}
+
+var kinds = map[string]Kind{
+	assigned.UUID_PROTOCOL:       PROTOCOL,
+	assigned.UUID_SERVICE_CLASS:  SERVICE_CLASS,
+	assigned.UUID_SERVICE:        SERVICE,
+	assigned.UUID_DECLARATION:    DECLARATION,
+	assigned.UUID_DESCRIPTOR:     DESCRIPTOR,
+	assigned.UUID_CHARACTERISTIC: CHARACTERISTIC,
+	assigned.UUID_UNIT:           UNIT,
+	assigned.UUID_MEMBER:         MEMBER,
+}
+
+// Lookup returns the assigned name of the UUID and its category.
+func Lookup(u UUID) (string, Kind, bool) {
+	if v, ok := u.Uint16(); !ok {
+		return "", UNKNOWN, false
+	} else if name, kind, ok := assigned.UUID16(v); !ok {
+		return "", UNKNOWN, false
+	} else {
+		return name, kinds[kind], true
+	}
+}
+
+// Name returns the assigned name, or the empty string.
+func (self UUID) Name() string {
+	name, _, _ := Lookup(self)
+	return name
+}
+
+// Kind returns the category of the assigned number.
+func (self UUID) Kind() Kind {
+	_, kind, _ := Lookup(self)
+	return kind
+}
@@ -0,0 +1,188 @@
+// Package uuid implements the Bluetooth UUIDs, of 16, 32 or 128 bits, the
+// shorter forms being on the Bluetooth Base UUID. The UUID is held in the
+// little endian byte order of HCI, AD and ATT; SDP is big endian.
+//
+// Bluetooth Core specification, Vol 3, Part B, Section 2.5.1
+package uuid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// BASE is the Bluetooth Base UUID 00000000-0000-1000-8000-00805F9B34FB.
+var BASE = UUID{0xFB, 0x34, 0x9B, 0x5F, 0x80, 0x00, 0x00, 0x80, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// UUID is in the little endian byte order, either of 2, 4 or 16 octets.
+type UUID []byte
+
+// UUID16 returns the 16-bit UUID.
+func UUID16(v uint16) UUID {
+	ret := make(UUID, 2)
+	binary.LittleEndian.PutUint16(ret, v)
+	return ret
+}
+
+// UUID32 returns the 32-bit UUID.
+func UUID32(v uint32) UUID {
+	ret := make(UUID, 4)
+	binary.LittleEndian.PutUint32(ret, v)
+	return ret
+}
+
+// FromBytes copies the UUID of the little endian octets.
+func FromBytes(data []byte) (UUID, error) {
+	switch len(data) {
+	case 2, 4, 16:
+		return append(UUID(nil), data...), nil
+	default:
+		return nil, fmt.Errorf("uuid: invalid length %d", len(data))
+	}
+}
+
+// FromBigEndian copies the UUID of the big endian octets, as of SDP.
+func FromBigEndian(data []byte) (UUID, error) {
+	if ret, err := FromBytes(data); err != nil {
+		return nil, err
+	} else {
+		reverse(ret)
+		return ret, nil
+	}
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// Parse reads the 4 or 8 hex digits of the short forms, with or without
+// "0x", or the 128-bit form with or without the hyphens.
+func Parse(s string) (UUID, error) {
+	t := s
+	if strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0X") {
+		t = t[2:]
+	} else if len(t) == 36 {
+		if t[8] != '-' || t[13] != '-' || t[18] != '-' || t[23] != '-' {
+			return nil, fmt.Errorf("uuid: invalid format %q", s)
+		}
+		t = t[:8] + t[9:13] + t[14:18] + t[19:23] + t[24:]
+	}
+	if len(t) != 4 && len(t) != 8 && len(t) != 32 {
+		return nil, fmt.Errorf("uuid: invalid length %q", s)
+	}
+	if b, err := hex.DecodeString(t); err != nil {
+		return nil, fmt.Errorf("uuid: invalid hex %q", s)
+	} else {
+		reverse(b)
+		return UUID(b), nil
+	}
+}
+
+// MustParse is Parse that panics on the error, for the constants.
+func MustParse(s string) UUID {
+	if ret, err := Parse(s); err != nil {
+		panic(err)
+	} else {
+		return ret
+	}
+}
+
+// Full returns the 128-bit form.
+func (self UUID) Full() UUID {
+	switch len(self) {
+	case 2, 4:
+		ret := append(UUID(nil), BASE...)
+		copy(ret[12:], self)
+		return ret
+	default:
+		return self
+	}
+}
+
+// Shortest returns the 16 or 32-bit form when the UUID is on the base
+// UUID, as the shorter forms are used on the wire when possible.
+func (self UUID) Shortest() UUID {
+	if v, ok := self.Uint16(); ok {
+		return UUID16(v)
+	} else if v, ok := self.Uint32(); ok {
+		return UUID32(v)
+	}
+	return self
+}
+
+// Uint32 returns the 32-bit value when the UUID is on the base UUID.
+func (self UUID) Uint32() (uint32, bool) {
+	f := self.Full()
+	if len(f) == 16 && bytes.Equal(f[:12], BASE[:12]) {
+		return binary.LittleEndian.Uint32(f[12:]), true
+	}
+	return 0, false
+}
+
+// Uint16 returns the 16-bit value when the UUID is on the base UUID.
+func (self UUID) Uint16() (uint16, bool) {
+	if v, ok := self.Uint32(); ok && v <= 0xFFFF {
+		return uint16(v), true
+	}
+	return 0, false
+}
+
+func (self UUID) Equal(other UUID) bool {
+	return bytes.Equal(self.Full(), other.Full())
+}
+
+// Compare orders the UUIDs by the 128-bit value, as of bytes.Compare.
+func (self UUID) Compare(other UUID) int {
+	return bytes.Compare(self.Full().BigEndian(), other.Full().BigEndian())
+}
+
+// BigEndian returns the octets in the big endian order.
+func (self UUID) BigEndian() []byte {
+	ret := append([]byte(nil), self...)
+	reverse(ret)
+	return ret
+}
+
+// MarshalBinary returns the little endian octets.
+func (self UUID) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), self...), nil
+}
+
+func (self *UUID) UnmarshalBinary(data []byte) error {
+	if v, err := FromBytes(data); err != nil {
+		return err
+	} else {
+		*self = v
+		return nil
+	}
+}
+
+func (self UUID) MarshalText() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+func (self *UUID) UnmarshalText(text []byte) error {
+	if v, err := Parse(string(text)); err != nil {
+		return err
+	} else {
+		*self = v
+		return nil
+	}
+}
+
+// String returns 4 hex digits of the 16-bit UUIDs, or the 128-bit form.
+func (self UUID) String() string {
+	if v, ok := self.Uint16(); ok {
+		return fmt.Sprintf("%04x", v)
+	}
+	f := self.Full()
+	if len(f) != 16 {
+		return fmt.Sprintf("%x", []byte(self))
+	}
+	b := f.BigEndian()
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,76 @@
+package uuid
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	hr := UUID16(0x180D)
+	for _, s := range []string{
+		"180d",
+		"0x180D",
+		"0000180d",
+		"0000180d-0000-1000-8000-00805f9b34fb",
+		"0000180D00001000800000805F9B34FB",
+	} {
+		if u, err := Parse(s); err != nil {
+			t.Error(err)
+		} else if !u.Equal(hr) || u.String() != "180d" {
+			t.Errorf("%s parsed %v", s, u)
+		}
+	}
+	for _, s := range []string{"180", "0x180d1", "0000180d_0000-1000-8000-00805f9b34fb", "zzzz"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%s accepted", s)
+		}
+	}
+
+	custom := MustParse("6e400001-b5a3-f393-e0a9-e50e24dcca9e")
+	if !bytes.Equal(custom[:2], []byte{0x9e, 0xca}) || custom.String() != "6e400001-b5a3-f393-e0a9-e50e24dcca9e" {
+		t.Errorf("got %x %v", []byte(custom), custom)
+	}
+	if _, ok := custom.Uint32(); ok || len(custom.Shortest()) != 16 {
+		t.Error("custom uuid shortened")
+	}
+
+	full := hr.Full()
+	if len(full) != 16 || !bytes.Equal(full.Shortest(), hr) {
+		t.Errorf("got %x", []byte(full))
+	}
+	if v, ok := UUID32(0x12345678).Full().Uint32(); !ok || v != 0x12345678 {
+		t.Errorf("got %x", v)
+	} else if len(UUID32(0x0000180D).Shortest()) != 2 {
+		t.Error("32-bit uuid not shortened")
+	}
+	if be := hr.BigEndian(); !bytes.Equal(be, []byte{0x18, 0x0D}) {
+		t.Errorf("got %x", be)
+	} else if u, _ := FromBigEndian(be); !bytes.Equal(u, hr) {
+		t.Errorf("got %x", []byte(u))
+	}
+	if UUID16(0x1800).Compare(UUID16(0x180D).Full()) >= 0 || hr.Compare(full) != 0 || custom.Compare(hr) <= 0 {
+		t.Error("compare")
+	}
+
+	if data, err := json.Marshal(map[string]UUID{"a": hr, "b": custom}); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"a":"180d","b":"6e400001-b5a3-f393-e0a9-e50e24dcca9e"}` {
+		t.Errorf("got %s", data)
+	} else {
+		var m map[string]UUID
+		if err := json.Unmarshal(data, &m); err != nil || !m["a"].Equal(hr) || !m["b"].Equal(custom) {
+			t.Errorf("got %v %v", m, err)
+		}
+	}
+
+	if hr.Name() != "Heart Rate" || hr.Kind() != SERVICE {
+		t.Errorf("got %s %v", hr.Name(), hr.Kind())
+	}
+	if name, kind, ok := Lookup(UUID16(0x2902).Full()); !ok || kind != DESCRIPTOR || name != "Client Characteristic Configuration" {
+		t.Errorf("got %s %v", name, kind)
+	}
+	if UUID16(0x27AD).Kind() != UNIT || custom.Name() != "" {
+		t.Error("lookup")
+	}
+}
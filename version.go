@@ -0,0 +1,34 @@
+package blugo
+
+import (
+	"fmt"
+
+	"github.com/hkwi/blugo/assigned"
+)
+
+// LocalVersion is the response of HCI_Read_Local_Version_Information,
+// Bluetooth Core specification, Vol 2, Part E, Section 7.4.1
+type LocalVersion struct {
+	HciVersion    assigned.CoreVersion
+	HciRevision   uint16
+	LmpVersion    assigned.CoreVersion
+	Manufacturer  assigned.CompanyID
+	LmpSubversion uint16
+}
+
+func parseLocalVersion(ret Parameters) LocalVersion {
+	return LocalVersion{
+		HciVersion:    assigned.CoreVersion(ret[1].(uint8)),
+		HciRevision:   ret[2].(uint16),
+		LmpVersion:    assigned.CoreVersion(ret[3].(uint8)),
+		Manufacturer:  assigned.CompanyID(ret[4].(uint16)),
+		LmpSubversion: ret[5].(uint16),
+	}
+}
+
+func (self LocalVersion) String() string {
+	return fmt.Sprintf("HCI %v (revision 0x%04x), LMP %v (subversion 0x%04x), %v",
+		self.HciVersion, self.HciRevision,
+		self.LmpVersion, self.LmpSubversion,
+		self.Manufacturer)
+}
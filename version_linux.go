@@ -0,0 +1,13 @@
+// +build linux
+
+package blugo
+
+func (self HciDev) ReadLocalVersion() (LocalVersion, error) {
+	if ret, err := self.Request(HCI_Read_Local_Version_Information); err != nil {
+		return LocalVersion{}, err
+	} else if err := statusError(ret); err != nil {
+		return LocalVersion{}, err
+	} else {
+		return parseLocalVersion(ret), nil
+	}
+}
@@ -0,0 +1,24 @@
+package blugo
+
+import (
+	"testing"
+)
+
+func TestLocalVersion(t *testing.T) {
+	ret, err := OpCode(HCI_Read_Local_Version_Information).Response([]byte{
+		0x00, 0x0c, 0x1f, 0x01, 0x0c, 0x4c, 0x00, 0x34, 0x12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := parseLocalVersion(ret)
+	if v.Manufacturer.String() != "Apple, Inc." || v.LmpSubversion != 0x1234 {
+		t.Errorf("got %#v", v)
+	}
+	if s := v.String(); s != "HCI Bluetooth 5.3 (revision 0x011f), LMP Bluetooth 5.3 (subversion 0x1234), Apple, Inc." {
+		t.Errorf("got %s", s)
+	}
+	if _, err := OpCode(HCI_Read_Local_Version_Information).Response([]byte{0x00, 0x0c}); err == nil {
+		t.Error("short response accepted")
+	}
+}